@@ -0,0 +1,48 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import "errors"
+
+// ErrChainNotFound 规则链不存在
+var ErrChainNotFound = errors.New("rule chain not found")
+
+// ChainRevision 规则链历史版本
+type ChainRevision struct {
+	// Revision 版本号，从1开始递增
+	Revision int64 `json:"revision"`
+	// Def 规则链定义
+	Def []byte `json:"def"`
+	// Ts 保存时间，毫秒时间戳
+	Ts int64 `json:"ts"`
+}
+
+// ChainStore 规则链存储，保存规则链定义和历史版本
+// 可以通过`rulego.WithChainStore`配置，规则链创建和更新后写回存储，内置实现，详见`store`包
+type ChainStore interface {
+	// List 获取所有规则链ID，按ID排序
+	List() ([]string, error)
+	// Get 获取规则链最新版本定义，不存在返回ErrChainNotFound
+	Get(id string) ([]byte, error)
+	// Save 保存规则链定义，生成新的版本并返回版本号
+	// 内容和最新版本相同则不生成新版本，返回最新版本号
+	Save(id string, def []byte) (int64, error)
+	// Delete 删除规则链和所有历史版本，不存在返回ErrChainNotFound
+	Delete(id string) error
+	// History 获取规则链所有保存的版本，按版本号从小到大排序，不存在返回ErrChainNotFound
+	History(id string) ([]ChainRevision, error)
+}
@@ -56,6 +56,15 @@ type Config struct {
 	Properties Metadata
 	// Udf 注册自定义golang函数，js运行时可以通过x(param1,param2,...) 方式调用
 	Udf map[string]interface{}
+	// DeadLetterHandler 死信处理器，节点通过`Failure`关系通知下一个节点，但是没有`Failure`连接的消息会交给该处理器
+	// 规则链通过`rulego.WithDeadLetterHandler`配置的死信处理器优先
+	DeadLetterHandler DeadLetterHandler
+	// MetricsCollector 指标收集器，为空不收集指标
+	MetricsCollector MetricsCollector
+	// Tracer 链路追踪，为空不记录链路
+	Tracer Tracer
+	// RunRecorder 运行记录器，为空不记录
+	RunRecorder RunRecorder
 }
 
 // RegisterUdf 注册自定义函数
@@ -154,3 +163,35 @@ func WithLogger(logger Logger) Option {
 		return nil
 	}
 }
+
+// WithDeadLetterHandler is an option that sets the dead letter handler of the Config.
+func WithDeadLetterHandler(handler DeadLetterHandler) Option {
+	return func(c *Config) error {
+		c.DeadLetterHandler = handler
+		return nil
+	}
+}
+
+// WithMetricsCollector is an option that sets the metrics collector of the Config.
+func WithMetricsCollector(collector MetricsCollector) Option {
+	return func(c *Config) error {
+		c.MetricsCollector = collector
+		return nil
+	}
+}
+
+// WithTracer is an option that sets the tracer of the Config.
+func WithTracer(tracer Tracer) Option {
+	return func(c *Config) error {
+		c.Tracer = tracer
+		return nil
+	}
+}
+
+// WithRunRecorder is an option that sets the run recorder of the Config.
+func WithRunRecorder(recorder RunRecorder) Option {
+	return func(c *Config) error {
+		c.RunRecorder = recorder
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// DeadLetter 死信
+// 节点通过`Failure`关系通知下一个节点，但是规则链没有配置`Failure`连接，该消息会作为死信交给死信处理器
+type DeadLetter struct {
+	// 死信ID
+	Id string `json:"id"`
+	// 规则链ID
+	ChainId string `json:"chainId"`
+	// 执行失败的节点ID
+	NodeId string `json:"nodeId"`
+	// 执行失败的消息
+	Msg RuleMsg `json:"msg"`
+	// 错误信息
+	Error string `json:"error"`
+	// 记录时间，毫秒时间戳
+	Ts int64 `json:"ts"`
+}
+
+// NewDeadLetter 创建死信
+func NewDeadLetter(chainId, nodeId string, msg RuleMsg, err error) DeadLetter {
+	uuId, _ := uuid.NewV4()
+	letter := DeadLetter{
+		Id:      uuId.String(),
+		ChainId: chainId,
+		NodeId:  nodeId,
+		Msg:     msg.Copy(),
+		Ts:      time.Now().UnixMilli(),
+	}
+	if err != nil {
+		letter.Error = err.Error()
+	}
+	return letter
+}
+
+// DeadLetterHandler 死信处理器
+// 可以通过`types.WithDeadLetterHandler`配置全局死信处理器，或者通过`rulego.WithDeadLetterHandler`配置规则链死信处理器
+// 内置实现，详见`deadletter`包
+type DeadLetterHandler interface {
+	// Handle 处理死信
+	Handle(letter DeadLetter) error
+}
+
+// DeadLetterStore 可查询的死信存储，用于查询和重放死信
+type DeadLetterStore interface {
+	DeadLetterHandler
+	// List 按记录顺序获取所有死信
+	List() ([]DeadLetter, error)
+	// Get 通过死信ID获取死信
+	Get(id string) (DeadLetter, bool)
+	// Delete 删除死信
+	Delete(id string) error
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import "time"
+
+// MetricsCollector 规则引擎指标收集器
+// 通过`types.WithMetricsCollector`配置，内置Prometheus文本格式实现，详见`metrics`包
+// 方法会在消息处理流程中同步调用，实现需要并发安全并且尽快返回
+type MetricsCollector interface {
+	// OnMsgStart 根规则链开始处理消息
+	OnMsgStart(chainId string)
+	// OnMsgEnd 根规则链所有节点执行完成，cost为消息处理耗时
+	OnMsgEnd(chainId string, cost time.Duration)
+	// OnNodeMsg 节点通过relationType关系输出一条消息，节点输出多条消息或者通过多个关系输出时调用多次
+	OnNodeMsg(chainId, nodeId, relationType string)
+	// OnNodeEnd 节点执行完成，每次执行只调用一次，cost为节点执行耗时(包含重试)，err不为nil表示节点执行失败
+	OnNodeEnd(chainId, nodeId string, cost time.Duration, err error)
+}
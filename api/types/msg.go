@@ -17,6 +17,7 @@
 package types
 
 import (
+	"encoding/json"
 	"github.com/gofrs/uuid/v5"
 	"time"
 )
@@ -86,6 +87,11 @@ func (md *Metadata) PutValue(key, value string) {
 	}
 }
 
+//Delete 删除值
+func (md *Metadata) Delete(key string) {
+	delete(md.data, key)
+}
+
 //Values 获取所有值
 func (md *Metadata) Values() map[string]string {
 	data := make(map[string]string)
@@ -96,6 +102,24 @@ func (md *Metadata) Values() map[string]string {
 	return data
 }
 
+//MarshalJSON 序列化成JSON对象
+func (md Metadata) MarshalJSON() ([]byte, error) {
+	if md.data == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(md.data)
+}
+
+//UnmarshalJSON 从JSON对象反序列化
+func (md *Metadata) UnmarshalJSON(b []byte) error {
+	data := make(map[string]string)
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	md.data = data
+	return nil
+}
+
 //RuleMsg 规则引擎消息
 type RuleMsg struct {
 	// 消息时间戳
@@ -112,7 +136,7 @@ type RuleMsg struct {
 	//消息内容
 	Data string `json:"data"`
 	//消息元数据
-	Metadata Metadata
+	Metadata Metadata `json:"metadata"`
 }
 
 //NewMsg 创建一个新的消息实例，并通过uuid生成消息ID
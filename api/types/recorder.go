@@ -0,0 +1,34 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+// RunRecorder 运行记录器，记录根规则链每次处理消息经过的节点
+// 通过`types.WithRunRecorder`配置，内置实现，详见`recorder`包
+type RunRecorder interface {
+	// OnRunStart 根规则链开始处理消息，返回记录本次运行的观察者
+	OnRunStart(chainId string, msg RuleMsg) RunObserver
+}
+
+// RunObserver 一次运行的观察者，子规则链的节点也会记录到同一次运行
+// 方法会在消息处理流程中同步调用，实现需要并发安全
+type RunObserver interface {
+	// OnNodeStart 节点开始处理消息，返回节点处理完成的回调函数
+	// relationType为节点通知下一个节点的关系，多个关系使用`,`分隔
+	OnNodeStart(chainId, nodeId, nodeType string, msg RuleMsg) func(msg RuleMsg, relationType string, err error)
+	// OnRunEnd 所有节点执行完成，err为上下文取消或者超时错误
+	OnRunEnd(err error)
+}
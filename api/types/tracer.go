@@ -0,0 +1,130 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceParentHeader W3C Trace Context请求头
+const TraceParentHeader = "traceparent"
+
+// SpanContext 链路上下文，兼容W3C Trace Context
+type SpanContext struct {
+	// TraceId 32位16进制字符串
+	TraceId string
+	// SpanId 16位16进制字符串
+	SpanId string
+	// Sampled 是否采样
+	Sampled bool
+}
+
+// IsValid 链路上下文是否有效
+func (sc SpanContext) IsValid() bool {
+	return isHexId(sc.TraceId, 32) && isHexId(sc.SpanId, 16)
+}
+
+// TraceParent 转换成W3C traceparent请求头的值，例如：00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceId, sc.SpanId, flags)
+}
+
+// ParseTraceParent 解析W3C traceparent请求头
+func ParseTraceParent(traceParent string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	// 版本00只能有4个字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{
+		TraceId: strings.ToLower(parts[1]),
+		SpanId:  strings.ToLower(parts[2]),
+		Sampled: flags[0]&0x01 == 0x01,
+	}
+	return sc, sc.IsValid()
+}
+
+// isHexId 是否是指定长度并且不全为0的16进制字符串
+func isHexId(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 把链路上下文保存到context
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext 从context获取链路上下文
+// 组件可以通过该方法获取当前节点的链路上下文，并传递给外部调用，例如：设置traceparent请求头
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Span 链路中的一个操作，例如：规则链处理一条消息或者节点处理一条消息
+type Span interface {
+	// Context 获取链路上下文
+	Context() SpanContext
+	// SetAttribute 设置属性
+	SetAttribute(key, value string)
+	// End 结束，relationType为节点通知下一个节点的关系，err不为nil表示执行失败
+	// 重复调用只有第一次生效
+	End(relationType string, err error)
+}
+
+// Tracer 链路追踪接口
+// 通过`types.WithTracer`配置，内置实现，详见`tracing`包
+type Tracer interface {
+	// StartSpan 开始一个span，parent无效时开始一条新的链路
+	StartSpan(parent SpanContext, name string, msg RuleMsg) Span
+}
+
+// 链路属性
+const (
+	AttrChainId      = "rulego.chain.id"
+	AttrNodeId       = "rulego.node.id"
+	AttrNodeType     = "rulego.node.type"
+	AttrMsgId        = "rulego.msg.id"
+	AttrMsgType      = "rulego.msg.type"
+	AttrRelationType = "rulego.relation.type"
+)
@@ -29,6 +29,11 @@ const (
 	Failure = "Failure"
 	True    = "True"
 	False   = "False"
+	// Timeout 节点在配置的超时时间内没有通知下一个节点，由规则引擎通过该关系把消息发送到下一个节点
+	// 如果没有配置该关系的连接，则使用`Failure`关系
+	Timeout = "Timeout"
+	// Done 节点输出的多条消息及其后续分支都处理完成后，通过该关系发送汇总消息，例如：拆分(split)节点
+	Done = "Done"
 )
 
 // flow direction type
@@ -120,6 +125,17 @@ type Node interface {
 	Destroy()
 }
 
+// StatefulNode 有状态组件可选接口，例如：聚合窗口(aggregate)节点
+// 规则链或者节点重新加载(ReloadSelf)时，规则引擎把旧实例的状态快照恢复到ID和类型都相同的新实例，
+// 旧实例在Destroy前调用Snapshot，新实例在Init后、接收消息前调用Restore，
+// 状态转移后，旧版本规则链中还在处理的消息流入该节点时，交给新实例处理
+type StatefulNode interface {
+	// Snapshot 获取组件状态快照，状态转移到新实例，调用后旧实例不再维护该状态
+	Snapshot() ([]byte, error)
+	// Restore 使用状态快照恢复组件状态，快照与当前配置不兼容返回错误
+	Restore(snapshot []byte) error
+}
+
 // NodeCtx 规则节点实例化上下文
 type NodeCtx interface {
 	Node
@@ -174,6 +190,37 @@ type RuleContext interface {
 	GetContext() context.Context
 }
 
+// ChainContext RuleContext可选接口，获取当前节点在规则链中的连接信息
+// 默认实现：rulego.DefaultRuleContext，组件通过类型断言使用，例如：
+//
+//	if chainCtx, ok := ctx.(types.ChainContext); ok {
+//		count := chainCtx.InboundCount()
+//	}
+type ChainContext interface {
+	// InboundCount 规则链中连接到当前节点的上游节点数量，同一个上游节点通过多个关系(例如：Success和Failure)连接只计算一次
+	// 例如：汇聚(join)节点需要等待所有连接到该节点的分支
+	InboundCount() int
+	// HasRelation 当前节点是否有指定关系的下一个节点
+	HasRelation(relationType string) bool
+}
+
+// BranchContext RuleContext可选接口，节点输出多条消息时，跟踪每条消息后续分支的执行
+// 默认实现：rulego.DefaultRuleContext，组件通过类型断言使用，例如：拆分(split)节点
+type BranchContext interface {
+	// Hold 保持当前节点处于执行中，直到调用返回的release函数
+	// 节点在OnMsg返回后仍会异步发送消息时使用，防止先发送的消息处理完成后提前触发规则链处理完成事件
+	Hold() (release func())
+	// TellNextWithCompleted 使用指定的relationTypes发送消息到下一个节点，
+	// 该消息所有后续节点都处理完成(或者没有下一个节点)后调用onCompleted，该方法不触发节点重试
+	TellNextWithCompleted(msg RuleMsg, onCompleted func(), relationTypes ...string)
+	// Detach 创建当前节点的独立上下文，节点在消息处理结束后主动发送新消息时使用，例如：聚合(aggregate)节点定时发送聚合消息
+	// 独立上下文不继承当前消息的context、结束回调和链路，不受当前消息取消或者超时影响，发送的消息作为新消息在规则链中执行
+	Detach() RuleContext
+	// End 结束当前消息，不通知下一个节点，触发结束回调
+	// 节点吸收消息不再往下传递时使用，例如：聚合(aggregate)节点被聚合的消息
+	End(msg RuleMsg, err error)
+}
+
 // RuleContextOption 修改RuleContext选项的函数
 type RuleContextOption func(RuleContext)
 
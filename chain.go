@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/xyzbit/rulego/api/types"
 )
@@ -52,22 +53,38 @@ type RuleChainCtx struct {
 	// 组件路由关系
 	nodeRoutes    map[types.RuleNodeId][]types.RuleNodeRelation
 	nodeCtxRoutes map[types.RuleNodeId][]types.NodeCtx
+	// 入节点路由关系，key:出节点ID
+	inboundRoutes map[types.RuleNodeId][]types.RuleNodeRelation
 	// 通过入节点查询指定关系出节点列表缓存
 	relationCache map[RelationCache][]types.NodeCtx
 	// 根上下文
 	rootRuleContext types.RuleContext
 	// 子规则链池
 	ruleChainPool *RuleGo
+	// 版本号，规则引擎每次重新加载根规则链加1
+	version int64
+	// 正在处理的消息数量
+	inflight int64
+	// 死信处理器，为空使用`Config.DeadLetterHandler`
+	deadLetterHandler types.DeadLetterHandler
+	// 是否已经被新版本替换
+	retired     int32
+	destroyOnce sync.Once
 	sync.RWMutex
 }
 
 // InitRuleChainCtx 初始化RuleChainCtx
 func InitRuleChainCtx(config types.Config, ruleChainDef *RuleChain) (*RuleChainCtx, error) {
+	// 加载前静态校验规则链定义，一次返回所有问题
+	if errs := ValidateWithRegistry(config.ComponentsRegistry, *ruleChainDef); len(errs) > 0 {
+		return nil, ValidationErrors(errs)
+	}
 	ruleChainCtx := &RuleChainCtx{
 		Config:             config,
 		SelfDefinition:     ruleChainDef,
 		nodes:              make(map[types.RuleNodeId]types.NodeCtx),
 		nodeRoutes:         make(map[types.RuleNodeId][]types.RuleNodeRelation),
+		inboundRoutes:      make(map[types.RuleNodeId][]types.RuleNodeRelation),
 		relationCache:      make(map[RelationCache][]types.NodeCtx),
 		componentsRegistry: config.ComponentsRegistry,
 		initialized:        true,
@@ -107,6 +124,7 @@ func InitRuleChainCtx(config types.Config, ruleChainDef *RuleChain) (*RuleChainC
 			nodeRelations = []types.RuleNodeRelation{ruleNodeRelation}
 		}
 		ruleChainCtx.nodeRoutes[inNodeId] = nodeRelations
+		ruleChainCtx.inboundRoutes[outNodeId] = append(ruleChainCtx.inboundRoutes[outNodeId], ruleNodeRelation)
 	}
 	// 加载子规则链
 	for _, item := range ruleChainDef.Metadata.RuleChainConnections {
@@ -145,8 +163,8 @@ func (rc *RuleChainCtx) GetNodeById(id types.RuleNodeId) (types.NodeCtx, bool) {
 	defer rc.RUnlock()
 	if id.Type == types.CHAIN {
 		// 子规则链通过规则链池查找
-		if subRuleEngine, ok := rc.GetRuleChainPool().Get(id.Id); ok && subRuleEngine.rootRuleChainCtx != nil {
-			return subRuleEngine.rootRuleChainCtx, true
+		if subRuleEngine, ok := rc.GetRuleChainPool().Get(id.Id); ok && subRuleEngine.RootRuleChainCtx() != nil {
+			return subRuleEngine.RootRuleChainCtx(), true
 		} else {
 			return nil, false
 		}
@@ -176,6 +194,14 @@ func (rc *RuleChainCtx) GetNodeRoutes(id types.RuleNodeId) ([]types.RuleNodeRela
 	return relations, ok
 }
 
+// GetInboundRoutes 获取连接到指定节点的路由关系
+func (rc *RuleChainCtx) GetInboundRoutes(id types.RuleNodeId) ([]types.RuleNodeRelation, bool) {
+	rc.RLock()
+	defer rc.RUnlock()
+	relations, ok := rc.inboundRoutes[id]
+	return relations, ok
+}
+
 // GetNextNodes 获取当前节点指定关系的子节点
 func (rc *RuleChainCtx) GetNextNodes(id types.RuleNodeId, relationType string) ([]types.NodeCtx, bool) {
 	var nodeCtxList []types.NodeCtx
@@ -239,12 +265,52 @@ func (rc *RuleChainCtx) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 	rootCtxCopy.isFirst = rootCtx.isFirst
 	if fromCtx, ok := ctx.(*DefaultRuleContext); ok {
 		rootCtxCopy.parentRuleCtx = fromCtx
+		// 子规则链节点记录到同一次运行
+		rootCtxCopy.runObserver = fromCtx.runObserver
 	}
 
+	// 子规则链被替换后，等处理中的消息执行完再销毁
+	rc.acquire()
+	var once sync.Once
+	rootCtxCopy.onAllNodeCompleted = func() {
+		once.Do(func() {
+			rc.release()
+			// 子规则链节点不会通知下一个节点，所有节点执行完结束子规则链节点
+			if rootCtxCopy.parentRuleCtx != nil {
+				rootCtxCopy.parentRuleCtx.nodeDone(msg, "", rootCtxCopy.contextErr())
+			}
+		})
+	}
 	rootCtxCopy.TellNext(msg)
 	return nil
 }
 
+// Version 版本号
+func (rc *RuleChainCtx) Version() int64 {
+	return rc.version
+}
+
+// acquire 增加一条处理中的消息
+func (rc *RuleChainCtx) acquire() {
+	atomic.AddInt64(&rc.inflight, 1)
+}
+
+// release 减少一条处理中的消息，如果已经被新版本替换并且没有处理中的消息，则销毁
+func (rc *RuleChainCtx) release() {
+	if atomic.AddInt64(&rc.inflight, -1) <= 0 && atomic.LoadInt32(&rc.retired) == 1 {
+		rc.destroyOnce.Do(rc.Destroy)
+	}
+}
+
+// retire 被新版本替换，不再接收新消息
+// 没有处理中的消息则立即销毁，否则等处理中的消息都执行完再销毁
+func (rc *RuleChainCtx) retire() {
+	atomic.StoreInt32(&rc.retired, 1)
+	if atomic.LoadInt64(&rc.inflight) <= 0 {
+		rc.destroyOnce.Do(rc.Destroy)
+	}
+}
+
 func (rc *RuleChainCtx) Destroy() {
 	rc.RLock()
 	defer rc.RUnlock()
@@ -264,6 +330,7 @@ func (rc *RuleChainCtx) GetNodeId() types.RuleNodeId {
 
 func (rc *RuleChainCtx) ReloadSelf(def []byte) error {
 	if ctx, err := rc.Config.Parser.DecodeRuleChain(rc.Config, def); err == nil {
+		rc.transferStates(ctx.(*RuleChainCtx))
 		rc.Destroy()
 		rc.Copy(ctx.(*RuleChainCtx))
 
@@ -273,6 +340,27 @@ func (rc *RuleChainCtx) ReloadSelf(def []byte) error {
 	return nil
 }
 
+// transferStates 把有状态节点的状态转移到新规则链中ID和类型都相同的节点
+// 旧规则链中还在处理的消息流入这些节点时，由新规则链的节点处理
+func (rc *RuleChainCtx) transferStates(newCtx *RuleChainCtx) {
+	rc.RLock()
+	defer rc.RUnlock()
+	for id, item := range newCtx.nodes {
+		newNode, ok := item.(*RuleNodeCtx)
+		if !ok {
+			continue
+		}
+		if oldNode, ok := rc.nodes[id].(*RuleNodeCtx); ok {
+			oldNode.stateLock.Lock()
+			if transferState(rc.Config, id.Id, oldNode, newNode) {
+				// 状态转移后，旧节点收到的消息交给新节点处理
+				oldNode.successor = newNode
+			}
+			oldNode.stateLock.Unlock()
+		}
+	}
+}
+
 func (rc *RuleChainCtx) ReloadChild(ruleNodeId types.RuleNodeId, def []byte) error {
 	if node, ok := rc.GetNodeById(ruleNodeId); ok {
 		// 更新子节点
@@ -300,7 +388,9 @@ func (rc *RuleChainCtx) Copy(newCtx *RuleChainCtx) {
 	rc.nodeIds = newCtx.nodeIds
 	rc.nodes = newCtx.nodes
 	rc.nodeRoutes = newCtx.nodeRoutes
+	rc.inboundRoutes = newCtx.inboundRoutes
 	rc.rootRuleContext = newCtx.rootRuleContext
+	rc.deadLetterHandler = newCtx.deadLetterHandler
 	// 清除缓存
 	rc.relationCache = make(map[RelationCache][]types.NodeCtx)
 }
@@ -0,0 +1,686 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "aggregate",
+//        "name": "聚合",
+//        "debugMode": false,
+//        "configuration": {
+//          "groupBy": "metadata.deviceId",
+//          "windowType": "sliding",
+//          "sizeMs": 60000,
+//          "slideMs": 10000,
+//          "aggregations": [
+//            {"field": "temperature", "func": "avg", "as": "avgTemperature"},
+//            {"field": "temperature", "func": "max", "as": "maxTemperature"},
+//            {"func": "count", "as": "count"}
+//          ]
+//        }
+//  }
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/expr"
+	"github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/maps"
+	"github.com/xyzbit/rulego/utils/str"
+)
+
+// 窗口类型
+const (
+	// WindowTumbling 滚动窗口，固定大小、互不重叠的时间窗口
+	WindowTumbling = "tumbling"
+	// WindowSliding 滑动窗口，每隔slideMs计算一次最近sizeMs的时间窗口
+	WindowSliding = "sliding"
+	// WindowCount 计数窗口，每个分组每收到count条消息计算一次
+	WindowCount = "count"
+)
+
+// 聚合函数
+const (
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateSum   = "sum"
+	AggregateCount = "count"
+	AggregateFirst = "first"
+	AggregateLast  = "last"
+)
+
+// 存放到metadata key
+const (
+	// KeyWindowStart 窗口开始时间，毫秒时间戳
+	KeyWindowStart = "windowStart"
+	// KeyWindowEnd 窗口结束时间，毫秒时间戳
+	KeyWindowEnd = "windowEnd"
+	// KeyWindowCount 窗口内的消息数量
+	KeyWindowCount = "windowCount"
+	// KeyGroupKey 分组key
+	KeyGroupKey = "groupKey"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&AggregateNode{})
+}
+
+// Aggregation 聚合字段
+type Aggregation struct {
+	// 聚合的值，使用expr包表达式计算，例如：temperature、msg.values.humidity、metadata.rssi
+	// count函数为空时统计消息数量，否则统计值不为null的数量
+	Field string
+	// 聚合函数：avg/min/max/sum/count/first/last
+	// avg/min/max/sum 忽略不是数字的值
+	Func string
+	// 输出字段名，默认：field_func，field为空时默认：func
+	As string
+}
+
+// AggregateNodeConfiguration 节点配置
+type AggregateNodeConfiguration struct {
+	// 分组表达式，使用expr包表达式计算，例如：metadata.deviceId，为空所有消息使用同一个分组
+	GroupBy string
+	// 窗口类型：tumbling/sliding/count，默认：tumbling
+	WindowType string
+	// 时间窗口大小，单位毫秒
+	SizeMs int64
+	// 滑动窗口滑动步长，单位毫秒，sizeMs必须是slideMs的整数倍
+	SlideMs int64
+	// 计数窗口消息数量
+	Count int
+	// 聚合字段
+	Aggregations []Aggregation
+	// 聚合消息类型，默认使用窗口内最后一条消息的类型
+	MsgType string
+}
+
+// AggregateNode 聚合窗口节点，按分组在内存中维护滚动、滑动或者计数窗口，计算平均值、最小值、最大值、总和和数量等，
+// 窗口关闭时，把聚合结果作为JSON对象通过`Success`链路由到下一个节点。
+// 聚合消息使用窗口内最后一条消息的元数据，metadata.windowStart、metadata.windowEnd记录窗口开始和结束时间，
+// metadata.windowCount记录窗口内的消息数量，metadata.groupKey记录分组key。
+//
+// 时间窗口按消息到达时间划分，窗口边界按窗口大小(滑动窗口按滑动步长)对齐，由定时器关闭窗口，
+// 聚合消息作为新消息，通过与流入消息无关的节点上下文发送，不受流入消息的上下文取消或者超时影响，
+// 被聚合的流入消息不路由到下一个节点，聚合后立即结束。
+// 计数窗口由第count条消息发送聚合消息。
+// 表达式计算错误，通过`Failure`链路由该消息。
+//
+// 实现types.StatefulNode，规则链或者节点重新加载后，未关闭的窗口在新实例中继续计算
+type AggregateNode struct {
+	// 节点配置
+	Config  AggregateNodeConfiguration
+	groupBy *expr.Program
+	fields  []*expr.Program
+	// 窗口状态，key:分组key
+	groups map[string]*aggregateGroup
+	// 用于发送时间窗口聚合消息的节点上下文，由最近一条流入消息的上下文创建
+	ctx types.RuleContext
+	// 没有上下文或者上下文已经结束时关闭的窗口，收到下一条消息时发送
+	pending []aggregateResult
+	timer   *time.Timer
+	stopped bool
+	mu      sync.Mutex
+	// 当前时间，毫秒时间戳
+	now func() int64
+}
+
+// aggregateGroup 分组窗口状态
+type aggregateGroup struct {
+	// 时间窗口的窗格，按开始时间排序，每个窗格长度为滑动步长
+	Panes []*aggregatePane `json:"panes,omitempty"`
+	// 计数窗口当前窗口
+	Current *aggregatePane `json:"current,omitempty"`
+	// 最后一条消息的类型和元数据
+	MsgType  string            `json:"msgType"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// aggregatePane 窗格，每个聚合字段一个累加器
+type aggregatePane struct {
+	Start int64          `json:"start"`
+	End   int64          `json:"end"`
+	Count int            `json:"count"`
+	Accs  []*accumulator `json:"accs"`
+}
+
+// accumulator 累加器，可以合并，用于滑动窗口合并多个窗格
+type accumulator struct {
+	Count int         `json:"count"`
+	Sum   float64     `json:"sum"`
+	Min   float64     `json:"min"`
+	Max   float64     `json:"max"`
+	First interface{} `json:"first,omitempty"`
+	Last  interface{} `json:"last,omitempty"`
+	// 数字值的数量
+	NumCount int `json:"numCount"`
+}
+
+// aggregateResult 窗口聚合结果
+type aggregateResult struct {
+	MsgType  string            `json:"msgType"`
+	Metadata map[string]string `json:"metadata"`
+	Data     string            `json:"data"`
+}
+
+// aggregateSnapshot 状态快照
+type aggregateSnapshot struct {
+	// 窗口配置签名，配置不兼容时不能恢复
+	Signature string                     `json:"signature"`
+	Groups    map[string]*aggregateGroup `json:"groups"`
+	Pending   []aggregateResult          `json:"pending,omitempty"`
+}
+
+// Type 组件类型
+func (x *AggregateNode) Type() string {
+	return "aggregate"
+}
+
+func (x *AggregateNode) New() types.Node {
+	return &AggregateNode{Config: AggregateNodeConfiguration{WindowType: WindowTumbling}}
+}
+
+// Init 初始化
+func (x *AggregateNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if err = x.validate(); err != nil {
+		return err
+	}
+	if x.Config.GroupBy != "" {
+		if x.groupBy, err = expr.Compile(x.Config.GroupBy); err != nil {
+			return err
+		}
+	}
+	x.fields = make([]*expr.Program, len(x.Config.Aggregations))
+	for i, item := range x.Config.Aggregations {
+		if item.Field == "" {
+			continue
+		}
+		if x.fields[i], err = expr.Compile(item.Field); err != nil {
+			return fmt.Errorf("aggregations[%d] field error: %w", i, err)
+		}
+	}
+	x.groups = make(map[string]*aggregateGroup)
+	if x.now == nil {
+		x.now = func() int64 {
+			return time.Now().UnixMilli()
+		}
+	}
+	if x.Config.WindowType != WindowCount {
+		x.mu.Lock()
+		x.schedule()
+		x.mu.Unlock()
+	}
+	return nil
+}
+
+// validate 校验配置，并设置默认值
+func (x *AggregateNode) validate() error {
+	switch x.Config.WindowType {
+	case "", WindowTumbling:
+		x.Config.WindowType = WindowTumbling
+		if x.Config.SizeMs <= 0 {
+			return errors.New("sizeMs must be greater than 0")
+		}
+		x.Config.SlideMs = x.Config.SizeMs
+	case WindowSliding:
+		if x.Config.SizeMs <= 0 || x.Config.SlideMs <= 0 {
+			return errors.New("sizeMs and slideMs must be greater than 0")
+		}
+		if x.Config.SlideMs > x.Config.SizeMs || x.Config.SizeMs%x.Config.SlideMs != 0 {
+			return errors.New("sizeMs must be a multiple of slideMs")
+		}
+	case WindowCount:
+		if x.Config.Count <= 0 {
+			return errors.New("count must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("unsupported windowType:%s", x.Config.WindowType)
+	}
+	if len(x.Config.Aggregations) == 0 {
+		return errors.New("aggregations can't be empty")
+	}
+	for i := range x.Config.Aggregations {
+		item := &x.Config.Aggregations[i]
+		switch item.Func {
+		case AggregateAvg, AggregateMin, AggregateMax, AggregateSum, AggregateFirst, AggregateLast:
+			if item.Field == "" {
+				return fmt.Errorf("aggregations[%d] field can't be empty", i)
+			}
+		case AggregateCount:
+		default:
+			return fmt.Errorf("aggregations[%d] unsupported func:%s", i, item.Func)
+		}
+		if item.As == "" {
+			if item.Field == "" {
+				item.As = item.Func
+			} else {
+				item.As = item.Field + "_" + item.Func
+			}
+		}
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *AggregateNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	env := expr.NewEnv(msg)
+	key, values, err := x.eval(env)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return err
+	}
+	if x.Config.WindowType == WindowCount {
+		x.mu.Lock()
+		if x.stopped {
+			x.mu.Unlock()
+			// 实例已经销毁或者状态已经转移，不再聚合，结束该消息
+			x.end(ctx, msg)
+			return nil
+		}
+		result, ok := x.addCount(key, msg, values)
+		x.mu.Unlock()
+		if ok {
+			ctx.TellNext(result.msg(), types.Success)
+		} else {
+			x.end(ctx, msg)
+		}
+		return nil
+	}
+
+	// 窗口关闭时发送聚合消息的上下文，不继承当前消息的上下文和结束回调
+	emitCtx := ctx
+	if branchCtx, ok := ctx.(types.BranchContext); ok {
+		emitCtx = branchCtx.Detach()
+	}
+	x.mu.Lock()
+	if x.stopped {
+		x.mu.Unlock()
+		// 实例已经销毁或者状态已经转移，不再聚合，结束该消息
+		x.end(ctx, msg)
+		return nil
+	}
+	x.addTime(key, msg, values)
+	x.ctx = emitCtx
+	pending := x.pending
+	x.pending = nil
+	x.mu.Unlock()
+
+	x.end(ctx, msg)
+	for _, item := range pending {
+		emitCtx.TellNext(item.msg(), types.Success)
+	}
+	return nil
+}
+
+// end 结束被聚合的消息，触发该消息的结束回调
+func (x *AggregateNode) end(ctx types.RuleContext, msg types.RuleMsg) {
+	if branchCtx, ok := ctx.(types.BranchContext); ok {
+		branchCtx.End(msg, nil)
+	} else {
+		ctx.TellNext(msg)
+	}
+}
+
+// Destroy 销毁，停止定时器
+func (x *AggregateNode) Destroy() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.stopped = true
+	if x.timer != nil {
+		x.timer.Stop()
+	}
+	x.ctx = nil
+}
+
+// Snapshot 获取未关闭窗口的状态快照，并把状态转移出当前实例：
+// 停止定时器，清空窗口，之后流入当前实例的消息不再聚合，防止新旧实例重复发送聚合消息
+func (x *AggregateNode) Snapshot() ([]byte, error) {
+	x.mu.Lock()
+	buf, err := json.Marshal(aggregateSnapshot{Signature: x.signature(), Groups: x.groups, Pending: x.pending})
+	if err != nil {
+		x.mu.Unlock()
+		return nil, err
+	}
+	x.stopped = true
+	if x.timer != nil {
+		x.timer.Stop()
+	}
+	x.groups = make(map[string]*aggregateGroup)
+	x.pending = nil
+	x.ctx = nil
+	x.mu.Unlock()
+	return buf, nil
+}
+
+// Restore 使用状态快照恢复窗口状态，窗口类型、大小或者聚合字段变化时返回错误
+func (x *AggregateNode) Restore(snapshot []byte) error {
+	var state aggregateSnapshot
+	if err := json.Unmarshal(snapshot, &state); err != nil {
+		return err
+	}
+	if state.Signature != x.signature() {
+		return errors.New("aggregate snapshot is incompatible with configuration")
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if state.Groups != nil {
+		x.groups = state.Groups
+	}
+	x.pending = append(state.Pending, x.pending...)
+	return nil
+}
+
+// signature 窗口配置签名
+func (x *AggregateNode) signature() string {
+	s := fmt.Sprintf("%s/%d/%d/%d", x.Config.WindowType, x.Config.SizeMs, x.Config.SlideMs, x.Config.Count)
+	for _, item := range x.Config.Aggregations {
+		s += "/" + item.Func + ":" + item.Field
+	}
+	return s
+}
+
+// eval 计算分组key和聚合字段的值
+func (x *AggregateNode) eval(env *expr.Env) (string, []interface{}, error) {
+	var key string
+	if x.groupBy != nil {
+		v, err := x.groupBy.Eval(env)
+		if err != nil {
+			return "", nil, err
+		}
+		key = str.ToString(v)
+	}
+	values := make([]interface{}, len(x.fields))
+	for i, program := range x.fields {
+		if program == nil {
+			continue
+		}
+		v, err := program.Eval(env)
+		if err != nil {
+			return "", nil, err
+		}
+		values[i] = v
+	}
+	return key, values, nil
+}
+
+// group 获取分组状态，并记录最后一条消息的类型和元数据
+func (x *AggregateNode) group(key string, msg types.RuleMsg) *aggregateGroup {
+	group, ok := x.groups[key]
+	if !ok {
+		group = &aggregateGroup{}
+		x.groups[key] = group
+	}
+	group.MsgType = msg.Type
+	group.Metadata = msg.Metadata.Values()
+	return group
+}
+
+// addCount 计数窗口，窗口满时返回聚合结果
+func (x *AggregateNode) addCount(key string, msg types.RuleMsg, values []interface{}) (aggregateResult, bool) {
+	now := x.now()
+	group := x.group(key, msg)
+	if group.Current == nil {
+		group.Current = x.newPane(now)
+	}
+	group.Current.add(values, now)
+	if group.Current.Count < x.Config.Count {
+		return aggregateResult{}, false
+	}
+	result := x.result(key, group, group.Current)
+	delete(x.groups, key)
+	return result, true
+}
+
+// addTime 时间窗口，把消息加入当前窗格
+func (x *AggregateNode) addTime(key string, msg types.RuleMsg, values []interface{}) {
+	now := x.now()
+	start := now / x.Config.SlideMs * x.Config.SlideMs
+	group := x.group(key, msg)
+	var pane *aggregatePane
+	if n := len(group.Panes); n > 0 && group.Panes[n-1].Start == start {
+		pane = group.Panes[n-1]
+	} else {
+		pane = x.newPane(start)
+		group.Panes = append(group.Panes, pane)
+	}
+	pane.add(values, now)
+}
+
+func (x *AggregateNode) newPane(start int64) *aggregatePane {
+	pane := &aggregatePane{Start: start, Accs: make([]*accumulator, len(x.Config.Aggregations))}
+	for i := range pane.Accs {
+		pane.Accs[i] = &accumulator{}
+	}
+	return pane
+}
+
+// schedule 在下一个窗口边界关闭窗口，需要持有锁
+func (x *AggregateNode) schedule() {
+	if x.stopped {
+		return
+	}
+	now := x.now()
+	end := (now/x.Config.SlideMs + 1) * x.Config.SlideMs
+	x.timer = time.AfterFunc(time.Duration(end-now)*time.Millisecond, func() {
+		x.onWindowEnd(end)
+		x.mu.Lock()
+		x.schedule()
+		x.mu.Unlock()
+	})
+}
+
+// onWindowEnd 关闭在end时刻结束的窗口，通过节点上下文发送聚合消息
+// 没有上下文或者上下文已经结束，则保存聚合结果，收到下一条消息时发送
+func (x *AggregateNode) onWindowEnd(end int64) {
+	x.mu.Lock()
+	if x.stopped {
+		x.mu.Unlock()
+		return
+	}
+	results := x.closeWindows(end)
+	ctx := x.ctx
+	if ctx == nil || (ctx.GetContext() != nil && ctx.GetContext().Err() != nil) {
+		x.pending = append(x.pending, results...)
+		x.ctx = nil
+		ctx = nil
+	}
+	x.mu.Unlock()
+
+	if ctx != nil {
+		for _, item := range results {
+			ctx.TellNext(item.msg(), types.Success)
+		}
+	}
+}
+
+// closeWindows 计算在end时刻结束的窗口，并删除之后窗口不再需要的窗格，需要持有锁
+func (x *AggregateNode) closeWindows(end int64) []aggregateResult {
+	start := end - x.Config.SizeMs
+	keys := make([]string, 0, len(x.groups))
+	for key := range x.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var results []aggregateResult
+	for _, key := range keys {
+		group := x.groups[key]
+		window := x.newPane(start)
+		window.End = end
+		var remain []*aggregatePane
+		for _, pane := range group.Panes {
+			if pane.Start >= start && pane.Start < end {
+				window.merge(pane)
+			}
+			// 下一个窗口还需要的窗格
+			if pane.Start >= start+x.Config.SlideMs {
+				remain = append(remain, pane)
+			}
+		}
+		if window.Count > 0 {
+			results = append(results, x.result(key, group, window))
+		}
+		if len(remain) == 0 {
+			delete(x.groups, key)
+		} else {
+			group.Panes = remain
+		}
+	}
+	return results
+}
+
+// result 计算窗口聚合结果
+func (x *AggregateNode) result(key string, group *aggregateGroup, pane *aggregatePane) aggregateResult {
+	data := make(map[string]interface{}, len(x.Config.Aggregations))
+	for i, item := range x.Config.Aggregations {
+		if item.Func == AggregateCount && item.Field == "" {
+			data[item.As] = pane.Count
+		} else {
+			data[item.As] = pane.Accs[i].value(item)
+		}
+	}
+	buf, _ := json.MarshalValue(data)
+	metadata := make(map[string]string, len(group.Metadata)+4)
+	for k, v := range group.Metadata {
+		metadata[k] = v
+	}
+	metadata[KeyWindowStart] = strconv.FormatInt(pane.Start, 10)
+	metadata[KeyWindowEnd] = strconv.FormatInt(pane.End, 10)
+	metadata[KeyWindowCount] = strconv.Itoa(pane.Count)
+	metadata[KeyGroupKey] = key
+	msgType := x.Config.MsgType
+	if msgType == "" {
+		msgType = group.MsgType
+	}
+	return aggregateResult{MsgType: msgType, Metadata: metadata, Data: buf}
+}
+
+func (r aggregateResult) msg() types.RuleMsg {
+	return types.NewMsg(0, r.MsgType, types.JSON, types.BuildMetadata(r.Metadata), r.Data)
+}
+
+// add 把消息的值加入窗格
+func (p *aggregatePane) add(values []interface{}, now int64) {
+	p.Count++
+	if now > p.End {
+		p.End = now
+	}
+	for i, acc := range p.Accs {
+		acc.add(values[i])
+	}
+}
+
+// merge 合并窗格
+func (p *aggregatePane) merge(other *aggregatePane) {
+	p.Count += other.Count
+	for i, acc := range p.Accs {
+		acc.merge(other.Accs[i])
+	}
+}
+
+func (a *accumulator) add(v interface{}) {
+	if v == nil {
+		return
+	}
+	if a.Count == 0 {
+		a.First = v
+	}
+	a.Last = v
+	a.Count++
+	f, ok := toFloat(v)
+	if !ok {
+		return
+	}
+	if a.NumCount == 0 || f < a.Min {
+		a.Min = f
+	}
+	if a.NumCount == 0 || f > a.Max {
+		a.Max = f
+	}
+	a.Sum += f
+	a.NumCount++
+}
+
+// merge 合并后面窗格的累加器
+func (a *accumulator) merge(other *accumulator) {
+	if other.Count == 0 {
+		return
+	}
+	if a.Count == 0 {
+		a.First = other.First
+	}
+	a.Last = other.Last
+	a.Count += other.Count
+	if other.NumCount > 0 {
+		if a.NumCount == 0 || other.Min < a.Min {
+			a.Min = other.Min
+		}
+		if a.NumCount == 0 || other.Max > a.Max {
+			a.Max = other.Max
+		}
+		a.Sum += other.Sum
+		a.NumCount += other.NumCount
+	}
+}
+
+// value 聚合值，没有数字值时avg/min/max为null
+func (a *accumulator) value(item Aggregation) interface{} {
+	switch item.Func {
+	case AggregateCount:
+		return a.Count
+	case AggregateSum:
+		return a.Sum
+	case AggregateFirst:
+		return a.First
+	case AggregateLast:
+		return a.Last
+	}
+	if a.NumCount == 0 {
+		return nil
+	}
+	switch item.Func {
+	case AggregateAvg:
+		return a.Sum / float64(a.NumCount)
+	case AggregateMin:
+		return a.Min
+	default:
+		return a.Max
+	}
+}
+
+// toFloat 转换成数字，支持数字字符串
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,286 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+const hourMs = int64(time.Hour / time.Millisecond)
+
+// newTestAggregateNode 创建使用模拟时钟的聚合节点，窗口以小时为单位，避免定时器在测试期间触发
+func newTestAggregateNode(t *testing.T, clock *int64, configuration types.Configuration) *AggregateNode {
+	node := (&AggregateNode{}).New().(*AggregateNode)
+	node.now = func() int64 {
+		return *clock
+	}
+	err := node.Init(types.NewConfig(), configuration)
+	assert.Nil(t, err)
+	return node
+}
+
+type collector struct {
+	mu            sync.Mutex
+	msgs          []types.RuleMsg
+	relationTypes []string
+}
+
+func (c *collector) ctx() types.RuleContext {
+	return test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.msgs = append(c.msgs, msg)
+		c.relationTypes = append(c.relationTypes, relationType)
+	})
+}
+
+func (c *collector) data() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var list []string
+	for _, item := range c.msgs {
+		list = append(list, item.Data)
+	}
+	c.msgs = nil
+	return list
+}
+
+func deviceMsg(deviceId string, data string) types.RuleMsg {
+	metaData := types.NewMetadata()
+	metaData.PutValue("deviceId", deviceId)
+	return types.NewMsg(0, "TELEMETRY", types.JSON, metaData, data)
+}
+
+func TestAggregateNodeTumbling(t *testing.T) {
+	var clock int64
+	node := newTestAggregateNode(t, &clock, types.Configuration{
+		"groupBy": "metadata.deviceId",
+		"sizeMs":  hourMs,
+		"aggregations": []interface{}{
+			map[string]interface{}{"field": "temperature", "func": "avg"},
+			map[string]interface{}{"field": "temperature", "func": "min", "as": "min"},
+			map[string]interface{}{"field": "temperature", "func": "max", "as": "max"},
+			map[string]interface{}{"field": "temperature", "func": "sum", "as": "sum"},
+			map[string]interface{}{"func": "count"},
+			map[string]interface{}{"field": "status", "func": "first", "as": "first"},
+			map[string]interface{}{"field": "status", "func": "last", "as": "last"},
+		},
+	})
+	defer node.Destroy()
+	c := &collector{}
+	ctx := c.ctx()
+	clock = 10
+	for _, item := range []types.RuleMsg{
+		deviceMsg("d2", `{"temperature":20,"status":"on"}`),
+		deviceMsg("d1", `{"temperature":10,"status":"on"}`),
+		deviceMsg("d1", `{"temperature":"30","status":"off"}`),
+		deviceMsg("d1", `{"status":"unknown"}`),
+	} {
+		assert.Nil(t, node.OnMsg(ctx, item))
+	}
+	//下一个窗口的消息
+	clock = hourMs + 1
+	assert.Nil(t, node.OnMsg(ctx, deviceMsg("d1", `{"temperature":50}`)))
+	assert.Equal(t, 0, len(c.data()))
+
+	node.onWindowEnd(hourMs)
+	assert.Equal(t, []string{
+		`{"count":3,"first":"on","last":"unknown","max":30,"min":10,"sum":40,"temperature_avg":20}`,
+		`{"count":1,"first":"on","last":"on","max":20,"min":20,"sum":20,"temperature_avg":20}`,
+	}, c.data())
+	assert.Equal(t, []string{types.Success, types.Success}, c.relationTypes)
+	node.onWindowEnd(2 * hourMs)
+	assert.Equal(t, []string{`{"count":1,"first":null,"last":null,"max":50,"min":50,"sum":50,"temperature_avg":50}`}, c.data())
+	assert.Equal(t, 0, len(node.groups))
+}
+
+func TestAggregateNodeMetadata(t *testing.T) {
+	var clock int64
+	node := newTestAggregateNode(t, &clock, types.Configuration{
+		"groupBy":      "metadata.deviceId",
+		"sizeMs":       hourMs,
+		"msgType":      "AGGREGATE",
+		"aggregations": []interface{}{map[string]interface{}{"func": "count"}},
+	})
+	defer node.Destroy()
+	var msgs []types.RuleMsg
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		msgs = append(msgs, msg)
+	})
+	clock = 100
+	assert.Nil(t, node.OnMsg(ctx, deviceMsg("d1", `{}`)))
+	node.onWindowEnd(hourMs)
+	assert.Equal(t, 1, len(msgs))
+	assert.Equal(t, "AGGREGATE", msgs[0].Type)
+	assert.Equal(t, types.JSON, msgs[0].DataType)
+	assert.Equal(t, "d1", msgs[0].Metadata.GetValue("deviceId"))
+	assert.Equal(t, "d1", msgs[0].Metadata.GetValue(KeyGroupKey))
+	assert.Equal(t, "0", msgs[0].Metadata.GetValue(KeyWindowStart))
+	assert.Equal(t, "3600000", msgs[0].Metadata.GetValue(KeyWindowEnd))
+	assert.Equal(t, "1", msgs[0].Metadata.GetValue(KeyWindowCount))
+
+	//表达式计算错误
+	node2 := newTestAggregateNode(t, &clock, types.Configuration{
+		"sizeMs":       hourMs,
+		"aggregations": []interface{}{map[string]interface{}{"field": "a / 0", "func": "sum"}},
+	})
+	defer node2.Destroy()
+	var relationType string
+	ctx = test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, r string) {
+		relationType = r
+	})
+	assert.NotNil(t, node2.OnMsg(ctx, deviceMsg("d1", `{"a":1}`)))
+	assert.Equal(t, types.Failure, relationType)
+}
+
+func TestAggregateNodeSliding(t *testing.T) {
+	var clock int64
+	node := newTestAggregateNode(t, &clock, types.Configuration{
+		"windowType":   WindowSliding,
+		"sizeMs":       3 * hourMs,
+		"slideMs":      hourMs,
+		"aggregations": []interface{}{map[string]interface{}{"field": "v", "func": "avg", "as": "avg"}},
+	})
+	defer node.Destroy()
+	c := &collector{}
+	for i, v := range []string{`{"v":1}`, `{"v":2}`, `{"v":3}`} {
+		clock = int64(i) * hourMs
+		assert.Nil(t, node.OnMsg(c.ctx(), deviceMsg("d1", v)))
+	}
+	var results []string
+	for i := int64(1); i <= 6; i++ {
+		node.onWindowEnd(i * hourMs)
+		results = append(results, c.data()...)
+	}
+	assert.Equal(t, []string{`{"avg":1}`, `{"avg":1.5}`, `{"avg":2}`, `{"avg":2.5}`, `{"avg":3}`}, results)
+	assert.Equal(t, 0, len(node.groups))
+}
+
+func TestAggregateNodeCount(t *testing.T) {
+	var clock int64
+	node := newTestAggregateNode(t, &clock, types.Configuration{
+		"windowType":   WindowCount,
+		"count":        2,
+		"groupBy":      "metadata.deviceId",
+		"aggregations": []interface{}{map[string]interface{}{"field": "v", "func": "max", "as": "max"}},
+	})
+	defer node.Destroy()
+	c := &collector{}
+	ctx := c.ctx()
+	for _, item := range []types.RuleMsg{deviceMsg("d1", `{"v":1}`), deviceMsg("d2", `{"v":5}`), deviceMsg("d1", `{"v":3}`), deviceMsg("d1", `{"v":2}`)} {
+		assert.Nil(t, node.OnMsg(ctx, item))
+	}
+	assert.Equal(t, []string{types.Success}, c.relationTypes)
+	assert.Equal(t, []string{`{"max":3}`}, c.data())
+	assert.Equal(t, 2, len(node.groups))
+}
+
+func TestAggregateNodeSnapshot(t *testing.T) {
+	var clock int64
+	configuration := types.Configuration{
+		"groupBy":      "metadata.deviceId",
+		"sizeMs":       hourMs,
+		"aggregations": []interface{}{map[string]interface{}{"field": "v", "func": "sum", "as": "sum"}},
+	}
+	node := newTestAggregateNode(t, &clock, configuration)
+	c := &collector{}
+	assert.Nil(t, node.OnMsg(c.ctx(), deviceMsg("d1", `{"v":1}`)))
+	snapshot, err := node.Snapshot()
+	assert.Nil(t, err)
+	node.Destroy()
+	//状态已经转移，旧实例不再聚合
+	assert.Nil(t, node.OnMsg(c.ctx(), deviceMsg("d1", `{"v":100}`)))
+	node.onWindowEnd(hourMs)
+	assert.Equal(t, 0, len(c.data()))
+
+	node2 := newTestAggregateNode(t, &clock, configuration)
+	defer node2.Destroy()
+	assert.Nil(t, node2.Restore(snapshot))
+	assert.Nil(t, node2.OnMsg(c.ctx(), deviceMsg("d1", `{"v":2}`)))
+	node2.onWindowEnd(hourMs)
+	assert.Equal(t, []string{`{"sum":3}`}, c.data())
+
+	//没有上下文时关闭的窗口，收到下一条消息时发送
+	clock = hourMs
+	assert.Nil(t, node2.OnMsg(c.ctx(), deviceMsg("d1", `{"v":5}`)))
+	snapshot, err = node2.Snapshot()
+	assert.Nil(t, err)
+	node3 := newTestAggregateNode(t, &clock, configuration)
+	defer node3.Destroy()
+	assert.Nil(t, node3.Restore(snapshot))
+	node3.onWindowEnd(2 * hourMs)
+	assert.Equal(t, 0, len(c.data()))
+	assert.Nil(t, node3.OnMsg(c.ctx(), deviceMsg("d2", `{"v":1}`)))
+	assert.Equal(t, []string{`{"sum":5}`}, c.data())
+
+	//配置不兼容
+	configuration["sizeMs"] = 2 * hourMs
+	node4 := newTestAggregateNode(t, &clock, configuration)
+	defer node4.Destroy()
+	assert.NotNil(t, node4.Restore(snapshot))
+}
+
+func TestAggregateNodeInit(t *testing.T) {
+	for _, configuration := range []types.Configuration{
+		{"aggregations": []interface{}{map[string]interface{}{"func": "count"}}},
+		{"sizeMs": 1000},
+		{"sizeMs": 1000, "aggregations": []interface{}{map[string]interface{}{"func": "median", "field": "v"}}},
+		{"sizeMs": 1000, "aggregations": []interface{}{map[string]interface{}{"func": "avg"}}},
+		{"sizeMs": 1000, "aggregations": []interface{}{map[string]interface{}{"func": "avg", "field": "v >"}}},
+		{"windowType": "sliding", "sizeMs": 1000, "slideMs": 300, "aggregations": []interface{}{map[string]interface{}{"func": "count"}}},
+		{"windowType": "count", "aggregations": []interface{}{map[string]interface{}{"func": "count"}}},
+		{"windowType": "session", "sizeMs": 1000, "aggregations": []interface{}{map[string]interface{}{"func": "count"}}},
+		{"groupBy": "(", "sizeMs": 1000, "aggregations": []interface{}{map[string]interface{}{"func": "count"}}},
+	} {
+		node := (&AggregateNode{}).New().(*AggregateNode)
+		assert.NotNil(t, node.Init(types.NewConfig(), configuration))
+	}
+}
+
+func TestAggregateNodeTimer(t *testing.T) {
+	node := (&AggregateNode{}).New().(*AggregateNode)
+	err := node.Init(types.NewConfig(), types.Configuration{
+		"sizeMs":       50,
+		"aggregations": []interface{}{map[string]interface{}{"func": "count"}},
+	})
+	assert.Nil(t, err)
+	defer node.Destroy()
+	c := &collector{}
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, node.OnMsg(c.ctx(), deviceMsg("d1", `{}`)))
+	}
+	time.Sleep(time.Millisecond * 150)
+	//消息可能跨越窗口边界
+	total := 0
+	for _, item := range c.data() {
+		switch item {
+		case `{"count":1}`:
+			total += 1
+		case `{"count":2}`:
+			total += 2
+		case `{"count":3}`:
+			total += 3
+		}
+	}
+	assert.Equal(t, 3, total)
+}
@@ -32,8 +32,8 @@ import (
 	"sync"
 
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
 	"github.com/xyzbit/rulego/utils/maps"
-	"github.com/xyzbit/rulego/utils/str"
 )
 
 var DelayNodeMsgType = "DELAY_NODE_MSG_TYPE"
@@ -50,6 +50,7 @@ type DelayNodeConfiguration struct {
 	// 最大允许挂起消息的数量
 	MaxPendingMsgs int
 	// 通过${metadataKey}方式从metadata变量中获取，延迟时间，如果该值有值，优先取该值。
+	// 支持占位符表达式，详见el包
 	PeriodInSecondsPattern string
 }
 
@@ -62,6 +63,10 @@ type DelayNode struct {
 	// 消息队列
 	PendingMsgs map[string]types.RuleMsg
 	mu          sync.Mutex
+	// 延迟时间模板
+	periodInSecondsTemplate *el.Template
+	// 全局属性
+	global map[string]string
 }
 
 // Type 组件类型
@@ -76,7 +81,13 @@ func (x *DelayNode) New() types.Node {
 // Init 初始化
 func (x *DelayNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	x.PendingMsgs = make(map[string]types.RuleMsg)
-	return maps.Map2Struct(configuration, &x.Config)
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	x.global = ruleConfig.Properties.Values()
+	var err error
+	x.periodInSecondsTemplate, err = el.Compile(x.Config.PeriodInSecondsPattern)
+	return err
 }
 
 // OnMsg 处理消息
@@ -102,7 +113,7 @@ func (x *DelayNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 			periodInSeconds := x.Config.PeriodInSeconds
 			// 从Metadata获取延迟时间
 			if x.Config.PeriodInSecondsPattern != "" {
-				if v, err := strconv.Atoi(str.SprintfDict(x.Config.PeriodInSecondsPattern, msg.Metadata.Values())); err != nil {
+				if v, err := strconv.Atoi(x.periodInSecondsTemplate.ExecuteMsg(msg, x.global)); err != nil {
 					ctx.TellFailure(msg, err)
 					return err
 				} else {
@@ -90,3 +90,28 @@ func TestDelayNodeByPattern(t *testing.T) {
 
 	time.Sleep(3)
 }
+
+func TestDelayNodeByExpression(t *testing.T) {
+	node := (&DelayNode{}).New().(*DelayNode)
+	configuration := make(types.Configuration)
+	// 优先从消息负荷获取，没有则使用默认值
+	configuration["PeriodInSecondsPattern"] = "${msg.period:-0}"
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	assert.Nil(t, err)
+
+	var count int32
+	ctx := test.NewRuleContextFull(config, node, func(msg types.RuleMsg, relationType string) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, types.Success, relationType)
+	})
+	msg := ctx.NewMsg("ACTIVITY_EVENT", types.NewMetadata(), "{}")
+	_ = node.OnMsg(ctx, msg)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// 表达式错误，初始化失败
+	configuration["PeriodInSecondsPattern"] = "${notFound(msg.period)}"
+	err = node.Init(config, configuration)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+//规则链节点配置示例：
+//{
+//        "id": "s4",
+//        "type": "join",
+//        "name": "汇聚",
+//        "debugMode": false,
+//        "configuration": {
+//          "timeoutMs": 5000,
+//          "mergeStrategy": "merge"
+//        }
+//  }
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+// 数据合并策略
+const (
+	// MergeStrategyMerge 把所有分支JSON对象数据合并成一个JSON对象，后到达分支覆盖相同字段
+	MergeStrategyMerge = "merge"
+	// MergeStrategyArray 把所有分支数据按到达顺序合并成一个JSON数组
+	MergeStrategyArray = "array"
+)
+
+// 存放到metadata key
+const (
+	// 实际汇聚的分支数量
+	joinCountKey = "joinCount"
+	// 期望汇聚的分支数量
+	joinExpectedKey = "joinExpected"
+)
+
+// ErrJoinTimeout 等待分支超时错误
+var ErrJoinTimeout = errors.New("join timeout")
+
+// 注册节点
+func init() {
+	Registry.Add(&JoinNode{})
+}
+
+// JoinNodeConfiguration 节点配置
+type JoinNodeConfiguration struct {
+	// 等待的分支数量，<=0 表示使用规则链中连接到该节点的上游节点数量
+	ExpectedCount int
+	// 等待所有分支超时时间，单位毫秒
+	TimeoutMs int
+	// 数据合并策略：merge/array，默认:merge
+	// metadata 总是合并，后到达分支覆盖相同key
+	MergeStrategy string
+}
+
+// JoinNode 汇聚节点，等待同一条消息(通过消息ID关联)的多个并行分支都到达后，把数据和元数据合并成一条消息，
+// 通过`Success`链路由到下一个节点。
+// 如果在超时时间内没有等到所有分支，则把已经到达的分支合并的部分结果，通过`Timeout`链路由到下一个节点，
+// 如果没有配置`Timeout`链，则通过`Failure`链路由。超时后再保留一个超时时间，期间到达的分支直接结束，不再产生新的结果。
+// 合并失败(例如：merge策略分支数据不是JSON对象)，通过`Failure`链路由。
+// metadata.joinCount记录实际汇聚的分支数量，metadata.joinExpected记录期望汇聚的分支数量。
+type JoinNode struct {
+	// 节点配置
+	Config JoinNodeConfiguration
+	// 等待中的消息，key:消息ID
+	pending map[string]*joinState
+	mu      sync.Mutex
+}
+
+// joinState 同一条消息的汇聚状态
+type joinState struct {
+	// 期望汇聚的分支数量
+	expected int
+	// 已到达分支的上下文，汇聚完成前，分支上下文不通知下一个节点，防止规则链提前结束
+	ctxList []types.RuleContext
+	// 已到达分支的消息
+	msgs  []types.RuleMsg
+	timer *time.Timer
+	// 是否已经超时，超时后作为墓碑保留，用于结束超时后到达的分支
+	timedOut bool
+	// 已到达的分支数量，包括超时后到达的分支
+	arrived int
+}
+
+// Type 组件类型
+func (x *JoinNode) Type() string {
+	return "join"
+}
+
+func (x *JoinNode) New() types.Node {
+	return &JoinNode{Config: JoinNodeConfiguration{TimeoutMs: 10000, MergeStrategy: MergeStrategyMerge}}
+}
+
+// Init 初始化
+func (x *JoinNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	x.pending = make(map[string]*joinState)
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	if x.Config.MergeStrategy == "" {
+		x.Config.MergeStrategy = MergeStrategyMerge
+	}
+	if x.Config.MergeStrategy != MergeStrategyMerge && x.Config.MergeStrategy != MergeStrategyArray {
+		return fmt.Errorf("unsupported mergeStrategy:%s", x.Config.MergeStrategy)
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *JoinNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	x.mu.Lock()
+	state, ok := x.pending[msg.Id]
+	if ok && state.timedOut {
+		state.arrived++
+		if state.arrived >= state.expected {
+			delete(x.pending, msg.Id)
+			state.timer.Stop()
+		}
+		x.mu.Unlock()
+		// 超时的部分结果已经发送，超时后到达的分支只结束，不通知下一个节点
+		ctx.TellNext(msg)
+		return nil
+	}
+	if !ok {
+		state = &joinState{expected: x.expectedCount(ctx)}
+		x.pending[msg.Id] = state
+		if x.Config.TimeoutMs > 0 {
+			msgId := msg.Id
+			state.timer = time.AfterFunc(time.Duration(x.Config.TimeoutMs)*time.Millisecond, func() {
+				x.onTimeout(msgId)
+			})
+		}
+	}
+	state.ctxList = append(state.ctxList, ctx)
+	state.msgs = append(state.msgs, msg)
+	completed := len(state.msgs) >= state.expected
+	if completed {
+		delete(x.pending, msg.Id)
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+	}
+	x.mu.Unlock()
+
+	if completed {
+		// 由最后到达的分支通知下一个节点
+		x.emit(state, len(state.ctxList)-1, types.Success, nil)
+	}
+	return nil
+}
+
+// Def 组件可视化定义，汇聚节点可以产生`Timeout`关系
+func (x *JoinNode) Def() types.ComponentForm {
+	relationTypes := &[]string{types.Success, types.Timeout, types.Failure}
+	return types.ComponentForm{
+		RelationTypes: relationTypes,
+	}
+}
+
+// Destroy 销毁
+func (x *JoinNode) Destroy() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, state := range x.pending {
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+	}
+	x.pending = make(map[string]*joinState)
+}
+
+// expectedCount 获取期望汇聚的分支数量
+func (x *JoinNode) expectedCount(ctx types.RuleContext) int {
+	if x.Config.ExpectedCount > 0 {
+		return x.Config.ExpectedCount
+	}
+	if chainCtx, ok := ctx.(types.ChainContext); ok && chainCtx.InboundCount() > 0 {
+		return chainCtx.InboundCount()
+	}
+	return 1
+}
+
+func (x *JoinNode) onTimeout(msgId string) {
+	x.mu.Lock()
+	state, ok := x.pending[msgId]
+	if !ok {
+		x.mu.Unlock()
+		return
+	}
+	if state.timedOut {
+		// 墓碑过期
+		delete(x.pending, msgId)
+		x.mu.Unlock()
+		return
+	}
+	// 已到达的分支交给超时结果，保留墓碑一个超时时间
+	timeoutState := &joinState{expected: state.expected, ctxList: state.ctxList, msgs: state.msgs}
+	state.timedOut = true
+	state.arrived = len(state.msgs)
+	state.ctxList = nil
+	state.msgs = nil
+	state.timer.Reset(time.Duration(x.Config.TimeoutMs) * time.Millisecond)
+	x.mu.Unlock()
+
+	// 由最先到达的分支通知下一个节点
+	relationType := types.Timeout
+	if chainCtx, ok := timeoutState.ctxList[0].(types.ChainContext); ok && !chainCtx.HasRelation(types.Timeout) {
+		relationType = types.Failure
+	}
+	x.emit(timeoutState, 0, relationType, ErrJoinTimeout)
+}
+
+// emit 合并所有分支消息，通过ctxList[index]通知下一个节点，其他分支上下文结束，不通知下一个节点
+func (x *JoinNode) emit(state *joinState, index int, relationType string, err error) {
+	msg, mergeErr := x.merge(state)
+	for i, ctx := range state.ctxList {
+		if i == index {
+			continue
+		}
+		// 不指定关系，只结束该分支
+		ctx.TellNext(msg)
+	}
+	ctx := state.ctxList[index]
+	if mergeErr != nil {
+		ctx.TellFailure(msg, mergeErr)
+	} else if relationType == types.Failure {
+		ctx.TellFailure(msg, err)
+	} else {
+		ctx.TellNext(msg, relationType)
+	}
+}
+
+// merge 合并所有分支消息
+func (x *JoinNode) merge(state *joinState) (types.RuleMsg, error) {
+	msg := state.msgs[0].Copy()
+	metadata := types.NewMetadata()
+	for _, item := range state.msgs {
+		for k, v := range item.Metadata.Values() {
+			metadata.PutValue(k, v)
+		}
+	}
+	metadata.PutValue(joinCountKey, strconv.Itoa(len(state.msgs)))
+	metadata.PutValue(joinExpectedKey, strconv.Itoa(state.expected))
+	msg.Metadata = metadata
+	msg.DataType = types.JSON
+
+	var data interface{}
+	if x.Config.MergeStrategy == MergeStrategyArray {
+		var list []interface{}
+		for _, item := range state.msgs {
+			var v interface{}
+			if item.DataType == types.JSON && json.Unmarshal([]byte(item.Data), &v) == nil {
+				list = append(list, v)
+			} else {
+				list = append(list, item.Data)
+			}
+		}
+		data = list
+	} else {
+		dataMap := make(map[string]interface{})
+		for _, item := range state.msgs {
+			var v map[string]interface{}
+			if err := json.Unmarshal([]byte(item.Data), &v); err != nil {
+				return msg, fmt.Errorf("merge error, data is not json object:%s", item.Data)
+			}
+			for k, value := range v {
+				dataMap[k] = value
+			}
+		}
+		data = dataMap
+	}
+	if b, err := json.Marshal(data); err != nil {
+		return msg, err
+	} else {
+		msg.Data = string(b)
+	}
+	return msg, nil
+}
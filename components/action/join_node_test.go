@@ -0,0 +1,134 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestJoinNodeOnMsg(t *testing.T) {
+	var node JoinNode
+	configuration := make(types.Configuration)
+	configuration["expectedCount"] = 2
+	configuration["timeoutMs"] = 500
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	if err != nil {
+		t.Errorf("err=%s", err)
+	}
+	var count int32
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "{\"humidity\":20,\"temperature\":41}", msg.Data)
+		assert.Equal(t, "test01", msg.Metadata.GetValue("productType"))
+		assert.Equal(t, "b", msg.Metadata.GetValue("branch"))
+		assert.Equal(t, "2", msg.Metadata.GetValue(joinCountKey))
+	})
+	metaData := types.NewMetadata()
+	metaData.PutValue("productType", "test01")
+	msg := ctx.NewMsg("TEST_MSG_TYPE", metaData, "{\"temperature\":41}")
+	_ = node.OnMsg(ctx, msg)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+
+	msg2 := msg.Copy()
+	msg2.Data = "{\"humidity\":20}"
+	msg2.Metadata.PutValue("branch", "b")
+	_ = node.OnMsg(ctx, msg2)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+func TestJoinNodeTimeout(t *testing.T) {
+	var node JoinNode
+	configuration := make(types.Configuration)
+	configuration["expectedCount"] = 3
+	configuration["timeoutMs"] = 100
+	configuration["mergeStrategy"] = MergeStrategyArray
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	if err != nil {
+		t.Errorf("err=%s", err)
+	}
+	var count int32
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, types.Timeout, relationType)
+		assert.Equal(t, "[{\"temperature\":41},\"AA\"]", msg.Data)
+		assert.Equal(t, "2", msg.Metadata.GetValue(joinCountKey))
+		assert.Equal(t, "3", msg.Metadata.GetValue(joinExpectedKey))
+	})
+	msg := ctx.NewMsg("TEST_MSG_TYPE", types.NewMetadata(), "{\"temperature\":41}")
+	_ = node.OnMsg(ctx, msg)
+	msg2 := msg.Copy()
+	msg2.DataType = types.TEXT
+	msg2.Data = "AA"
+	_ = node.OnMsg(ctx, msg2)
+
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	configuration["mergeStrategy"] = "unknown"
+	err = (&JoinNode{}).Init(config, configuration)
+	assert.NotNil(t, err)
+}
+
+func TestJoinNodeLateBranch(t *testing.T) {
+	var node JoinNode
+	configuration := make(types.Configuration)
+	configuration["expectedCount"] = 2
+	configuration["timeoutMs"] = 100
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	if err != nil {
+		t.Errorf("err=%s", err)
+	}
+	var count int32
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, types.Timeout, relationType)
+		assert.Equal(t, "1", msg.Metadata.GetValue(joinCountKey))
+	})
+	msg := ctx.NewMsg("TEST_MSG_TYPE", types.NewMetadata(), "{\"temperature\":41}")
+	_ = node.OnMsg(ctx, msg)
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// 比超时时间慢的分支到达，只结束该分支，不再产生新的超时结果
+	msg2 := msg.Copy()
+	msg2.Data = "{\"humidity\":20}"
+	_ = node.OnMsg(ctx, msg2)
+	time.Sleep(time.Millisecond * 250)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	node.mu.Lock()
+	assert.Equal(t, 0, len(node.pending))
+	node.mu.Unlock()
+
+	// 只有部分分支超时后到达，墓碑过期后删除
+	msg3 := ctx.NewMsg("TEST_MSG_TYPE", types.NewMetadata(), "{\"temperature\":42}")
+	_ = node.OnMsg(ctx, msg3)
+	time.Sleep(time.Millisecond * 300)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	node.mu.Lock()
+	assert.Equal(t, 0, len(node.pending))
+	node.mu.Unlock()
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "split",
+//        "name": "拆分",
+//        "debugMode": false,
+//        "configuration": {
+//          "path": "$.items",
+//          "maxConcurrency": 10,
+//          "sendDone": true
+//        }
+//  }
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/expr"
+	"github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+// 存放到metadata key
+const (
+	// KeySplitIndex 元素在数组中的下标，从0开始
+	KeySplitIndex = "index"
+	// KeySplitTotal 数组元素数量
+	KeySplitTotal = "total"
+	// KeySplitParentId 拆分前的消息ID
+	KeySplitParentId = "parentId"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&SplitNode{})
+}
+
+// SplitNodeConfiguration 节点配置
+type SplitNodeConfiguration struct {
+	// 数组路径，$或者msg表示整个消息负荷，例如：$.items、$.data.list，默认：$
+	// 路径使用expr包表达式计算，详见expr包
+	Path string
+	// 最多同时处理的元素数量，<=0 不限制
+	// 元素及其后续分支处理完成后，才发送下一个元素
+	MaxConcurrency int
+	// 所有元素及其后续分支处理完成后，是否通过`Done`链发送汇总消息
+	SendDone bool
+}
+
+// SplitNode 拆分节点，把msg.Data中的数组拆分成多条消息，每个元素一条消息，通过`Success`链路由到下一个节点。
+// 元素是字符串，消息DataType为TEXT，否则序列化成JSON，DataType为JSON。
+// 元素消息复制原消息的消息类型和元数据，metadata.index记录元素下标，metadata.total记录元素数量，metadata.parentId记录原消息ID。
+// 如果配置了sendDone，所有元素及其后续分支处理完成后，把原消息通过`Done`链路由到下一个节点，metadata.total记录元素数量。
+// 路径计算错误或者不是数组，通过`Failure`链路由。
+type SplitNode struct {
+	// 节点配置
+	Config  SplitNodeConfiguration
+	program *expr.Program
+}
+
+// Type 组件类型
+func (x *SplitNode) Type() string {
+	return "split"
+}
+
+func (x *SplitNode) New() types.Node {
+	return &SplitNode{Config: SplitNodeConfiguration{Path: "$"}}
+}
+
+// Init 初始化
+func (x *SplitNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.Config.Path == "" {
+		x.Config.Path = "$"
+	}
+	x.program, err = expr.Compile(x.Config.Path)
+	return err
+}
+
+// OnMsg 处理消息
+func (x *SplitNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	msgs, err := x.split(msg)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return err
+	}
+	doneMsg := msg.Copy()
+	doneMsg.Metadata.PutValue(KeySplitTotal, strconv.Itoa(len(msgs)))
+
+	branchCtx, ok := ctx.(types.BranchContext)
+	if !ok {
+		// 上下文不支持跟踪分支执行，发送后即认为元素处理完成
+		for _, item := range msgs {
+			ctx.TellNext(item, types.Success)
+		}
+		if x.Config.SendDone {
+			ctx.TellNext(doneMsg, types.Done)
+		}
+		return nil
+	}
+
+	// 所有元素处理完成前，保持节点处于执行中
+	release := branchCtx.Hold()
+	done := func() {
+		if x.Config.SendDone {
+			ctx.TellNext(doneMsg, types.Done)
+		}
+		release()
+	}
+	if len(msgs) == 0 {
+		done()
+		return nil
+	}
+	remaining := int32(len(msgs))
+	var sem chan struct{}
+	if x.Config.MaxConcurrency > 0 && x.Config.MaxConcurrency < len(msgs) {
+		sem = make(chan struct{}, x.Config.MaxConcurrency)
+	}
+	onCompleted := func() {
+		if sem != nil {
+			<-sem
+		}
+		if atomic.AddInt32(&remaining, -1) == 0 {
+			done()
+		}
+	}
+	if sem == nil {
+		for _, item := range msgs {
+			branchCtx.TellNextWithCompleted(item, onCompleted, types.Success)
+		}
+		return nil
+	}
+	// 限制并发时，等待元素处理完成会阻塞，不能占用协程池的协程
+	go func() {
+		for _, item := range msgs {
+			sem <- struct{}{}
+			branchCtx.TellNextWithCompleted(item, onCompleted, types.Success)
+		}
+	}()
+	return nil
+}
+
+// Def 组件可视化定义，拆分节点可以产生`Done`关系
+func (x *SplitNode) Def() types.ComponentForm {
+	relationTypes := &[]string{types.Success, types.Failure, types.Done}
+	return types.ComponentForm{
+		RelationTypes: relationTypes,
+	}
+}
+
+// Destroy 销毁
+func (x *SplitNode) Destroy() {
+}
+
+// split 把数组拆分成元素消息
+func (x *SplitNode) split(msg types.RuleMsg) ([]types.RuleMsg, error) {
+	v, err := x.program.Eval(expr.NewEnv(msg))
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("path %s is not an array", x.Config.Path)
+	}
+	total := strconv.Itoa(len(items))
+	msgs := make([]types.RuleMsg, 0, len(items))
+	for i, item := range items {
+		dataType := types.TEXT
+		data, ok := item.(string)
+		if !ok {
+			dataType = types.JSON
+			if data, err = json.MarshalValue(item); err != nil {
+				return nil, err
+			}
+		}
+		metadata := msg.Metadata.Copy()
+		metadata.PutValue(KeySplitIndex, strconv.Itoa(i))
+		metadata.PutValue(KeySplitTotal, total)
+		metadata.PutValue(KeySplitParentId, msg.Id)
+		msgs = append(msgs, types.NewMsg(0, msg.Type, dataType, metadata, data))
+	}
+	return msgs, nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestSplitNodeOnMsg(t *testing.T) {
+	var node SplitNode
+	configuration := types.Configuration{"path": "$.items", "sendDone": true}
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	assert.Nil(t, err)
+
+	var msgs []types.RuleMsg
+	var relationTypes []string
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		msgs = append(msgs, msg)
+		relationTypes = append(relationTypes, relationType)
+	})
+	metaData := types.NewMetadata()
+	metaData.PutValue("deviceId", "d1")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"items":[{"id":1,"v":1.50},"text",[1,2]]}`)
+	err = node.OnMsg(ctx, msg)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{types.Success, types.Success, types.Success, types.Done}, relationTypes)
+	assert.Equal(t, `{"id":1,"v":1.50}`, msgs[0].Data)
+	assert.Equal(t, types.JSON, msgs[0].DataType)
+	assert.Equal(t, "text", msgs[1].Data)
+	assert.Equal(t, types.TEXT, msgs[1].DataType)
+	assert.Equal(t, "[1,2]", msgs[2].Data)
+	for i, item := range msgs[:3] {
+		assert.Equal(t, "TEST_MSG_TYPE", item.Type)
+		assert.Equal(t, "d1", item.Metadata.GetValue("deviceId"))
+		assert.Equal(t, string(rune('0'+i)), item.Metadata.GetValue(KeySplitIndex))
+		assert.Equal(t, "3", item.Metadata.GetValue(KeySplitTotal))
+		assert.Equal(t, msg.Id, item.Metadata.GetValue(KeySplitParentId))
+	}
+	assert.Equal(t, msg.Id, msgs[3].Id)
+	assert.Equal(t, msg.Data, msgs[3].Data)
+	assert.Equal(t, "3", msgs[3].Metadata.GetValue(KeySplitTotal))
+	assert.False(t, msg.Metadata.Has(KeySplitTotal))
+
+	//默认整个消息负荷，不发送汇总消息
+	relationTypes = nil
+	assert.Nil(t, (&SplitNode{}).Init(config, types.Configuration{}))
+	node2 := node.New().(*SplitNode)
+	assert.Nil(t, node2.Init(config, types.Configuration{}))
+	assert.Nil(t, node2.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `[1,2]`)))
+	assert.Equal(t, []string{types.Success, types.Success}, relationTypes)
+
+	//不是数组
+	relationTypes = nil
+	assert.NotNil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"items":{}}`)))
+	assert.NotNil(t, node2.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.TEXT, types.NewMetadata(), `aa`)))
+	assert.Equal(t, []string{types.Failure, types.Failure}, relationTypes)
+
+	assert.NotNil(t, (&SplitNode{}).Init(config, types.Configuration{"path": "$.items["}))
+}
@@ -24,6 +24,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
 	"github.com/xyzbit/rulego/utils/maps"
 	"github.com/xyzbit/rulego/utils/str"
 )
@@ -47,9 +48,9 @@ const (
 
 // DbClientNodeConfiguration 节点配置
 type DbClientNodeConfiguration struct {
-	// Sql SQL语句，可以使用${metaKeyName} 替换元数据中的变量
+	// Sql SQL语句，可以使用${metaKeyName} 替换元数据中的变量，支持占位符表达式，详见el包
 	Sql string
-	// Params SQL语句参数列表，可以使用${metaKeyName} 替换元数据中的变量
+	// Params SQL语句参数列表，可以使用${metaKeyName} 替换元数据中的变量，支持占位符表达式
 	Params []interface{}
 	// GetOne 是否只返回一条记录，true:返回结构不是数组结构，false：返回数据是数组结构
 	GetOne bool
@@ -69,6 +70,12 @@ type DbClientNode struct {
 	opType string
 	// 参数是否有变量
 	paramsHasVar bool
+	// sql模板
+	sqlTemplate *el.Template
+	// 参数模板，非字符串参数为nil
+	paramTemplates []*el.Template
+	// 全局属性
+	global map[string]string
 }
 
 // Type 返回组件类型
@@ -104,15 +111,24 @@ func (x *DbClientNode) Init(ruleConfig types.Config, configuration types.Configu
 			}
 
 			// 检查是参数否有变量
-			for _, item := range x.Config.Params {
+			x.paramTemplates = make([]*el.Template, len(x.Config.Params))
+			for i, item := range x.Config.Params {
 				if v, ok := item.(string); ok && str.CheckHasVar(v) {
+					if x.paramTemplates[i], err = el.Compile(v); err != nil {
+						return err
+					}
 					x.paramsHasVar = true
-					break
 				}
 			}
 
 			// 检查是否需要转换成$1风格占位符
 			x.Config.Sql = str.ConvertDollarPlaceholder(x.Config.Sql, x.Config.DbType)
+			x.global = ruleConfig.Properties.Values()
+			if sqlTemplate, compileErr := el.Compile(x.Config.Sql); compileErr != nil {
+				return compileErr
+			} else {
+				x.sqlTemplate = sqlTemplate
+			}
 		}
 	}
 	return err
@@ -124,14 +140,15 @@ func (x *DbClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 	var err error
 	var rowsAffected int64
 	var lastInsertId int64
-	sqlStr := str.SprintfDict(x.Config.Sql, msg.Metadata.Values())
+	env := el.NewEnv(msg, x.global)
+	sqlStr := x.sqlTemplate.Execute(env)
 
 	var params []interface{}
 	if x.paramsHasVar {
 		// 转换参数变量
-		for _, item := range x.Config.Params {
-			if v, ok := item.(string); ok {
-				params = append(params, str.SprintfDict(v, msg.Metadata.Values()))
+		for i, item := range x.Config.Params {
+			if x.paramTemplates[i] != nil {
+				params = append(params, x.paramTemplates[i].Execute(env))
 			} else {
 				params = append(params, item)
 			}
@@ -103,6 +103,10 @@ func (x *RPCCallNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 		md := metadata.New(header)
 		gctx = metadata.NewIncomingContext(gctx, md)
 	}
+	// 传递链路上下文
+	if sc, ok := types.SpanContextFromContext(gctx); ok {
+		gctx = metadata.AppendToOutgoingContext(gctx, types.TraceParentHeader, sc.TraceParent())
+	}
 
 	err = x.gconn.Invoke(gctx, x.Config.Method, req, reply)
 	if err != nil {
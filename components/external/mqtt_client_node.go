@@ -21,8 +21,8 @@ import (
 
 	"github.com/xyzbit/rulego/api/types"
 	"github.com/xyzbit/rulego/components/mqtt"
+	"github.com/xyzbit/rulego/utils/el"
 	"github.com/xyzbit/rulego/utils/maps"
-	"github.com/xyzbit/rulego/utils/str"
 )
 
 // 规则链节点配置示例：
@@ -42,7 +42,7 @@ func init() {
 }
 
 type MqttClientNodeConfiguration struct {
-	// publish topic
+	// publish topic，支持占位符表达式，详见el包
 	Topic                string
 	Server               string
 	Username             string
@@ -75,6 +75,10 @@ type MqttClientNode struct {
 	// 节点配置
 	Config     MqttClientNodeConfiguration
 	mqttClient *mqtt.Client
+	// topic模板
+	topicTemplate *el.Template
+	// 全局属性
+	global map[string]string
 }
 
 // Type 组件类型
@@ -90,6 +94,10 @@ func (x *MqttClientNode) New() types.Node {
 func (x *MqttClientNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	err := maps.Map2Struct(configuration, &x.Config)
 	if err == nil {
+		x.global = ruleConfig.Properties.Values()
+		if x.topicTemplate, err = el.Compile(x.Config.Topic); err != nil {
+			return err
+		}
 		x.mqttClient, err = mqtt.NewClient(x.Config.ToMqttConfig())
 	}
 	return err
@@ -97,7 +105,7 @@ func (x *MqttClientNode) Init(ruleConfig types.Config, configuration types.Confi
 
 // OnMsg 处理消息
 func (x *MqttClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
-	topic := str.SprintfDict(x.Config.Topic, msg.Metadata.Values())
+	topic := x.topicTemplate.ExecuteMsg(msg, x.global)
 	err := x.mqttClient.Publish(topic, x.Config.QOS, []byte(msg.Data))
 	if err != nil {
 		ctx.TellFailure(msg, err)
@@ -40,8 +40,8 @@ import (
 	"time"
 
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
 	"github.com/xyzbit/rulego/utils/maps"
-	"github.com/xyzbit/rulego/utils/str"
 )
 
 func init() {
@@ -60,11 +60,11 @@ const (
 
 // RestApiCallNodeConfiguration rest配置
 type RestApiCallNodeConfiguration struct {
-	// RestEndpointUrlPattern HTTP URL地址目标,可以使用 ${metaKeyName} 替换元数据中的变量
+	// RestEndpointUrlPattern HTTP URL地址目标,可以使用 ${metaKeyName} 替换元数据中的变量，支持占位符表达式，详见el包
 	RestEndpointUrlPattern string
 	// RequestMethod 请求方法
 	RequestMethod string
-	// Headers 请求头,可以使用 ${metaKeyName} 替换元数据中的变量
+	// Headers 请求头,可以使用 ${metaKeyName} 替换元数据中的变量，支持占位符表达式
 	Headers map[string]string
 	// ReadTimeoutMs 超时，单位毫秒
 	ReadTimeoutMs int
@@ -94,6 +94,12 @@ type RestApiCallNode struct {
 	Config RestApiCallNodeConfiguration
 	// httpClient http客户端
 	httpClient *http.Client
+	// url模板
+	urlTemplate *el.Template
+	// 请求头模板，key:请求头名称模板
+	headerTemplates map[*el.Template]*el.Template
+	// 全局属性
+	global map[string]string
 }
 
 // Type 组件类型
@@ -118,21 +124,41 @@ func (x *RestApiCallNode) Init(ruleConfig types.Config, configuration types.Conf
 	if err == nil {
 		x.Config.RequestMethod = strings.ToUpper(x.Config.RequestMethod)
 		x.httpClient = NewHttpClient(x.Config)
+		x.global = ruleConfig.Properties.Values()
+		if x.urlTemplate, err = el.Compile(x.Config.RestEndpointUrlPattern); err != nil {
+			return err
+		}
+		x.headerTemplates = make(map[*el.Template]*el.Template)
+		for key, value := range x.Config.Headers {
+			keyTemplate, err := el.Compile(key)
+			if err != nil {
+				return err
+			}
+			valueTemplate, err := el.Compile(value)
+			if err != nil {
+				return err
+			}
+			x.headerTemplates[keyTemplate] = valueTemplate
+		}
 	}
 	return err
 }
 
 // OnMsg 处理消息
 func (x *RestApiCallNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
-	metaData := msg.Metadata.Values()
-	endpointUrl := str.SprintfDict(x.Config.RestEndpointUrlPattern, metaData)
+	env := el.NewEnv(msg, x.global)
+	endpointUrl := x.urlTemplate.Execute(env)
 	req, err := http.NewRequest(x.Config.RequestMethod, endpointUrl, bytes.NewReader([]byte(msg.Data)))
 	if err != nil {
 		ctx.TellFailure(msg, err)
 	}
 	// 设置header
-	for key, value := range x.Config.Headers {
-		req.Header.Set(str.SprintfDict(key, metaData), str.SprintfDict(value, metaData))
+	for key, value := range x.headerTemplates {
+		req.Header.Set(key.Execute(env), value.Execute(env))
+	}
+	// 传递链路上下文
+	if sc, ok := types.SpanContextFromContext(ctx.GetContext()); ok {
+		req.Header.Set(types.TraceParentHeader, sc.TraceParent())
 	}
 
 	response, err := x.httpClient.Do(req)
@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
 	"github.com/xyzbit/rulego/utils/maps"
 	string2 "github.com/xyzbit/rulego/utils/str"
 )
@@ -47,9 +48,9 @@ type Email struct {
 	Cc string
 	// Bcc 密送人邮箱，多个与`,`隔开
 	Bcc string
-	// Subject 邮件主题，可以使用 ${metaKeyName} 替换元数据中的变量
+	// Subject 邮件主题，可以使用 ${metaKeyName} 替换元数据中的变量，SendEmailNode支持占位符表达式，详见el包
 	Subject string
-	// Body 邮件模板，可以使用 ${metaKeyName} 替换元数据中的变量
+	// Body 邮件模板，可以使用 ${metaKeyName} 替换元数据中的变量，SendEmailNode支持占位符表达式
 	Body string
 }
 
@@ -170,6 +171,12 @@ type SendEmailNode struct {
 	Config   SendEmailConfiguration
 	smtpAddr string
 	smtpAuth smtp.Auth
+	// 邮件主题模板
+	subjectTemplate *el.Template
+	// 邮件正文模板
+	bodyTemplate *el.Template
+	// 全局属性
+	global map[string]string
 }
 
 // Type 组件类型
@@ -191,19 +198,27 @@ func (x *SendEmailNode) Init(ruleConfig types.Config, configuration types.Config
 		x.smtpAddr = fmt.Sprintf("%s:%d", x.Config.SmtpHost, x.Config.SmtpPort)
 		// 创建一个PLAIN认证
 		x.smtpAuth = smtp.PlainAuth("", x.Config.Username, x.Config.Password, x.Config.SmtpHost)
+		x.global = ruleConfig.Properties.Values()
+		if x.subjectTemplate, err = el.Compile(x.Config.Email.Subject); err != nil {
+			return err
+		}
+		x.bodyTemplate, err = el.Compile(x.Config.Email.Body)
 	}
 	return err
 }
 
 // OnMsg 处理消息
 func (x *SendEmailNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
-	metaData := msg.Metadata.Values()
+	env := el.NewEnv(msg, x.global)
 	emailPojo := x.Config.Email
+	emailPojo.Subject = x.subjectTemplate.Execute(env)
+	emailPojo.Body = x.bodyTemplate.Execute(env)
 	var err error
+	// 占位符已经替换，不再使用元数据替换
 	if x.Config.EnableTls {
-		err = emailPojo.SendEmailWithTls(x.smtpAddr, x.smtpAuth, metaData)
+		err = emailPojo.SendEmailWithTls(x.smtpAddr, x.smtpAuth, nil)
 	} else {
-		err = emailPojo.SendEmail(x.smtpAddr, x.smtpAuth, metaData)
+		err = emailPojo.SendEmail(x.smtpAddr, x.smtpAuth, nil)
 	}
 	if err != nil {
 		ctx.TellFailure(msg, err)
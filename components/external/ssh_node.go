@@ -31,8 +31,8 @@ import (
 	"fmt"
 
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
 	"github.com/xyzbit/rulego/utils/maps"
-	"github.com/xyzbit/rulego/utils/str"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -50,7 +50,7 @@ type SshConfiguration struct {
 	Username string
 	// Password ssh登录密码
 	Password string
-	// Cmd shell命令,可以使用 ${metaKeyName} 替换元数据中的变量
+	// Cmd shell命令,可以使用 ${metaKeyName} 替换元数据中的变量，支持占位符表达式，详见el包
 	Cmd string
 }
 
@@ -63,6 +63,10 @@ type SshNode struct {
 	Config SshConfiguration
 	// client 是一个 ssh.Client 类型的字段，用来保存 ssh 客户端对象
 	client *ssh.Client
+	// shell命令模板
+	cmdTemplate *el.Template
+	// 全局属性
+	global map[string]string
 }
 
 // Type 方法用来返回组件的类型
@@ -79,6 +83,10 @@ func (x *SshNode) New() types.Node {
 func (x *SshNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	err := maps.Map2Struct(configuration, &x.Config)
 	if err == nil {
+		x.global = ruleConfig.Properties.Values()
+		if x.cmdTemplate, err = el.Compile(x.Config.Cmd); err != nil {
+			return err
+		}
 		// 从配置中获取 ssh 连接的参数
 		sshConfig := x.Config
 		// 如果参数不为空，则创建一个 ssh 客户端对象
@@ -113,8 +121,7 @@ func (x *SshNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 		ctx.TellFailure(msg, err)
 		return err
 	}
-	metaData := msg.Metadata.Values()
-	cmd = str.SprintfDict(cmd, metaData)
+	cmd = x.cmdTemplate.ExecuteMsg(msg, x.global)
 	var output []byte
 	var session *ssh.Session
 	// 如果有 ssh 客户端对象，则创建一个 ssh 会话，并执行远程 shell 命令，并获取其输出或错误信息
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+// TestSshNodeShellCmd shell命令中的${...}不是占位符时，可以正常初始化，并且原样执行
+func TestSshNodeShellCmd(t *testing.T) {
+	var node SshNode
+	configuration := types.Configuration{
+		"cmd": "for f in ${FILES[@]}; do echo ${f,,} ${#f}; done; cd $${HOME:-/root}/${dir}",
+	}
+	err := node.Init(types.NewConfig(), configuration)
+	// 没有配置ssh服务器，命令模板已经编译
+	assert.Equal(t, "ssh client is empty", err.Error())
+
+	metaData := types.NewMetadata()
+	metaData.PutValue("dir", "logs")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.TEXT, metaData, "")
+	assert.Equal(t, "for f in ${FILES[@]}; do echo ${f,,} ${#f}; done; cd ${HOME:-/root}/logs", node.cmdTemplate.ExecuteMsg(msg, nil))
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "exprFilter",
+//        "name": "表达式过滤",
+//        "debugMode": false,
+//        "configuration": {
+//          "expr": "temperature > 50 && metadata.deviceType == 'sensor'"
+//        }
+//      }
+import (
+	"errors"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/expr"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+func init() {
+	Registry.Add(&ExprFilterNode{})
+}
+
+// ExprFilterNodeConfiguration 节点配置
+type ExprFilterNodeConfiguration struct {
+	// Expr 过滤表达式，语法详见 expr 包
+	Expr string
+}
+
+// ExprFilterNode 使用表达式过滤消息，表达式在初始化时编译，不需要js引擎
+// 表达式结果为真，把消息发送到`True`链, 否则发到`False`链。求值错误发到`Failure`链
+// 消息体字段可以直接访问或者通过`msg`变量访问。例如:`temperature > 50` 或者 `msg.temperature > 50`
+// 消息元数据可以通过`metadata`变量访问。例如 `metadata.customerName == 'Lala'`
+// 消息类型可以通过`msgType`变量访问。例如 `msgType in ['TELEMETRY', 'ATTRIBUTES']`
+type ExprFilterNode struct {
+	// 节点配置
+	Config  ExprFilterNodeConfiguration
+	program *expr.Program
+}
+
+// Type 组件类型
+func (x *ExprFilterNode) Type() string {
+	return "exprFilter"
+}
+
+func (x *ExprFilterNode) New() types.Node {
+	return &ExprFilterNode{}
+}
+
+// Init 初始化
+func (x *ExprFilterNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.Config.Expr == "" {
+		return errors.New("expr can't be empty")
+	}
+	x.program, err = expr.Compile(x.Config.Expr)
+	return err
+}
+
+// OnMsg 处理消息
+func (x *ExprFilterNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	ok, err := x.program.EvalBool(expr.NewEnv(msg))
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return err
+	}
+	if ok {
+		ctx.TellNext(msg, types.True)
+	} else {
+		ctx.TellNext(msg, types.False)
+	}
+	return nil
+}
+
+// Destroy 销毁
+func (x *ExprFilterNode) Destroy() {
+}
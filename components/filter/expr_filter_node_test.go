@@ -0,0 +1,84 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestExprFilterNodeOnMsg(t *testing.T) {
+	var node ExprFilterNode
+	configuration := make(types.Configuration)
+	configuration["expr"] = "temperature > 50 && metadata.deviceType == 'sensor'"
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	assert.Nil(t, err)
+
+	var relationTypes []string
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		relationTypes = append(relationTypes, relationType)
+	})
+	metaData := types.NewMetadata()
+	metaData.PutValue("deviceType", "sensor")
+	for _, data := range []string{`{"temperature":60}`, `{"temperature":40}`, `{"humidity":60}`} {
+		err = node.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, data))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []string{types.True, types.False, types.False}, relationTypes)
+
+	//求值错误
+	relationTypes = nil
+	assert.Nil(t, node.Init(config, types.Configuration{"expr": "temperature / 0 > 1"}))
+	err = node.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"temperature":60}`))
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{types.Failure}, relationTypes)
+
+	//编译错误
+	assert.NotNil(t, (&ExprFilterNode{}).Init(config, types.Configuration{"expr": "temperature >"}))
+	assert.NotNil(t, (&ExprFilterNode{}).Init(config, types.Configuration{}))
+}
+
+func BenchmarkExprFilterNode(b *testing.B) {
+	benchmarkFilterNode(b, &ExprFilterNode{}, types.Configuration{"expr": "temperature > 50 && metadata.deviceType == 'sensor'"})
+}
+
+func BenchmarkJsFilterNode(b *testing.B) {
+	benchmarkFilterNode(b, &JsFilterNode{}, types.Configuration{"jsScript": "return msg.temperature > 50 && metadata.deviceType == 'sensor';"})
+}
+
+func benchmarkFilterNode(b *testing.B, node types.Node, configuration types.Configuration) {
+	config := types.NewConfig()
+	if err := node.Init(config, configuration); err != nil {
+		b.Fatal(err)
+	}
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		if relationType != types.True {
+			b.Fatal(relationType)
+		}
+	})
+	metaData := types.NewMetadata()
+	metaData.PutValue("deviceType", "sensor")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"temperature":60,"humidity":30}`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = node.OnMsg(ctx, msg)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "exprSwitch",
+//        "name": "表达式路由",
+//        "debugMode": false,
+//        "configuration": {
+//          "cases": [
+//            {"expr": "temperature > 50", "then": "high"},
+//            {"expr": "temperature < 0", "then": "low"}
+//          ],
+//          "defaultRelation": "normal",
+//          "matchAll": false
+//        }
+//      }
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/expr"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+// DefaultRelation exprSwitch没有匹配的分支时默认的关系类型
+const DefaultRelation = "Default"
+
+func init() {
+	Registry.Add(&ExprSwitchNode{})
+}
+
+// ExprSwitchCase 路由分支
+type ExprSwitchCase struct {
+	// Expr 分支表达式，语法详见 expr 包
+	Expr string
+	// Then 表达式结果为真时，消息路由到的关系类型
+	Then string
+}
+
+// ExprSwitchNodeConfiguration 节点配置
+type ExprSwitchNodeConfiguration struct {
+	// Cases 路由分支，按顺序计算
+	Cases []ExprSwitchCase
+	// DefaultRelation 没有匹配的分支时路由到的关系类型，默认：Default
+	DefaultRelation string
+	// MatchAll 是否路由到所有匹配的分支，默认false：只路由到第一个匹配的分支
+	MatchAll bool
+}
+
+// ExprSwitchNode 按顺序计算分支表达式，把消息路由到匹配的分支。表达式在初始化时编译，不需要js引擎
+// 没有匹配的分支路由到`DefaultRelation`链，求值错误发到`Failure`链
+// 表达式变量和 ExprFilterNode 相同
+type ExprSwitchNode struct {
+	// 节点配置
+	Config   ExprSwitchNodeConfiguration
+	programs []*expr.Program
+}
+
+// Type 组件类型
+func (x *ExprSwitchNode) Type() string {
+	return "exprSwitch"
+}
+
+func (x *ExprSwitchNode) New() types.Node {
+	return &ExprSwitchNode{}
+}
+
+// Init 初始化
+func (x *ExprSwitchNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if len(x.Config.Cases) == 0 {
+		return errors.New("cases can't be empty")
+	}
+	if x.Config.DefaultRelation == "" {
+		x.Config.DefaultRelation = DefaultRelation
+	}
+	x.programs = make([]*expr.Program, 0, len(x.Config.Cases))
+	for i, item := range x.Config.Cases {
+		if item.Then == "" {
+			return fmt.Errorf("cases[%d] then can't be empty", i)
+		}
+		program, err := expr.Compile(item.Expr)
+		if err != nil {
+			return fmt.Errorf("cases[%d] expr error: %w", i, err)
+		}
+		x.programs = append(x.programs, program)
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *ExprSwitchNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	// 所有分支共用求值环境，消息只解析一次
+	env := expr.NewEnv(msg)
+	var relationTypes []string
+	for i, program := range x.programs {
+		ok, err := program.EvalBool(env)
+		if err != nil {
+			ctx.TellFailure(msg, err)
+			return err
+		}
+		if !ok {
+			continue
+		}
+		relationTypes = append(relationTypes, x.Config.Cases[i].Then)
+		if !x.Config.MatchAll {
+			break
+		}
+	}
+	if len(relationTypes) == 0 {
+		relationTypes = append(relationTypes, x.Config.DefaultRelation)
+	}
+	ctx.TellNext(msg, relationTypes...)
+	return nil
+}
+
+// Destroy 销毁
+func (x *ExprSwitchNode) Destroy() {
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestExprSwitchNodeOnMsg(t *testing.T) {
+	var node ExprSwitchNode
+	configuration := types.Configuration{
+		"cases": []interface{}{
+			map[string]interface{}{"expr": "temperature > 50", "then": "high"},
+			map[string]interface{}{"expr": "temperature > 40", "then": "warm"},
+			map[string]interface{}{"expr": "temperature < 0", "then": "low"},
+		},
+	}
+	config := types.NewConfig()
+	err := node.Init(config, configuration)
+	assert.Nil(t, err)
+
+	var relationTypes []string
+	ctx := test.NewRuleContext(config, func(msg types.RuleMsg, relationType string) {
+		relationTypes = append(relationTypes, relationType)
+	})
+	for _, data := range []string{`{"temperature":60}`, `{"temperature":45}`, `{"temperature":-1}`, `{"temperature":20}`} {
+		err = node.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), data))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []string{"high", "warm", "low", DefaultRelation}, relationTypes)
+
+	//路由到所有匹配的分支
+	configuration["matchAll"] = true
+	configuration["defaultRelation"] = "normal"
+	assert.Nil(t, node.Init(config, configuration))
+	relationTypes = nil
+	for _, data := range []string{`{"temperature":60}`, `{"temperature":20}`, `{"temperature":"x"}`} {
+		_ = node.OnMsg(ctx, types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), data))
+	}
+	assert.Equal(t, []string{"high", "warm", "normal", types.Failure}, relationTypes)
+
+	//配置错误
+	assert.NotNil(t, (&ExprSwitchNode{}).Init(config, types.Configuration{}))
+	assert.NotNil(t, (&ExprSwitchNode{}).Init(config, types.Configuration{"cases": []interface{}{map[string]interface{}{"expr": "a >", "then": "x"}}}))
+	assert.NotNil(t, (&ExprSwitchNode{}).Init(config, types.Configuration{"cases": []interface{}{map[string]interface{}{"expr": "a > 1"}}}))
+}
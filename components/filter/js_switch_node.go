@@ -92,9 +92,11 @@ func (x *JsSwitchNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 		ctx.TellFailure(msg, err)
 	} else {
 		if formatData, ok := out.([]interface{}); ok {
+			relationTypes := make([]string, 0, len(formatData))
 			for _, relationType := range formatData {
-				ctx.TellNext(msg, str.ToString(relationType))
+				relationTypes = append(relationTypes, str.ToString(relationType))
 			}
+			ctx.TellNext(msg, relationTypes...)
 		} else {
 			ctx.TellFailure(msg, errors.New("return the value is not []interface{}"))
 		}
@@ -0,0 +1,670 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "fieldMapping",
+//        "name": "字段映射",
+//        "configuration": {
+//          "mappings": [
+//            {"op": "rename", "path": "$.temp", "name": "temperature"},
+//            {"op": "cast", "path": "$.temperature", "type": "float"},
+//            {"op": "copy", "from": "metadata.deviceId", "path": "$.device.id"},
+//            {"op": "set", "path": "$.status", "value": "${metadata.status}"},
+//            {"op": "default", "path": "$.unit", "value": "C"},
+//            {"op": "delete", "path": "$.debug"}
+//          ]
+//        }
+//      }
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
+	"github.com/xyzbit/rulego/utils/expr"
+	json2 "github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/maps"
+	"github.com/xyzbit/rulego/utils/str"
+)
+
+// 字段映射操作
+const (
+	// OpSet 设置字段值，字符串值支持${}占位符
+	OpSet = "set"
+	// OpCopy 复制From字段到Path
+	OpCopy = "copy"
+	// OpMove 移动From字段到Path
+	OpMove = "move"
+	// OpDelete 删除字段
+	OpDelete = "delete"
+	// OpRename 重命名字段，新名称为Name
+	OpRename = "rename"
+	// OpCast 转换字段类型，类型为Type：string、int、float、bool、json
+	OpCast = "cast"
+	// OpDefault 字段不存在、为null或者空字符串时设置默认值
+	OpDefault = "default"
+)
+
+// 字段转换类型
+const (
+	CastString = "string"
+	CastInt    = "int"
+	CastFloat  = "float"
+	CastBool   = "bool"
+	CastJson   = "json"
+)
+
+func init() {
+	Registry.Add(&FieldMappingNode{})
+}
+
+// FieldMapping 字段映射操作
+// 字段路径使用规则表达式(utils/expr)的字段访问语法，下标必须是常量：
+// $、$.a.b[0]、$['a.b'] 或者 msg.a.b 表示消息负荷msg.Data中的字段，$和msg表示整个消息负荷
+// metadata.key、metadata['a.b'] 表示元数据中的字段
+// msgType 表示消息类型
+type FieldMapping struct {
+	// Op 操作类型：set、copy、move、delete、rename、cast、default
+	Op string
+	// Path 目标字段路径
+	Path string
+	// From 源字段路径，copy、move使用
+	From string
+	// Name 新字段名称，rename使用
+	Name string
+	// Value 字段值，set、default使用
+	Value interface{}
+	// Type 目标类型，cast使用：string、int、float、bool、json
+	Type string
+}
+
+// FieldMappingNodeConfiguration 节点配置
+type FieldMappingNodeConfiguration struct {
+	// Mappings 字段映射操作列表，按顺序执行
+	Mappings []FieldMapping
+}
+
+// FieldMappingNode 声明式字段映射转换节点，不需要js引擎
+// 对msg.Data、metadata和msgType进行设置、复制、移动、删除、重命名、类型转换和设置默认值
+// 处理成功把新的消息通过Success发送到下一个节点，否则通过Failure把原始消息发送到下一个节点
+// msg.Data被修改后，如果是字符串则DataType为TEXT，否则序列化成JSON，DataType为JSON
+type FieldMappingNode struct {
+	// 节点配置
+	Config FieldMappingNodeConfiguration
+	// 编译后的操作
+	operations []*operation
+	// 全局属性
+	global map[string]string
+}
+
+// Type 组件类型
+func (x *FieldMappingNode) Type() string {
+	return "fieldMapping"
+}
+
+func (x *FieldMappingNode) New() types.Node {
+	return &FieldMappingNode{}
+}
+
+// Init 初始化
+func (x *FieldMappingNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	x.global = ruleConfig.Properties.Values()
+	x.operations = nil
+	for i, item := range x.Config.Mappings {
+		op, err := compileOperation(item)
+		if err != nil {
+			return fmt.Errorf("mappings[%d] %w", i, err)
+		}
+		x.operations = append(x.operations, op)
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *FieldMappingNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	// 元数据在第一次修改时才复制
+	env := &fieldEnv{msg: msg, origin: msg, global: x.global}
+	err := env.run(x.operations)
+	env.release()
+	if err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		ctx.TellSuccess(env.msg)
+	}
+	return nil
+}
+
+// Destroy 销毁
+func (x *FieldMappingNode) Destroy() {
+}
+
+// fieldPath 编译后的字段路径，keys元素为string(对象字段)或者int(数组下标)
+type fieldPath struct {
+	raw   string
+	scope string
+	keys  []interface{}
+}
+
+// parseFieldPath 解析字段路径，使用规则表达式的字段访问语法
+func parseFieldPath(path string) (*fieldPath, error) {
+	p, err := expr.ParsePath(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid path=%s err:%w", path, err)
+	}
+	if p.Scope == types.MetadataKey {
+		if len(p.Keys) != 1 {
+			return nil, fmt.Errorf("invalid path=%s, metadata only support one level key", path)
+		}
+		if _, ok := p.Keys[0].(string); !ok {
+			return nil, fmt.Errorf("invalid path=%s, metadata key must be string", path)
+		}
+	}
+	return &fieldPath{raw: path, scope: p.Scope, keys: p.Keys}, nil
+}
+
+// parent 父路径
+func (p *fieldPath) parent() *fieldPath {
+	return &fieldPath{raw: p.raw, scope: p.scope, keys: p.keys[:len(p.keys)-1]}
+}
+
+// child 子路径
+func (p *fieldPath) child(key interface{}) *fieldPath {
+	keys := make([]interface{}, 0, len(p.keys)+1)
+	keys = append(keys, p.keys...)
+	return &fieldPath{raw: p.raw, scope: p.scope, keys: append(keys, key)}
+}
+
+// operation 编译后的操作
+type operation struct {
+	op       string
+	path     *fieldPath
+	from     *fieldPath
+	value    interface{}
+	template *el.Template
+	castType string
+}
+
+func compileOperation(mapping FieldMapping) (*operation, error) {
+	op := &operation{op: strings.ToLower(mapping.Op), value: compileValue(mapping.Value)}
+	path, err := parseFieldPath(mapping.Path)
+	if err != nil {
+		return nil, err
+	}
+	op.path = path
+	switch op.op {
+	case OpSet, OpDefault:
+		if v, ok := mapping.Value.(string); ok && strings.Contains(v, "${") {
+			if op.template, err = el.Compile(v); err != nil {
+				return nil, err
+			}
+		}
+	case OpCopy, OpMove:
+		if op.from, err = parseFieldPath(mapping.From); err != nil {
+			return nil, err
+		}
+		if op.op == OpMove && op.from.scope == types.MsgTypeKey {
+			return nil, errors.New("can't move msgType")
+		}
+	case OpDelete:
+		if path.scope == types.MsgTypeKey {
+			return nil, errors.New("can't delete msgType")
+		}
+	case OpRename:
+		if mapping.Name == "" {
+			return nil, errors.New("rename name can't be empty")
+		}
+		if len(path.keys) == 0 {
+			return nil, fmt.Errorf("can't rename path=%s", path.raw)
+		}
+		// 重命名转换成移动到父路径下的新字段
+		op.from = path
+		op.path = path.parent().child(mapping.Name)
+	case OpCast:
+		switch op.castType = strings.ToLower(mapping.Type); op.castType {
+		case CastString, CastInt, CastFloat, CastBool, CastJson:
+		default:
+			return nil, fmt.Errorf("unsupported cast type=%s", mapping.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported op=%s", mapping.Op)
+	}
+	return op, nil
+}
+
+// compileValue 配置中的数字转换成json.Number，和解析消息负荷得到的数字一致，避免每次序列化时反射
+func compileValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = compileValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = compileValue(item)
+		}
+		return s
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		if data, err := json.Marshal(v); err == nil {
+			return json.Number(data)
+		}
+	}
+	return value
+}
+
+func (op *operation) execute(env *fieldEnv) error {
+	switch op.op {
+	case OpSet:
+		return env.set(op.path, op.resolveValue(env))
+	case OpDefault:
+		v, ok, err := env.get(op.path)
+		if err != nil {
+			return err
+		}
+		if !ok || v == nil || v == "" {
+			return env.set(op.path, op.resolveValue(env))
+		}
+	case OpCopy:
+		v, ok, err := env.get(op.from)
+		if err != nil || !ok {
+			return err
+		}
+		return env.set(op.path, cloneValue(v))
+	case OpMove, OpRename:
+		v, ok, err := env.get(op.from)
+		if err != nil || !ok {
+			return err
+		}
+		if err := env.delete(op.from); err != nil {
+			return err
+		}
+		return env.set(op.path, v)
+	case OpDelete:
+		return env.delete(op.path)
+	case OpCast:
+		v, ok, err := env.get(op.path)
+		if err != nil || !ok {
+			return err
+		}
+		if v, err = castValue(v, op.castType); err != nil {
+			return fmt.Errorf("cast path=%s err:%w", op.path.raw, err)
+		}
+		return env.set(op.path, v)
+	}
+	return nil
+}
+
+// resolveValue 获取设置的值，字符串占位符使用原始消息替换
+func (op *operation) resolveValue(env *fieldEnv) interface{} {
+	if op.template != nil {
+		return op.template.ExecuteMsg(env.origin, env.global)
+	}
+	return cloneValue(op.value)
+}
+
+// fieldEnv 操作执行环境，msg.Data按需解析，所有操作执行结束后统一序列化
+type fieldEnv struct {
+	msg     types.RuleMsg
+	origin  types.RuleMsg
+	global  map[string]string
+	data    interface{}
+	parsed  bool
+	changed bool
+	// 元数据是否已经复制
+	metadataCopied bool
+	// 从objectPool获取的顶层对象
+	object map[string]interface{}
+}
+
+// maxPooledFields 字段数量不超过时回收顶层对象的map，避免大map一直占用内存
+const maxPooledFields = 64
+
+// objectPool 复用解析消息负荷顶层对象的map
+var objectPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]interface{})
+	},
+}
+
+// run 按顺序执行操作，然后把修改后的数据写回消息
+func (env *fieldEnv) run(operations []*operation) error {
+	for _, op := range operations {
+		if err := op.execute(env); err != nil {
+			return err
+		}
+	}
+	return env.flush()
+}
+
+// release 回收解析消息负荷使用的map，写回消息后不再引用
+func (env *fieldEnv) release() {
+	if env.object != nil && len(env.object) <= maxPooledFields {
+		for k := range env.object {
+			delete(env.object, k)
+		}
+		objectPool.Put(env.object)
+	}
+	env.object = nil
+	env.data = nil
+}
+
+// metadata 返回可以修改的元数据，避免修改原始消息的元数据
+func (env *fieldEnv) metadata() *types.Metadata {
+	if !env.metadataCopied {
+		env.metadataCopied = true
+		env.msg.Metadata = env.origin.Metadata.Copy()
+	}
+	return &env.msg.Metadata
+}
+
+func (env *fieldEnv) loadData() error {
+	if env.parsed {
+		return nil
+	}
+	env.parsed = true
+	if env.msg.Data == "" {
+		return nil
+	}
+	if env.msg.DataType != types.JSON {
+		// 非JSON消息负荷作为字符串处理
+		env.data = env.msg.Data
+		return nil
+	}
+	// 顶层对象解析到复用的map中，执行结束后回收
+	env.object = objectPool.Get().(map[string]interface{})
+	data, err := json2.UnmarshalValueTo(env.msg.Data, env.object)
+	if err != nil {
+		return fmt.Errorf("msg data is not json:%w", err)
+	}
+	env.data = data
+	return nil
+}
+
+func (env *fieldEnv) get(p *fieldPath) (interface{}, bool, error) {
+	switch p.scope {
+	case types.MsgTypeKey:
+		return env.msg.Type, true, nil
+	case types.MetadataKey:
+		key := p.keys[0].(string)
+		return env.msg.Metadata.GetValue(key), env.msg.Metadata.Has(key), nil
+	}
+	if err := env.loadData(); err != nil {
+		return nil, false, err
+	}
+	v, ok := getValue(env.data, p.keys)
+	return v, ok, nil
+}
+
+func (env *fieldEnv) set(p *fieldPath, value interface{}) error {
+	switch p.scope {
+	case types.MsgTypeKey:
+		env.msg.Type = toString(value)
+		return nil
+	case types.MetadataKey:
+		env.metadata().PutValue(p.keys[0].(string), toString(value))
+		return nil
+	}
+	if len(p.keys) == 0 {
+		// 替换整个消息负荷，不需要解析原数据
+		env.parsed = true
+	} else if err := env.loadData(); err != nil {
+		return err
+	}
+	data, err := setValue(env.data, p.keys, value)
+	if err != nil {
+		return fmt.Errorf("set path=%s err:%w", p.raw, err)
+	}
+	env.data = data
+	env.changed = true
+	return nil
+}
+
+func (env *fieldEnv) delete(p *fieldPath) error {
+	if p.scope == types.MetadataKey {
+		env.metadata().Delete(p.keys[0].(string))
+		return nil
+	}
+	if err := env.loadData(); err != nil {
+		return err
+	}
+	env.data = deleteValue(env.data, p.keys)
+	env.changed = true
+	return nil
+}
+
+// flush 把修改后的数据写回消息
+func (env *fieldEnv) flush() error {
+	if !env.changed {
+		return nil
+	}
+	switch v := env.data.(type) {
+	case nil:
+		env.msg.Data = ""
+	case string:
+		env.msg.Data = v
+		env.msg.DataType = types.TEXT
+	default:
+		data, err := json2.MarshalValue(v)
+		if err != nil {
+			return err
+		}
+		env.msg.Data = data
+		env.msg.DataType = types.JSON
+	}
+	return nil
+}
+
+func getValue(node interface{}, keys []interface{}) (interface{}, bool) {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			m, ok := node.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if node, ok = m[k]; !ok {
+				return nil, false
+			}
+		case int:
+			s, ok := node.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			if k < 0 {
+				k += len(s)
+			}
+			if k < 0 || k >= len(s) {
+				return nil, false
+			}
+			node = s[k]
+		}
+	}
+	return node, true
+}
+
+// setValue 设置值，自动创建不存在的对象，数组下标等于数组长度时追加元素
+func setValue(node interface{}, keys []interface{}, value interface{}) (interface{}, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	switch k := keys[0].(type) {
+	case string:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			if node != nil {
+				return nil, fmt.Errorf("field %s parent is not an object", k)
+			}
+			m = make(map[string]interface{})
+		}
+		child, err := setValue(m[k], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = child
+		return m, nil
+	case int:
+		s, ok := node.([]interface{})
+		if !ok && node != nil {
+			return nil, fmt.Errorf("index %d parent is not an array", k)
+		}
+		if k < 0 {
+			k += len(s)
+		}
+		if k == len(s) {
+			s = append(s, nil)
+		}
+		if k < 0 || k >= len(s) {
+			return nil, fmt.Errorf("index %d out of range", keys[0])
+		}
+		child, err := setValue(s[k], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		s[k] = child
+		return s, nil
+	}
+	return node, nil
+}
+
+// deleteValue 删除值，字段不存在则忽略
+func deleteValue(node interface{}, keys []interface{}) interface{} {
+	if len(keys) == 0 {
+		return nil
+	}
+	switch k := keys[0].(type) {
+	case string:
+		if m, ok := node.(map[string]interface{}); ok {
+			if len(keys) == 1 {
+				delete(m, k)
+			} else if child, ok := m[k]; ok {
+				m[k] = deleteValue(child, keys[1:])
+			}
+		}
+	case int:
+		if s, ok := node.([]interface{}); ok {
+			if k < 0 {
+				k += len(s)
+			}
+			if k < 0 || k >= len(s) {
+				return node
+			}
+			if len(keys) == 1 {
+				return append(s[:k], s[k+1:]...)
+			}
+			s[k] = deleteValue(s[k], keys[1:])
+		}
+	}
+	return node
+}
+
+// cloneValue 深复制对象和数组，避免复制后修改相互影响
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = cloneValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = cloneValue(item)
+		}
+		return s
+	}
+	return value
+}
+
+// toString 转换成字符串，对象和数组序列化成JSON
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		if data, err := json2.MarshalValue(v); err == nil {
+			return data
+		}
+	}
+	return str.ToString(value)
+}
+
+func castValue(value interface{}, castType string) (interface{}, error) {
+	switch castType {
+	case CastString:
+		return toString(value), nil
+	case CastInt:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return 1, nil
+			}
+			return 0, nil
+		case float64:
+			return int64(v), nil
+		}
+		s := strings.TrimSpace(toString(value))
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int64(f), nil
+	case CastFloat:
+		switch v := value.(type) {
+		case bool:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		case float64:
+			return v, nil
+		}
+		return strconv.ParseFloat(strings.TrimSpace(toString(value)), 64)
+	case CastBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case json.Number:
+			f, err := v.Float64()
+			return f != 0, err
+		case float64:
+			return v != 0, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(toString(value)))
+	case CastJson:
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		return json2.UnmarshalValue(s)
+	}
+	return value, nil
+}
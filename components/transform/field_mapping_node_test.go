@@ -0,0 +1,175 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func newFieldMappingNode(t testing.TB, mappings ...map[string]interface{}) *FieldMappingNode {
+	var items []interface{}
+	for _, item := range mappings {
+		items = append(items, item)
+	}
+	var node FieldMappingNode
+	if err := node.Init(types.NewConfig(), types.Configuration{"mappings": items}); err != nil {
+		t.Fatal(err)
+	}
+	return &node
+}
+
+func TestFieldMappingNodeOnMsg(t *testing.T) {
+	node := newFieldMappingNode(t,
+		map[string]interface{}{"op": "rename", "path": "$.temp", "name": "temperature"},
+		map[string]interface{}{"op": "cast", "path": "$.temperature", "type": "float"},
+		map[string]interface{}{"op": "cast", "path": "$.count", "type": "int"},
+		map[string]interface{}{"op": "copy", "from": "metadata.deviceId", "path": "$.device.id"},
+		map[string]interface{}{"op": "move", "from": "$.tags[0]", "path": "metadata.tag"},
+		map[string]interface{}{"op": "set", "path": "$['a.b']", "value": "${metadata.deviceId}-${msg.count}"},
+		map[string]interface{}{"op": "set", "path": "$.items[1]", "value": 2},
+		map[string]interface{}{"op": "default", "path": "$.unit", "value": "C"},
+		map[string]interface{}{"op": "default", "path": "$.name", "value": "default"},
+		map[string]interface{}{"op": "delete", "path": "$.debug"},
+		map[string]interface{}{"op": "delete", "path": "metadata.secret"},
+		map[string]interface{}{"op": "copy", "from": "$.device", "path": "metadata.device"},
+		map[string]interface{}{"op": "set", "path": "msgType", "value": "TELEMETRY"},
+	)
+	metadata := types.NewMetadata()
+	metadata.PutValue("deviceId", "d01")
+	metadata.PutValue("secret", "xx")
+	data := `{"temp":"35.5","count":"12","tags":["t1","t2"],"items":[1],"name":"n1","debug":true,"big":12345678901234567}`
+	msg := types.NewMsg(0, "TEST", types.JSON, metadata, data)
+	var result types.RuleMsg
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		assert.Equal(t, types.Success, relationType)
+		result = msg
+	})
+	assert.Nil(t, node.OnMsg(ctx, msg))
+
+	assert.Equal(t, `{"a.b":"d01-12","big":12345678901234567,"count":12,"device":{"id":"d01"},"items":[1,2],"name":"n1","tags":["t2"],"temperature":35.5,"unit":"C"}`, result.Data)
+	assert.Equal(t, types.JSON, result.DataType)
+	assert.Equal(t, "TELEMETRY", result.Type)
+	assert.Equal(t, "t1", result.Metadata.GetValue("tag"))
+	assert.Equal(t, `{"id":"d01"}`, result.Metadata.GetValue("device"))
+	assert.False(t, result.Metadata.Has("secret"))
+	// 原始消息不修改
+	assert.Equal(t, data, msg.Data)
+	assert.True(t, msg.Metadata.Has("secret"))
+}
+
+func TestFieldMappingNodeDataType(t *testing.T) {
+	// 整个消息负荷替换成字符串
+	node := newFieldMappingNode(t, map[string]interface{}{"op": "copy", "from": "$.name", "path": "$"})
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "n1", msg.Data)
+		assert.Equal(t, types.TEXT, msg.DataType)
+	})
+	assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"name":"n1"}`)))
+
+	// 文本消息负荷解析成JSON
+	node = newFieldMappingNode(t, map[string]interface{}{"op": "cast", "path": "$", "type": "json"})
+	ctx = test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, `{"a":1}`, msg.Data)
+		assert.Equal(t, types.JSON, msg.DataType)
+	})
+	assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), `{"a":1}`)))
+
+	// 转换失败
+	node = newFieldMappingNode(t, map[string]interface{}{"op": "cast", "path": "$.a", "type": "int"})
+	ctx = test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, `{"a":"x"}`, msg.Data)
+	})
+	assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"a":"x"}`)))
+}
+
+func TestFieldMappingNodeReuseObject(t *testing.T) {
+	// 解析消息负荷的map被回收复用，不能残留上一条消息的字段
+	node := newFieldMappingNode(t,
+		map[string]interface{}{"op": "set", "path": "$.aa", "value": 66},
+		map[string]interface{}{"op": "move", "from": "$.tags[-1]", "path": "metadata.tag"},
+	)
+	var results []types.RuleMsg
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		results = append(results, msg)
+	})
+	for _, data := range []string{`{"a":1,"tags":["t1","t2"]}`, `{"a":1`, `{"b":2}`} {
+		assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), data)))
+	}
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, `{"a":1,"aa":66,"tags":["t1"]}`, results[0].Data)
+	assert.Equal(t, "t2", results[0].Metadata.GetValue("tag"))
+	assert.Equal(t, `{"a":1`, results[1].Data)
+	assert.Equal(t, `{"aa":66,"b":2}`, results[2].Data)
+	assert.False(t, results[2].Metadata.Has("tag"))
+}
+
+func TestFieldMappingNodeInit(t *testing.T) {
+	for _, item := range []map[string]interface{}{
+		{"op": "unknown", "path": "$.a"},
+		{"op": "set", "path": "a.b"},
+		{"op": "set", "path": "$.a["},
+		{"op": "set", "path": "metadata.a.b"},
+		{"op": "delete", "path": "msgType"},
+		{"op": "rename", "path": "$.a"},
+		{"op": "cast", "path": "$.a", "type": "date"},
+		{"op": "copy", "path": "$.a", "from": "b"},
+	} {
+		var node FieldMappingNode
+		err := node.Init(types.NewConfig(), types.Configuration{"mappings": []interface{}{item}})
+		assert.NotNil(t, err)
+	}
+}
+
+func BenchmarkFieldMappingNode(b *testing.B) {
+	node := newFieldMappingNode(b,
+		map[string]interface{}{"op": "set", "path": "metadata.test", "value": "test02"},
+		map[string]interface{}{"op": "set", "path": "metadata.index", "value": 50},
+		map[string]interface{}{"op": "set", "path": "msgType", "value": "TEST_MSG_TYPE_MODIFY"},
+		map[string]interface{}{"op": "set", "path": "$.aa", "value": 66},
+	)
+	benchmarkTransformNode(b, node)
+}
+
+func BenchmarkJsTransformNode(b *testing.B) {
+	var node JsTransformNode
+	err := node.Init(types.NewConfig(), types.Configuration{
+		"jsScript": "metadata['test']='test02';\n metadata['index']=50;\n msgType='TEST_MSG_TYPE_MODIFY';\n  msg['aa']=66;\n return {'msg':msg,'metadata':metadata,'msgType':msgType};",
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkTransformNode(b, &node)
+}
+
+func benchmarkTransformNode(b *testing.B, node types.Node) {
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string) {
+	})
+	metadata := types.NewMetadata()
+	metadata.PutValue("productType", "test01")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metadata, "{\"temperature\":35}")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = node.OnMsg(ctx, msg)
+	}
+}
@@ -0,0 +1,318 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "templateTransform",
+//        "name": "生成告警邮件",
+//        "configuration": {
+//          "template": "设备{{.metadata.deviceId}}温度{{.msg.temperature}}，{{date \"2006-01-02 15:04:05\"}}",
+//          "dataType": "TEXT"
+//        }
+//      }
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	json2 "github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/maps"
+	"github.com/xyzbit/rulego/utils/str"
+)
+
+func init() {
+	Registry.Add(&TemplateTransformNode{})
+}
+
+// TemplateTransformNodeConfiguration 节点配置
+type TemplateTransformNodeConfiguration struct {
+	// Template Go text/template 模板内容，渲染结果作为新消息的msg.Data
+	// 模板数据：
+	// .msg msg.Data，JSON数据类型解析成对象，否则为字符串
+	// .metadata 元数据
+	// .msgType 消息类型
+	// .global 全局属性
+	// 可用函数：json、toUpper、toLower、trim、default、date、now、int、float、add、sub、mul、div、mod、round
+	Template string
+	// DataType 输出消息数据类型：JSON、TEXT、BINARY，默认TEXT
+	DataType string
+}
+
+// TemplateTransformNode 使用Go text/template 渲染新的消息负荷
+// 渲染成功通过Success把新消息发送到下一个节点，否则通过Failure把原始消息发送到下一个节点
+type TemplateTransformNode struct {
+	// 节点配置
+	Config   TemplateTransformNodeConfiguration
+	template *template.Template
+	dataType types.DataType
+	// 全局属性
+	global map[string]string
+}
+
+// Type 组件类型
+func (x *TemplateTransformNode) Type() string {
+	return "templateTransform"
+}
+
+func (x *TemplateTransformNode) New() types.Node {
+	return &TemplateTransformNode{}
+}
+
+// Init 初始化
+func (x *TemplateTransformNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	switch dataType := types.DataType(strings.ToUpper(x.Config.DataType)); dataType {
+	case "":
+		x.dataType = types.TEXT
+	case types.JSON, types.TEXT, types.BINARY:
+		x.dataType = dataType
+	default:
+		return fmt.Errorf("unsupported dataType=%s", x.Config.DataType)
+	}
+	// 元数据中不存在的字段渲染成空字符串
+	x.template, err = template.New(x.Type()).Option("missingkey=zero").Funcs(templateFuncs).Parse(x.Config.Template)
+	if err != nil {
+		return err
+	}
+	// 对象中不存在的字段渲染成空字符串
+	for _, t := range x.template.Templates() {
+		if t.Tree != nil {
+			wrapActions(t.Tree, t.Tree.Root)
+		}
+	}
+	x.global = ruleConfig.Properties.Values()
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *TemplateTransformNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	var data interface{} = msg.Data
+	if msg.DataType == types.JSON && msg.Data != "" {
+		if v, err := json2.UnmarshalValue(msg.Data); err == nil {
+			data = v
+		}
+	}
+	var buf bytes.Buffer
+	err := x.template.Execute(&buf, map[string]interface{}{
+		types.MsgKey:      data,
+		types.MetadataKey: msg.Metadata.Values(),
+		types.MsgTypeKey:  msg.Type,
+		"global":          x.global,
+	})
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return nil
+	}
+	newMsg := msg.Copy()
+	newMsg.Data = buf.String()
+	newMsg.DataType = x.dataType
+	ctx.TellSuccess(newMsg)
+	return nil
+}
+
+// Destroy 销毁
+func (x *TemplateTransformNode) Destroy() {
+}
+
+// orEmptyFunc 不存在的值转换成空字符串的函数名
+const orEmptyFunc = "orEmpty"
+
+// wrapActions 在输出动作的管道末尾增加orEmpty函数
+// text/template 输出nil值时为"<no value>"，通过orEmpty转换成空字符串，不影响数据中的同名内容
+func wrapActions(tree *parse.Tree, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	for _, item := range list.Nodes {
+		switch n := item.(type) {
+		case *parse.ActionNode:
+			// 变量声明不输出内容
+			if len(n.Pipe.Decl) == 0 {
+				n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Pos:      n.Pos,
+					Args:     []parse.Node{parse.NewIdentifier(orEmptyFunc).SetTree(tree).SetPos(n.Pos)},
+				})
+			}
+		case *parse.IfNode:
+			wrapActions(tree, n.List)
+			wrapActions(tree, n.ElseList)
+		case *parse.RangeNode:
+			wrapActions(tree, n.List)
+			wrapActions(tree, n.ElseList)
+		case *parse.WithNode:
+			wrapActions(tree, n.List)
+			wrapActions(tree, n.ElseList)
+		}
+	}
+}
+
+// templateFuncs 模板可用函数，只包含无副作用的函数
+var templateFuncs = template.FuncMap{
+	// orEmpty 值不存在时输出空字符串，自动追加到每个输出动作
+	orEmptyFunc: func(v interface{}) interface{} {
+		if v == nil {
+			return ""
+		}
+		return v
+	},
+	// json 序列化成JSON字符串
+	"json": func(v interface{}) (string, error) {
+		return json2.MarshalValue(v)
+	},
+	"toUpper": strings.ToUpper,
+	"toLower": strings.ToLower,
+	"trim":    strings.TrimSpace,
+	// default 值为空时使用默认值，用法：{{.msg.name | default "unknown"}}
+	"default": func(defaultValue interface{}, v ...interface{}) interface{} {
+		if len(v) == 0 || isEmptyValue(v[0]) {
+			return defaultValue
+		}
+		return v[0]
+	},
+	// date 格式化时间，用法：{{date "2006-01-02"}} 当前时间，{{date "2006-01-02" .msg.ts}}
+	// 时间可以是time.Time、毫秒时间戳或者RFC3339格式字符串
+	"date": func(layout string, v ...interface{}) (string, error) {
+		if len(v) == 0 {
+			return time.Now().Format(layout), nil
+		}
+		t, err := toTime(v[0])
+		if err != nil {
+			return "", err
+		}
+		return t.Format(layout), nil
+	},
+	// now 当前时间
+	"now": time.Now,
+	// int 转换成整数
+	"int": func(v interface{}) (int64, error) {
+		f, err := toFloat(v)
+		return int64(f), err
+	},
+	// float 转换成浮点数
+	"float": toFloat,
+	"add": func(a, b interface{}) (float64, error) {
+		return mathOp(a, b, func(x, y float64) (float64, error) { return x + y, nil })
+	},
+	"sub": func(a, b interface{}) (float64, error) {
+		return mathOp(a, b, func(x, y float64) (float64, error) { return x - y, nil })
+	},
+	"mul": func(a, b interface{}) (float64, error) {
+		return mathOp(a, b, func(x, y float64) (float64, error) { return x * y, nil })
+	},
+	"div": func(a, b interface{}) (float64, error) {
+		return mathOp(a, b, func(x, y float64) (float64, error) {
+			if y == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return x / y, nil
+		})
+	},
+	"mod": func(a, b interface{}) (float64, error) {
+		return mathOp(a, b, func(x, y float64) (float64, error) {
+			if y == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return math.Mod(x, y), nil
+		})
+	},
+	// round 保留指定位数小数，用法：{{round .msg.temperature 1}}
+	"round": func(v interface{}, places int) (float64, error) {
+		f, err := toFloat(v)
+		if err != nil {
+			return 0, err
+		}
+		p := math.Pow(10, float64(places))
+		return math.Round(f*p) / p, nil
+	},
+}
+
+func mathOp(a, b interface{}, op func(x, y float64) (float64, error)) (float64, error) {
+	x, err := toFloat(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toFloat(b)
+	if err != nil {
+		return 0, err
+	}
+	return op(x, y)
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case json.Number:
+		return n.Float64()
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	case nil:
+		return 0, nil
+	}
+	return strconv.ParseFloat(strings.TrimSpace(str.ToString(v)), 64)
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		if _, err := strconv.ParseFloat(t, 64); err != nil {
+			return time.Parse(time.RFC3339, t)
+		}
+	}
+	ms, err := toFloat(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case map[string]interface{}:
+		return len(t) == 0
+	case []interface{}:
+		return len(t) == 0
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestTemplateTransformNodeOnMsg(t *testing.T) {
+	var node TemplateTransformNode
+	config := types.NewConfig()
+	config.Properties.PutValue("site", "s01")
+	err := node.Init(config, types.Configuration{
+		"template": `{"device":{{json .metadata.deviceId}},"site":"{{.global.site}}","type":"{{toLower .msgType}}",` +
+			`"temperature":{{round (mul .msg.temperature 1.8 | add 32) 1}},"name":{{.msg.name | default "unknown" | toUpper | json}},` +
+			`"tags":{{json .msg.tags}},"year":"{{date "2006" .msg.ts}}","missing":"{{.msg.notFound}}"}`,
+		"dataType": "json",
+	})
+	assert.Nil(t, err)
+	metadata := types.NewMetadata()
+	metadata.PutValue("deviceId", "d\"01")
+	msg := types.NewMsg(0, "TELEMETRY", types.JSON, metadata, `{"temperature":36.55,"tags":["a","b"],"ts":1700000000000}`)
+	var count int
+	ctx := test.NewRuleContext(config, func(newMsg types.RuleMsg, relationType string) {
+		count++
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, types.JSON, newMsg.DataType)
+		assert.Equal(t, `{"device":"d\"01","site":"s01","type":"telemetry","temperature":97.8,"name":"UNKNOWN",`+
+			`"tags":["a","b"],"year":"2023","missing":""}`, newMsg.Data)
+		assert.Equal(t, "d\"01", newMsg.Metadata.GetValue("deviceId"))
+	})
+	assert.Nil(t, node.OnMsg(ctx, msg))
+	assert.Equal(t, 1, count)
+}
+
+func TestTemplateTransformNodeText(t *testing.T) {
+	var node TemplateTransformNode
+	err := node.Init(types.NewConfig(), types.Configuration{
+		"template": `{{if gt (float .msg) 30.0}}high:{{.msg}}{{else}}normal{{end}}`,
+	})
+	assert.Nil(t, err)
+	ctx := test.NewRuleContext(types.NewConfig(), func(newMsg types.RuleMsg, relationType string) {
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, types.TEXT, newMsg.DataType)
+		assert.Equal(t, "high:35", newMsg.Data)
+	})
+	assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "35")))
+
+	// 渲染失败
+	err = node.Init(types.NewConfig(), types.Configuration{"template": `{{div .msg.a 0}}`})
+	assert.Nil(t, err)
+	ctx = test.NewRuleContext(types.NewConfig(), func(newMsg types.RuleMsg, relationType string) {
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, `{"a":1}`, newMsg.Data)
+	})
+	assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"a":1}`)))
+
+	// 配置错误
+	assert.NotNil(t, node.Init(types.NewConfig(), types.Configuration{"template": `{{.msg`}))
+	assert.NotNil(t, node.Init(types.NewConfig(), types.Configuration{"template": `{{exec "ls"}}`}))
+	assert.NotNil(t, node.Init(types.NewConfig(), types.Configuration{"template": `ok`, "dataType": "XML"}))
+}
+
+func TestTemplateTransformNodeMissingKey(t *testing.T) {
+	var node TemplateTransformNode
+	err := node.Init(types.NewConfig(), types.Configuration{
+		"template": `{{define "item"}}[{{.name}}{{.notFound}}]{{end}}{{.msg.text}}|{{.msg.notFound}}|` +
+			`{{if .msg.items}}{{range .msg.items}}{{template "item" .}}{{.notFound}}{{end}}{{end}}|{{with .msg.text}}{{$.msg.notFound}}{{end}}`,
+	})
+	assert.Nil(t, err)
+	var count int
+	ctx := test.NewRuleContext(types.NewConfig(), func(newMsg types.RuleMsg, relationType string) {
+		count++
+		assert.Equal(t, types.Success, relationType)
+		// 数据中的"<no value>"原样输出，不存在的字段输出空字符串
+		assert.Equal(t, "a <no value> b||[x]|", newMsg.Data)
+	})
+	assert.Nil(t, node.OnMsg(ctx, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"text":"a <no value> b","items":[{"name":"x"}]}`)))
+	assert.Equal(t, 1, count)
+}
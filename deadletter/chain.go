@@ -0,0 +1,74 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// 转发死信时，添加到消息元数据的key
+const (
+	KeyDeadLetterId      = "deadLetterId"
+	KeyDeadLetterChainId = "deadLetterChainId"
+	KeyDeadLetterNodeId  = "deadLetterNodeId"
+	KeyDeadLetterError   = "deadLetterError"
+	KeyDeadLetterTs      = "deadLetterTs"
+)
+
+var _ types.DeadLetterHandler = (*ChainHandler)(nil)
+
+// ChainHandler 把死信转发到另外一条规则链处理
+// 死信的规则链ID、节点ID、错误信息和时间通过消息元数据传递
+type ChainHandler struct {
+	// 处理死信的规则链ID
+	ChainId string
+	// 规则链池，为nil使用rulego.DefaultRuleGo
+	Pool *rulego.RuleGo
+}
+
+// NewChainHandler 创建转发死信的处理器
+func NewChainHandler(chainId string, pool *rulego.RuleGo) *ChainHandler {
+	return &ChainHandler{ChainId: chainId, Pool: pool}
+}
+
+// Handle 转发死信
+func (h *ChainHandler) Handle(letter types.DeadLetter) error {
+	if letter.ChainId == h.ChainId {
+		// 避免死信处理链执行失败时，无限循环
+		return fmt.Errorf("dead letter chain id:%s can not forward to itself", h.ChainId)
+	}
+	pool := h.Pool
+	if pool == nil {
+		pool = rulego.DefaultRuleGo
+	}
+	ruleEngine, ok := pool.Get(h.ChainId)
+	if !ok {
+		return fmt.Errorf("dead letter chain id:%s not found", h.ChainId)
+	}
+	msg := letter.Msg.Copy()
+	msg.Metadata.PutValue(KeyDeadLetterId, letter.Id)
+	msg.Metadata.PutValue(KeyDeadLetterChainId, letter.ChainId)
+	msg.Metadata.PutValue(KeyDeadLetterNodeId, letter.NodeId)
+	msg.Metadata.PutValue(KeyDeadLetterError, letter.Error)
+	msg.Metadata.PutValue(KeyDeadLetterTs, strconv.FormatInt(letter.Ts, 10))
+	ruleEngine.OnMsg(msg)
+	return nil
+}
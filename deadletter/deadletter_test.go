@@ -0,0 +1,205 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var failRuleChain = `
+	{
+	  "ruleChain": {
+		"id": "deadLetterChain",
+		"name": "死信测试规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "metadata['step']='s1';return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "if (metadata['fail']==='true') {throw 'fail';} metadata['step']='s2';return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Success"
+		  }
+		]
+	  }
+	}
+`
+
+var forwardRuleChain = `
+	{
+	  "ruleChain": {
+		"name": "死信处理规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsFilter",
+			"configuration": {
+			  "jsScript": "return true;"
+			}
+		  }
+		]
+	  }
+	}
+`
+
+func newMsg(fail string) types.RuleMsg {
+	metaData := types.NewMetadata()
+	metaData.PutValue("fail", fail)
+	return types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, "{\"temperature\":41}")
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(2)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, store.Handle(types.NewDeadLetter("c1", "s1", newMsg("true"), errors.New("fail"))))
+	}
+	letters, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(letters))
+
+	letter, ok := store.Get(letters[0].Id)
+	assert.True(t, ok)
+	assert.Equal(t, "fail", letter.Error)
+	assert.Nil(t, store.Delete(letter.Id))
+	assert.Equal(t, ErrNotFound, store.Delete(letter.Id))
+	_, ok = store.Get(letter.Id)
+	assert.False(t, ok)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letter.log")
+	store, err := NewFileStore(path)
+	assert.Nil(t, err)
+	first := types.NewDeadLetter("c1", "s1", newMsg("true"), errors.New("fail"))
+	second := types.NewDeadLetter("c1", "s2", newMsg("true"), errors.New("fail"))
+	assert.Nil(t, store.Handle(first))
+	assert.Nil(t, store.Handle(second))
+	assert.Nil(t, store.Delete(first.Id))
+	assert.Nil(t, store.Close())
+
+	//重新打开文件，恢复未删除的死信
+	store, err = NewFileStore(path)
+	assert.Nil(t, err)
+	defer store.Close()
+	letters, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(letters))
+	assert.Equal(t, second.Id, letters[0].Id)
+	assert.Equal(t, "s2", letters[0].NodeId)
+	assert.Equal(t, "true", letters[0].Msg.Metadata.GetValue("fail"))
+	assert.Equal(t, second.Msg.Data, letters[0].Msg.Data)
+}
+
+func TestReplay(t *testing.T) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var steps []string
+	config := rulego.NewConfig(types.WithOnEnd(func(msg types.RuleMsg, err error) {
+		lock.Lock()
+		steps = append(steps, msg.Metadata.GetValue("step"))
+		lock.Unlock()
+		wg.Done()
+	}))
+	pool := &rulego.RuleGo{}
+	store := NewMemoryStore(10)
+	ruleEngine, err := pool.New("", []byte(failRuleChain), rulego.WithConfig(config), rulego.WithDeadLetterHandler(store))
+	assert.Nil(t, err)
+	defer pool.Stop()
+
+	//等待规则链执行结束后再修改节点
+	wg.Add(2)
+	ruleEngine.OnMsgAndWait(newMsg("true"))
+	ruleEngine.OnMsgAndWait(newMsg("false"))
+	wg.Wait()
+
+	letters, _ := store.List()
+	assert.Equal(t, 1, len(letters))
+	assert.Equal(t, "deadLetterChain", letters[0].ChainId)
+	assert.Equal(t, "s2", letters[0].NodeId)
+	assert.Equal(t, "s1", letters[0].Msg.Metadata.GetValue("step"))
+
+	//修复节点后重放，从s2节点开始执行
+	assert.Nil(t, ruleEngine.ReloadChild("s2", []byte(`{"id":"s2","type":"jsTransform","configuration":{"jsScript":"metadata['step']='fixed';return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}`)))
+	wg.Add(1)
+	count, err := Replay(store, pool)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	wg.Wait()
+	lock.Lock()
+	assert.Equal(t, "fixed", steps[len(steps)-1])
+	lock.Unlock()
+	letters, _ = store.List()
+	assert.Equal(t, 0, len(letters))
+
+	_, err = Replay(store, pool, "notFound")
+	assert.NotNil(t, err)
+	assert.NotNil(t, ruleEngine.OnMsgFromNode("notFound", newMsg("false")))
+}
+
+func TestChainHandler(t *testing.T) {
+	pool := &rulego.RuleGo{}
+	defer pool.Stop()
+	received := make(chan types.RuleMsg, 1)
+	config := rulego.NewConfig(types.WithOnEnd(func(msg types.RuleMsg, err error) {
+		received <- msg
+	}))
+	_, err := pool.New("forward", []byte(forwardRuleChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+
+	//全局死信处理器
+	globalConfig := rulego.NewConfig(types.WithDeadLetterHandler(NewChainHandler("forward", pool)))
+	ruleEngine, err := pool.New("", []byte(failRuleChain), rulego.WithConfig(globalConfig))
+	assert.Nil(t, err)
+	ruleEngine.OnMsg(newMsg("true"))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "deadLetterChain", msg.Metadata.GetValue(KeyDeadLetterChainId))
+		assert.Equal(t, "s2", msg.Metadata.GetValue(KeyDeadLetterNodeId))
+		assert.True(t, msg.Metadata.GetValue(KeyDeadLetterError) != "")
+	case <-time.After(time.Second * 3):
+		t.Fatal("dead letter not forwarded")
+	}
+
+	assert.NotNil(t, NewChainHandler("forward", pool).Handle(types.DeadLetter{ChainId: "forward"}))
+	assert.NotNil(t, NewChainHandler("notFound", pool).Handle(types.DeadLetter{ChainId: "c1"}))
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"sync"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/fs"
+)
+
+const (
+	opAdd    = "add"
+	opDelete = "delete"
+)
+
+var _ types.DeadLetterStore = (*FileStore)(nil)
+
+// record 文件中的一行记录
+type record struct {
+	Op     string            `json:"op"`
+	Id     string            `json:"id,omitempty"`
+	Letter *types.DeadLetter `json:"letter,omitempty"`
+}
+
+// FileStore 追加写文件死信存储
+// 每条死信或者删除操作以一行JSON追加到文件末尾，创建时回放文件恢复未删除的死信
+type FileStore struct {
+	log     *fs.AppendLog[record]
+	letters []types.DeadLetter
+	lock    sync.RWMutex
+}
+
+// NewFileStore 创建文件死信存储，文件不存在则创建
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{}
+	log, err := fs.OpenAppendLog(path, s.replay)
+	if err != nil {
+		return nil, err
+	}
+	s.log = log
+	return s, nil
+}
+
+// replay 从文件记录恢复死信
+func (s *FileStore) replay(r record) {
+	switch r.Op {
+	case opAdd:
+		if r.Letter != nil {
+			s.letters = append(s.letters, *r.Letter)
+		}
+	case opDelete:
+		s.remove(r.Id)
+	}
+}
+
+// remove 从内存中删除死信
+func (s *FileStore) remove(id string) bool {
+	for i, item := range s.letters {
+		if item.Id == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Handle 保存死信
+func (s *FileStore) Handle(letter types.DeadLetter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.log.Append(record{Op: opAdd, Letter: &letter}); err != nil {
+		return err
+	}
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+// List 按记录顺序获取所有死信
+func (s *FileStore) List() ([]types.DeadLetter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	letters := make([]types.DeadLetter, len(s.letters))
+	copy(letters, s.letters)
+	return letters, nil
+}
+
+// Get 通过死信ID获取死信
+func (s *FileStore) Get(id string) (types.DeadLetter, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, item := range s.letters {
+		if item.Id == id {
+			return item, true
+		}
+	}
+	return types.DeadLetter{}, false
+}
+
+// Delete 删除死信
+func (s *FileStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.remove(id) {
+		return ErrNotFound
+	}
+	return s.log.Append(record{Op: opDelete, Id: id})
+}
+
+// Close 关闭文件
+func (s *FileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.log.Close()
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package deadletter 死信处理器内置实现
+//
+// 节点执行失败，并且规则链没有配置`Failure`连接时，消息会作为死信交给死信处理器。
+// 提供内存环形缓冲区、追加写文件和转发到其他规则链3种实现，以及死信重放API。
+package deadletter
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// DefaultCapacity 内存存储默认容量
+const DefaultCapacity = 1000
+
+// ErrNotFound 死信不存在
+var ErrNotFound = errors.New("dead letter not found")
+
+var _ types.DeadLetterStore = (*MemoryStore)(nil)
+
+// MemoryStore 内存环形缓冲区死信存储
+// 超过容量后，最早的死信会被覆盖
+type MemoryStore struct {
+	capacity int
+	letters  []types.DeadLetter
+	lock     sync.RWMutex
+}
+
+// NewMemoryStore 创建内存死信存储，capacity<=0使用默认容量
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &MemoryStore{capacity: capacity}
+}
+
+// Handle 保存死信
+func (s *MemoryStore) Handle(letter types.DeadLetter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.letters) >= s.capacity {
+		// 丢弃最早的死信
+		copy(s.letters, s.letters[1:])
+		s.letters = s.letters[:len(s.letters)-1]
+	}
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+// List 按记录顺序获取所有死信
+func (s *MemoryStore) List() ([]types.DeadLetter, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	letters := make([]types.DeadLetter, len(s.letters))
+	copy(letters, s.letters)
+	return letters, nil
+}
+
+// Get 通过死信ID获取死信
+func (s *MemoryStore) Get(id string) (types.DeadLetter, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, item := range s.letters {
+		if item.Id == id {
+			return item, true
+		}
+	}
+	return types.DeadLetter{}, false
+}
+
+// Delete 删除死信
+func (s *MemoryStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, item := range s.letters {
+		if item.Id == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
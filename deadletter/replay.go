@@ -0,0 +1,72 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadletter
+
+import (
+	"fmt"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// Replay 重放死信，消息从执行失败的节点重新开始执行
+// ids 为空重放存储中的所有死信，重放提交成功的死信会从存储中删除
+// pool 为nil使用rulego.DefaultRuleGo，返回重放成功的数量和第一个错误
+func Replay(store types.DeadLetterStore, pool *rulego.RuleGo, ids ...string) (int, error) {
+	if pool == nil {
+		pool = rulego.DefaultRuleGo
+	}
+	var letters []types.DeadLetter
+	if len(ids) == 0 {
+		var err error
+		if letters, err = store.List(); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, id := range ids {
+			letter, ok := store.Get(id)
+			if !ok {
+				return 0, fmt.Errorf("dead letter id:%s not found", id)
+			}
+			letters = append(letters, letter)
+		}
+	}
+	var count int
+	var firstErr error
+	for _, letter := range letters {
+		if err := replay(letter, pool); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if err := store.Delete(letter.Id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		count++
+	}
+	return count, firstErr
+}
+
+func replay(letter types.DeadLetter, pool *rulego.RuleGo) error {
+	ruleEngine, ok := pool.Get(letter.ChainId)
+	if !ok {
+		return fmt.Errorf("dead letter id:%s chain id:%s not found", letter.Id, letter.ChainId)
+	}
+	msg := letter.Msg.Copy()
+	return ruleEngine.OnMsgFromNode(letter.NodeId, msg)
+}
@@ -19,14 +19,15 @@ package rulego
 import (
 	"github.com/xyzbit/rulego/api/types"
 	"github.com/xyzbit/rulego/utils/json"
+	"gopkg.in/yaml.v3"
 )
 
 // RuleChain 规则链定义
 type RuleChain struct {
 	// 规则链基础信息定义
-	RuleChain RuleChainBaseInfo `json:"ruleChain"`
+	RuleChain RuleChainBaseInfo `json:"ruleChain" yaml:"ruleChain"`
 	// 包含了规则链中节点和连接的信息
-	Metadata RuleMetadata `json:"metadata"`
+	Metadata RuleMetadata `json:"metadata" yaml:"metadata"`
 }
 
 // ParserRuleChain 通过json解析规则链结构体
@@ -36,54 +37,86 @@ func ParserRuleChain(rootRuleChain []byte) (RuleChain, error) {
 	return def, err
 }
 
+// ParserRuleChainYaml 通过yaml解析规则链结构体
+func ParserRuleChainYaml(rootRuleChain []byte) (RuleChain, error) {
+	var def RuleChain
+	err := yaml.Unmarshal(rootRuleChain, &def)
+	return def, err
+}
+
 // RuleChainBaseInfo 规则链基础信息定义
 type RuleChainBaseInfo struct {
 	// 规则链ID
-	ID string `json:"id"`
+	ID string `json:"id" yaml:"id,omitempty"`
 	// 扩展字段
-	AdditionalInfo map[string]string `json:"additionalInfo"`
+	AdditionalInfo map[string]string `json:"additionalInfo" yaml:"additionalInfo,omitempty"`
 	// Name 规则链的名称
-	Name string `json:"name"`
+	Name string `json:"name" yaml:"name"`
 	// 表示这个节点是否处于调试模式。如果为真，当节点处理消息时，会触发调试回调函数。
 	// 优先使用子节点的DebugMode配置
-	DebugMode bool `json:"debugMode"`
+	DebugMode bool `json:"debugMode" yaml:"debugMode"`
 	// Root 表示这个规则链是根规则链还是子规则链。(只做标记使用，非应用在实际逻辑)
-	Root bool `json:"root"`
+	Root bool `json:"root" yaml:"root"`
 	// Configuration 规则链配置信息
-	Configuration types.Configuration `json:"configuration"`
+	Configuration types.Configuration `json:"configuration" yaml:"configuration,omitempty"`
 }
 
 // RuleMetadata 规则链元数据定义，包含了规则链中节点和连接的信息
 type RuleMetadata struct {
 	// 数据流转的第一个节点，默认:0
-	FirstNodeIndex int `json:"firstNodeIndex"`
+	FirstNodeIndex int `json:"firstNodeIndex" yaml:"firstNodeIndex"`
 	// 节点组件定义
 	// 每个对象代表规则链中的一个规则节点
-	Nodes []*RuleNode `json:"nodes"`
+	Nodes []*RuleNode `json:"nodes" yaml:"nodes"`
 	// 连接定义
 	// 每个对象代表规则链中两个节点之间的连接
-	Connections []NodeConnection `json:"connections"`
+	Connections []NodeConnection `json:"connections" yaml:"connections,omitempty"`
 	// 子规则链链接
 	// 每个对象代表规则链中一个节点和一个子规则链之间的连接
-	RuleChainConnections []RuleChainConnection `json:"ruleChainConnections"`
+	RuleChainConnections []RuleChainConnection `json:"ruleChainConnections" yaml:"ruleChainConnections,omitempty"`
 }
 
 // RuleNode 规则链节点信息定义
 type RuleNode struct {
 	// 节点的唯一标识符，可以是任意字符串
-	Id string `json:"Id"`
+	Id string `json:"Id" yaml:"id"`
 	// 扩展字段
-	AdditionalInfo NodeAdditionalInfo `json:"additionalInfo"`
+	AdditionalInfo NodeAdditionalInfo `json:"additionalInfo" yaml:"additionalInfo,omitempty"`
 	// 节点的类型，决定了节点的逻辑和行为。它应该与规则引擎中注册的节点类型之一匹配。
-	Type string `json:"type"`
+	Type string `json:"type" yaml:"type"`
 	// 节点的名称，可以是任意字符串
-	Name string `json:"name"`
+	Name string `json:"name" yaml:"name"`
 	// 表示这个节点是否处于调试模式。如果为真，当节点处理消息时，会触发调试回调函数。
-	DebugMode bool `json:"debugMode"`
+	DebugMode bool `json:"debugMode" yaml:"debugMode"`
+	// 节点执行超时时间，单位毫秒，<=0 表示不限制
+	// 如果节点在该时间内没有通知下一个节点，则规则引擎通过`Timeout`关系把消息发送到下一个节点，
+	// 没有`Timeout`关系的连接，则使用`Failure`关系。超时后节点再通知下一个节点会被忽略
+	TimeoutMs int64 `json:"timeoutMs,omitempty" yaml:"timeoutMs,omitempty"`
+	// 节点重试策略，为空表示不重试
+	// 节点通过重试策略指定的关系通知下一个节点时，规则引擎使用原始消息重新调用节点，直到达到最大执行次数
+	Retry *RetryPolicy `json:"retry,omitempty" yaml:"retry,omitempty"`
 	// 包含了节点的配置参数，具体内容取决于节点类型。
 	// 例如，一个JS过滤器节点可能有一个`jsScript`字段，定义了过滤逻辑，
 	// 而一个REST API调用节点可能有一个`restEndpointUrlPattern`字段，定义了要调用的URL。
-	Configuration types.Configuration `json:"configuration"`
+	Configuration types.Configuration `json:"configuration" yaml:"configuration,omitempty"`
+}
+
+// RetryPolicy 节点重试策略定义
+type RetryPolicy struct {
+	// 最大执行次数，包含第一次执行，<=1 表示不重试
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// 退避策略：fixed(固定间隔)/exponential(指数增长)，默认:fixed
+	Backoff string `json:"backoff" yaml:"backoff"`
+	// 重试间隔，单位毫秒。如果是指数退避，则是第一次重试的间隔
+	DelayMs int64 `json:"delayMs" yaml:"delayMs"`
+	// 指数退避间隔增长倍数，默认:2
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+	// 最大重试间隔，单位毫秒，<=0 表示不限制
+	MaxDelayMs int64 `json:"maxDelayMs" yaml:"maxDelayMs"`
+	// 随机抖动系数，取值范围[0,1]，实际间隔在 delay*(1-jitter) 到 delay*(1+jitter) 之间
+	Jitter float64 `json:"jitter" yaml:"jitter"`
+	// 触发重试的关系列表，默认:["Failure"]
+	RetryOn []string `json:"retryOn" yaml:"retryOn"`
 }
 
 // ParserRuleNode 通过json解析节点结构体
@@ -93,32 +126,39 @@ func ParserRuleNode(rootRuleChain []byte) (RuleNode, error) {
 	return def, err
 }
 
+// ParserRuleNodeYaml 通过yaml解析节点结构体
+func ParserRuleNodeYaml(rootRuleChain []byte) (RuleNode, error) {
+	var def RuleNode
+	err := yaml.Unmarshal(rootRuleChain, &def)
+	return def, err
+}
+
 // NodeAdditionalInfo 用于可视化位置信息(预留字段)
 type NodeAdditionalInfo struct {
-	Description string `json:"description"`
-	LayoutX     int    `json:"layoutX"`
-	LayoutY     int    `json:"layoutY"`
+	Description string `json:"description" yaml:"description"`
+	LayoutX     int    `json:"layoutX" yaml:"layoutX"`
+	LayoutY     int    `json:"layoutY" yaml:"layoutY"`
 }
 
 // NodeConnection 规则链节点连接定义
 // 每个对象代表规则链中两个节点之间的连接
 type NodeConnection struct {
 	// 连接的源节点的id，应该与nodes数组中的某个节点id匹配。
-	FromId string `json:"fromId"`
+	FromId string `json:"fromId" yaml:"fromId"`
 	// 连接的目标节点的id，应该与nodes数组中的某个节点id匹配
-	ToId string `json:"toId"`
+	ToId string `json:"toId" yaml:"toId"`
 	// 连接的类型，决定了什么时候以及如何把消息从一个节点发送到另一个节点。它应该与源节点类型支持的连接类型之一匹配。
 	// 例如，一个JS过滤器节点可能支持两种连接类型："True"和"False"，表示消息是否通过或者失败过滤条件。
-	Type string `json:"type"`
+	Type string `json:"type" yaml:"type"`
 }
 
 // RuleChainConnection 子规则链连接定义
 // 每个对象代表规则链中一个节点和一个子规则链之间的连接
 type RuleChainConnection struct {
 	// 连接的源节点的id，应该与nodes数组中的某个节点id匹配。
-	FromId string `json:"fromId"`
+	FromId string `json:"fromId" yaml:"fromId"`
 	// 连接的目标子规则链的id，应该与规则引擎中注册的子规则链之一匹配。
-	ToId string `json:"toId"`
+	ToId string `json:"toId" yaml:"toId"`
 	// 连接的类型，决定了什么时候以及如何把消息从一个节点发送到另一个节点。它应该与源节点类型支持的连接类型之一匹配。
-	Type string `json:"type"`
+	Type string `json:"type" yaml:"type"`
 }
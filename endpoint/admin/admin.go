@@ -0,0 +1,467 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package admin 规则引擎管理接口，挂载到`rest.Rest`endpoint
+//
+// 接口列表(BasePath默认:/api/v1)：
+//
+//	GET    /chains                          规则链列表
+//	GET    /chains/:chainId                 获取规则链DSL
+//	POST   /chains/:chainId                 创建规则链，body为规则链DSL
+//	PUT    /chains/:chainId                 更新规则链，body为规则链DSL
+//	DELETE /chains/:chainId                 删除规则链
+//	POST   /chains/:chainId/reload          重新加载规则链，配置了规则链存储则从存储加载
+//	GET    /chains/:chainId/nodes/:nodeId   获取节点DSL
+//	PUT    /chains/:chainId/nodes/:nodeId   更新节点，body为节点DSL
+//	POST   /chains/:chainId/msg             发送测试消息并等待执行结果，参数：msgType、timeout，其他参数作为消息元数据，body为消息内容
+//	GET    /components                      组件配置表单列表
+//	GET    /debug/events                    最近的调试事件，参数：chainId、nodeId、limit
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/endpoint/rest"
+)
+
+const (
+	// DefaultBasePath 默认接口路径前缀
+	DefaultBasePath = "/api/v1"
+	// DefaultMaxDebugEvents 默认保存的调试事件数量
+	DefaultMaxDebugEvents = 1000
+	// DefaultMsgTimeout 测试消息默认等待时间
+	DefaultMsgTimeout = time.Second * 10
+
+	paramChainId = "chainId"
+	paramNodeId  = "nodeId"
+	paramMsgType = "msgType"
+	paramTimeout = "timeout"
+	paramLimit   = "limit"
+)
+
+// Config 管理接口配置
+type Config struct {
+	// BasePath 接口路径前缀，默认：/api/v1
+	BasePath string
+	// Token Bearer认证token，为空不认证
+	Token string
+	// RuleGo 规则链池，默认：rulego.DefaultRuleGo
+	RuleGo *rulego.RuleGo
+	// ChainStore 规则链存储，可以为空
+	// 配置后，创建的规则链会写回存储，删除规则链会从存储删除，重新加载规则链从存储加载
+	ChainStore types.ChainStore
+	// RuleEngineOptions 创建规则链的选项，例如：rulego.WithConfig(config)
+	RuleEngineOptions []rulego.RuleEngineOption
+	// ComponentsRegistry 组件注册器，默认：rulego.Registry
+	ComponentsRegistry types.ComponentRegistry
+	// MaxDebugEvents 保存的最近调试事件数量，默认：1000
+	MaxDebugEvents int
+	// MsgTimeout 测试消息默认等待时间，默认：10秒
+	MsgTimeout time.Duration
+}
+
+// DebugEvent 调试事件
+type DebugEvent struct {
+	Ts           int64         `json:"ts"`
+	FlowType     string        `json:"flowType"`
+	ChainId      string        `json:"chainId,omitempty"`
+	NodeId       string        `json:"nodeId"`
+	Msg          types.RuleMsg `json:"msg"`
+	RelationType string        `json:"relationType,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// ChainInfo 规则链信息
+type ChainInfo struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Version     int64  `json:"version"`
+	Initialized bool   `json:"initialized"`
+}
+
+// MsgResult 测试消息执行结果，规则链每个结束点一条
+type MsgResult struct {
+	Msg   types.RuleMsg `json:"msg"`
+	Error string        `json:"error,omitempty"`
+}
+
+// rawBody 不需要JSON编码的响应数据
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// MsgResponse 测试消息响应
+type MsgResponse struct {
+	MsgId   string      `json:"msgId"`
+	Results []MsgResult `json:"results"`
+	// Error 等待超时错误
+	Error string `json:"error,omitempty"`
+}
+
+// Admin 管理接口
+type Admin struct {
+	config Config
+	// events 最近的调试事件，环形缓冲区，写满后覆盖最旧的事件
+	events []DebugEvent
+	// next 下一个事件写入的位置
+	next int
+	lock sync.RWMutex
+}
+
+// New 创建管理接口
+func New(config Config) *Admin {
+	if config.BasePath == "" {
+		config.BasePath = DefaultBasePath
+	}
+	config.BasePath = strings.TrimSuffix(config.BasePath, "/")
+	if config.RuleGo == nil {
+		config.RuleGo = rulego.DefaultRuleGo
+	}
+	if config.ComponentsRegistry == nil {
+		config.ComponentsRegistry = rulego.Registry
+	}
+	if config.MaxDebugEvents <= 0 {
+		config.MaxDebugEvents = DefaultMaxDebugEvents
+	}
+	if config.MsgTimeout <= 0 {
+		config.MsgTimeout = DefaultMsgTimeout
+	}
+	return &Admin{config: config}
+}
+
+// Mount 把管理接口注册到rest endpoint
+func (a *Admin) Mount(restEndpoint *rest.Rest) *Admin {
+	base := a.config.BasePath
+	restEndpoint.GET(a.router(base+"/chains", a.listChains))
+	restEndpoint.GET(a.router(base+"/chains/:chainId", a.getChain))
+	restEndpoint.POST(a.router(base+"/chains/:chainId", a.createChain))
+	restEndpoint.PUT(a.router(base+"/chains/:chainId", a.updateChain))
+	restEndpoint.DELETE(a.router(base+"/chains/:chainId", a.deleteChain))
+	restEndpoint.POST(a.router(base+"/chains/:chainId/reload", a.reloadChain))
+	restEndpoint.GET(a.router(base+"/chains/:chainId/nodes/:nodeId", a.getNode))
+	restEndpoint.PUT(a.router(base+"/chains/:chainId/nodes/:nodeId", a.updateNode))
+	restEndpoint.POST(a.router(base+"/chains/:chainId/msg", a.sendMsg))
+	restEndpoint.GET(a.router(base+"/components", a.listComponents))
+	restEndpoint.GET(a.router(base+"/debug/events", a.listDebugEvents))
+	return a
+}
+
+// OnDebug 返回记录指定规则链调试事件的回调函数，只有debugMode=true的节点会触发
+// 通过管理接口创建的规则链会自动记录，其他规则链需要配置到该规则链的`types.Config.OnDebug`，例如：
+//
+//	config := rulego.NewConfig(types.WithOnDebug(adminApi.OnDebug("rule01")))
+//	ruleEngine, err := rulego.New("rule01", def, rulego.WithConfig(config))
+func (a *Admin) OnDebug(chainId string) func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+	return func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+		event := DebugEvent{
+			Ts:           time.Now().UnixMilli(),
+			FlowType:     flowType,
+			ChainId:      chainId,
+			NodeId:       nodeId,
+			Msg:          msg,
+			RelationType: relationType,
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		a.lock.Lock()
+		defer a.lock.Unlock()
+		if len(a.events) < a.config.MaxDebugEvents {
+			a.events = append(a.events, event)
+		} else {
+			a.events[a.next] = event
+		}
+		a.next = (a.next + 1) % a.config.MaxDebugEvents
+	}
+}
+
+// withDebug 记录规则链的调试事件，保留规则链已经配置的调试回调函数
+func (a *Admin) withDebug(chainId string) rulego.RuleEngineOption {
+	return func(e *rulego.RuleEngine) error {
+		onDebug := e.Config.OnDebug
+		record := a.OnDebug(chainId)
+		e.Config.OnDebug = func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+			if onDebug != nil {
+				onDebug(flowType, nodeId, msg, relationType, err)
+			}
+			record(flowType, nodeId, msg, relationType, err)
+		}
+		return nil
+	}
+}
+
+// handler 管理接口处理函数，返回http状态码和响应数据
+type handler func(exchange *endpoint.Exchange) (int, interface{})
+
+// router 创建路由，先认证再执行处理函数
+func (a *Admin) router(path string, h handler) *endpoint.Router {
+	return endpoint.NewRouter().From(path).Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		if !a.authorized(exchange) {
+			writeBody(exchange, http.StatusUnauthorized, errorBody(errors.New("unauthorized")))
+			return false
+		}
+		statusCode, body := h(exchange)
+		writeBody(exchange, statusCode, body)
+		return true
+	}).End()
+}
+
+// authorized Bearer token认证
+func (a *Admin) authorized(exchange *endpoint.Exchange) bool {
+	if a.config.Token == "" {
+		return true
+	}
+	token := strings.TrimPrefix(exchange.In.Headers().Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) == 1
+}
+
+func (a *Admin) listChains(_ *endpoint.Exchange) (int, interface{}) {
+	chains := make([]ChainInfo, 0)
+	a.config.RuleGo.Range(func(id string, ruleEngine *rulego.RuleEngine) bool {
+		info := ChainInfo{Id: id, Version: ruleEngine.Version(), Initialized: ruleEngine.Initialized()}
+		if ctx := ruleEngine.RootRuleChainCtx(); ctx != nil && ctx.SelfDefinition != nil {
+			info.Name = ctx.SelfDefinition.RuleChain.Name
+		}
+		chains = append(chains, info)
+		return true
+	})
+	sort.Slice(chains, func(i, j int) bool {
+		return chains[i].Id < chains[j].Id
+	})
+	return http.StatusOK, chains
+}
+
+func (a *Admin) getChain(exchange *endpoint.Exchange) (int, interface{}) {
+	ruleEngine, ok := a.ruleEngine(exchange)
+	if !ok {
+		return chainNotFound(exchange)
+	}
+	return http.StatusOK, dslBody(ruleEngine, ruleEngine.DSL())
+}
+
+func (a *Admin) createChain(exchange *endpoint.Exchange) (int, interface{}) {
+	chainId := param(exchange, paramChainId)
+	if _, ok := a.config.RuleGo.Get(chainId); ok {
+		return http.StatusConflict, errorBody(errors.New("rule chain already exists"))
+	}
+	opts := append(append([]rulego.RuleEngineOption{}, a.config.RuleEngineOptions...), a.withDebug(chainId))
+	if a.config.ChainStore != nil {
+		opts = append(opts, rulego.WithChainStore(a.config.ChainStore))
+	}
+	if _, err := a.config.RuleGo.New(chainId, exchange.In.Body(), opts...); err != nil {
+		return http.StatusBadRequest, errorBody(err)
+	}
+	return http.StatusCreated, nil
+}
+
+func (a *Admin) updateChain(exchange *endpoint.Exchange) (int, interface{}) {
+	ruleEngine, ok := a.ruleEngine(exchange)
+	if !ok {
+		return chainNotFound(exchange)
+	}
+	if err := ruleEngine.ReloadSelf(exchange.In.Body()); err != nil {
+		return http.StatusBadRequest, errorBody(err)
+	}
+	return http.StatusOK, nil
+}
+
+func (a *Admin) deleteChain(exchange *endpoint.Exchange) (int, interface{}) {
+	chainId := param(exchange, paramChainId)
+	if _, ok := a.config.RuleGo.Get(chainId); !ok {
+		return chainNotFound(exchange)
+	}
+	a.config.RuleGo.Del(chainId)
+	if a.config.ChainStore != nil {
+		if err := a.config.ChainStore.Delete(chainId); err != nil && !errors.Is(err, types.ErrChainNotFound) {
+			return http.StatusInternalServerError, errorBody(err)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func (a *Admin) reloadChain(exchange *endpoint.Exchange) (int, interface{}) {
+	ruleEngine, ok := a.ruleEngine(exchange)
+	if !ok {
+		return chainNotFound(exchange)
+	}
+	def := ruleEngine.DSL()
+	if a.config.ChainStore != nil {
+		var err error
+		if def, err = a.config.ChainStore.Get(ruleEngine.Id); err != nil {
+			return http.StatusInternalServerError, errorBody(err)
+		}
+	}
+	if err := ruleEngine.ReloadSelf(def); err != nil {
+		return http.StatusBadRequest, errorBody(err)
+	}
+	return http.StatusOK, nil
+}
+
+func (a *Admin) getNode(exchange *endpoint.Exchange) (int, interface{}) {
+	ruleEngine, ok := a.ruleEngine(exchange)
+	if !ok {
+		return chainNotFound(exchange)
+	}
+	nodeId := param(exchange, paramNodeId)
+	def := ruleEngine.NodeDSL(types.EmptyRuleNodeId, types.RuleNodeId{Id: nodeId, Type: types.NODE})
+	if def == nil {
+		return http.StatusNotFound, errorBody(errors.New("node not found"))
+	}
+	return http.StatusOK, dslBody(ruleEngine, def)
+}
+
+func (a *Admin) updateNode(exchange *endpoint.Exchange) (int, interface{}) {
+	ruleEngine, ok := a.ruleEngine(exchange)
+	if !ok {
+		return chainNotFound(exchange)
+	}
+	nodeId := param(exchange, paramNodeId)
+	if ruleEngine.NodeDSL(types.EmptyRuleNodeId, types.RuleNodeId{Id: nodeId, Type: types.NODE}) == nil {
+		return http.StatusNotFound, errorBody(errors.New("node not found"))
+	}
+	if err := ruleEngine.ReloadChild(nodeId, exchange.In.Body()); err != nil {
+		return http.StatusBadRequest, errorBody(err)
+	}
+	return http.StatusOK, nil
+}
+
+func (a *Admin) sendMsg(exchange *endpoint.Exchange) (int, interface{}) {
+	ruleEngine, ok := a.ruleEngine(exchange)
+	if !ok {
+		return chainNotFound(exchange)
+	}
+	timeout := a.config.MsgTimeout
+	if v := exchange.In.GetParam(paramTimeout); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil {
+			return http.StatusBadRequest, errorBody(err)
+		}
+	}
+	// 请求参数作为消息元数据
+	metadata := types.NewMetadata()
+	for k, v := range exchange.In.GetMsg().Metadata.Values() {
+		if k != paramChainId && k != paramMsgType && k != paramTimeout {
+			metadata.PutValue(k, v)
+		}
+	}
+	msg := types.NewMsg(0, exchange.In.GetParam(paramMsgType), types.JSON, metadata, string(exchange.In.Body()))
+
+	response := MsgResponse{MsgId: msg.Id, Results: make([]MsgResult, 0)}
+	var lock sync.Mutex
+	err := ruleEngine.OnMsgAndWaitWithTimeout(msg, timeout, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		result := MsgResult{Msg: msg}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		lock.Lock()
+		response.Results = append(response.Results, result)
+		lock.Unlock()
+	}))
+	lock.Lock()
+	defer lock.Unlock()
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return http.StatusOK, response
+}
+
+func (a *Admin) listComponents(_ *endpoint.Exchange) (int, interface{}) {
+	return http.StatusOK, a.config.ComponentsRegistry.GetComponentForms().Values()
+}
+
+func (a *Admin) listDebugEvents(exchange *endpoint.Exchange) (int, interface{}) {
+	chainId := exchange.In.GetParam(paramChainId)
+	nodeId := exchange.In.GetParam(paramNodeId)
+	limit, _ := strconv.Atoi(exchange.In.GetParam(paramLimit))
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	// 从最新的事件开始
+	events := make([]DebugEvent, 0)
+	for i := 1; i <= len(a.events); i++ {
+		item := a.events[(a.next-i+len(a.events))%len(a.events)]
+		if (chainId != "" && item.ChainId != chainId) || (nodeId != "" && item.NodeId != nodeId) {
+			continue
+		}
+		events = append(events, item)
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+	}
+	return http.StatusOK, events
+}
+
+func (a *Admin) ruleEngine(exchange *endpoint.Exchange) (*rulego.RuleEngine, bool) {
+	return a.config.RuleGo.Get(param(exchange, paramChainId))
+}
+
+// param 获取路径参数
+func param(exchange *endpoint.Exchange, key string) string {
+	return exchange.In.GetMsg().Metadata.GetValue(key)
+}
+
+func chainNotFound(exchange *endpoint.Exchange) (int, interface{}) {
+	return http.StatusNotFound, errorBody(errors.New("rule chain not found:" + param(exchange, paramChainId)))
+}
+
+func errorBody(err error) map[string]string {
+	return map[string]string{"error": err.Error()}
+}
+
+// dslBody 规则链或者节点DSL响应，使用规则引擎解析器的格式，JSON以外的格式(例如：YAML)不进行JSON编码
+func dslBody(ruleEngine *rulego.RuleEngine, def []byte) interface{} {
+	if json.Valid(def) {
+		return json.RawMessage(def)
+	}
+	contentType := "text/plain; charset=utf-8"
+	if _, ok := ruleEngine.Config.Parser.(*rulego.YamlParser); ok {
+		contentType = "application/yaml"
+	}
+	return rawBody{contentType: contentType, data: def}
+}
+
+// writeBody 写响应，响应数据编码成JSON，编码失败返回500
+func writeBody(exchange *endpoint.Exchange, statusCode int, body interface{}) {
+	if raw, ok := body.(rawBody); ok {
+		exchange.Out.Headers().Set("Content-Type", raw.contentType)
+		exchange.Out.SetStatusCode(statusCode)
+		exchange.Out.SetBody(raw.data)
+		return
+	}
+	exchange.Out.Headers().Set("Content-Type", "application/json")
+	if body == nil {
+		exchange.Out.SetStatusCode(statusCode)
+		return
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		b, _ = json.Marshal(errorBody(err))
+	}
+	exchange.Out.SetStatusCode(statusCode)
+	exchange.Out.SetBody(b)
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint/rest"
+	"github.com/xyzbit/rulego/store"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var chainDef = `{
+  "ruleChain": {"id": "chain01", "name": "测试规则链"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsFilter", "name": "过滤", "debugMode": true, "configuration": {"jsScript": "return msg.temperature>10;"}},
+      {"id": "s2", "type": "jsTransform", "name": "转换", "debugMode": true, "configuration": {"jsScript": "metadata.name=metadata.name+'-ok';return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+    ],
+    "connections": [{"fromId": "s1", "toId": "s2", "type": "True"}]
+  }
+}`
+
+var nodeDef = `{"id": "s2", "type": "jsTransform", "name": "转换", "debugMode": true, "configuration": {"jsScript": "metadata.name=metadata.name+'-v2';return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}`
+
+func newTestServer(t *testing.T, token string) (*httptest.Server, *rulego.RuleGo, types.ChainStore) {
+	pool := &rulego.RuleGo{}
+	chainStore := store.NewKVStore(store.NewMemoryKV())
+	config := rulego.NewConfig(types.WithDefaultPool())
+	admin := New(Config{
+		Token:             token,
+		RuleGo:            pool,
+		ChainStore:        chainStore,
+		RuleEngineOptions: []rulego.RuleEngineOption{rulego.WithConfig(config)},
+	})
+	restEndpoint := &rest.Rest{RuleConfig: config}
+	admin.Mount(restEndpoint)
+	server := httptest.NewServer(restEndpoint.Router())
+	t.Cleanup(server.Close)
+	return server, pool, chainStore
+}
+
+func doRequest(t *testing.T, method, url, token, body string) (int, []byte) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp.StatusCode, b
+}
+
+func TestAdmin(t *testing.T) {
+	server, pool, chainStore := newTestServer(t, "")
+	base := server.URL + DefaultBasePath
+
+	// 创建规则链
+	code, _ := doRequest(t, http.MethodPost, base+"/chains/chain01", "", chainDef)
+	assert.Equal(t, http.StatusCreated, code)
+	_, ok := pool.Get("chain01")
+	assert.True(t, ok)
+	_, err := chainStore.Get("chain01")
+	assert.Nil(t, err)
+
+	code, _ = doRequest(t, http.MethodPost, base+"/chains/chain01", "", chainDef)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, body := doRequest(t, http.MethodPost, base+"/chains/chain02", "", "{")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.True(t, strings.Contains(string(body), "error"))
+
+	// 规则链列表
+	code, body = doRequest(t, http.MethodGet, base+"/chains", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	var chains []ChainInfo
+	assert.Nil(t, json.Unmarshal(body, &chains))
+	assert.Equal(t, 1, len(chains))
+	assert.Equal(t, "chain01", chains[0].Id)
+	assert.Equal(t, "测试规则链", chains[0].Name)
+
+	// 获取规则链
+	code, body = doRequest(t, http.MethodGet, base+"/chains/chain01", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, bytes.Contains(body, []byte(`"s2"`)))
+
+	code, _ = doRequest(t, http.MethodGet, base+"/chains/notFound", "", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 发送测试消息
+	code, body = doRequest(t, http.MethodPost, base+"/chains/chain01/msg?msgType=TEST&name=dev", "", `{"temperature":41}`)
+	assert.Equal(t, http.StatusOK, code)
+	var response MsgResponse
+	assert.Nil(t, json.Unmarshal(body, &response))
+	assert.Equal(t, "", response.Error)
+	assert.Equal(t, 1, len(response.Results))
+	assert.Equal(t, "TEST", response.Results[0].Msg.Type)
+	assert.Equal(t, "dev-ok", response.Results[0].Msg.Metadata.GetValue("name"))
+	assert.False(t, response.Results[0].Msg.Metadata.Has(paramMsgType))
+
+	// 调试事件
+	code, body = doRequest(t, http.MethodGet, base+"/debug/events?nodeId=s2", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	var events []DebugEvent
+	assert.Nil(t, json.Unmarshal(body, &events))
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, types.Out, events[0].FlowType)
+	assert.Equal(t, types.In, events[1].FlowType)
+
+	code, body = doRequest(t, http.MethodGet, base+"/debug/events?chainId=chain01", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &events))
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, "chain01", events[0].ChainId)
+
+	code, body = doRequest(t, http.MethodGet, base+"/debug/events?chainId=chain02", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &events))
+	assert.Equal(t, 0, len(events))
+
+	code, body = doRequest(t, http.MethodGet, base+"/debug/events?limit=1", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &events))
+	assert.Equal(t, 1, len(events))
+
+	// 节点
+	code, body = doRequest(t, http.MethodGet, base+"/chains/chain01/nodes/s2", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, bytes.Contains(body, []byte("jsTransform")))
+
+	code, _ = doRequest(t, http.MethodGet, base+"/chains/chain01/nodes/notFound", "", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = doRequest(t, http.MethodPut, base+"/chains/chain01/nodes/s2", "", nodeDef)
+	assert.Equal(t, http.StatusOK, code)
+
+	_, body = doRequest(t, http.MethodPost, base+"/chains/chain01/msg?msgType=TEST&name=dev", "", `{"temperature":41}`)
+	assert.Nil(t, json.Unmarshal(body, &response))
+	assert.Equal(t, "dev-v2", response.Results[0].Msg.Metadata.GetValue("name"))
+
+	// 节点更新写回存储
+	def, err := chainStore.Get("chain01")
+	assert.Nil(t, err)
+	assert.True(t, bytes.Contains(def, []byte("-v2")))
+
+	// 更新规则链
+	code, _ = doRequest(t, http.MethodPut, base+"/chains/chain01", "", chainDef)
+	assert.Equal(t, http.StatusOK, code)
+	_, body = doRequest(t, http.MethodPost, base+"/chains/chain01/msg?msgType=TEST&name=dev", "", `{"temperature":41}`)
+	assert.Nil(t, json.Unmarshal(body, &response))
+	assert.Equal(t, "dev-ok", response.Results[0].Msg.Metadata.GetValue("name"))
+
+	// 从存储重新加载
+	_, err = chainStore.Save("chain01", []byte(strings.Replace(chainDef, "-ok", "-store", 1)))
+	assert.Nil(t, err)
+	code, _ = doRequest(t, http.MethodPost, base+"/chains/chain01/reload", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	_, body = doRequest(t, http.MethodPost, base+"/chains/chain01/msg?msgType=TEST&name=dev", "", `{"temperature":41}`)
+	assert.Nil(t, json.Unmarshal(body, &response))
+	assert.Equal(t, "dev-store", response.Results[0].Msg.Metadata.GetValue("name"))
+
+	// 组件列表
+	code, body = doRequest(t, http.MethodGet, base+"/components", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, bytes.Contains(body, []byte("jsFilter")))
+
+	// 删除规则链
+	code, _ = doRequest(t, http.MethodDelete, base+"/chains/chain01", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	_, ok = pool.Get("chain01")
+	assert.False(t, ok)
+	_, err = chainStore.Get("chain01")
+	assert.Equal(t, types.ErrChainNotFound, err)
+
+	code, _ = doRequest(t, http.MethodDelete, base+"/chains/chain01", "", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAdminDebugEventsRing(t *testing.T) {
+	admin := New(Config{RuleGo: &rulego.RuleGo{}, MaxDebugEvents: 3})
+	restEndpoint := &rest.Rest{}
+	admin.Mount(restEndpoint)
+	server := httptest.NewServer(restEndpoint.Router())
+	defer server.Close()
+
+	onDebug := admin.OnDebug("chain01")
+	for _, nodeId := range []string{"n1", "n2", "n3", "n4", "n5"} {
+		onDebug(types.In, nodeId, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), "", nil)
+	}
+	// 只保留最近3条，从最新的事件开始
+	code, body := doRequest(t, http.MethodGet, server.URL+DefaultBasePath+"/debug/events", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	var events []DebugEvent
+	assert.Nil(t, json.Unmarshal(body, &events))
+	assert.Equal(t, 3, len(events))
+	assert.Equal(t, "n5", events[0].NodeId)
+	assert.Equal(t, "n4", events[1].NodeId)
+	assert.Equal(t, "n3", events[2].NodeId)
+
+	code, body = doRequest(t, http.MethodGet, server.URL+DefaultBasePath+"/debug/events?limit=2&nodeId=n3", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, json.Unmarshal(body, &events))
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "n3", events[0].NodeId)
+}
+
+func TestAdminAuth(t *testing.T) {
+	server, _, _ := newTestServer(t, "secret")
+	base := server.URL + DefaultBasePath
+
+	code, _ := doRequest(t, http.MethodGet, base+"/chains", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = doRequest(t, http.MethodGet, base+"/chains", "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = doRequest(t, http.MethodGet, base+"/chains", "secret", "")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAdminYamlChain(t *testing.T) {
+	server, pool, _ := newTestServer(t, "")
+	base := server.URL + DefaultBasePath
+	chain, err := rulego.ParserRuleChain([]byte(chainDef))
+	assert.Nil(t, err)
+	yamlDef, err := (&rulego.YamlParser{}).EncodeRuleChain(chain)
+	assert.Nil(t, err)
+	_, err = pool.New("chain01", yamlDef, rulego.WithConfig(rulego.NewConfig()), rulego.WithParser(&rulego.YamlParser{}))
+	assert.Nil(t, err)
+
+	// yaml规则链使用yaml格式返回
+	for _, path := range []string{"/chains/chain01", "/chains/chain01/nodes/s2"} {
+		resp, err := http.Get(base + path)
+		assert.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/yaml", resp.Header.Get("Content-Type"))
+		assert.True(t, bytes.Contains(body, []byte("type: jsTransform")))
+	}
+}
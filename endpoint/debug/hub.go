@@ -0,0 +1,307 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package debug 节点调试事件实时推送
+//
+// Hub 通过规则链的`types.Config.OnDebug`接收节点调试事件，按节点缓存最近的事件，
+// 并通过WebSocket和SSE(Server-Sent Events)推送给订阅者。
+// 订阅者可以按规则链ID、节点ID和流向(IN/OUT)过滤，订阅者消费慢时丢弃事件，不会阻塞规则引擎。
+//
+// 挂载到`rest.Rest`endpoint后的接口(BasePath默认:/api/v1/debug/live)：
+//
+//	GET /ws      WebSocket推送，参数：chainId、nodeId、flowType
+//	GET /sse     SSE推送，参数：chainId、nodeId、flowType
+//	GET /events  最近的调试事件，参数：chainId、nodeId、flowType、limit
+package debug
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+)
+
+const (
+	// DefaultBufferSize 默认每个节点缓存的事件数量
+	DefaultBufferSize = 100
+	// DefaultSubscriberBufferSize 默认每个订阅者的待推送事件队列大小
+	DefaultSubscriberBufferSize = 256
+)
+
+// Event 节点调试事件
+type Event struct {
+	// Seq 事件序号，单调递增
+	Seq          uint64        `json:"seq"`
+	Ts           int64         `json:"ts"`
+	ChainId      string        `json:"chainId"`
+	NodeId       string        `json:"nodeId"`
+	FlowType     string        `json:"flowType"`
+	RelationType string        `json:"relationType,omitempty"`
+	Msg          types.RuleMsg `json:"msg"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Filter 事件过滤条件，字段为空表示不过滤
+type Filter struct {
+	ChainId string
+	NodeId  string
+	// FlowType IN/OUT
+	FlowType string
+}
+
+// Match 事件是否满足过滤条件
+func (f Filter) Match(event Event) bool {
+	return (f.ChainId == "" || f.ChainId == event.ChainId) &&
+		(f.NodeId == "" || f.NodeId == event.NodeId) &&
+		(f.FlowType == "" || f.FlowType == event.FlowType)
+}
+
+// Subscription 订阅
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	ch      chan Event
+	dropped int64
+	once    sync.Once
+}
+
+// C 事件通道，取消订阅后关闭
+func (s *Subscription) C() <-chan Event {
+	return s.ch
+}
+
+// Dropped 因为消费慢丢弃的事件数量
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.lock.Lock()
+		delete(s.hub.subscribers, s)
+		s.hub.lock.Unlock()
+		close(s.ch)
+	})
+}
+
+// offer 非阻塞推送，队列满则丢弃
+func (s *Subscription) offer(event Event) {
+	select {
+	case s.ch <- event:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// Config Hub配置
+type Config struct {
+	// BufferSize 每个节点缓存的最近事件数量，默认：100
+	BufferSize int
+	// SubscriberBufferSize 每个订阅者的待推送事件队列大小，默认：256
+	SubscriberBufferSize int
+	// BasePath 挂载到rest endpoint的接口路径前缀，默认：/api/v1/debug/live
+	BasePath string
+	// Token Bearer认证token，为空不认证
+	// 浏览器WebSocket和EventSource不能设置请求头，也可以通过token参数传递
+	Token string
+	// KeepAlive 推送连接保活间隔，默认：15秒
+	KeepAlive time.Duration
+}
+
+// Hub 调试事件中心
+type Hub struct {
+	config Config
+	seq    uint64
+	// 节点最近的事件，key:chainId+nodeId
+	buffers     map[nodeKey]*ring
+	subscribers map[*Subscription]struct{}
+	lock        sync.RWMutex
+}
+
+type nodeKey struct {
+	chainId string
+	nodeId  string
+}
+
+// NewHub 创建调试事件中心
+func NewHub(config Config) *Hub {
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+	if config.SubscriberBufferSize <= 0 {
+		config.SubscriberBufferSize = DefaultSubscriberBufferSize
+	}
+	if config.BasePath == "" {
+		config.BasePath = DefaultBasePath
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = DefaultKeepAlive
+	}
+	return &Hub{
+		config:      config,
+		buffers:     make(map[nodeKey]*ring),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// OnDebug 返回指定规则链的调试回调函数，只有debugMode=true的节点会触发
+// 会替换规则链已经配置的`types.Config.OnDebug`，需要保留时使用WithDebug
+func (h *Hub) OnDebug(chainId string) func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+	return func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+		event := Event{
+			Ts:           time.Now().UnixMilli(),
+			ChainId:      chainId,
+			NodeId:       nodeId,
+			FlowType:     flowType,
+			RelationType: relationType,
+			Msg:          msg,
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		h.Publish(event)
+	}
+}
+
+// WithDebug 把指定规则链的调试事件发布到Hub，保留规则链已经配置的调试回调函数
+// 需要放在rulego.WithConfig之后，例如：
+//
+//	ruleEngine, err := rulego.New("rule01", def, rulego.WithConfig(config), hub.WithDebug("rule01"))
+func (h *Hub) WithDebug(chainId string) rulego.RuleEngineOption {
+	return func(e *rulego.RuleEngine) error {
+		onDebug := e.Config.OnDebug
+		publish := h.OnDebug(chainId)
+		e.Config.OnDebug = func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+			if onDebug != nil {
+				onDebug(flowType, nodeId, msg, relationType, err)
+			}
+			publish(flowType, nodeId, msg, relationType, err)
+		}
+		return nil
+	}
+}
+
+// Publish 发布事件，缓存到节点最近事件并推送给匹配的订阅者
+func (h *Hub) Publish(event Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.seq++
+	event.Seq = h.seq
+	key := nodeKey{chainId: event.ChainId, nodeId: event.NodeId}
+	buffer, ok := h.buffers[key]
+	if !ok {
+		buffer = newRing(h.config.BufferSize)
+		h.buffers[key] = buffer
+	}
+	buffer.add(event)
+	for sub := range h.subscribers {
+		if sub.filter.Match(event) {
+			sub.offer(event)
+		}
+	}
+}
+
+// Subscribe 订阅事件，先推送缓存中匹配的最近事件
+// 使用完需要调用Subscription.Close()取消订阅
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	sub := &Subscription{
+		hub:    h,
+		filter: filter,
+		ch:     make(chan Event, h.config.SubscriberBufferSize),
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, event := range h.recent(filter, h.config.SubscriberBufferSize) {
+		sub.offer(event)
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Recent 获取缓存中匹配的最近事件，按发生顺序排序，limit<=0不限制数量
+func (h *Hub) Recent(filter Filter, limit int) []Event {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.recent(filter, limit)
+}
+
+// Clear 清除缓存的事件
+func (h *Hub) Clear() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.buffers = make(map[nodeKey]*ring)
+}
+
+// Subscribers 当前订阅者数量
+func (h *Hub) Subscribers() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return len(h.subscribers)
+}
+
+func (h *Hub) recent(filter Filter, limit int) []Event {
+	events := make([]Event, 0)
+	for key, buffer := range h.buffers {
+		if (filter.ChainId != "" && filter.ChainId != key.chainId) || (filter.NodeId != "" && filter.NodeId != key.nodeId) {
+			continue
+		}
+		for _, event := range buffer.values() {
+			if filter.Match(event) {
+				events = append(events, event)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	return events
+}
+
+// ring 固定大小的环形缓冲区
+type ring struct {
+	items []Event
+	next  int
+	full  bool
+}
+
+func newRing(size int) *ring {
+	return &ring{items: make([]Event, size)}
+}
+
+func (r *ring) add(event Event) {
+	r.items[r.next] = event
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// values 按写入顺序返回
+func (r *ring) values() []Event {
+	if !r.full {
+		return r.items[:r.next]
+	}
+	values := make([]Event, 0, len(r.items))
+	values = append(values, r.items[r.next:]...)
+	return append(values, r.items[:r.next]...)
+}
@@ -0,0 +1,242 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint/admin"
+	"github.com/xyzbit/rulego/endpoint/rest"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var chainDef = `{
+  "ruleChain": {"id": "chain01", "name": "测试规则链"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsFilter", "name": "过滤", "debugMode": true, "configuration": {"jsScript": "return msg.temperature>10;"}},
+      {"id": "s2", "type": "log", "name": "日志", "debugMode": true, "configuration": {"jsScript": "return 'log';"}}
+    ],
+    "connections": [{"fromId": "s1", "toId": "s2", "type": "True"}]
+  }
+}`
+
+func publish(hub *Hub, chainId, nodeId, flowType string, n int) {
+	onDebug := hub.OnDebug(chainId)
+	for i := 0; i < n; i++ {
+		onDebug(flowType, nodeId, types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), types.Success, nil)
+	}
+}
+
+func TestHubBuffer(t *testing.T) {
+	hub := NewHub(Config{BufferSize: 3})
+	publish(hub, "c1", "s1", types.In, 5)
+	publish(hub, "c1", "s2", types.Out, 2)
+	publish(hub, "c2", "s1", types.In, 1)
+
+	events := hub.Recent(Filter{}, 0)
+	assert.Equal(t, 6, len(events))
+	// 每个节点只保留最近3条，按发生顺序排序
+	assert.Equal(t, uint64(3), events[0].Seq)
+	assert.Equal(t, uint64(8), events[5].Seq)
+
+	assert.Equal(t, 3, len(hub.Recent(Filter{ChainId: "c1", NodeId: "s1"}, 0)))
+	assert.Equal(t, 4, len(hub.Recent(Filter{NodeId: "s1"}, 0)))
+	assert.Equal(t, 2, len(hub.Recent(Filter{FlowType: types.Out}, 0)))
+	events = hub.Recent(Filter{ChainId: "c1"}, 2)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, uint64(7), events[1].Seq)
+
+	hub.Clear()
+	assert.Equal(t, 0, len(hub.Recent(Filter{}, 0)))
+}
+
+func TestHubSubscribe(t *testing.T) {
+	hub := NewHub(Config{SubscriberBufferSize: 2})
+	publish(hub, "c1", "s1", types.In, 1)
+
+	sub := hub.Subscribe(Filter{ChainId: "c1", FlowType: types.In})
+	assert.Equal(t, 1, hub.Subscribers())
+	// 先推送缓存的最近事件
+	event := <-sub.C()
+	assert.Equal(t, "s1", event.NodeId)
+
+	publish(hub, "c2", "s1", types.In, 1)
+	publish(hub, "c1", "s1", types.Out, 1)
+	publish(hub, "c1", "s2", types.In, 1)
+	event = <-sub.C()
+	assert.Equal(t, "s2", event.NodeId)
+
+	// 订阅者消费慢，丢弃事件，不阻塞发布者
+	publish(hub, "c1", "s1", types.In, 5)
+	assert.Equal(t, int64(3), sub.Dropped())
+
+	sub.Close()
+	sub.Close()
+	assert.Equal(t, 0, hub.Subscribers())
+	count := 0
+	for range sub.C() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestHubWithDebug(t *testing.T) {
+	hub := NewHub(Config{})
+	// 规则链已经配置的调试回调函数需要保留
+	var count int32
+	config := rulego.NewConfig(types.WithDefaultPool(), types.WithOnDebug(func(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+		atomic.AddInt32(&count, 1)
+	}))
+	ruleEngine, err := (&rulego.RuleGo{}).New("chain01", []byte(chainDef), rulego.WithConfig(config), hub.WithDebug("chain01"))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"temperature":41}`))
+	// s1、s2 各有IN和OUT事件，OUT事件异步回调
+	var events []Event
+	for i := 0; i < 100 && (len(events) < 4 || atomic.LoadInt32(&count) < 4); i++ {
+		time.Sleep(time.Millisecond * 10)
+		events = hub.Recent(Filter{ChainId: "chain01"}, 0)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&count))
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, "s1", events[0].NodeId)
+}
+
+func newTestServer(t *testing.T, hub *Hub) *httptest.Server {
+	restEndpoint := &rest.Rest{}
+	hub.Mount(restEndpoint)
+	server := httptest.NewServer(restEndpoint.Router())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWebSocket(t *testing.T) {
+	hub := NewHub(Config{Token: "secret"})
+	server := newTestServer(t, hub)
+	config := rulego.NewConfig(types.WithDefaultPool(), types.WithOnDebug(hub.OnDebug("chain01")))
+	ruleEngine, err := (&rulego.RuleGo{}).New("chain01", []byte(chainDef), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + DefaultBasePath + "/ws?nodeId=s2&flowType=IN"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"&token=secret", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	// 等待订阅完成
+	for hub.Subscribers() == 0 {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	msg := types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"temperature":41}`)
+	ruleEngine.OnMsgAndWait(msg)
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var event Event
+	assert.Nil(t, conn.ReadJSON(&event))
+	assert.Equal(t, "chain01", event.ChainId)
+	assert.Equal(t, "s2", event.NodeId)
+	assert.Equal(t, types.In, event.FlowType)
+	assert.Equal(t, msg.Id, event.Msg.Id)
+
+	_ = conn.Close()
+	for hub.Subscribers() != 0 {
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestSSE(t *testing.T) {
+	hub := NewHub(Config{})
+	server := newTestServer(t, hub)
+	publish(hub, "c1", "s1", types.In, 1)
+
+	resp, err := http.Get(server.URL + DefaultBasePath + "/sse?chainId=c1")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	publish(hub, "c2", "s1", types.In, 1)
+	publish(hub, "c1", "s2", types.Out, 1)
+
+	reader := bufio.NewReader(resp.Body)
+	var events []Event
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		if strings.HasPrefix(line, "data: ") {
+			var event Event
+			assert.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			events = append(events, event)
+		}
+	}
+	assert.Equal(t, "s1", events[0].NodeId)
+	assert.Equal(t, "s2", events[1].NodeId)
+
+	resp, err = http.Get(server.URL + DefaultBasePath + "/events?nodeId=s1&limit=1")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&events))
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "c2", events[0].ChainId)
+}
+
+func TestMountWithAdmin(t *testing.T) {
+	// 和管理接口挂载到同一个rest endpoint，接口路径不冲突
+	restEndpoint := &rest.Rest{}
+	adminApi := admin.New(admin.Config{RuleGo: &rulego.RuleGo{}})
+	adminApi.Mount(restEndpoint)
+	hub := NewHub(Config{})
+	hub.Mount(restEndpoint)
+	server := httptest.NewServer(restEndpoint.Router())
+	defer server.Close()
+
+	adminApi.OnDebug("c1")(types.In, "s1", types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), "", nil)
+	publish(hub, "c1", "s2", types.In, 1)
+
+	var adminEvents []admin.DebugEvent
+	resp, err := http.Get(server.URL + admin.DefaultBasePath + "/debug/events")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&adminEvents))
+	assert.Equal(t, 1, len(adminEvents))
+	assert.Equal(t, "s1", adminEvents[0].NodeId)
+
+	var events []Event
+	resp, err = http.Get(server.URL + DefaultBasePath + "/events")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&events))
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "s2", events[0].NodeId)
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package debug
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/endpoint/rest"
+)
+
+const (
+	// DefaultBasePath 默认接口路径前缀，和管理接口(endpoint/admin)的/api/v1/debug/events不冲突
+	DefaultBasePath = "/api/v1/debug/live"
+	// DefaultKeepAlive 默认推送连接保活间隔
+	DefaultKeepAlive = time.Second * 15
+	// writeTimeout WebSocket写超时
+	writeTimeout = time.Second * 10
+)
+
+var upgrader = websocket.Upgrader{
+	// 编辑器通常和规则引擎不同源，通过Token认证
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// Mount 把WebSocket、SSE和最近事件接口注册到rest endpoint
+func (h *Hub) Mount(restEndpoint *rest.Rest) *Hub {
+	base := strings.TrimSuffix(h.config.BasePath, "/")
+	restEndpoint.GET(h.router(base+"/ws", h.serveWebSocket))
+	restEndpoint.GET(h.router(base+"/sse", h.serveSSE))
+	restEndpoint.GET(h.router(base+"/events", h.serveEvents))
+	return h
+}
+
+// router 创建路由，先认证再处理请求
+func (h *Hub) router(path string, handler func(w http.ResponseWriter, r *http.Request)) *endpoint.Router {
+	return endpoint.NewRouter().From(path).Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		request, ok := exchange.In.(*rest.RequestMessage)
+		if !ok {
+			return false
+		}
+		response, ok := exchange.Out.(*rest.ResponseMessage)
+		if !ok {
+			return false
+		}
+		r, w := request.Request(), response.Response()
+		if !h.authorized(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+		handler(w, r)
+		return true
+	}).End()
+}
+
+// authorized Bearer token认证，也支持token参数
+func (h *Hub) authorized(r *http.Request) bool {
+	if h.config.Token == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Token)) == 1
+}
+
+// serveWebSocket 通过WebSocket推送事件，每个事件一条JSON文本消息
+func (h *Hub) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	sub := h.Subscribe(filterFromRequest(r))
+	defer sub.Close()
+
+	// 读取客户端消息，用于感知连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(h.config.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveSSE 通过SSE推送事件，事件名：debug，id：事件序号
+func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub := h.Subscribe(filterFromRequest(r))
+	defer sub.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(h.config.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: debug\ndata: %s\n\n", event.Seq, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			// 注释行保活
+			if _, err := fmt.Fprint(w, ":\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// serveEvents 查询最近的事件
+func (h *Hub) serveEvents(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	data, err := json.Marshal(h.Recent(filterFromRequest(r), limit))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func filterFromRequest(r *http.Request) Filter {
+	query := r.URL.Query()
+	return Filter{
+		ChainId:  query.Get("chainId"),
+		NodeId:   query.Get("nodeId"),
+		FlowType: query.Get("flowType"),
+	}
+}
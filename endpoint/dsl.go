@@ -0,0 +1,166 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/json"
+	"gopkg.in/yaml.v3"
+)
+
+// Dsl endpoint定义，用于通过json/yaml配置endpoint及其路由
+//
+//	{
+//	  "id": "api",
+//	  "type": "http",
+//	  "configuration": {"server": ":9090"},
+//	  "routers": [
+//	    {
+//	      "id": "msg",
+//	      "params": ["POST"],
+//	      "from": {"path": "/api/v1/msg/:msgType", "processors": [{"name": "headersToMetadata"}]},
+//	      "to": {"path": "chain:default", "wait": true, "processors": [{"name": "responseToBody"}]}
+//	    }
+//	  ]
+//	}
+type Dsl struct {
+	// Id endpoint ID
+	Id string `json:"id" yaml:"id"`
+	// Type endpoint类型，需要在DefaultFactory注册，例如：http、mqtt
+	Type string `json:"type" yaml:"type"`
+	// Name 名称
+	Name string `json:"name" yaml:"name,omitempty"`
+	// Configuration endpoint配置，对应endpoint的Config结构体
+	Configuration types.Configuration `json:"configuration" yaml:"configuration,omitempty"`
+	// Routers 路由列表
+	Routers []*RouterDsl `json:"routers" yaml:"routers"`
+}
+
+// RouterDsl 路由定义
+type RouterDsl struct {
+	// Id 路由ID，用于热更新时识别路由，为空使用from.path和params
+	Id string `json:"id" yaml:"id,omitempty"`
+	// Params 添加路由参数，例如：http endpoint的请求方法["POST"]
+	Params []interface{} `json:"params" yaml:"params,omitempty"`
+	// From 输入端
+	From FromDsl `json:"from" yaml:"from"`
+	// To 输出端，为空表示只执行from端处理器
+	To *ToDsl `json:"to" yaml:"to,omitempty"`
+}
+
+// Key 路由唯一标识
+func (r *RouterDsl) Key() string {
+	if r.Id != "" {
+		return r.Id
+	}
+	return fmt.Sprintf("%v %s", r.Params, r.From.Path)
+}
+
+// FromDsl 路由输入端定义
+type FromDsl struct {
+	// Path 来源路径，例如：http路径、mqtt主题
+	Path string `json:"path" yaml:"path"`
+	// Configuration from端配置
+	Configuration types.Configuration `json:"configuration" yaml:"configuration,omitempty"`
+	// Processors 处理器列表，按顺序执行
+	Processors []ProcessorDsl `json:"processors" yaml:"processors,omitempty"`
+}
+
+// ToDsl 路由输出端定义
+type ToDsl struct {
+	// Path 目标路径，例如：chain:default、component:log
+	Path string `json:"path" yaml:"path"`
+	// Configuration to组件配置
+	Configuration types.Configuration `json:"configuration" yaml:"configuration,omitempty"`
+	// Wait 是否同步等待规则链/组件执行结束，例如：http需要响应规则链结果
+	Wait bool `json:"wait" yaml:"wait,omitempty"`
+	// Processors 规则链执行结束后的处理器列表，按顺序执行
+	Processors []ProcessorDsl `json:"processors" yaml:"processors,omitempty"`
+}
+
+// ProcessorDsl 处理器定义，Name和JsScript二选一
+type ProcessorDsl struct {
+	// Name 处理函数名称，需要在DefaultProcessFactory注册
+	Name string `json:"name" yaml:"name,omitempty"`
+	// JsScript js脚本函数体，详见NewJsProcess
+	JsScript string `json:"jsScript" yaml:"jsScript,omitempty"`
+}
+
+// ParserDsl 通过json解析endpoint定义
+func ParserDsl(dsl []byte) (Dsl, error) {
+	var def Dsl
+	err := json.Unmarshal(dsl, &def)
+	return def, err
+}
+
+// ParserDslYaml 通过yaml解析endpoint定义
+func ParserDslYaml(dsl []byte) (Dsl, error) {
+	var def Dsl
+	err := yaml.Unmarshal(dsl, &def)
+	return def, err
+}
+
+// NewRouterFromDsl 根据路由定义创建路由
+func NewRouterFromDsl(def *RouterDsl, opts ...RouterOption) (router *Router, err error) {
+	if def == nil {
+		return nil, errors.New("router definition can't be nil")
+	}
+	router = NewRouter(opts...)
+	from := router.From(def.From.Path, def.From.Configuration)
+	for _, item := range def.From.Processors {
+		process, err := newProcess(router.Config, item)
+		if err != nil {
+			return nil, err
+		}
+		from.Process(process)
+	}
+	if def.To == nil || def.To.Path == "" {
+		return router, nil
+	}
+	// 创建to执行器失败会panic，转换成错误返回
+	defer func() {
+		if e := recover(); e != nil {
+			router = nil
+			err = fmt.Errorf("router=%s to=%s err:%v", def.Key(), def.To.Path, e)
+		}
+	}()
+	to := from.To(def.To.Path, def.To.Configuration)
+	if def.To.Wait {
+		to.Wait()
+	}
+	for _, item := range def.To.Processors {
+		process, err := newProcess(router.Config, item)
+		if err != nil {
+			return nil, err
+		}
+		to.Process(process)
+	}
+	return router, nil
+}
+
+func newProcess(config types.Config, def ProcessorDsl) (Process, error) {
+	if def.JsScript != "" {
+		return NewJsProcess(config, def.JsScript)
+	}
+	if process, ok := DefaultProcessFactory.Get(def.Name); ok {
+		return process, nil
+	}
+	return nil, fmt.Errorf("process=%s not found", def.Name)
+}
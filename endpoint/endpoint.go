@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"net/textproto"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -373,6 +374,12 @@ func (e *BaseEndpoint) AddInterceptors(interceptors ...Process) {
 }
 
 func (e *BaseEndpoint) DoProcess(router *Router, exchange *Exchange) {
+	e.DoProcessWithContext(context.TODO(), router, exchange)
+}
+
+// DoProcessWithContext 使用指定上下文执行路由逻辑
+// ctx 会传递给规则链，ctx取消或者超时，规则链停止往下一个节点分发消息。例如：http请求的客户端已经断开
+func (e *BaseEndpoint) DoProcessWithContext(ctx context.Context, router *Router, exchange *Exchange) {
 	for _, item := range e.interceptors {
 		// 执行全局拦截器
 		if !item(router, exchange) {
@@ -387,7 +394,7 @@ func (e *BaseEndpoint) DoProcess(router *Router, exchange *Exchange) {
 	}
 	// 执行to端逻辑
 	if router.GetFrom() != nil && router.GetFrom().GetTo() != nil {
-		router.GetFrom().GetTo().Execute(context.TODO(), exchange)
+		router.GetFrom().GetTo().Execute(ctx, exchange)
 	}
 }
 
@@ -481,17 +488,17 @@ func (ce *ChainExecutor) Execute(ctx context.Context, router *Router, exchange *
 					}
 				}
 			})
-			if toFlow.wait {
+			if toFlow.wait || waitFromContext(ctx) {
 				// 同步
 				ruleEngine.OnMsgAndWait(*inMsg, types.WithContext(ctx), endFunc)
 			} else {
-				// 异步
-				ruleEngine.OnMsgWithOptions(*inMsg, types.WithContext(ctx), endFunc)
+				// 异步，请求上下文在请求处理结束后会被取消，不能传递给规则链
+				ruleEngine.OnMsgWithOptions(*inMsg, types.WithContext(detachContext(ctx)), endFunc)
 			}
 		} else {
 			// 找不到规则链返回错误
+			exchange.Out.SetError(fmt.Errorf("chainId=%s %w", toChainId, ChainNotFoundErr))
 			for _, process := range toFlow.GetProcessList() {
-				exchange.Out.SetError(fmt.Errorf("chainId=%s not found error", toChainId))
 				if !process(router, exchange) {
 					break
 				}
@@ -501,6 +508,38 @@ func (ce *ChainExecutor) Execute(ctx context.Context, router *Router, exchange *
 	}
 }
 
+type waitKey struct{}
+
+// ContextWithWait 要求to端同步执行，等待规则链执行结束，不修改路由的Wait配置
+// 例如：定时调度端点通过该方法判断上一次执行是否结束
+func ContextWithWait(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, waitKey{}, true)
+}
+
+// waitFromContext ctx是否要求to端同步执行
+func waitFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	wait, _ := ctx.Value(waitKey{}).(bool)
+	return wait
+}
+
+// detachContext 创建不受ctx取消和超时影响的上下文，只保留链路上下文
+func detachContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	if ctx == nil {
+		return detached
+	}
+	if sc, ok := types.SpanContextFromContext(ctx); ok {
+		detached = types.ContextWithSpanContext(detached, sc)
+	}
+	return detached
+}
+
 // ComponentExecutor node组件执行器
 type ComponentExecutor struct {
 	component types.Node
@@ -568,6 +607,50 @@ func (ce *ComponentExecutor) Execute(ctx context.Context, router *Router, exchan
 // DefaultExecutorFactory 默认to端执行器注册器
 var DefaultExecutorFactory = new(ExecutorFactory)
 
+// Factory endpoint类型注册器，用于通过DSL配置创建endpoint
+type Factory struct {
+	sync.RWMutex
+	endpoints map[string]Endpoint
+}
+
+// Register 注册endpoint类型，类型名称为Endpoint.Type()
+func (f *Factory) Register(endpoint Endpoint) {
+	f.Lock()
+	defer f.Unlock()
+	if f.endpoints == nil {
+		f.endpoints = make(map[string]Endpoint)
+	}
+	f.endpoints[endpoint.Type()] = endpoint
+}
+
+// New 根据类型创建endpoint实例
+func (f *Factory) New(endpointType string) (Endpoint, error) {
+	f.RLock()
+	defer f.RUnlock()
+	if item, ok := f.endpoints[endpointType]; ok {
+		if ep, ok := item.New().(Endpoint); ok {
+			return ep, nil
+		}
+	}
+	return nil, fmt.Errorf("endpoint type=%s not found", endpointType)
+}
+
+// Types 已注册的endpoint类型列表
+func (f *Factory) Types() []string {
+	f.RLock()
+	defer f.RUnlock()
+	var items []string
+	for k := range f.endpoints {
+		items = append(items, k)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// DefaultFactory 默认endpoint类型注册器
+// 各endpoint包在init中注册，使用时需要导入对应的包
+var DefaultFactory = new(Factory)
+
 // 注册默认执行器
 func init() {
 	DefaultExecutorFactory.Register("chain", &ChainExecutor{})
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+// testMessage 测试消息
+type testMessage struct {
+	body []byte
+	msg  *types.RuleMsg
+	err  error
+}
+
+func (m *testMessage) Body() []byte {
+	return m.body
+}
+
+func (m *testMessage) Headers() textproto.MIMEHeader {
+	return textproto.MIMEHeader{}
+}
+
+func (m *testMessage) From() string {
+	return ""
+}
+
+func (m *testMessage) GetParam(key string) string {
+	return ""
+}
+
+func (m *testMessage) SetMsg(msg *types.RuleMsg) {
+	m.msg = msg
+}
+
+func (m *testMessage) GetMsg() *types.RuleMsg {
+	if m.msg == nil {
+		msg := types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), string(m.body))
+		m.msg = &msg
+	}
+	return m.msg
+}
+
+func (m *testMessage) SetStatusCode(statusCode int) {
+}
+
+func (m *testMessage) SetBody(body []byte) {
+	m.body = body
+}
+
+func (m *testMessage) SetError(err error) {
+	m.err = err
+}
+
+func (m *testMessage) GetError() error {
+	return m.err
+}
+
+// TestAsyncRouterDetachContext 异步路由不受请求上下文取消影响，只保留链路上下文
+func TestAsyncRouterDetachContext(t *testing.T) {
+	ruleGo := &rulego.RuleGo{}
+	_, err := ruleGo.New("detachContext", []byte(`{
+	  "ruleChain": {"id": "detachContext", "name": "test"},
+	  "metadata": {
+		"nodes": [{"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}]
+	  }
+	}`))
+	assert.Nil(t, err)
+
+	for _, wait := range []bool{false, true} {
+		result := make(chan error, 1)
+		to := NewRouter(WithRuleGo(ruleGo)).From("/").To("chain:detachContext").Process(func(router *Router, exchange *Exchange) bool {
+			result <- exchange.Out.GetError()
+			return true
+		})
+		if wait {
+			to.Wait()
+		}
+		router := to.End()
+		sc := types.SpanContext{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "00f067aa0ba902b7"}
+		ctx, cancel := context.WithCancel(types.ContextWithSpanContext(context.Background(), sc))
+		// 请求已经结束，请求上下文已经取消
+		cancel()
+		ep := &BaseEndpoint{}
+		ep.DoProcessWithContext(ctx, router, &Exchange{In: &testMessage{body: []byte(`{}`)}, Out: &testMessage{}})
+		select {
+		case err := <-result:
+			if wait {
+				assert.Equal(t, context.Canceled, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+
+	detached := detachContext(context.WithValue(types.ContextWithSpanContext(context.Background(), types.SpanContext{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "00f067aa0ba902b7"}), "k", "v"))
+	sc, ok := types.SpanContextFromContext(detached)
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceId)
+	assert.Nil(t, detached.Value("k"))
+}
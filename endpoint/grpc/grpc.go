@@ -0,0 +1,537 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpc gRPC接收端端点，把一元调用交给规则链处理
+//
+// 请求消息转换成JSON格式的RuleMsg.Data，gRPC元数据转换成RuleMsg.Metadata，
+// 等待规则链执行结束，把结束消息转换成方法声明的响应类型，错误转换成gRPC状态码。
+// Router.From 为gRPC方法全名，例如：/helloworld.Greeter/SayHello
+//
+// 内置通用服务：/rulego.RuleChain/OnMsg，请求和响应类型为google.protobuf.Value，可以传递任意JSON。
+// 也可以通过Config.Services注册protoregistry中的服务描述，动态提供这些服务。
+//
+// 例如：
+//
+//	grpcEndpoint := &grpc.Grpc{Config: grpc.Config{Server: ":9000", Services: []string{"helloworld.Greeter"}}}
+//	router := endpoint.NewRouter().From("/helloworld.Greeter/SayHello").To("chain:default").End()
+//	router2 := endpoint.NewRouter().From(grpc.GenericMethod).To("chain:${chainid}").End()
+//	grpcEndpoint.AddRouter(router, router2)
+//	err := grpcEndpoint.Start()
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/utils/maps"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// Type 组件类型
+	Type = "grpc"
+	// GenericService 内置通用服务名
+	GenericService = "rulego.RuleChain"
+	// GenericMethod 内置通用服务方法全名
+	GenericMethod = "/" + GenericService + "/OnMsg"
+
+	// KeyMethod gRPC方法全名元数据key
+	KeyMethod = "grpcMethod"
+	// KeyCode 规则链通过结束消息元数据指定返回的gRPC状态码，可以是数字或者名称，例如：5或者NotFound
+	KeyCode = "grpcCode"
+	// KeyMessage 规则链通过结束消息元数据指定返回的gRPC错误信息，默认使用消息负荷
+	KeyMessage = "grpcMessage"
+)
+
+var (
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true}
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// RequestMessage gRPC请求
+type RequestMessage struct {
+	ctx    context.Context
+	method string
+	body   []byte
+	md     metadata.MD
+	msg    *types.RuleMsg
+	err    error
+}
+
+func (r *RequestMessage) Body() []byte {
+	return r.body
+}
+
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	header := make(map[string][]string)
+	for k, v := range r.md {
+		header[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	return header
+}
+
+func (r *RequestMessage) From() string {
+	return r.method
+}
+
+// GetParam 获取gRPC元数据
+func (r *RequestMessage) GetParam(key string) string {
+	if v := r.md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+// GetMsg 请求消息转换成JSON格式的RuleMsg，gRPC元数据转换成消息元数据，多个值使用逗号分隔
+// 注意：gRPC元数据key都是小写
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		ruleMsg := types.NewMsg(0, r.method, types.JSON, types.NewMetadata(), string(r.body))
+		for k, v := range r.md {
+			ruleMsg.Metadata.PutValue(k, strings.Join(v, ","))
+		}
+		ruleMsg.Metadata.PutValue(KeyMethod, r.method)
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// Context 请求上下文
+func (r *RequestMessage) Context() context.Context {
+	return r.ctx
+}
+
+// ResponseMessage gRPC响应
+// 响应优先使用SetBody设置的内容，否则使用规则链结束消息
+// Headers 会作为gRPC响应头返回
+type ResponseMessage struct {
+	method     string
+	body       []byte
+	msg        *types.RuleMsg
+	headers    textproto.MIMEHeader
+	statusCode int
+	err        error
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	return r.method
+}
+
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+// SetStatusCode 设置gRPC状态码，非0则返回错误
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+	r.statusCode = statusCode
+}
+
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	return r.err
+}
+
+// Config gRPC服务配置
+type Config struct {
+	// Server 监听地址，例如：:9000
+	Server      string
+	CertFile    string
+	CertKeyFile string
+	// Services 需要动态提供的服务全名，例如：helloworld.Greeter
+	// 服务描述从protoregistry.GlobalFiles查找，只支持一元方法
+	Services []string
+}
+
+// 注册到endpoint类型注册器，可以通过DSL配置创建
+func init() {
+	endpoint.DefaultFactory.Register(&Grpc{})
+}
+
+// Grpc gRPC接收端端点
+type Grpc struct {
+	endpoint.BaseEndpoint
+	// 配置
+	Config     Config
+	RuleConfig types.Config
+	// Files 服务描述查找器，默认：protoregistry.GlobalFiles
+	Files    *protoregistry.Files
+	server   *grpc.Server
+	listener net.Listener
+}
+
+// Type 组件类型
+func (g *Grpc) Type() string {
+	return Type
+}
+
+func (g *Grpc) New() types.Node {
+	return &Grpc{}
+}
+
+// Init 初始化
+func (g *Grpc) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &g.Config)
+	g.RuleConfig = ruleConfig
+	return err
+}
+
+// Destroy 销毁
+func (g *Grpc) Destroy() {
+	_ = g.Close()
+}
+
+func (g *Grpc) Close() error {
+	if g.server != nil {
+		g.server.Stop()
+	}
+	return nil
+}
+
+func (g *Grpc) Id() string {
+	return g.Config.Server
+}
+
+func (g *Grpc) AddRouterWithParams(router *endpoint.Router, params ...interface{}) error {
+	g.AddRouter(router)
+	return nil
+}
+
+func (g *Grpc) RemoveRouterWithParams(from string, params ...interface{}) error {
+	g.Lock()
+	defer g.Unlock()
+	if g.RouterStorage != nil {
+		delete(g.RouterStorage, methodName(from))
+	}
+	return nil
+}
+
+// AddRouter 添加路由，From为gRPC方法全名，服务启动后也可以添加
+// 规则链总是同步执行，等待结束消息作为响应
+func (g *Grpc) AddRouter(routers ...*endpoint.Router) *Grpc {
+	g.Lock()
+	defer g.Unlock()
+	if g.RouterStorage == nil {
+		g.RouterStorage = make(map[string]*endpoint.Router)
+	}
+	for _, router := range routers {
+		if from := router.GetFrom(); from != nil && from.GetTo() != nil {
+			from.GetTo().Wait()
+		}
+		g.RouterStorage[methodName(router.FromToString())] = router
+	}
+	return g
+}
+
+// Start 注册服务并启动，监听成功后在后台提供服务
+func (g *Grpc) Start() error {
+	var opts []grpc.ServerOption
+	if g.Config.CertKeyFile != "" && g.Config.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(g.Config.CertFile, g.Config.CertKeyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	server := grpc.NewServer(opts...)
+	server.RegisterService(g.genericServiceDesc(), nil)
+	for _, name := range g.Config.Services {
+		desc, err := g.serviceDesc(name)
+		if err != nil {
+			return err
+		}
+		server.RegisterService(desc, nil)
+	}
+	listener, err := net.Listen("tcp", g.Config.Server)
+	if err != nil {
+		return err
+	}
+	g.server = server
+	g.listener = listener
+	g.Printf("starting grpc server on :%s", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			g.Printf("grpc server stopped :%v", err)
+		}
+	}()
+	return nil
+}
+
+// Addr 实际监听地址
+func (g *Grpc) Addr() net.Addr {
+	if g.listener != nil {
+		return g.listener.Addr()
+	}
+	return nil
+}
+
+// genericServiceDesc 内置通用服务
+func (g *Grpc) genericServiceDesc() *grpc.ServiceDesc {
+	newValue := func() proto.Message {
+		return &structpb.Value{}
+	}
+	return &grpc.ServiceDesc{
+		ServiceName: GenericService,
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "OnMsg",
+			Handler:    g.methodHandler(GenericMethod, newValue, newValue),
+		}},
+	}
+}
+
+// serviceDesc 根据服务描述动态创建服务
+func (g *Grpc) serviceDesc(name string) (*grpc.ServiceDesc, error) {
+	files := g.Files
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: %w", name, err)
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+	desc := &grpc.ServiceDesc{
+		ServiceName: name,
+		HandlerType: (*interface{})(nil),
+		Metadata:    service.ParentFile().Path(),
+	}
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		if method.IsStreamingClient() || method.IsStreamingServer() {
+			g.Printf("grpc method %s skipped, streaming is not supported", method.FullName())
+			continue
+		}
+		input, output := method.Input(), method.Output()
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: string(method.Name()),
+			Handler: g.methodHandler("/"+name+"/"+string(method.Name()), func() proto.Message {
+				return newMessage(input)
+			}, func() proto.Message {
+				return newMessage(output)
+			}),
+		})
+	}
+	return desc, nil
+}
+
+// methodHandler 一元方法处理器
+func (g *Grpc) methodHandler(method string, newRequest, newResponse func() proto.Message) func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newRequest()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return g.handle(ctx, method, req.(proto.Message), newResponse())
+		}
+		if interceptor == nil {
+			return handler(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+}
+
+// handle 把请求交给路由处理，并转换响应
+func (g *Grpc) handle(ctx context.Context, method string, req proto.Message, resp proto.Message) (proto.Message, error) {
+	g.RLock()
+	router, ok := g.RouterStorage[method]
+	g.RUnlock()
+	if !ok || router.IsDisable() {
+		return nil, status.Errorf(codes.Unimplemented, "method %s not routed", method)
+	}
+	body, err := marshalOptions.Marshal(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	// 传递W3C traceparent链路上下文
+	if v := md.Get(types.TraceParentHeader); len(v) > 0 {
+		if sc, ok := types.ParseTraceParent(v[0]); ok {
+			ctx = types.ContextWithSpanContext(ctx, sc)
+		}
+	}
+	in := &RequestMessage{ctx: ctx, method: method, body: body, md: md}
+	out := &ResponseMessage{method: method}
+	exchange := &endpoint.Exchange{In: in, Out: out}
+	if err := g.process(ctx, router, exchange); err != nil {
+		return nil, err
+	}
+
+	if len(out.headers) > 0 {
+		header := metadata.MD{}
+		for k, v := range out.headers {
+			header.Append(k, v...)
+		}
+		_ = grpc.SetHeader(ctx, header)
+	}
+	if out.err != nil {
+		return nil, toStatusError(out.err)
+	}
+	if out.statusCode != 0 {
+		return nil, status.Error(codes.Code(out.statusCode), string(out.body))
+	}
+	data := out.body
+	if data == nil && out.msg != nil {
+		if code, ok := parseCode(out.msg.Metadata.GetValue(KeyCode)); ok && code != codes.OK {
+			message := out.msg.Metadata.GetValue(KeyMessage)
+			if message == "" {
+				message = out.msg.Data
+			}
+			return nil, status.Error(code, message)
+		}
+		data = []byte(out.msg.Data)
+	}
+	if len(data) > 0 {
+		if err := unmarshalOptions.Unmarshal(data, resp); err != nil {
+			return nil, status.Errorf(codes.Internal, "convert response to %s: %v", resp.ProtoReflect().Descriptor().FullName(), err)
+		}
+	}
+	return resp, nil
+}
+
+func (g *Grpc) process(ctx context.Context, router *endpoint.Router, exchange *endpoint.Exchange) (err error) {
+	defer func() {
+		// 捕捉异常
+		if e := recover(); e != nil {
+			g.Printf("grpc handler err :%v", e)
+			err = status.Errorf(codes.Internal, "%v", e)
+		}
+	}()
+	g.DoProcessWithContext(ctx, router, exchange)
+	return nil
+}
+
+func (g *Grpc) Printf(format string, v ...interface{}) {
+	if g.RuleConfig.Logger != nil {
+		g.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// methodName 统一为/开头的方法全名
+func methodName(from string) string {
+	if strings.HasPrefix(from, "/") {
+		return from
+	}
+	return "/" + from
+}
+
+// newMessage 优先使用已经注册的消息类型，否则使用动态消息
+func newMessage(desc protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(desc)
+}
+
+// toStatusError 规则链错误转换成gRPC状态
+func toStatusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, endpoint.ChainNotFoundErr):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// parseCode 解析状态码，支持数字或者名称，例如：5、NotFound、NOT_FOUND
+func parseCode(v string) (codes.Code, bool) {
+	if v == "" {
+		return codes.OK, false
+	}
+	if i, err := strconv.Atoi(v); err == nil {
+		return codes.Code(i), true
+	}
+	name := strings.ReplaceAll(strings.ToLower(v), "_", "")
+	for i := codes.OK; i <= codes.Unauthenticated; i++ {
+		if strings.ToLower(i.String()) == name {
+			return i, true
+		}
+	}
+	return codes.Unknown, true
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/test/assert"
+	"github.com/xyzbit/rulego/testdata/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var helloChain = `{
+  "ruleChain": {"id": "hello"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "if (msg.name=='nobody') {metadata.grpcCode='NOT_FOUND';metadata.grpcMessage='user not found';} var reply={'code':200,'message':'Hello '+msg.name+' '+metadata.token,'unknown':1};return {'msg':reply,'metadata':metadata,'msgType':msgType};"}}
+    ]
+  }
+}`
+
+var failureChain = `{
+  "ruleChain": {"id": "failure"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "throw 'bad request';"}}
+    ]
+  }
+}`
+
+func TestGrpcEndpoint(t *testing.T) {
+	config := rulego.NewConfig(types.WithDefaultPool())
+	ruleGo := &rulego.RuleGo{}
+	_, err := ruleGo.New("hello", []byte(helloChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	_, err = ruleGo.New("failure", []byte(failureChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+
+	grpcEndpoint := &Grpc{}
+	assert.Nil(t, grpcEndpoint.Init(config, types.Configuration{"server": "127.0.0.1:0", "services": []string{"helloworld.Greeter"}}))
+	grpcEndpoint.AddRouter(
+		endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From("/helloworld.Greeter/SayHello").To("chain:hello").End(),
+		endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From("helloworld.Greeter/GetWalletInfo").To("chain:failure").End(),
+		endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From(GenericMethod).To("chain:${chainid}").End(),
+	)
+	assert.Nil(t, grpcEndpoint.Start())
+	defer grpcEndpoint.Destroy()
+	// 启动后添加路由
+	assert.Nil(t, grpcEndpoint.AddRouterWithParams(endpoint.NewRouter().From("/helloworld.Greeter/GetUserInfo").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.Headers().Set("x-user", exchange.In.GetMsg().Metadata.GetValue(KeyMethod))
+		exchange.Out.SetBody([]byte(`{"age":18,"nick_name":"` + exchange.In.GetParam("token") + `"}`))
+		return true
+	}).End()))
+
+	conn, err := grpc.Dial(grpcEndpoint.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "token", "t1", "chainid", "hello")
+
+	// 动态服务
+	reply := &pb.HelloReply{}
+	err = conn.Invoke(ctx, "/helloworld.Greeter/SayHello", &pb.HelloRequest{Name: "lala"}, reply)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(200), reply.Code)
+	assert.Equal(t, "Hello lala t1", reply.Message)
+
+	userReply := &pb.GetUserInfoReply{}
+	var header metadata.MD
+	err = conn.Invoke(ctx, "/helloworld.Greeter/GetUserInfo", &pb.GetUserInfoRequest{UserName: "lala"}, userReply, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(18), userReply.Age)
+	assert.Equal(t, "t1", userReply.NickName)
+	assert.Equal(t, []string{"/helloworld.Greeter/GetUserInfo"}, header.Get("x-user"))
+
+	// 通用服务
+	resp := &structpb.Value{}
+	req, _ := structpb.NewValue(map[string]interface{}{"name": "generic"})
+	err = conn.Invoke(ctx, GenericMethod, req, resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello generic t1", resp.GetStructValue().Fields["message"].GetStringValue())
+
+	// 错误状态码
+	err = conn.Invoke(ctx, "/helloworld.Greeter/SayHello", &pb.HelloRequest{Name: "nobody"}, reply)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "user not found", status.Convert(err).Message())
+
+	err = conn.Invoke(ctx, "/helloworld.Greeter/GetWalletInfo", &pb.GetWalletInfoRequest{}, &pb.GetWalletInfoReply{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = conn.Invoke(metadata.AppendToOutgoingContext(context.Background(), "chainid", "notFound"), GenericMethod, req, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	assert.Nil(t, grpcEndpoint.RemoveRouterWithParams("/helloworld.Greeter/GetUserInfo"))
+	err = conn.Invoke(ctx, "/helloworld.Greeter/GetUserInfo", &pb.GetUserInfoRequest{}, userReply)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	assert.NotNil(t, (&Grpc{Config: Config{Server: "127.0.0.1:0", Services: []string{"helloworld.NotFound"}}}).Start())
+}
+
+func TestParseCode(t *testing.T) {
+	for v, expected := range map[string]codes.Code{"5": codes.NotFound, "NotFound": codes.NotFound, "NOT_FOUND": codes.NotFound,
+		"invalid_argument": codes.InvalidArgument, "bad": codes.Unknown} {
+		code, ok := parseCode(v)
+		assert.True(t, ok)
+		assert.Equal(t, expected, code)
+	}
+	_, ok := parseCode("")
+	assert.False(t, ok)
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loader 通过DSL加载endpoint及其路由，并支持路由热更新
+//
+// 导入该包会注册所有内置endpoint类型：http、mqtt、schedule、websocket、net、grpc
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	_ "github.com/xyzbit/rulego/endpoint/grpc"
+	_ "github.com/xyzbit/rulego/endpoint/mqtt"
+	_ "github.com/xyzbit/rulego/endpoint/net"
+	_ "github.com/xyzbit/rulego/endpoint/rest"
+	_ "github.com/xyzbit/rulego/endpoint/schedule"
+	_ "github.com/xyzbit/rulego/endpoint/websocket"
+	"github.com/xyzbit/rulego/utils/json"
+)
+
+// ErrNotFound endpoint不存在
+var ErrNotFound = errors.New("endpoint not found")
+
+// Config 加载器配置
+type Config struct {
+	// RuleGo 路由使用的规则链池，默认使用rulego.DefaultRuleGo
+	RuleGo *rulego.RuleGo
+	// RuleConfig endpoint和路由使用的规则引擎配置，默认rulego.NewConfig()
+	RuleConfig *types.Config
+	// StartWait 启动endpoint后等待启动错误的时间，默认100ms
+	// http等endpoint的Start会阻塞，在该时间内没有返回错误则认为启动成功
+	StartWait time.Duration
+}
+
+// Loader endpoint加载器
+type Loader struct {
+	config    Config
+	lock      sync.Mutex
+	endpoints map[string]*entry
+}
+
+type entry struct {
+	def      endpoint.Dsl
+	endpoint endpoint.Endpoint
+}
+
+// New 创建加载器
+func New(config Config) *Loader {
+	if config.RuleGo == nil {
+		config.RuleGo = rulego.DefaultRuleGo
+	}
+	if config.RuleConfig == nil {
+		ruleConfig := rulego.NewConfig()
+		config.RuleConfig = &ruleConfig
+	}
+	if config.StartWait <= 0 {
+		config.StartWait = 100 * time.Millisecond
+	}
+	return &Loader{config: config, endpoints: make(map[string]*entry)}
+}
+
+// Load 创建endpoint、添加路由并启动，ID已经存在返回错误
+func (l *Loader) Load(def endpoint.Dsl) (endpoint.Endpoint, error) {
+	def, err := clone(def)
+	if err != nil {
+		return nil, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.endpoints[def.Id]; ok {
+		return nil, fmt.Errorf("endpoint id=%s already exists", def.Id)
+	}
+	return l.load(def)
+}
+
+// Reload 热更新endpoint，不存在则加载
+// 类型或者endpoint配置变化，重启endpoint；否则只更新变化的路由：删除、添加或者替换
+func (l *Loader) Reload(def endpoint.Dsl) (endpoint.Endpoint, error) {
+	def, err := clone(def)
+	if err != nil {
+		return nil, err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	old, ok := l.endpoints[def.Id]
+	if !ok {
+		return l.load(def)
+	}
+	if old.def.Type != def.Type || !reflect.DeepEqual(old.def.Configuration, def.Configuration) {
+		l.stop(def.Id, old)
+		return l.load(def)
+	}
+	routers, err := l.newRouters(def)
+	if err != nil {
+		return nil, err
+	}
+	newDefs := make(map[string]*endpoint.RouterDsl)
+	for _, item := range def.Routers {
+		newDefs[item.Key()] = item
+	}
+	for _, item := range old.def.Routers {
+		if newDef, ok := newDefs[item.Key()]; !ok || newDef.From.Path != item.From.Path || !reflect.DeepEqual(newDef.Params, item.Params) {
+			if err := old.endpoint.RemoveRouterWithParams(item.From.Path, item.Params...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	oldDefs := make(map[string]*endpoint.RouterDsl)
+	for _, item := range old.def.Routers {
+		oldDefs[item.Key()] = item
+	}
+	for i, item := range def.Routers {
+		if oldDef, ok := oldDefs[item.Key()]; ok && reflect.DeepEqual(oldDef, item) {
+			continue
+		}
+		if err := old.endpoint.AddRouterWithParams(routers[i], item.Params...); err != nil {
+			return nil, err
+		}
+	}
+	old.def = def
+	return old.endpoint, nil
+}
+
+// LoadFile 从文件加载或者热更新endpoint，.yaml/.yml文件使用yaml解析，否则使用json解析
+func (l *Loader) LoadFile(path string) (endpoint.Endpoint, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var def endpoint.Dsl
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		def, err = endpoint.ParserDslYaml(buf)
+	default:
+		def, err = endpoint.ParserDsl(buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l.Reload(def)
+}
+
+// Get 获取endpoint
+func (l *Loader) Get(id string) (endpoint.Endpoint, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if item, ok := l.endpoints[id]; ok {
+		return item.endpoint, true
+	}
+	return nil, false
+}
+
+// Dsl 获取endpoint当前的定义
+func (l *Loader) Dsl(id string) (endpoint.Dsl, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if item, ok := l.endpoints[id]; ok {
+		return item.def, true
+	}
+	return endpoint.Dsl{}, false
+}
+
+// Stop 停止并删除endpoint
+func (l *Loader) Stop(id string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	item, ok := l.endpoints[id]
+	if !ok {
+		return ErrNotFound
+	}
+	l.stop(id, item)
+	return nil
+}
+
+// Close 停止并删除所有endpoint
+func (l *Loader) Close() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for id, item := range l.endpoints {
+		l.stop(id, item)
+	}
+}
+
+func (l *Loader) load(def endpoint.Dsl) (endpoint.Endpoint, error) {
+	if def.Id == "" {
+		return nil, errors.New("endpoint id can't be empty")
+	}
+	ep, err := endpoint.DefaultFactory.New(def.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := ep.Init(*l.config.RuleConfig, def.Configuration); err != nil {
+		return nil, err
+	}
+	routers, err := l.newRouters(def)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range def.Routers {
+		if err := ep.AddRouterWithParams(routers[i], item.Params...); err != nil {
+			ep.Destroy()
+			return nil, err
+		}
+	}
+	if err := l.start(ep); err != nil {
+		ep.Destroy()
+		return nil, err
+	}
+	l.endpoints[def.Id] = &entry{def: def, endpoint: ep}
+	return ep, nil
+}
+
+// 创建所有路由，任意路由定义错误则返回错误，不修改endpoint
+func (l *Loader) newRouters(def endpoint.Dsl) ([]*endpoint.Router, error) {
+	var routers []*endpoint.Router
+	for _, item := range def.Routers {
+		router, err := endpoint.NewRouterFromDsl(item, endpoint.WithRuleGo(l.config.RuleGo), endpoint.WithRuleConfig(*l.config.RuleConfig))
+		if err != nil {
+			return nil, err
+		}
+		routers = append(routers, router)
+	}
+	return routers, nil
+}
+
+// 在后台启动endpoint，等待StartWait时间获取启动错误
+func (l *Loader) start(ep endpoint.Endpoint) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- ep.Start()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(l.config.StartWait):
+		go func() {
+			if err := <-result; err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.Printf("endpoint id=%s stopped :%v", ep.Id(), err)
+			}
+		}()
+		return nil
+	}
+}
+
+func (l *Loader) stop(id string, item *entry) {
+	item.endpoint.Destroy()
+	delete(l.endpoints, id)
+}
+
+// 复制定义，避免调用方修改已加载的定义，并统一json/yaml解析的数值类型，用于比较定义是否变化
+func clone(def endpoint.Dsl) (endpoint.Dsl, error) {
+	var result endpoint.Dsl
+	buf, err := json.Marshal(def)
+	if err == nil {
+		err = json.Unmarshal(buf, &result)
+	}
+	return result, err
+}
+
+func (l *Loader) Printf(format string, v ...interface{}) {
+	if l.config.RuleConfig.Logger != nil {
+		l.config.RuleConfig.Logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loader
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var chainDef = `{
+  "ruleChain": {"id": "chain01", "name": "测试规则链"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsTransform", "name": "转换", "configuration": {"jsScript": "msg.status='ok';msg.user=metadata.userId;return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+    ]
+  }
+}`
+
+var endpointDsl = `
+id: api
+type: http
+configuration:
+  server: 127.0.0.1:19093
+routers:
+  - id: msg
+    params: [POST]
+    from:
+      path: /api/v1/msg/:msgType
+      processors:
+        - name: headersToMetadata
+        - jsScript: |
+            metadata.userId = metadata.Userid;
+            return {'msg':msg,'metadata':metadata,'msgType':metadata.msgType};
+    to:
+      path: chain:chain01
+      wait: true
+      processors:
+        - name: responseToBody
+  - id: ping
+    params: [GET]
+    from:
+      path: /api/v1/ping
+      processors:
+        - name: pong
+`
+
+func post(t *testing.T, url string) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"temperature":41}`))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("userId", "u1")
+	return do(t, req)
+}
+
+func get(t *testing.T, url string) (int, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.Nil(t, err)
+	return do(t, req)
+}
+
+func do(t *testing.T, req *http.Request) (int, string) {
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp.StatusCode, string(b)
+}
+
+func TestLoader(t *testing.T) {
+	pool := &rulego.RuleGo{}
+	config := rulego.NewConfig(types.WithDefaultPool())
+	_, err := pool.New("chain01", []byte(chainDef), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	endpoint.DefaultProcessFactory.Register("pong", func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("pong"))
+		return true
+	})
+	defer endpoint.DefaultProcessFactory.Unregister("pong")
+
+	file := filepath.Join(t.TempDir(), "api.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte(endpointDsl), 0644))
+
+	l := New(Config{RuleGo: pool, RuleConfig: &config})
+	defer l.Close()
+	ep, err := l.LoadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "http", ep.Type())
+
+	code, body := post(t, "http://127.0.0.1:19093/api/v1/msg/TEST")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, strings.Contains(body, `"status":"ok"`))
+	assert.True(t, strings.Contains(body, `"user":"u1"`))
+	code, body = get(t, "http://127.0.0.1:19093/api/v1/ping")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "pong", body)
+
+	// 重复加载
+	def, ok := l.Dsl("api")
+	assert.True(t, ok)
+	_, err = l.Load(def)
+	assert.NotNil(t, err)
+
+	// 错误的定义不修改endpoint
+	def, _ = endpoint.ParserDslYaml([]byte(endpointDsl))
+	def.Routers[1].From.Processors[0].Name = "notFound"
+	_, err = l.Reload(def)
+	assert.NotNil(t, err)
+	code, _ = get(t, "http://127.0.0.1:19093/api/v1/ping")
+	assert.Equal(t, http.StatusOK, code)
+
+	// 热更新：替换msg路由，删除ping路由
+	def, _ = endpoint.ParserDslYaml([]byte(endpointDsl))
+	def.Routers[0].To.Path = "chain:chain02"
+	def.Routers = def.Routers[:1]
+	reloaded, err := l.Reload(def)
+	assert.Nil(t, err)
+	assert.True(t, reloaded == ep)
+
+	code, body = post(t, "http://127.0.0.1:19093/api/v1/msg/TEST")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.True(t, strings.Contains(body, endpoint.ChainNotFoundErr.Error()))
+	code, _ = get(t, "http://127.0.0.1:19093/api/v1/ping")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// 配置变化，重启endpoint
+	def.Configuration["server"] = "127.0.0.1:19094"
+	reloaded, err = l.Reload(def)
+	assert.Nil(t, err)
+	assert.True(t, reloaded != ep)
+	code, _ = post(t, "http://127.0.0.1:19094/api/v1/msg/TEST")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	assert.Nil(t, l.Stop("api"))
+	assert.Equal(t, ErrNotFound, l.Stop("api"))
+	_, ok = l.Get("api")
+	assert.False(t, ok)
+}
+
+func TestNewRouterFromDsl(t *testing.T) {
+	_, err := endpoint.NewRouterFromDsl(&endpoint.RouterDsl{
+		From: endpoint.FromDsl{Path: "/a", Processors: []endpoint.ProcessorDsl{{JsScript: "return {"}}},
+	})
+	assert.NotNil(t, err)
+	_, err = endpoint.NewRouterFromDsl(&endpoint.RouterDsl{
+		From: endpoint.FromDsl{Path: "/a"},
+		To:   &endpoint.ToDsl{Path: "component:notFound"},
+	})
+	assert.NotNil(t, err)
+	router, err := endpoint.NewRouterFromDsl(&endpoint.RouterDsl{
+		From: endpoint.FromDsl{Path: "/a"},
+		To:   &endpoint.ToDsl{Path: "chain:${chainId}", Wait: true},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "/a", router.FromToString())
+	assert.True(t, router.GetFrom().GetTo().HasVars)
+
+	assert.True(t, len(endpoint.DefaultFactory.Types()) >= 6)
+	_, err = endpoint.DefaultFactory.New("notFound")
+	assert.NotNil(t, err)
+}
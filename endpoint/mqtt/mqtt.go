@@ -152,6 +152,11 @@ func (r *ResponseMessage) Response() paho.Client {
 	return r.response
 }
 
+// 注册到endpoint类型注册器，可以通过DSL配置创建
+func init() {
+	endpoint.DefaultFactory.Register(&Mqtt{})
+}
+
 // Mqtt MQTT 接收端端点
 type Mqtt struct {
 	endpoint.BaseEndpoint
@@ -199,6 +204,9 @@ func (m *Mqtt) AddRouterWithParams(router *endpoint.Router, params ...interface{
 
 func (m *Mqtt) RemoveRouterWithParams(from string, params ...interface{}) error {
 	m.deleteRouter(from)
+	if m.client == nil {
+		return nil
+	}
 	return m.client.UnregisterHandler(from)
 }
 
@@ -0,0 +1,226 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// FramingLine 按换行符分帧，兼容\r\n
+	FramingLine = "line"
+	// FramingDelimiter 按自定义分隔符分帧
+	FramingDelimiter = "delimiter"
+	// FramingFixed 固定长度分帧
+	FramingFixed = "fixed"
+	// FramingLengthPrefix 长度前缀分帧，长度不包含前缀本身
+	FramingLengthPrefix = "lengthPrefix"
+
+	// DefaultMaxFrameLength 默认最大帧长度
+	DefaultMaxFrameLength = 64 * 1024
+)
+
+// ErrFrameTooLong 帧超过最大长度
+var ErrFrameTooLong = errors.New("frame too long")
+
+// Framer 分帧策略
+type Framer interface {
+	// ReadFrame 读取一帧，返回的数据不包含分隔符或者长度前缀
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+	// WriteFrame 按相同的分帧方式写入一帧
+	WriteFrame(w io.Writer, data []byte) error
+}
+
+// FramingConfig 分帧配置
+type FramingConfig struct {
+	// Type 分帧方式：line/delimiter/fixed/lengthPrefix，默认：line
+	Type string
+	// Delimiter 分隔符，Type=delimiter时有效
+	Delimiter string
+	// Length 帧长度，Type=fixed时有效
+	Length int
+	// PrefixSize 长度前缀字节数：1/2/4，默认：2，Type=lengthPrefix时有效
+	PrefixSize int
+	// LittleEndian 长度前缀是否小端字节序，默认大端
+	LittleEndian bool
+	// MaxFrameLength 最大帧长度，默认：65536
+	MaxFrameLength int
+}
+
+// NewFramer 根据配置创建分帧策略
+func NewFramer(config FramingConfig) (Framer, error) {
+	maxLength := config.MaxFrameLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxFrameLength
+	}
+	switch config.Type {
+	case "", FramingLine:
+		return &DelimiterFramer{Delimiter: []byte("\n"), TrimCR: true, MaxFrameLength: maxLength}, nil
+	case FramingDelimiter:
+		if config.Delimiter == "" {
+			return nil, errors.New("delimiter can not be empty")
+		}
+		return &DelimiterFramer{Delimiter: []byte(config.Delimiter), MaxFrameLength: maxLength}, nil
+	case FramingFixed:
+		if config.Length <= 0 {
+			return nil, errors.New("fixed length must be positive")
+		}
+		return &FixedLengthFramer{Length: config.Length}, nil
+	case FramingLengthPrefix:
+		prefixSize := config.PrefixSize
+		if prefixSize == 0 {
+			prefixSize = 2
+		}
+		if prefixSize != 1 && prefixSize != 2 && prefixSize != 4 {
+			return nil, fmt.Errorf("unsupported prefix size %d", prefixSize)
+		}
+		var order binary.ByteOrder = binary.BigEndian
+		if config.LittleEndian {
+			order = binary.LittleEndian
+		}
+		return &LengthPrefixFramer{PrefixSize: prefixSize, ByteOrder: order, MaxFrameLength: maxLength}, nil
+	default:
+		return nil, fmt.Errorf("unsupported framing type %s", config.Type)
+	}
+}
+
+// DelimiterFramer 按分隔符分帧
+type DelimiterFramer struct {
+	Delimiter []byte
+	// TrimCR 是否去掉帧末尾的\r
+	TrimCR         bool
+	MaxFrameLength int
+}
+
+func (f *DelimiterFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	last := f.Delimiter[len(f.Delimiter)-1]
+	var frame []byte
+	for {
+		chunk, err := r.ReadSlice(last)
+		frame = append(frame, chunk...)
+		if f.MaxFrameLength > 0 && len(frame) > f.MaxFrameLength+len(f.Delimiter) {
+			return nil, ErrFrameTooLong
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(frame) > 0 {
+			// 结束前最后一帧没有分隔符，例如：udp报文最后一帧
+			return f.trim(frame), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasSuffix(frame, f.Delimiter) {
+			return f.trim(frame[:len(frame)-len(f.Delimiter)]), nil
+		}
+	}
+}
+
+func (f *DelimiterFramer) trim(frame []byte) []byte {
+	if f.TrimCR {
+		return bytes.TrimSuffix(frame, []byte("\r"))
+	}
+	return frame
+}
+
+func (f *DelimiterFramer) WriteFrame(w io.Writer, data []byte) error {
+	_, err := w.Write(append(append([]byte{}, data...), f.Delimiter...))
+	return err
+}
+
+// FixedLengthFramer 固定长度分帧
+type FixedLengthFramer struct {
+	Length int
+}
+
+func (f *FixedLengthFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	frame := make([]byte, f.Length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// WriteFrame 数据长度必须等于帧长度
+func (f *FixedLengthFramer) WriteFrame(w io.Writer, data []byte) error {
+	if len(data) != f.Length {
+		return fmt.Errorf("frame length %d, expected %d", len(data), f.Length)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// LengthPrefixFramer 长度前缀分帧
+type LengthPrefixFramer struct {
+	// PrefixSize 长度前缀字节数：1/2/4
+	PrefixSize     int
+	ByteOrder      binary.ByteOrder
+	MaxFrameLength int
+}
+
+func (f *LengthPrefixFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	prefix := make([]byte, f.PrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+	var length int
+	switch f.PrefixSize {
+	case 1:
+		length = int(prefix[0])
+	case 2:
+		length = int(f.ByteOrder.Uint16(prefix))
+	default:
+		length = int(f.ByteOrder.Uint32(prefix))
+	}
+	if f.MaxFrameLength > 0 && length > f.MaxFrameLength {
+		return nil, ErrFrameTooLong
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (f *LengthPrefixFramer) WriteFrame(w io.Writer, data []byte) error {
+	prefix := make([]byte, f.PrefixSize)
+	switch f.PrefixSize {
+	case 1:
+		if len(data) > 0xff {
+			return ErrFrameTooLong
+		}
+		prefix[0] = byte(len(data))
+	case 2:
+		if len(data) > 0xffff {
+			return ErrFrameTooLong
+		}
+		f.ByteOrder.PutUint16(prefix, uint16(len(data)))
+	default:
+		f.ByteOrder.PutUint32(prefix, uint32(len(data)))
+	}
+	_, err := w.Write(append(prefix, data...))
+	return err
+}
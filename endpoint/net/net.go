@@ -0,0 +1,588 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package net TCP/UDP接收端端点
+//
+// 每一帧数据转换成`DataType: BINARY`的RuleMsg，数据使用hex或者base64编码，
+// 元数据包含客户端地址，调用`Exchange.Out.SetBody`按相同的分帧方式在同一个连接回复客户端。
+// Router.From 为匹配帧数据的正则表达式，*匹配所有帧，所有匹配的路由都会处理该帧。
+//
+// 例如：
+//
+//	tcpEndpoint := &net.Net{Config: net.Config{Protocol: "tcp", Server: ":8888",
+//		Framing: net.FramingConfig{Type: net.FramingLengthPrefix, PrefixSize: 2}}}
+//	router := endpoint.NewRouter().From("*").To("chain:default").End()
+//	tcpEndpoint.AddRouter(router)
+//	err := tcpEndpoint.Start()
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+const (
+	// Type 组件类型
+	Type = "net"
+
+	// ProtocolTCP tcp协议
+	ProtocolTCP = "tcp"
+	// ProtocolUDP udp协议
+	ProtocolUDP = "udp"
+
+	// EncodingHex 帧数据hex编码
+	EncodingHex = "hex"
+	// EncodingBase64 帧数据base64编码
+	EncodingBase64 = "base64"
+
+	// KeyRemoteAddr 客户端地址元数据key
+	KeyRemoteAddr = "remoteAddr"
+	// KeyLocalAddr 服务端地址元数据key
+	KeyLocalAddr = "localAddr"
+	// KeyProtocol 协议元数据key
+	KeyProtocol = "protocol"
+	// KeyEncoding 帧数据编码元数据key
+	KeyEncoding = "encoding"
+
+	// 匹配所有帧
+	matchAll = "*"
+	// udp最大报文长度
+	maxDatagramSize = 64 * 1024
+)
+
+// Encode 按编码方式编码帧数据
+func Encode(encoding string, data []byte) string {
+	if encoding == EncodingBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+// Decode 按编码方式解码帧数据，用于把RuleMsg.Data还原成原始帧
+func Decode(encoding string, data string) ([]byte, error) {
+	if encoding == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return hex.DecodeString(data)
+}
+
+// RequestMessage 收到的帧
+type RequestMessage struct {
+	conn    *connection
+	body    []byte
+	msgType string
+	msg     *types.RuleMsg
+	err     error
+}
+
+func (r *RequestMessage) Body() []byte {
+	return r.body
+}
+
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	header := make(map[string][]string)
+	header[KeyRemoteAddr] = []string{r.conn.remoteAddr.String()}
+	header[KeyLocalAddr] = []string{r.conn.localAddr.String()}
+	header[KeyProtocol] = []string{r.conn.protocol}
+	return header
+}
+
+func (r *RequestMessage) From() string {
+	return r.conn.remoteAddr.String()
+}
+
+func (r *RequestMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		ruleMsg := types.NewMsg(0, r.msgType, types.BINARY, types.NewMetadata(), Encode(r.conn.encoding, r.body))
+		ruleMsg.Metadata.PutValue(KeyRemoteAddr, r.conn.remoteAddr.String())
+		ruleMsg.Metadata.PutValue(KeyLocalAddr, r.conn.localAddr.String())
+		ruleMsg.Metadata.PutValue(KeyProtocol, r.conn.protocol)
+		ruleMsg.Metadata.PutValue(KeyEncoding, r.conn.encoding)
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// ResponseMessage 回复客户端
+type ResponseMessage struct {
+	conn    *connection
+	body    []byte
+	msg     *types.RuleMsg
+	headers textproto.MIMEHeader
+	err     error
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	return r.conn.remoteAddr.String()
+}
+
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+}
+
+// SetBody 按相同的分帧方式回复客户端，body为原始帧数据
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+	if err := r.conn.write(body); err != nil {
+		r.err = err
+	}
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	return r.err
+}
+
+// Config 服务配置
+type Config struct {
+	// Protocol 协议：tcp/udp，默认：tcp
+	Protocol string
+	// Server 监听地址，例如：:8888
+	Server string
+	// Framing 分帧配置，tcp默认按换行符分帧，udp默认每个报文一帧
+	Framing FramingConfig
+	// Encoding RuleMsg.Data的编码方式：hex/base64，默认：hex
+	Encoding string
+	// MsgType 消息类型，默认：协议名大写，例如：TCP
+	MsgType string
+	// IdleTimeout tcp连接空闲超时时间，超时没有收到数据则关闭连接，0不超时
+	IdleTimeout time.Duration
+	// MaxConnections tcp最大连接数，超过则拒绝新连接，0不限制
+	MaxConnections int
+}
+
+// 注册到endpoint类型注册器，可以通过DSL配置创建
+func init() {
+	endpoint.DefaultFactory.Register(&Net{})
+}
+
+// Net TCP/UDP接收端端点
+type Net struct {
+	endpoint.BaseEndpoint
+	// 配置
+	Config     Config
+	RuleConfig types.Config
+	framer     Framer
+	// 路由匹配的正则表达式，key:From
+	patterns map[string]*regexp.Regexp
+	listener net.Listener
+	udpConn  net.PacketConn
+	// 当前tcp连接
+	conns     map[*connection]struct{}
+	connCount int32
+	connLock  sync.Mutex
+	closed    int32
+}
+
+// Type 组件类型
+func (n *Net) Type() string {
+	return Type
+}
+
+func (n *Net) New() types.Node {
+	return &Net{}
+}
+
+// Init 初始化
+func (n *Net) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &n.Config)
+	n.RuleConfig = ruleConfig
+	return err
+}
+
+// Destroy 销毁
+func (n *Net) Destroy() {
+	_ = n.Close()
+}
+
+// Close 关闭服务和所有连接
+func (n *Net) Close() error {
+	atomic.StoreInt32(&n.closed, 1)
+	var err error
+	if n.listener != nil {
+		err = n.listener.Close()
+	}
+	if n.udpConn != nil {
+		err = n.udpConn.Close()
+	}
+	n.connLock.Lock()
+	defer n.connLock.Unlock()
+	for c := range n.conns {
+		_ = c.conn.Close()
+	}
+	return err
+}
+
+func (n *Net) Id() string {
+	return n.Config.Server
+}
+
+func (n *Net) AddRouterWithParams(router *endpoint.Router, params ...interface{}) error {
+	return n.addRouter(router)
+}
+
+func (n *Net) RemoveRouterWithParams(from string, params ...interface{}) error {
+	n.Lock()
+	defer n.Unlock()
+	if n.RouterStorage != nil {
+		delete(n.RouterStorage, from)
+	}
+	delete(n.patterns, from)
+	return nil
+}
+
+// AddRouter 添加路由，From为匹配帧数据的正则表达式，*匹配所有帧
+// 正则表达式错误打印日志并忽略该路由，需要返回错误使用 AddRouterWithParams
+func (n *Net) AddRouter(routers ...*endpoint.Router) *Net {
+	for _, router := range routers {
+		if err := n.addRouter(router); err != nil {
+			n.Printf("net add router err :%v", err)
+		}
+	}
+	return n
+}
+
+func (n *Net) addRouter(router *endpoint.Router) error {
+	from := router.FromToString()
+	var pattern *regexp.Regexp
+	if from != matchAll && from != "" {
+		var err error
+		if pattern, err = regexp.Compile(from); err != nil {
+			return err
+		}
+	}
+	n.Lock()
+	defer n.Unlock()
+	if n.RouterStorage == nil {
+		n.RouterStorage = make(map[string]*endpoint.Router)
+	}
+	if n.patterns == nil {
+		n.patterns = make(map[string]*regexp.Regexp)
+	}
+	n.RouterStorage[from] = router
+	n.patterns[from] = pattern
+	return nil
+}
+
+// Start 启动服务，监听成功后在后台接收数据
+func (n *Net) Start() error {
+	if n.Config.Encoding == "" {
+		n.Config.Encoding = EncodingHex
+	}
+	if n.Config.Encoding != EncodingHex && n.Config.Encoding != EncodingBase64 {
+		return fmt.Errorf("unsupported encoding %s", n.Config.Encoding)
+	}
+	protocol := strings.ToLower(n.Config.Protocol)
+	if protocol == "" {
+		protocol = ProtocolTCP
+	}
+	if n.Config.MsgType == "" {
+		n.Config.MsgType = strings.ToUpper(protocol)
+	}
+	atomic.StoreInt32(&n.closed, 0)
+	switch protocol {
+	case ProtocolTCP:
+		framer, err := NewFramer(n.Config.Framing)
+		if err != nil {
+			return err
+		}
+		n.framer = framer
+		listener, err := net.Listen(ProtocolTCP, n.Config.Server)
+		if err != nil {
+			return err
+		}
+		n.listener = listener
+		n.Printf("starting tcp server on :%s", listener.Addr())
+		go n.acceptTCP()
+	case ProtocolUDP:
+		if n.Config.Framing.Type != "" {
+			framer, err := NewFramer(n.Config.Framing)
+			if err != nil {
+				return err
+			}
+			n.framer = framer
+		}
+		conn, err := net.ListenPacket(ProtocolUDP, n.Config.Server)
+		if err != nil {
+			return err
+		}
+		n.udpConn = conn
+		n.Printf("starting udp server on :%s", conn.LocalAddr())
+		go n.serveUDP()
+	default:
+		return fmt.Errorf("unsupported protocol %s", n.Config.Protocol)
+	}
+	return nil
+}
+
+// Addr 实际监听地址
+func (n *Net) Addr() net.Addr {
+	if n.listener != nil {
+		return n.listener.Addr()
+	}
+	if n.udpConn != nil {
+		return n.udpConn.LocalAddr()
+	}
+	return nil
+}
+
+func (n *Net) acceptTCP() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			if atomic.LoadInt32(&n.closed) == 0 {
+				n.Printf("tcp accept err :%v", err)
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if !n.acquireConn() {
+			n.Printf("tcp connection from %s rejected, max connections %d reached", conn.RemoteAddr(), n.Config.MaxConnections)
+			_ = conn.Close()
+			continue
+		}
+		go n.serveTCP(conn)
+	}
+}
+
+// acquireConn 占用一个连接数，达到最大连接数返回false
+// 需要在启动连接处理协程前占用，否则短时间内大量连接可能超过最大连接数
+func (n *Net) acquireConn() bool {
+	for {
+		count := atomic.LoadInt32(&n.connCount)
+		if n.Config.MaxConnections > 0 && count >= int32(n.Config.MaxConnections) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&n.connCount, count, count+1) {
+			return true
+		}
+	}
+}
+
+// serveTCP 处理tcp连接，调用前需要通过acquireConn占用连接数，连接关闭时释放
+func (n *Net) serveTCP(conn net.Conn) {
+	c := &connection{
+		protocol:   ProtocolTCP,
+		encoding:   n.Config.Encoding,
+		framer:     n.framer,
+		conn:       conn,
+		remoteAddr: conn.RemoteAddr(),
+		localAddr:  conn.LocalAddr(),
+	}
+	n.connLock.Lock()
+	if n.conns == nil {
+		n.conns = make(map[*connection]struct{})
+	}
+	n.conns[c] = struct{}{}
+	n.connLock.Unlock()
+	defer func() {
+		_ = conn.Close()
+		n.connLock.Lock()
+		delete(n.conns, c)
+		atomic.AddInt32(&n.connCount, -1)
+		n.connLock.Unlock()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		if n.Config.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(n.Config.IdleTimeout))
+		}
+		frame, err := n.framer.ReadFrame(reader)
+		if err != nil {
+			if err != io.EOF && atomic.LoadInt32(&n.closed) == 0 {
+				n.Printf("tcp connection %s closed :%v", c.remoteAddr, err)
+			}
+			return
+		}
+		n.process(c, frame)
+	}
+}
+
+func (n *Net) serveUDP() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		size, addr, err := n.udpConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			n.Printf("udp read err :%v", err)
+			continue
+		}
+		c := &connection{
+			protocol:   ProtocolUDP,
+			encoding:   n.Config.Encoding,
+			framer:     n.framer,
+			packetConn: n.udpConn,
+			remoteAddr: addr,
+			localAddr:  n.udpConn.LocalAddr(),
+		}
+		packet := append([]byte{}, buf[:size]...)
+		if n.framer == nil {
+			n.process(c, packet)
+			continue
+		}
+		reader := bufio.NewReader(bytes.NewReader(packet))
+		for {
+			frame, err := n.framer.ReadFrame(reader)
+			if err != nil {
+				break
+			}
+			n.process(c, frame)
+		}
+	}
+}
+
+// process 交给所有匹配的路由处理
+func (n *Net) process(c *connection, frame []byte) {
+	n.RLock()
+	var routers []*endpoint.Router
+	for from, router := range n.RouterStorage {
+		if pattern := n.patterns[from]; pattern == nil || pattern.Match(frame) {
+			routers = append(routers, router)
+		}
+	}
+	n.RUnlock()
+	for _, router := range routers {
+		n.handle(router, c, frame)
+	}
+}
+
+func (n *Net) handle(router *endpoint.Router, c *connection, frame []byte) {
+	defer func() {
+		// 捕捉异常
+		if e := recover(); e != nil {
+			n.Printf("net handler err :%v", e)
+		}
+	}()
+	if router.IsDisable() {
+		return
+	}
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			conn:    c,
+			body:    frame,
+			msgType: n.Config.MsgType,
+		},
+		Out: &ResponseMessage{
+			conn: c,
+		},
+	}
+	n.DoProcess(router, exchange)
+}
+
+func (n *Net) Printf(format string, v ...interface{}) {
+	if n.RuleConfig.Logger != nil {
+		n.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// connection tcp连接或者udp客户端
+type connection struct {
+	protocol   string
+	encoding   string
+	framer     Framer
+	conn       net.Conn
+	packetConn net.PacketConn
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	writeLock  sync.Mutex
+}
+
+// write 按分帧方式写入一帧
+func (c *connection) write(data []byte) error {
+	if c.packetConn != nil {
+		if c.framer != nil {
+			var buf bytes.Buffer
+			if err := c.framer.WriteFrame(&buf, data); err != nil {
+				return err
+			}
+			data = buf.Bytes()
+		}
+		_, err := c.packetConn.WriteTo(data, c.remoteAddr)
+		return err
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return c.framer.WriteFrame(c.conn, data)
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestFramer(t *testing.T) {
+	testCases := []struct {
+		config   FramingConfig
+		frames   []string
+		expected string
+	}{
+		{FramingConfig{}, []string{"a", "bc", ""}, "a\nbc\n\n"},
+		{FramingConfig{Type: FramingDelimiter, Delimiter: "$$"}, []string{"a$b", "c"}, "a$b$$c$$"},
+		{FramingConfig{Type: FramingFixed, Length: 2}, []string{"ab", "cd"}, "abcd"},
+		{FramingConfig{Type: FramingLengthPrefix}, []string{"abc", ""}, "\x00\x03abc\x00\x00"},
+		{FramingConfig{Type: FramingLengthPrefix, PrefixSize: 1}, []string{"ab"}, "\x02ab"},
+		{FramingConfig{Type: FramingLengthPrefix, PrefixSize: 4, LittleEndian: true}, []string{"ab"}, "\x02\x00\x00\x00ab"},
+	}
+	for _, item := range testCases {
+		framer, err := NewFramer(item.config)
+		assert.Nil(t, err)
+		var buf bytes.Buffer
+		for _, frame := range item.frames {
+			assert.Nil(t, framer.WriteFrame(&buf, []byte(frame)))
+		}
+		assert.Equal(t, item.expected, buf.String())
+
+		reader := bufio.NewReader(&buf)
+		for _, frame := range item.frames {
+			data, err := framer.ReadFrame(reader)
+			assert.Nil(t, err)
+			assert.Equal(t, frame, string(data))
+		}
+		_, err = framer.ReadFrame(reader)
+		assert.NotNil(t, err)
+	}
+
+	// 兼容\r\n，最后一帧没有分隔符
+	framer, _ := NewFramer(FramingConfig{Type: FramingLine})
+	reader := bufio.NewReader(strings.NewReader("a\r\nb"))
+	data, _ := framer.ReadFrame(reader)
+	assert.Equal(t, "a", string(data))
+	data, _ = framer.ReadFrame(reader)
+	assert.Equal(t, "b", string(data))
+
+	// 超过最大长度
+	framer, _ = NewFramer(FramingConfig{MaxFrameLength: 2})
+	_, err := framer.ReadFrame(bufio.NewReader(strings.NewReader("abcdef\n")))
+	assert.Equal(t, ErrFrameTooLong, err)
+	framer, _ = NewFramer(FramingConfig{Type: FramingLengthPrefix, MaxFrameLength: 2})
+	_, err = framer.ReadFrame(bufio.NewReader(strings.NewReader("\x00\x03abc")))
+	assert.Equal(t, ErrFrameTooLong, err)
+
+	for _, config := range []FramingConfig{{Type: "unknown"}, {Type: FramingDelimiter}, {Type: FramingFixed},
+		{Type: FramingLengthPrefix, PrefixSize: 3}} {
+		_, err := NewFramer(config)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	tcpEndpoint := &Net{}
+	assert.Nil(t, tcpEndpoint.Init(types.NewConfig(), types.Configuration{
+		"server":         "127.0.0.1:0",
+		"framing":        map[string]interface{}{"type": FramingLengthPrefix, "prefixSize": 2},
+		"idleTimeout":    "300ms",
+		"maxConnections": 1,
+	}))
+	var heartbeats int32
+	// 回复原始帧，前面加上ack
+	tcpEndpoint.AddRouter(endpoint.NewRouter().From("*").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		assert.Equal(t, types.BINARY, msg.DataType)
+		assert.Equal(t, "TCP", msg.Type)
+		assert.Equal(t, ProtocolTCP, msg.Metadata.GetValue(KeyProtocol))
+		data, err := Decode(msg.Metadata.GetValue(KeyEncoding), msg.Data)
+		assert.Nil(t, err)
+		exchange.Out.SetBody(append([]byte("ack:"), data...))
+		return true
+	}).End())
+	assert.Nil(t, tcpEndpoint.AddRouterWithParams(endpoint.NewRouter().From("^PING").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		atomic.AddInt32(&heartbeats, 1)
+		return true
+	}).End()))
+	assert.NotNil(t, tcpEndpoint.AddRouterWithParams(endpoint.NewRouter().From("(").End()))
+	assert.Nil(t, tcpEndpoint.Start())
+	defer tcpEndpoint.Destroy()
+
+	conn, err := net.Dial("tcp", tcpEndpoint.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	framer, _ := NewFramer(FramingConfig{Type: FramingLengthPrefix})
+	reader := bufio.NewReader(conn)
+	for _, frame := range []string{"\x01\x02", "PING"} {
+		assert.Nil(t, framer.WriteFrame(conn, []byte(frame)))
+		data, err := framer.ReadFrame(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, "ack:"+frame, string(data))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&heartbeats))
+
+	// 超过最大连接数
+	conn2, err := net.Dial("tcp", tcpEndpoint.Addr().String())
+	assert.Nil(t, err)
+	defer conn2.Close()
+	_ = conn2.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn2.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+
+	// 空闲超时关闭连接
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+// TestTCPMaxConnections 测试同时建立大量连接不超过最大连接数
+func TestTCPMaxConnections(t *testing.T) {
+	tcpEndpoint := &Net{}
+	assert.Nil(t, tcpEndpoint.Init(types.NewConfig(), types.Configuration{
+		"server":         "127.0.0.1:0",
+		"maxConnections": 2,
+	}))
+	tcpEndpoint.AddRouter(endpoint.NewRouter().From("*").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte("ack"))
+		return true
+	}).End())
+	assert.Nil(t, tcpEndpoint.Start())
+	defer tcpEndpoint.Destroy()
+
+	var conns []net.Conn
+	for i := 0; i < 20; i++ {
+		conn, err := net.Dial("tcp", tcpEndpoint.Addr().String())
+		assert.Nil(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	var served int
+	for _, conn := range conns {
+		_, _ = conn.Write([]byte("ping\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond * 500))
+		if _, err := conn.Read(make([]byte, 3)); err == nil {
+			served++
+		}
+	}
+	assert.Equal(t, 2, served)
+}
+
+func TestUDP(t *testing.T) {
+	udpEndpoint := &Net{Config: Config{Protocol: ProtocolUDP, Server: "127.0.0.1:0", Encoding: EncodingBase64, Framing: FramingConfig{Type: FramingLine}}}
+	var count int32
+	udpEndpoint.AddRouter(endpoint.NewRouter().From("*").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		assert.Equal(t, "UDP", msg.Type)
+		assert.Equal(t, exchange.In.From(), msg.Metadata.GetValue(KeyRemoteAddr))
+		data, err := Decode(EncodingBase64, msg.Data)
+		assert.Nil(t, err)
+		atomic.AddInt32(&count, 1)
+		exchange.Out.SetBody(bytes.ToUpper(data))
+		return true
+	}).End())
+	assert.Nil(t, udpEndpoint.Start())
+	defer udpEndpoint.Destroy()
+
+	conn, err := net.Dial("udp", udpEndpoint.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	// 一个报文包含多帧
+	_, err = conn.Write([]byte("a\nb"))
+	assert.Nil(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	buf := make([]byte, 16)
+	for _, expected := range []string{"A\n", "B\n"} {
+		size, err := conn.Read(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(buf[:size]))
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	assert.NotNil(t, (&Net{Config: Config{Protocol: "icmp"}}).Start())
+	assert.NotNil(t, (&Net{Config: Config{Encoding: "gzip"}}).Start())
+}
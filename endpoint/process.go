@@ -0,0 +1,146 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/dop251/goja"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/components/js"
+	"github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/str"
+)
+
+const (
+	// HeadersToMetadata 内置处理器：把请求头复制到msg元数据
+	HeadersToMetadata = "headersToMetadata"
+	// ResponseToBody 内置处理器：把规则链处理结果作为响应body，处理失败响应400和错误信息
+	ResponseToBody = "responseToBody"
+)
+
+// ProcessFactory 处理函数注册器
+// 注册的处理函数可以在endpoint DSL中通过名称引用
+type ProcessFactory struct {
+	sync.RWMutex
+	processes map[string]Process
+}
+
+// Register 注册处理函数，同名覆盖
+func (f *ProcessFactory) Register(name string, process Process) {
+	f.Lock()
+	defer f.Unlock()
+	if f.processes == nil {
+		f.processes = make(map[string]Process)
+	}
+	f.processes[name] = process
+}
+
+// Unregister 删除处理函数
+func (f *ProcessFactory) Unregister(name string) {
+	f.Lock()
+	defer f.Unlock()
+	delete(f.processes, name)
+}
+
+// Get 根据名称获取处理函数
+func (f *ProcessFactory) Get(name string) (Process, bool) {
+	f.RLock()
+	defer f.RUnlock()
+	process, ok := f.processes[name]
+	return process, ok
+}
+
+// DefaultProcessFactory 默认处理函数注册器
+var DefaultProcessFactory = new(ProcessFactory)
+
+// NewJsProcess 创建js脚本处理函数
+// 完整脚本函数：function Process(msg, metadata, msgType) { ${jsScript} }
+// 返回false：不执行后续处理器；返回{'msg':msg,'metadata':metadata,'msgType':msgType}：替换消息对应的字段
+// from端处理exchange.In的消息，to端处理exchange.Out的消息
+func NewJsProcess(config types.Config, jsScript string) (Process, error) {
+	script := fmt.Sprintf("function Process(msg, metadata, msgType) { %s }", jsScript)
+	if _, err := goja.Compile("", script, false); err != nil {
+		return nil, err
+	}
+	jsEngine := js.NewGojaJsEngine(config, script, nil)
+	return func(router *Router, exchange *Exchange) bool {
+		isOut := exchange.Out != nil && exchange.Out.GetMsg() != nil
+		var msg *types.RuleMsg
+		if isOut {
+			msg = exchange.Out.GetMsg()
+		} else {
+			msg = exchange.In.GetMsg()
+		}
+		var data interface{} = msg.Data
+		if msg.DataType == types.JSON {
+			var dataMap interface{}
+			if err := json.Unmarshal([]byte(msg.Data), &dataMap); err == nil {
+				data = dataMap
+			}
+		}
+		out, err := jsEngine.Execute("Process", data, msg.Metadata.Values(), msg.Type)
+		if err != nil {
+			if isOut {
+				exchange.Out.SetError(err)
+			} else {
+				exchange.In.SetError(err)
+			}
+			return false
+		}
+		switch v := out.(type) {
+		case bool:
+			return v
+		case map[string]interface{}:
+			if msgType, ok := v[types.MsgTypeKey]; ok {
+				msg.Type = str.ToString(msgType)
+			}
+			if metadata, ok := v[types.MetadataKey]; ok {
+				msg.Metadata = types.BuildMetadata(str.ToStringMapString(metadata))
+			}
+			if msgData, ok := v[types.MsgKey]; ok {
+				msg.Data = str.ToString(msgData)
+			}
+		}
+		return true
+	}, nil
+}
+
+// 注册内置处理函数
+func init() {
+	DefaultProcessFactory.Register(HeadersToMetadata, func(router *Router, exchange *Exchange) bool {
+		msg := exchange.In.GetMsg()
+		for k := range exchange.In.Headers() {
+			msg.Metadata.PutValue(k, exchange.In.Headers().Get(k))
+		}
+		return true
+	})
+	DefaultProcessFactory.Register(ResponseToBody, func(router *Router, exchange *Exchange) bool {
+		if err := exchange.Out.GetError(); err != nil {
+			exchange.Out.SetStatusCode(http.StatusBadRequest)
+			exchange.Out.SetBody([]byte(err.Error()))
+		} else if msg := exchange.Out.GetMsg(); msg != nil {
+			if msg.DataType == types.JSON {
+				exchange.Out.Headers().Set("Content-Type", "application/json")
+			}
+			exchange.Out.SetBody([]byte(msg.Data))
+		}
+		return true
+	})
+}
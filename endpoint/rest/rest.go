@@ -169,6 +169,11 @@ type Config struct {
 	CertKeyFile string
 }
 
+// 注册到endpoint类型注册器，可以通过DSL配置创建
+func init() {
+	endpoint.DefaultFactory.Register(&Rest{})
+}
+
 // Rest 接收端端点
 type Rest struct {
 	endpoint.BaseEndpoint
@@ -227,8 +232,10 @@ func (rest *Rest) RemoveRouterWithParams(from string, params ...interface{}) err
 	if len(params) <= 0 {
 		return errors.New("need to specify HTTP method")
 	} else {
+		rest.RLock()
+		defer rest.RUnlock()
 		for _, item := range params {
-			if router, ok := rest.RouterStorage[rest.routerKey(str.ToString(item), from)]; ok {
+			if router, ok := rest.RouterStorage[rest.routerKey(strings.ToUpper(str.ToString(item)), from)]; ok {
 				router.Disable(true)
 			}
 		}
@@ -266,15 +273,13 @@ func (rest *Rest) AddRouter(method string, routers ...*endpoint.Router) *Rest {
 	}
 	for _, item := range routers {
 		key := rest.routerKey(method, item.FromToString())
-		if old, ok := rest.RouterStorage[key]; ok {
-			// 已经存储则，把路由设置可用
-			old.Disable(false)
-		} else {
-			// 存储路由
-			rest.RouterStorage[key] = item
+		if _, ok := rest.RouterStorage[key]; !ok {
 			// 添加到http路由器
-			rest.router.Handle(method, item.FromToString(), rest.handler(item))
+			rest.router.Handle(method, item.FromToString(), rest.handler(key))
 		}
+		// 存储路由，已经存储则替换成新的路由，并把路由设置可用
+		item.Disable(false)
+		rest.RouterStorage[key] = item
 	}
 
 	return rest
@@ -336,7 +341,8 @@ func (rest *Rest) routerKey(method string, from string) string {
 	return method + " " + from
 }
 
-func (rest *Rest) handler(router *endpoint.Router) httprouter.Handle {
+// 请求时根据key获取路由，路由被替换后立即生效
+func (rest *Rest) handler(key string) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		defer func() {
 			// 捕捉异常
@@ -344,7 +350,10 @@ func (rest *Rest) handler(router *endpoint.Router) httprouter.Handle {
 				rest.Printf("rest handler err :%v", e)
 			}
 		}()
-		if router.IsDisable() {
+		rest.RLock()
+		router := rest.RouterStorage[key]
+		rest.RUnlock()
+		if router == nil || router.IsDisable() {
 			http.NotFound(w, r)
 			// w.WriteHeader(http.NotFound())
 			return
@@ -374,7 +383,13 @@ func (rest *Rest) handler(router *endpoint.Router) httprouter.Handle {
 				msg.Metadata.PutValue(key, value[0])
 			}
 		}
-		rest.DoProcess(router, exchange)
+		// 使用请求上下文，同步路由客户端断开连接后，规则链不再继续执行；异步路由只传递链路上下文
+		ctx := r.Context()
+		// 传递W3C traceparent链路上下文
+		if sc, ok := types.ParseTraceParent(r.Header.Get(types.TraceParentHeader)); ok {
+			ctx = types.ContextWithSpanContext(ctx, sc)
+		}
+		rest.DoProcessWithContext(ctx, router, exchange)
 	}
 }
 
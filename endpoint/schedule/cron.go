@@ -0,0 +1,301 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec 调度计划
+type Spec interface {
+	// Next 返回t之后的下一次执行时间，没有下一次执行时间返回零值
+	Next(t time.Time) time.Time
+}
+
+// 字段取值范围
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	seconds = bounds{0, 59, nil}
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// dow 星期，0和7都表示星期日
+	dow = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// 预定义表达式
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse 解析调度表达式，支持：
+//
+//	cron表达式，5个字段：分 时 日 月 周，或者6个字段：秒 分 时 日 月 周
+//	字段支持：*、?、列表(1,2)、范围(1-5)、步长(*/5、1-30/5)，月份和星期支持英文缩写(JAN、MON)
+//	预定义表达式：@yearly、@annually、@monthly、@weekly、@daily、@midnight、@hourly
+//	固定间隔：@every 30s，间隔使用time.ParseDuration格式
+func Parse(spec string) (Spec, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %s: interval must be positive", spec)
+		}
+		return everySchedule{interval: d}, nil
+	}
+	if strings.HasPrefix(spec, "@") {
+		if v, ok := descriptors[strings.ToLower(spec)]; ok {
+			spec = v
+		} else {
+			return nil, fmt.Errorf("invalid schedule %s: unknown descriptor", spec)
+		}
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid schedule %s: expected 5 or 6 fields, found %d", spec, len(fields))
+	}
+	s := &cronSchedule{}
+	var err error
+	if s.second, err = parseField(fields[0], seconds); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+	}
+	if s.minute, err = parseField(fields[1], minutes); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+	}
+	if s.hour, err = parseField(fields[2], hours); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+	}
+	if s.dom, err = parseField(fields[3], dom); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+	}
+	if s.month, err = parseField(fields[4], months); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+	}
+	if s.dow, err = parseField(fields[5], dow); err != nil {
+		return nil, fmt.Errorf("invalid schedule %s: %w", spec, err)
+	}
+	// 7和0都表示星期日
+	if s.dow&(1<<7) > 0 {
+		s.dow |= 1
+	}
+	s.domAny = isAny(fields[3])
+	s.dowAny = isAny(fields[5])
+	return s, nil
+}
+
+// everySchedule 固定间隔调度
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
+
+// cronSchedule cron表达式调度，每个字段使用位图表示允许的值
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// 日和周字段是否是*或者?
+	domAny, dowAny bool
+}
+
+// Next 从t的下一秒开始，逐级查找匹配的月、日、时、分、秒
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	// 是否已经把低位字段归零
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// 夏令时切换可能导致不是0点
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+	return t
+}
+
+// dayMatches 日和周都有限制时，满足其中一个即可
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow > 0
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func isAny(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseField 解析字段，返回位图
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		v, err := parseRange(item, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= v
+	}
+	return bits, nil
+}
+
+// parseRange 解析：*、?、n、a-b，可以带步长/step
+func parseRange(expr string, b bounds) (uint64, error) {
+	rangeExpr, stepExpr, hasStep := strings.Cut(expr, "/")
+	var start, end uint
+	switch {
+	case rangeExpr == "*" || rangeExpr == "?":
+		start, end = b.min, b.max
+	default:
+		low, high, isRange := strings.Cut(rangeExpr, "-")
+		var err error
+		if start, err = parseValue(low, b); err != nil {
+			return 0, err
+		}
+		switch {
+		case isRange:
+			if end, err = parseValue(high, b); err != nil {
+				return 0, err
+			}
+		case hasStep:
+			end = b.max
+		default:
+			end = start
+		}
+	}
+	step := uint(1)
+	if hasStep {
+		v, err := strconv.ParseUint(stepExpr, 10, 32)
+		if err != nil || v == 0 {
+			return 0, fmt.Errorf("invalid step %s", expr)
+		}
+		step = uint(v)
+	}
+	if start > end {
+		return 0, fmt.Errorf("invalid range %s", expr)
+	}
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits, nil
+}
+
+func parseValue(expr string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(expr, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s", expr)
+	}
+	if uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value %s out of range [%d,%d]", expr, b.min, b.max)
+	}
+	return uint(v), nil
+}
@@ -0,0 +1,470 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package schedule 定时调度endpoint，按cron表达式或者固定间隔把消息交给规则链处理
+//
+// 例如：
+//
+//	scheduleEndpoint := &schedule.Schedule{Config: schedule.Config{Timezone: "Asia/Shanghai"}}
+//	//每5分钟触发一次
+//	router := endpoint.NewRouter().From("0 */5 * * * *").To("chain:default").End()
+//	//每30秒触发一次，指定消息类型和消息内容
+//	router2 := endpoint.NewRouter().From("@every 30s", types.Configuration{"msgType": "HEARTBEAT", "data": "{}"}).To("chain:default").End()
+//	scheduleEndpoint.AddRouter(router, router2)
+//	err := scheduleEndpoint.Start()
+package schedule
+
+import (
+	"context"
+	"net/textproto"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+const (
+	// Type 组件类型
+	Type = "schedule"
+	// DefaultMsgType 默认消息类型
+	DefaultMsgType = "SCHEDULE"
+
+	// KeySchedule 调度表达式元数据key
+	KeySchedule = "schedule"
+	// KeyFireTime 计划触发时间元数据key，RFC3339格式
+	KeyFireTime = "fireTime"
+
+	// From端配置key
+	// configMsgType 消息类型
+	configMsgType = "msgType"
+	// configData 消息内容
+	configData = "data"
+	// configTimezone 时区，覆盖endpoint时区
+	configTimezone = "timezone"
+)
+
+// RequestMessage 调度触发消息
+type RequestMessage struct {
+	schedule string
+	fireTime time.Time
+	msgType  string
+	data     string
+	msg      *types.RuleMsg
+	err      error
+}
+
+func (r *RequestMessage) Body() []byte {
+	return []byte(r.data)
+}
+
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	header := make(map[string][]string)
+	header[KeySchedule] = []string{r.schedule}
+	return header
+}
+
+func (r *RequestMessage) From() string {
+	return r.schedule
+}
+
+func (r *RequestMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		ruleMsg := types.NewMsg(r.fireTime.UnixMilli(), r.msgType, types.JSON, types.NewMetadata(), r.data)
+		ruleMsg.Metadata.PutValue(KeySchedule, r.schedule)
+		ruleMsg.Metadata.PutValue(KeyFireTime, r.fireTime.Format(time.RFC3339))
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *RequestMessage) SetBody(body []byte) {
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// FireTime 计划触发时间
+func (r *RequestMessage) FireTime() time.Time {
+	return r.fireTime
+}
+
+// ResponseMessage 调度响应消息，保存规则链处理结果
+type ResponseMessage struct {
+	schedule string
+	body     []byte
+	msg      *types.RuleMsg
+	headers  textproto.MIMEHeader
+	err      error
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	return r.schedule
+}
+
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	return r.err
+}
+
+// Config 调度配置
+type Config struct {
+	// Timezone 时区，例如：Asia/Shanghai，默认使用本地时区
+	// 路由可以通过From端配置timezone覆盖
+	Timezone string
+	// AllowOverlap 是否允许重叠执行
+	// 默认false：等待规则链执行结束，上一次执行还没结束时跳过本次触发
+	AllowOverlap bool
+	// RunTimeout 不允许重叠执行时，等待规则链执行结束的超时时间，例如：30s
+	// 超时后规则链不再往下一个节点分发消息，也不再阻塞下一次触发，默认0：一直等待
+	RunTimeout time.Duration
+}
+
+// 注册到endpoint类型注册器，可以通过DSL配置创建
+func init() {
+	endpoint.DefaultFactory.Register(&Schedule{})
+}
+
+// Schedule 定时调度接收端端点
+// Router.From 为调度表达式，详见 Parse
+// From端配置：msgType 消息类型，默认：SCHEDULE；data 消息内容；timezone 时区
+type Schedule struct {
+	endpoint.BaseEndpoint
+	RuleConfig types.Config
+	Config     Config
+	// 运行中的调度任务，key:调度表达式
+	jobs    map[string]*job
+	started bool
+	jobLock sync.Mutex
+}
+
+// Type 组件类型
+func (s *Schedule) Type() string {
+	return Type
+}
+
+func (s *Schedule) New() types.Node {
+	return &Schedule{}
+}
+
+// Init 初始化
+func (s *Schedule) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &s.Config)
+	s.RuleConfig = ruleConfig
+	return err
+}
+
+// Destroy 销毁
+func (s *Schedule) Destroy() {
+	_ = s.Close()
+}
+
+// Close 停止所有调度任务
+func (s *Schedule) Close() error {
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+	for key, item := range s.jobs {
+		item.stop()
+		delete(s.jobs, key)
+	}
+	s.started = false
+	return nil
+}
+
+func (s *Schedule) Id() string {
+	return Type
+}
+
+func (s *Schedule) AddRouterWithParams(router *endpoint.Router, params ...interface{}) error {
+	return s.addRouter(router)
+}
+
+func (s *Schedule) RemoveRouterWithParams(from string, params ...interface{}) error {
+	s.deleteRouter(from)
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+	if item, ok := s.jobs[from]; ok {
+		item.stop()
+		delete(s.jobs, from)
+	}
+	return nil
+}
+
+// AddRouter 添加路由，如果服务已经启动，立即开始调度
+// 调度表达式错误打印日志并忽略该路由，需要返回错误使用 AddRouterWithParams
+func (s *Schedule) AddRouter(routers ...*endpoint.Router) *Schedule {
+	for _, router := range routers {
+		if err := s.addRouter(router); err != nil {
+			s.Printf("schedule add router err :%v", err)
+		}
+	}
+	return s
+}
+
+// Start 启动所有路由的调度
+func (s *Schedule) Start() error {
+	s.RLock()
+	routers := make([]*endpoint.Router, 0, len(s.RouterStorage))
+	for _, router := range s.RouterStorage {
+		routers = append(routers, router)
+	}
+	s.RUnlock()
+
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+	if s.started {
+		return nil
+	}
+	for _, router := range routers {
+		if err := s.startJob(router); err != nil {
+			return err
+		}
+	}
+	s.started = true
+	return nil
+}
+
+func (s *Schedule) addRouter(router *endpoint.Router) error {
+	from := router.GetFrom()
+	if from == nil {
+		return nil
+	}
+	// 校验表达式
+	if _, err := Parse(from.ToString()); err != nil {
+		return err
+	}
+	s.saveRouter(router)
+	s.jobLock.Lock()
+	defer s.jobLock.Unlock()
+	if s.started {
+		return s.startJob(router)
+	}
+	return nil
+}
+
+// startJob 启动调度任务，已经存在相同表达式的任务则替换
+func (s *Schedule) startJob(router *endpoint.Router) error {
+	from := router.GetFrom()
+	schedule, err := Parse(from.ToString())
+	if err != nil {
+		return err
+	}
+	location, err := s.location(from.Config)
+	if err != nil {
+		return err
+	}
+	if s.jobs == nil {
+		s.jobs = make(map[string]*job)
+	}
+	if old, ok := s.jobs[from.ToString()]; ok {
+		old.stop()
+	}
+	item := &job{
+		endpoint: s,
+		router:   router,
+		schedule: schedule,
+		location: location,
+		msgType:  from.Config.GetToString(configMsgType),
+		data:     from.Config.GetToString(configData),
+		done:     make(chan struct{}),
+	}
+	if item.msgType == "" {
+		item.msgType = DefaultMsgType
+	}
+	s.jobs[from.ToString()] = item
+	go item.run()
+	return nil
+}
+
+// location 获取时区，路由配置优先
+func (s *Schedule) location(config types.Configuration) (*time.Location, error) {
+	timezone := config.GetToString(configTimezone)
+	if timezone == "" {
+		timezone = s.Config.Timezone
+	}
+	if timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(timezone)
+}
+
+// 存储路由
+func (s *Schedule) saveRouter(routers ...*endpoint.Router) {
+	s.Lock()
+	defer s.Unlock()
+	if s.RouterStorage == nil {
+		s.RouterStorage = make(map[string]*endpoint.Router)
+	}
+	for _, item := range routers {
+		s.RouterStorage[item.FromToString()] = item
+	}
+}
+
+// 从存储器中删除路由
+func (s *Schedule) deleteRouter(from string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.RouterStorage != nil {
+		delete(s.RouterStorage, from)
+	}
+}
+
+func (s *Schedule) Printf(format string, v ...interface{}) {
+	if s.RuleConfig.Logger != nil {
+		s.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// job 调度任务
+type job struct {
+	endpoint *Schedule
+	router   *endpoint.Router
+	schedule Spec
+	location *time.Location
+	msgType  string
+	data     string
+	// 是否正在执行 1:是
+	running int32
+	// 正在执行的计划触发时间，UnixNano
+	runningFireTime int64
+	done            chan struct{}
+	stopOnce        sync.Once
+}
+
+func (j *job) stop() {
+	j.stopOnce.Do(func() {
+		close(j.done)
+	})
+}
+
+func (j *job) run() {
+	for {
+		next := j.schedule.Next(time.Now().In(j.location))
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-j.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			j.fire(next)
+		}
+	}
+}
+
+// fire 触发执行，不允许重叠执行时，上一次执行还没结束则跳过
+func (j *job) fire(fireTime time.Time) {
+	config := j.endpoint.Config
+	if !config.AllowOverlap {
+		if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+			previous := time.Unix(0, atomic.LoadInt64(&j.runningFireTime)).In(j.location)
+			j.endpoint.Printf("schedule %s skipped at %s, previous run fired at %s is still executing", j.router.FromToString(), fireTime.Format(time.RFC3339), previous.Format(time.RFC3339))
+			return
+		}
+		atomic.StoreInt64(&j.runningFireTime, fireTime.UnixNano())
+	}
+	go func() {
+		defer func() {
+			atomic.StoreInt32(&j.running, 0)
+			// 捕捉异常
+			if e := recover(); e != nil {
+				j.endpoint.Printf("schedule handler err :%v", e)
+			}
+		}()
+		if j.router.IsDisable() {
+			return
+		}
+		exchange := &endpoint.Exchange{
+			In: &RequestMessage{
+				schedule: j.router.FromToString(),
+				fireTime: fireTime,
+				msgType:  j.msgType,
+				data:     j.data,
+			},
+			Out: &ResponseMessage{
+				schedule: j.router.FromToString(),
+			},
+		}
+		ctx := context.Background()
+		if !config.AllowOverlap {
+			// 在本次执行内等待规则链执行结束，用于判断上一次执行是否结束
+			ctx = endpoint.ContextWithWait(ctx)
+			if config.RunTimeout > 0 {
+				// 规则链挂起时不能一直等待，否则之后的触发都会被跳过
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, config.RunTimeout)
+				defer cancel()
+			}
+		}
+		j.endpoint.DoProcessWithContext(ctx, j.router, exchange)
+		if ctx.Err() == context.DeadlineExceeded {
+			j.endpoint.Printf("schedule %s run fired at %s timed out after %s", j.router.FromToString(), fireTime.Format(time.RFC3339), config.RunTimeout)
+		}
+	}()
+}
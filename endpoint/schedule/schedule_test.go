@@ -0,0 +1,297 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schedule
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestParse(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	base := time.Date(2023, 10, 17, 10, 20, 30, 500, loc)
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * * *", time.Date(2023, 10, 17, 10, 20, 31, 0, loc)},
+		{"*/5 * * * *", time.Date(2023, 10, 17, 10, 25, 0, 0, loc)},
+		{"0 */5 * * * *", time.Date(2023, 10, 17, 10, 25, 0, 0, loc)},
+		{"15,45 * * * * ?", time.Date(2023, 10, 17, 10, 20, 45, 0, loc)},
+		{"0 0 9-17/4 * * *", time.Date(2023, 10, 17, 13, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2023, 11, 1, 0, 0, 0, 0, loc)},
+		{"0 12 * * MON-FRI", time.Date(2023, 10, 17, 12, 0, 0, 0, loc)},
+		{"0 12 * * sun", time.Date(2023, 10, 22, 12, 0, 0, 0, loc)},
+		{"0 12 * * 7", time.Date(2023, 10, 22, 12, 0, 0, 0, loc)},
+		// 日和周都有限制，满足其中一个即可
+		{"0 0 20 * 6", time.Date(2023, 10, 20, 0, 0, 0, 0, loc)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, loc)},
+		{"@hourly", time.Date(2023, 10, 17, 11, 0, 0, 0, loc)},
+		{"@daily", time.Date(2023, 10, 18, 0, 0, 0, 0, loc)},
+		{"@weekly", time.Date(2023, 10, 22, 0, 0, 0, 0, loc)},
+		{"@monthly", time.Date(2023, 11, 1, 0, 0, 0, 0, loc)},
+		{"@yearly", time.Date(2024, 1, 1, 0, 0, 0, 0, loc)},
+		{"@every 90s", base.Add(time.Second * 90)},
+	}
+	for _, item := range testCases {
+		spec, err := Parse(item.spec)
+		assert.Nil(t, err)
+		assert.Equal(t, item.expected, spec.Next(base))
+	}
+
+	// 不存在的日期
+	spec, err := Parse("0 0 30 2 *")
+	assert.Nil(t, err)
+	assert.True(t, spec.Next(base).IsZero())
+
+	for _, item := range []string{"", "* * * *", "* * * * * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *",
+		"5-1 * * * *", "* * * foo *", "@unknown", "@every x", "@every -1s"} {
+		_, err := Parse(item)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	config := rulego.NewConfig(types.WithDefaultPool())
+	scheduleEndpoint := &Schedule{}
+	err := scheduleEndpoint.Init(config, types.Configuration{"timezone": "Asia/Shanghai"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Asia/Shanghai", scheduleEndpoint.Config.Timezone)
+
+	var count int32
+	var lastMsg atomic.Value
+	router := endpoint.NewRouter().From("@every 50ms", types.Configuration{"msgType": "HEARTBEAT", "data": "{}"}).Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		atomic.AddInt32(&count, 1)
+		lastMsg.Store(*exchange.In.GetMsg())
+		return true
+	}).End()
+	scheduleEndpoint.AddRouter(router)
+	assert.Nil(t, scheduleEndpoint.AddRouterWithParams(endpoint.NewRouter().From("* * * * * *").End()))
+	assert.NotNil(t, scheduleEndpoint.AddRouterWithParams(endpoint.NewRouter().From("bad").End()))
+
+	// 启动前不触发
+	time.Sleep(time.Millisecond * 120)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+
+	assert.Nil(t, scheduleEndpoint.Start())
+	time.Sleep(time.Millisecond * 280)
+	assert.True(t, atomic.LoadInt32(&count) >= 3)
+	msg := lastMsg.Load().(types.RuleMsg)
+	assert.Equal(t, "HEARTBEAT", msg.Type)
+	assert.Equal(t, "{}", msg.Data)
+	assert.Equal(t, "@every 50ms", msg.Metadata.GetValue(KeySchedule))
+	fireTime, err := time.Parse(time.RFC3339, msg.Metadata.GetValue(KeyFireTime))
+	assert.Nil(t, err)
+	_, offset := fireTime.Zone()
+	assert.Equal(t, 8*3600, offset)
+
+	// 运行时删除路由
+	assert.Nil(t, scheduleEndpoint.RemoveRouterWithParams("@every 50ms"))
+	time.Sleep(time.Millisecond * 20)
+	stopped := atomic.LoadInt32(&count)
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, stopped, atomic.LoadInt32(&count))
+
+	// 运行时添加路由
+	scheduleEndpoint.AddRouter(router)
+	time.Sleep(time.Millisecond * 150)
+	assert.True(t, atomic.LoadInt32(&count) > stopped)
+
+	scheduleEndpoint.Destroy()
+}
+
+func TestScheduleOverlap(t *testing.T) {
+	for _, allowOverlap := range []bool{false, true} {
+		scheduleEndpoint := &Schedule{Config: Config{AllowOverlap: allowOverlap}}
+		var count, running, maxRunning int32
+		router := endpoint.NewRouter().From("@every 20ms").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+			atomic.AddInt32(&count, 1)
+			current := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&maxRunning)
+				if current <= old || atomic.CompareAndSwapInt32(&maxRunning, old, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 100)
+			atomic.AddInt32(&running, -1)
+			return true
+		}).End()
+		scheduleEndpoint.AddRouter(router)
+		assert.Nil(t, scheduleEndpoint.Start())
+		time.Sleep(time.Millisecond * 250)
+		_ = scheduleEndpoint.Close()
+		if allowOverlap {
+			assert.True(t, atomic.LoadInt32(&maxRunning) > 1)
+		} else {
+			assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+			assert.True(t, atomic.LoadInt32(&count) <= 3)
+		}
+	}
+}
+
+func TestScheduleToChain(t *testing.T) {
+	ruleGo := &rulego.RuleGo{}
+	var count int32
+	config := rulego.NewConfig(types.WithDefaultPool(), types.WithOnEnd(func(msg types.RuleMsg, err error) {
+		atomic.AddInt32(&count, 1)
+	}))
+	_, err := ruleGo.New("scheduleChain", []byte(`{
+	  "ruleChain": {"id": "scheduleChain"},
+	  "metadata": {"nodes": [{"id": "s1", "type": "jsFilter", "configuration": {"jsScript": "return msgType=='SCHEDULE';"}}]}
+	}`), rulego.WithConfig(config))
+	assert.Nil(t, err)
+
+	scheduleEndpoint := &Schedule{RuleConfig: config}
+	router := endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From("@every 30ms").To("chain:scheduleChain").End()
+	scheduleEndpoint.AddRouter(router)
+	assert.Nil(t, scheduleEndpoint.Start())
+	time.Sleep(time.Millisecond * 200)
+	scheduleEndpoint.Destroy()
+	assert.True(t, atomic.LoadInt32(&count) >= 3)
+}
+
+// slowNode 执行耗时的测试组件，记录最大并发执行数
+type slowNode struct {
+}
+
+var slowNodeRunning, slowNodeMaxRunning, slowNodeCount int32
+
+func (x *slowNode) Type() string {
+	return "test/scheduleSlow"
+}
+
+func (x *slowNode) New() types.Node {
+	return &slowNode{}
+}
+
+func (x *slowNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (x *slowNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	atomic.AddInt32(&slowNodeCount, 1)
+	current := atomic.AddInt32(&slowNodeRunning, 1)
+	for {
+		old := atomic.LoadInt32(&slowNodeMaxRunning)
+		if current <= old || atomic.CompareAndSwapInt32(&slowNodeMaxRunning, old, current) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond * 100)
+	atomic.AddInt32(&slowNodeRunning, -1)
+	ctx.TellSuccess(msg)
+	return nil
+}
+
+func (x *slowNode) Destroy() {
+}
+
+func TestScheduleOverlapToChain(t *testing.T) {
+	_ = rulego.Registry.Register(&slowNode{})
+	ruleGo := &rulego.RuleGo{}
+	config := rulego.NewConfig(types.WithDefaultPool())
+	_, err := ruleGo.New("scheduleSlowChain", []byte(`{
+	  "ruleChain": {"id": "scheduleSlowChain"},
+	  "metadata": {"nodes": [{"id": "s1", "type": "test/scheduleSlow"}]}
+	}`), rulego.WithConfig(config))
+	assert.Nil(t, err)
+
+	scheduleEndpoint := &Schedule{RuleConfig: config}
+	// to端异步执行，不允许重叠执行时调度端点等待规则链执行结束
+	router := endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From("@every 20ms").To("chain:scheduleSlowChain").End()
+	scheduleEndpoint.AddRouter(router)
+	assert.Nil(t, scheduleEndpoint.Start())
+	time.Sleep(time.Millisecond * 250)
+	scheduleEndpoint.Destroy()
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowNodeMaxRunning))
+	assert.True(t, atomic.LoadInt32(&slowNodeCount) <= 3)
+
+	// 路由的to端仍然是异步执行
+	exchange := &endpoint.Exchange{
+		In:  &RequestMessage{schedule: "@every 20ms", fireTime: time.Now(), msgType: DefaultMsgType},
+		Out: &ResponseMessage{},
+	}
+	start := time.Now()
+	router.GetFrom().GetTo().Execute(context.Background(), exchange)
+	assert.True(t, time.Since(start) < time.Millisecond*50)
+	time.Sleep(time.Millisecond * 150)
+}
+
+// hangNode 一直不通知下一个节点的测试组件，直到hangNodeRelease关闭
+type hangNode struct {
+}
+
+var hangNodeRelease = make(chan struct{})
+var hangNodeCount int32
+
+func (x *hangNode) Type() string {
+	return "test/scheduleHang"
+}
+
+func (x *hangNode) New() types.Node {
+	return &hangNode{}
+}
+
+func (x *hangNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (x *hangNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	atomic.AddInt32(&hangNodeCount, 1)
+	<-hangNodeRelease
+	return nil
+}
+
+func (x *hangNode) Destroy() {
+}
+
+func TestScheduleRunTimeout(t *testing.T) {
+	_ = rulego.Registry.Register(&hangNode{})
+	defer close(hangNodeRelease)
+	ruleGo := &rulego.RuleGo{}
+	config := rulego.NewConfig(types.WithDefaultPool())
+	_, err := ruleGo.New("scheduleHangChain", []byte(`{
+	  "ruleChain": {"id": "scheduleHangChain"},
+	  "metadata": {"nodes": [{"id": "s1", "type": "test/scheduleHang"}]}
+	}`), rulego.WithConfig(config))
+	assert.Nil(t, err)
+
+	var outErr atomic.Value
+	// 规则链挂起，超时后不再阻塞之后的触发
+	scheduleEndpoint := &Schedule{RuleConfig: config, Config: Config{RunTimeout: time.Millisecond * 50}}
+	router := endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From("@every 20ms").To("chain:scheduleHangChain").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		if err := exchange.Out.GetError(); err != nil {
+			outErr.Store(err)
+		}
+		return true
+	}).End()
+	scheduleEndpoint.AddRouter(router)
+	assert.Nil(t, scheduleEndpoint.Start())
+	time.Sleep(time.Millisecond * 300)
+	scheduleEndpoint.Destroy()
+	assert.True(t, atomic.LoadInt32(&hangNodeCount) >= 3)
+	assert.Equal(t, context.DeadlineExceeded, outErr.Load())
+}
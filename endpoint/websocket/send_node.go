@@ -0,0 +1,111 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+// 规则链节点配置示例：
+//
+//	{
+//	       "id": "s3",
+//	       "type": "websocketSend",
+//	       "name": "推送到客户端",
+//	       "debugMode": false,
+//	       "configuration": {
+//	         "sessionId": "${metadata.sessionId}",
+//	         "messageType": "TEXT"
+//	       }
+//	     }
+import (
+	"fmt"
+	"strings"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/el"
+	"github.com/xyzbit/rulego/utils/maps"
+)
+
+// 导入该包后注册`websocketSend`组件
+func init() {
+	_ = rulego.Registry.Register(&SendNode{})
+}
+
+// SendNodeConfiguration 节点配置
+type SendNodeConfiguration struct {
+	// SessionId 目标会话ID，支持占位符表达式，详见el包，默认：${metadata.sessionId}
+	SessionId string
+	// MessageType 帧类型：TEXT/BINARY，默认：TEXT
+	MessageType string
+}
+
+// SendNode 把消息负荷推送到指定的websocket客户端
+// 推送成功，把消息发送到`Success`链, 会话不存在或者推送失败，发到`Failure`链
+type SendNode struct {
+	// 节点配置
+	Config SendNodeConfiguration
+	// 会话ID模板
+	sessionIdTemplate *el.Template
+	messageType       int
+	// 全局属性
+	global map[string]string
+}
+
+// Type 组件类型
+func (x *SendNode) Type() string {
+	return "websocketSend"
+}
+
+func (x *SendNode) New() types.Node {
+	return &SendNode{Config: SendNodeConfiguration{
+		SessionId:   "${metadata." + KeySessionId + "}",
+		MessageType: textMessageType,
+	}}
+}
+
+// Init 初始化
+func (x *SendNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	x.global = ruleConfig.Properties.Values()
+	switch strings.ToUpper(x.Config.MessageType) {
+	case "", textMessageType:
+		x.messageType = ws.TextMessage
+	case binaryMessageType:
+		x.messageType = ws.BinaryMessage
+	default:
+		return fmt.Errorf("unsupported messageType %s", x.Config.MessageType)
+	}
+	x.sessionIdTemplate, err = el.Compile(x.Config.SessionId)
+	return err
+}
+
+// OnMsg 处理消息
+func (x *SendNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	sessionId := x.sessionIdTemplate.ExecuteMsg(msg, x.global)
+	if err := Sessions.Send(sessionId, x.messageType, []byte(msg.Data)); err != nil {
+		ctx.TellFailure(msg, fmt.Errorf("sessionId=%s: %w", sessionId, err))
+	} else {
+		ctx.TellSuccess(msg)
+	}
+	return nil
+}
+
+// Destroy 销毁
+func (x *SendNode) Destroy() {
+}
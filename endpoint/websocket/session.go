@@ -0,0 +1,140 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/xyzbit/rulego/endpoint"
+)
+
+// ErrSessionNotFound 会话不存在或者已经断开
+var ErrSessionNotFound = errors.New("websocket session not found")
+
+// Sessions 全局会话注册器，所有websocket endpoint的连接都注册到这里
+// 规则链可以通过`websocketSend`节点或者 Sessions.Get(sessionId) 给指定客户端推送消息
+var Sessions = &SessionRegistry{sessions: make(map[string]*Session)}
+
+// Session websocket连接会话
+type Session struct {
+	// Id 会话ID
+	Id string
+	// Request 握手请求
+	Request *http.Request
+	conn    *ws.Conn
+	// 所属路由
+	router *endpoint.Router
+	// 写锁，websocket连接不支持并发写
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+func newSession(id string, conn *ws.Conn, request *http.Request) *Session {
+	return &Session{Id: id, conn: conn, Request: request}
+}
+
+// WriteMessage 发送消息，并发安全
+// messageType websocket.TextMessage或者websocket.BinaryMessage
+func (s *Session) WriteMessage(messageType int, data []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.conn.WriteMessage(messageType, data)
+}
+
+// RemoteAddr 客户端地址
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// Close 关闭连接
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.conn.Close()
+	})
+	return err
+}
+
+// SessionRegistry 会话注册器
+type SessionRegistry struct {
+	sessions map[string]*Session
+	lock     sync.RWMutex
+}
+
+// Get 获取会话
+func (r *SessionRegistry) Get(id string) (*Session, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+// Send 给指定会话发送消息
+func (r *SessionRegistry) Send(id string, messageType int, data []byte) error {
+	s, ok := r.Get(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return s.WriteMessage(messageType, data)
+}
+
+// Range 遍历所有会话，f返回false停止遍历
+func (r *SessionRegistry) Range(f func(s *Session) bool) {
+	r.lock.RLock()
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.lock.RUnlock()
+	for _, s := range sessions {
+		if !f(s) {
+			return
+		}
+	}
+}
+
+// Len 会话数量
+func (r *SessionRegistry) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.sessions)
+}
+
+// add 注册会话，已经存在相同ID的会话返回false
+// 不替换已经存在的会话，防止客户端使用其他会话的ID把该会话挤下线并接收推送给该会话的消息
+func (r *SessionRegistry) add(s *Session) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.sessions[s.Id]; ok {
+		return false
+	}
+	r.sessions[s.Id] = s
+	return true
+}
+
+// remove 删除会话，只删除同一个连接，避免误删重连后的新会话
+func (r *SessionRegistry) remove(s *Session) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if current, ok := r.sessions[s.Id]; ok && current == s {
+		delete(r.sessions, s.Id)
+	}
+}
@@ -0,0 +1,481 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package websocket WebSocket接收端端点
+//
+// 每个客户端连接是一个会话，收到的每一帧数据转换成RuleMsg，交给Router处理，
+// 调用`Exchange.Out.SetBody`在同一个连接回复客户端。
+// 会话注册到 Sessions，规则链可以通过`websocketSend`节点给指定客户端推送消息。
+//
+// 例如：
+//
+//	wsEndpoint := &websocket.Websocket{Config: websocket.Config{Server: ":9090"}}
+//	router := endpoint.NewRouter().From("/ws/:sessionId").To("chain:default").End()
+//	wsEndpoint.AddRouter(router)
+//	err := wsEndpoint.Start()
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"sync"
+
+	"github.com/gofrs/uuid/v5"
+	ws "github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/utils/maps"
+	"github.com/xyzbit/rulego/utils/str"
+)
+
+const (
+	// Type 组件类型
+	Type = "websocket"
+	// KeySessionId 会话ID元数据key
+	KeySessionId = "sessionId"
+	// KeyMessageType 响应消息类型header key，值：TEXT/BINARY，默认和请求帧类型一致
+	KeyMessageType = "messageType"
+	// DefaultMaxMessageSize 默认单帧最大字节数
+	DefaultMaxMessageSize = 1024 * 1024
+
+	textMessageType   = "TEXT"
+	binaryMessageType = "BINARY"
+)
+
+// RequestMessage websocket请求帧
+type RequestMessage struct {
+	request     *http.Request
+	params      httprouter.Params
+	session     *Session
+	messageType int
+	body        []byte
+	msg         *types.RuleMsg
+	err         error
+}
+
+func (r *RequestMessage) Body() []byte {
+	return r.body
+}
+
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	return textproto.MIMEHeader(r.request.Header)
+}
+
+func (r *RequestMessage) From() string {
+	return r.request.URL.Path
+}
+
+func (r *RequestMessage) GetParam(key string) string {
+	return r.request.URL.Query().Get(key)
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+// GetMsg 把帧数据转换成RuleMsg，元数据包含会话ID、路径参数和url参数
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		dataType := types.JSON
+		if r.messageType == ws.BinaryMessage {
+			dataType = types.BINARY
+		}
+		ruleMsg := types.NewMsg(0, r.From(), dataType, types.NewMetadata(), string(r.body))
+		for _, param := range r.params {
+			ruleMsg.Metadata.PutValue(param.Key, param.Value)
+		}
+		for key, value := range r.request.URL.Query() {
+			if len(value) > 1 {
+				ruleMsg.Metadata.PutValue(key, str.ToString(value))
+			} else {
+				ruleMsg.Metadata.PutValue(key, value[0])
+			}
+		}
+		ruleMsg.Metadata.PutValue(KeySessionId, r.session.Id)
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// Session 当前连接会话
+func (r *RequestMessage) Session() *Session {
+	return r.session
+}
+
+// ResponseMessage websocket响应
+type ResponseMessage struct {
+	request     *http.Request
+	session     *Session
+	messageType int
+	body        []byte
+	msg         *types.RuleMsg
+	headers     textproto.MIMEHeader
+	err         error
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	return r.request.URL.Path
+}
+
+func (r *ResponseMessage) GetParam(key string) string {
+	return r.request.URL.Query().Get(key)
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+}
+
+// SetBody 在同一个连接回复客户端
+// 可以通过header messageType指定帧类型：TEXT/BINARY，默认和请求帧类型一致
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+	messageType := r.messageType
+	switch strings.ToUpper(r.Headers().Get(KeyMessageType)) {
+	case textMessageType:
+		messageType = ws.TextMessage
+	case binaryMessageType:
+		messageType = ws.BinaryMessage
+	}
+	if err := r.session.WriteMessage(messageType, body); err != nil {
+		r.err = err
+	}
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	return r.err
+}
+
+// Session 当前连接会话
+func (r *ResponseMessage) Session() *Session {
+	return r.session
+}
+
+// Config Websocket 服务配置
+type Config struct {
+	Server      string
+	CertFile    string
+	CertKeyFile string
+	// SessionIdKey 从路径参数或者url参数获取会话ID的参数名，默认：sessionId
+	// 获取不到则生成uuid，会话ID已经被其他连接使用则拒绝连接
+	SessionIdKey string
+	// MaxMessageSize 客户端单帧最大字节数，超过则断开连接，默认：1MB
+	MaxMessageSize int64
+	// AllowedOrigins 允许跨域的来源，为空只允许同源，*允许所有来源
+	AllowedOrigins []string
+}
+
+// 注册到endpoint类型注册器，可以通过DSL配置创建
+func init() {
+	endpoint.DefaultFactory.Register(&Websocket{})
+}
+
+// Websocket 接收端端点
+type Websocket struct {
+	endpoint.BaseEndpoint
+	// 配置
+	Config     Config
+	RuleConfig types.Config
+	// http路由器
+	router   *httprouter.Router
+	server   *http.Server
+	upgrader *ws.Upgrader
+	// 当前endpoint的连接
+	sessions    map[*Session]struct{}
+	sessionLock sync.Mutex
+}
+
+// Type 组件类型
+func (w *Websocket) Type() string {
+	return Type
+}
+
+func (w *Websocket) New() types.Node {
+	return &Websocket{}
+}
+
+// Init 初始化
+func (w *Websocket) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &w.Config)
+	w.RuleConfig = ruleConfig
+	return err
+}
+
+// Destroy 销毁
+func (w *Websocket) Destroy() {
+	_ = w.Close()
+}
+
+// Close 关闭服务和所有连接
+func (w *Websocket) Close() error {
+	var err error
+	if nil != w.server {
+		err = w.server.Shutdown(context.Background())
+	}
+	w.sessionLock.Lock()
+	defer w.sessionLock.Unlock()
+	for s := range w.sessions {
+		_ = s.Close()
+	}
+	return err
+}
+
+func (w *Websocket) Id() string {
+	return w.Config.Server
+}
+
+func (w *Websocket) AddRouterWithParams(router *endpoint.Router, params ...interface{}) error {
+	w.AddRouter(router)
+	return nil
+}
+
+// RemoveRouterWithParams 禁用路由，并关闭该路由的连接
+func (w *Websocket) RemoveRouterWithParams(from string, params ...interface{}) error {
+	w.RLock()
+	router, ok := w.RouterStorage[from]
+	w.RUnlock()
+	if ok {
+		router.Disable(true)
+		w.sessionLock.Lock()
+		defer w.sessionLock.Unlock()
+		for s := range w.sessions {
+			if s.router == router {
+				_ = s.Close()
+			}
+		}
+	}
+	return nil
+}
+
+// AddRouter 注册1个或者多个路由，From为连接路径，支持路径参数，例如：/ws/:sessionId
+func (w *Websocket) AddRouter(routers ...*endpoint.Router) *Websocket {
+	w.Lock()
+	defer w.Unlock()
+	if w.router == nil {
+		w.router = httprouter.New()
+	}
+	if w.RouterStorage == nil {
+		w.RouterStorage = make(map[string]*endpoint.Router)
+	}
+	for _, item := range routers {
+		if _, ok := w.RouterStorage[item.FromToString()]; !ok {
+			w.router.Handle(http.MethodGet, item.FromToString(), w.handler(item.FromToString()))
+		}
+		// 已经存储则替换成新的路由，并把路由设置可用，已经建立的连接继续使用原路由
+		item.Disable(false)
+		w.RouterStorage[item.FromToString()] = item
+	}
+	return w
+}
+
+// Router http路由器，可以挂载到已有的http服务
+func (w *Websocket) Router() *httprouter.Router {
+	return w.router
+}
+
+func (w *Websocket) Start() error {
+	var err error
+	w.server = &http.Server{Addr: w.Config.Server, Handler: w.router}
+	if w.Config.CertKeyFile != "" && w.Config.CertFile != "" {
+		w.Printf("starting websocket server with TLS on :%s", w.Config.Server)
+		err = w.server.ListenAndServeTLS(w.Config.CertFile, w.Config.CertKeyFile)
+	} else {
+		w.Printf("starting websocket server on :%s", w.Config.Server)
+		err = w.server.ListenAndServe()
+	}
+	return err
+}
+
+func (w *Websocket) getUpgrader() *ws.Upgrader {
+	w.Lock()
+	defer w.Unlock()
+	if w.upgrader == nil {
+		w.upgrader = &ws.Upgrader{}
+		if len(w.Config.AllowedOrigins) > 0 {
+			allowed := w.Config.AllowedOrigins
+			w.upgrader.CheckOrigin = func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				for _, item := range allowed {
+					if item == "*" || item == origin {
+						return true
+					}
+				}
+				return false
+			}
+		}
+	}
+	return w.upgrader
+}
+
+// sessionId 从路径参数或者url参数获取会话ID，获取不到则生成uuid
+func (w *Websocket) sessionId(r *http.Request, params httprouter.Params) string {
+	key := w.Config.SessionIdKey
+	if key == "" {
+		key = KeySessionId
+	}
+	if v := params.ByName(key); v != "" {
+		return v
+	}
+	if v := r.URL.Query().Get(key); v != "" {
+		return v
+	}
+	id, _ := uuid.NewV4()
+	return id.String()
+}
+
+// 连接时根据from获取路由，路由被替换后新建立的连接立即生效
+func (w *Websocket) handler(from string) httprouter.Handle {
+	return func(rw http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		w.RLock()
+		router := w.RouterStorage[from]
+		w.RUnlock()
+		if router == nil || router.IsDisable() {
+			http.NotFound(rw, r)
+			return
+		}
+		sessionId := w.sessionId(r, params)
+		if _, ok := Sessions.Get(sessionId); ok {
+			http.Error(rw, "session id already in use", http.StatusConflict)
+			return
+		}
+		conn, err := w.getUpgrader().Upgrade(rw, r, nil)
+		if err != nil {
+			w.Printf("websocket upgrade err :%v", err)
+			return
+		}
+		maxMessageSize := w.Config.MaxMessageSize
+		if maxMessageSize <= 0 {
+			maxMessageSize = DefaultMaxMessageSize
+		}
+		conn.SetReadLimit(maxMessageSize)
+		session := newSession(sessionId, conn, r)
+		session.router = router
+		if !w.addSession(session) {
+			// 升级期间会话ID被其他连接使用
+			_ = conn.WriteMessage(ws.CloseMessage, ws.FormatCloseMessage(ws.ClosePolicyViolation, "session id already in use"))
+			_ = conn.Close()
+			return
+		}
+		// 连接断开后，规则链不再继续执行
+		ctx, cancel := context.WithCancel(context.Background())
+		defer func() {
+			cancel()
+			w.removeSession(session)
+			_ = session.Close()
+		}()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if router.IsDisable() {
+				return
+			}
+			w.process(ctx, router, r, params, session, messageType, data)
+		}
+	}
+}
+
+// process 处理一帧数据
+func (w *Websocket) process(ctx context.Context, router *endpoint.Router, r *http.Request, params httprouter.Params, session *Session, messageType int, data []byte) {
+	defer func() {
+		// 捕捉异常
+		if e := recover(); e != nil {
+			w.Printf("websocket handler err :%v", e)
+		}
+	}()
+	exchange := &endpoint.Exchange{
+		In: &RequestMessage{
+			request:     r,
+			params:      params,
+			session:     session,
+			messageType: messageType,
+			body:        data,
+		},
+		Out: &ResponseMessage{
+			request:     r,
+			session:     session,
+			messageType: messageType,
+		},
+	}
+	w.DoProcessWithContext(ctx, router, exchange)
+}
+
+// addSession 注册会话，会话ID已经被其他连接使用返回false
+func (w *Websocket) addSession(s *Session) bool {
+	if !Sessions.add(s) {
+		return false
+	}
+	w.sessionLock.Lock()
+	defer w.sessionLock.Unlock()
+	if w.sessions == nil {
+		w.sessions = make(map[*Session]struct{})
+	}
+	w.sessions[s] = struct{}{}
+	return true
+}
+
+func (w *Websocket) removeSession(s *Session) {
+	Sessions.remove(s)
+	w.sessionLock.Lock()
+	delete(w.sessions, s)
+	w.sessionLock.Unlock()
+}
+
+func (w *Websocket) Printf(format string, v ...interface{}) {
+	if w.RuleConfig.Logger != nil {
+		w.RuleConfig.Logger.Printf(format, v...)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/endpoint"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+// 把消息推送到metadata.to指定的会话
+var pushChain = `{
+  "ruleChain": {"id": "push"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "msg.from=metadata.sessionId;return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+      {"id": "s2", "type": "websocketSend", "configuration": {"sessionId": "${metadata.to}"}}
+    ],
+    "connections": [{"fromId": "s1", "toId": "s2", "type": "Success"}]
+  }
+}`
+
+func dial(t *testing.T, server *httptest.Server, path string) *ws.Conn {
+	conn, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, nil)
+	assert.Nil(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	return conn
+}
+
+func waitSessions(n int) {
+	for i := 0; i < 500 && Sessions.Len() != n; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestWebsocketEndpoint(t *testing.T) {
+	config := rulego.NewConfig(types.WithDefaultPool())
+	ruleGo := &rulego.RuleGo{}
+	_, err := ruleGo.New("push", []byte(pushChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+
+	wsEndpoint := &Websocket{}
+	assert.Nil(t, wsEndpoint.Init(config, types.Configuration{"server": ":9090", "maxMessageSize": 64}))
+	// 回复同一个连接
+	echoRouter := endpoint.NewRouter().From("/echo").Process(func(router *endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		exchange.Out.SetBody([]byte(msg.Metadata.GetValue(KeySessionId) + ":" + msg.Data))
+		return true
+	}).End()
+	// 交给规则链推送给其他客户端
+	pushRouter := endpoint.NewRouter(endpoint.WithRuleGo(ruleGo)).From("/push/:sessionId").To("chain:push").End()
+	wsEndpoint.AddRouter(echoRouter, pushRouter)
+	server := httptest.NewServer(wsEndpoint.Router())
+	defer server.Close()
+	defer wsEndpoint.Destroy()
+
+	echo := dial(t, server, "/echo?sessionId=e1")
+	defer echo.Close()
+	assert.Nil(t, echo.WriteMessage(ws.TextMessage, []byte("hello")))
+	_, data, err := echo.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "e1:hello", string(data))
+
+	// 帧类型和请求一致
+	assert.Nil(t, echo.WriteMessage(ws.BinaryMessage, []byte{1, 2}))
+	messageType, data, err := echo.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, ws.BinaryMessage, messageType)
+	assert.Equal(t, "e1:\x01\x02", string(data))
+
+	// 会话ID已经被使用，拒绝连接
+	_, resp, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/echo?sessionId=e1", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Nil(t, echo.WriteMessage(ws.TextMessage, []byte("still")))
+	_, data, err = echo.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "e1:still", string(data))
+
+	// 超过单帧最大字节数，断开连接
+	large := dial(t, server, "/echo?sessionId=e2")
+	defer large.Close()
+	assert.Nil(t, large.WriteMessage(ws.TextMessage, []byte(strings.Repeat("a", 100))))
+	_, _, err = large.ReadMessage()
+	assert.NotNil(t, err)
+	waitSessions(1)
+
+	deviceA := dial(t, server, "/push/a?to=b")
+	defer deviceA.Close()
+	deviceB := dial(t, server, "/push/b")
+	defer deviceB.Close()
+	waitSessions(3)
+	_, ok := Sessions.Get("b")
+	assert.True(t, ok)
+
+	assert.Nil(t, deviceA.WriteMessage(ws.TextMessage, []byte(`{"temperature":41}`)))
+	// 通过url参数to指定推送目标
+	_, data, err = deviceB.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"from":"a","temperature":41}`, string(data))
+
+	// 关闭连接后会话删除
+	_ = deviceB.Close()
+	waitSessions(2)
+	_, ok = Sessions.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, ErrSessionNotFound, Sessions.Send("b", ws.TextMessage, []byte("x")))
+
+	// 删除路由，关闭该路由的连接
+	assert.Nil(t, wsEndpoint.RemoveRouterWithParams("/push/:sessionId"))
+	_, _, err = deviceA.ReadMessage()
+	assert.NotNil(t, err)
+	_, _, err = ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/push/c", nil)
+	assert.NotNil(t, err)
+	waitSessions(1)
+}
+
+func TestSendNode(t *testing.T) {
+	node := (&SendNode{}).New().(*SendNode)
+	assert.Nil(t, node.Init(types.NewConfig(), types.Configuration{}))
+	assert.Equal(t, "${metadata.sessionId}", node.Config.SessionId)
+	assert.NotNil(t, (&SendNode{}).Init(types.NewConfig(), types.Configuration{"messageType": "JSON"}))
+
+	_, ok := rulego.Registry.GetComponents()["websocketSend"]
+	assert.True(t, ok)
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -50,7 +52,33 @@ type DefaultRuleContext struct {
 	parentRuleCtx *DefaultRuleContext
 	// 所有子节点处理完成事件，只执行一次
 	onAllNodeCompleted func()
-}
+	// 当前节点执行超时定时器，节点没配置超时时间则为nil
+	timeoutTimer *time.Timer
+	// 当前节点通知状态，配置了超时时间才使用 0:未通知;1:已通知;2:已超时
+	tellState int32
+	// 当前节点重试策略，节点没配置重试策略则为nil
+	retryPolicy *RetryPolicy
+	// 当前节点输入的原始消息，用于重试
+	inMsg types.RuleMsg
+	// 当前节点已经重试的次数
+	retryCount int32
+	// 当前节点链路span，没有配置Tracer则为nil
+	span types.Span
+	// 当前运行的观察者，没有配置RunRecorder则为nil
+	runObserver types.RunObserver
+	// 当前节点处理完成回调，记录节点输出
+	onNodeEnd func(msg types.RuleMsg, relationType string, err error)
+	// 当前节点开始执行时间，用于统计节点执行耗时，分支和分离的上下文为零值
+	startTime time.Time
+	// 当前节点执行耗时是否已经统计 0:未统计;1:已统计
+	observed int32
+}
+
+const (
+	tellStatePending int32 = iota
+	tellStateTold
+	tellStateTimeout
+)
 
 // NewRuleContext 创建一个默认规则引擎消息处理上下文实例
 func NewRuleContext(config types.Config, ruleChainCtx *RuleChainCtx, from types.NodeCtx, self types.NodeCtx, pool types.Pool, onEnd func(msg types.RuleMsg, err error), context context.Context) *DefaultRuleContext {
@@ -76,6 +104,7 @@ func (ctx *DefaultRuleContext) NewNextNodeRuleContext(nextNode types.NodeCtx) *D
 		onEnd:         ctx.onEnd,
 		context:       ctx.GetContext(),
 		parentRuleCtx: ctx,
+		runObserver:   ctx.runObserver,
 	}
 }
 
@@ -92,7 +121,19 @@ func (ctx *DefaultRuleContext) TellNext(msg types.RuleMsg, relationTypes ...stri
 }
 
 func (ctx *DefaultRuleContext) TellSelf(msg types.RuleMsg, delayMs int64) {
+	// 等待期间持有规则链版本，节点超时后旧版本不会被提前销毁
+	release := ctx.holdChain()
 	time.AfterFunc(time.Millisecond*time.Duration(delayMs), func() {
+		defer release()
+		// 节点已经执行超时，不再执行
+		if ctx.timeoutTimer != nil && atomic.LoadInt32(&ctx.tellState) == tellStateTimeout {
+			return
+		}
+		// 上下文已取消或者超时，不再执行
+		if err := ctx.contextErr(); err != nil {
+			ctx.doOnEnd(msg, err)
+			return
+		}
 		_ = ctx.self.OnMsg(ctx, msg)
 	})
 }
@@ -133,12 +174,27 @@ func (ctx *DefaultRuleContext) SetAllCompletedFunc(f func()) types.RuleContext {
 }
 
 func (ctx *DefaultRuleContext) SubmitTack(task func()) {
+	if err := ctx.submit(task); err != nil {
+		ctx.config.Logger.Printf("SubmitTack error:%s", err)
+	}
+}
+
+// submit 异步执行任务，协程池提交失败返回错误
+func (ctx *DefaultRuleContext) submit(task func()) error {
 	if ctx.pool != nil {
-		if err := ctx.pool.Submit(task); err != nil {
-			ctx.config.Logger.Printf("SubmitTack error:%s", err)
-		}
-	} else {
-		go task()
+		return ctx.pool.Submit(task)
+	}
+	go task()
+	return nil
+}
+
+// submitChild 增加一个待执行子节点并异步执行任务
+// 任务提交失败则释放该计数，否则计数无法归零，同步调用会一直阻塞
+func (ctx *DefaultRuleContext) submitChild(task func()) {
+	ctx.childReady()
+	if err := ctx.submit(task); err != nil {
+		ctx.config.Logger.Printf("SubmitTack error:%s", err)
+		ctx.childDone()
 	}
 }
 
@@ -170,6 +226,33 @@ func (ctx *DefaultRuleContext) getNextNodes(relationType string) ([]types.NodeCt
 	return ctx.ruleChainCtx.GetNextNodes(ctx.self.GetNodeId(), relationType)
 }
 
+// InboundCount 规则链中连接到当前节点的上游节点数量，同一个上游节点的多个关系只计算一次
+func (ctx *DefaultRuleContext) InboundCount() int {
+	if ctx.ruleChainCtx == nil || ctx.self == nil {
+		return 0
+	}
+	relations, _ := ctx.ruleChainCtx.GetInboundRoutes(ctx.self.GetNodeId())
+	upstreams := make(map[types.RuleNodeId]struct{}, len(relations))
+	for _, item := range relations {
+		upstreams[item.InId] = struct{}{}
+	}
+	return len(upstreams)
+}
+
+// HasRelation 当前节点是否有指定关系的下一个节点
+func (ctx *DefaultRuleContext) HasRelation(relationType string) bool {
+	_, ok := ctx.getNextNodes(relationType)
+	return ok
+}
+
+// contextErr 获取上下文取消或者超时错误，如果上下文未结束返回nil
+func (ctx *DefaultRuleContext) contextErr() error {
+	if ctx.context == nil {
+		return nil
+	}
+	return ctx.context.Err()
+}
+
 func (ctx *DefaultRuleContext) onDebug(flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
 	if ctx.config.OnDebug != nil {
 		ctx.config.OnDebug(flowType, nodeId, msg.Copy(), relationType, err)
@@ -177,13 +260,164 @@ func (ctx *DefaultRuleContext) onDebug(flowType string, nodeId string, msg types
 }
 
 func (ctx *DefaultRuleContext) tell(msg types.RuleMsg, err error, relationTypes ...string) {
+	if ctx.timeoutTimer != nil && atomic.LoadInt32(&ctx.tellState) == tellStateTimeout {
+		// 已经通过Timeout关系通知下一个节点，忽略超时后的通知
+		ctx.config.Logger.Printf("tell ignored.node id:%s already timed out", ctx.GetSelfId())
+		return
+	}
+	// 满足重试条件，使用原始消息重新执行当前节点
+	if ctx.retryPolicy != nil && ctx.contextErr() == nil && ctx.retryPolicy.shouldRetry(relationTypes) && ctx.retry(err) {
+		return
+	}
+	if !ctx.markTold() {
+		return
+	}
+	ctx.dispatch(msg, err, relationTypes...)
+}
+
+// markTold 标记当前节点已经通知下一个节点并停止超时定时器，如果节点已经超时返回false
+func (ctx *DefaultRuleContext) markTold() bool {
+	if ctx.timeoutTimer != nil {
+		if atomic.CompareAndSwapInt32(&ctx.tellState, tellStatePending, tellStateTold) {
+			ctx.timeoutTimer.Stop()
+		} else if atomic.LoadInt32(&ctx.tellState) == tellStateTimeout {
+			// 已经通过Timeout关系通知下一个节点，忽略超时后的通知
+			ctx.config.Logger.Printf("tell ignored.node id:%s already timed out", ctx.GetSelfId())
+			return false
+		}
+	}
+	return true
+}
+
+// Hold 保持当前节点处于执行中，直到调用返回的release函数，release多次调用只生效一次
+func (ctx *DefaultRuleContext) Hold() func() {
+	ctx.childReady()
+	var once sync.Once
+	return func() {
+		once.Do(ctx.childDone)
+	}
+}
+
+// TellNextWithCompleted 使用指定的relationTypes发送消息到下一个节点，该消息所有后续节点都处理完成后调用onCompleted
+// 通过独立的分支上下文分发消息，分支上下文计数归零时触发onCompleted，并通知当前节点上下文
+func (ctx *DefaultRuleContext) TellNextWithCompleted(msg types.RuleMsg, onCompleted func(), relationTypes ...string) {
+	if !ctx.markTold() {
+		onCompleted()
+		return
+	}
+	var once sync.Once
+	branchCtx := &DefaultRuleContext{
+		config:        ctx.config,
+		ruleChainCtx:  ctx.ruleChainCtx,
+		from:          ctx.from,
+		self:          ctx.self,
+		pool:          ctx.pool,
+		onEnd:         ctx.onEnd,
+		context:       ctx.GetContext(),
+		parentRuleCtx: ctx,
+		span:          ctx.span,
+		runObserver:   ctx.runObserver,
+		onNodeEnd:     ctx.onNodeEnd,
+		onAllNodeCompleted: func() {
+			once.Do(onCompleted)
+		},
+	}
+	// 分支上下文执行完成时通知当前节点上下文
+	ctx.childReady()
+	branchCtx.dispatch(msg, nil, relationTypes...)
+}
+
+// Detach 创建当前节点的独立上下文，不继承当前消息的context、结束回调和链路
+func (ctx *DefaultRuleContext) Detach() types.RuleContext {
+	return &DefaultRuleContext{
+		config:       ctx.config,
+		ruleChainCtx: ctx.ruleChainCtx,
+		self:         ctx.self,
+		pool:         ctx.pool,
+		context:      context.Background(),
+	}
+}
+
+// End 结束当前消息，不通知下一个节点，触发结束回调
+func (ctx *DefaultRuleContext) End(msg types.RuleMsg, err error) {
+	if !ctx.markTold() {
+		return
+	}
 	msgCopy := msg.Copy()
+	ctx.childReady()
+	defer ctx.childDone()
+	ctx.nodeDone(msgCopy, "", err)
+	ctx.doOnEnd(msgCopy, err)
+}
+
+// retry 按重试策略延迟后使用原始消息重新执行当前节点，如果已经达到最大执行次数，返回false
+// 节点超时时间包含所有重试的执行时间
+func (ctx *DefaultRuleContext) retry(err error) bool {
+	retryCount := int(atomic.AddInt32(&ctx.retryCount, 1))
+	if retryCount >= ctx.retryPolicy.MaxAttempts {
+		return false
+	}
+	ctx.config.Logger.Printf("retry node id:%s attempt:%d error:%v", ctx.GetSelfId(), retryCount+1, err)
+	time.AfterFunc(ctx.retryPolicy.delay(retryCount), func() {
+		if ctx.timeoutTimer != nil && atomic.LoadInt32(&ctx.tellState) == tellStateTimeout {
+			return
+		}
+		// 等待重试期间上下文已取消或者超时，结束规则链
+		if ctxErr := ctx.contextErr(); ctxErr != nil {
+			ctx.tell(ctx.inMsg, ctxErr, types.Failure)
+			return
+		}
+		defer func() {
+			// 捕捉异常，作为执行失败处理
+			if e := recover(); e != nil {
+				ctx.tell(ctx.inMsg, fmt.Errorf("%v", e), types.Failure)
+			}
+		}()
+		if nodeErr := ctx.self.OnMsg(ctx, ctx.inMsg.Copy()); nodeErr != nil {
+			ctx.config.Logger.Printf("retry error.node type:%s error: %s", ctx.self.Type(), nodeErr)
+		}
+	})
+	return true
+}
+
+// watchTimeout 监听节点执行超时，如果节点在timeout内没有通知下一个节点，
+// 则通过`Timeout`关系把消息发送到下一个节点，没有`Timeout`关系的连接，则使用`Failure`关系
+func (ctx *DefaultRuleContext) watchTimeout(msg types.RuleMsg, timeout time.Duration) {
+	ctx.timeoutTimer = time.AfterFunc(timeout, func() {
+		if atomic.CompareAndSwapInt32(&ctx.tellState, tellStatePending, tellStateTimeout) {
+			err := fmt.Errorf("node id:%s execution timeout after %s", ctx.GetSelfId(), timeout)
+			relationType := types.Timeout
+			if _, ok := ctx.getNextNodes(types.Timeout); !ok {
+				relationType = types.Failure
+			}
+			ctx.dispatch(msg, err, relationType)
+		}
+	})
+}
+
+// dispatch 根据关系把消息分发到下一个或者多个节点，如果没有下一个节点，则触发结束回调
+func (ctx *DefaultRuleContext) dispatch(msg types.RuleMsg, err error, relationTypes ...string) {
+	msgCopy := msg.Copy()
+	// 分发期间持有一个计数，防止先提交的子节点执行完成，提前触发onAllNodeCompleted事件
+	ctx.childReady()
+	defer ctx.childDone()
+	// 上下文已取消或者超时，停止往下一个节点分发，并通知规则链结束
+	if ctxErr := ctx.contextErr(); ctxErr != nil {
+		ctx.nodeDone(msgCopy, "", ctxErr)
+		ctx.doOnEnd(msgCopy, ctxErr)
+		return
+	}
 	if ctx.isFirst {
-		ctx.SubmitTack(func() {
+		// 增加一个待执行的子节点
+		ctx.submitChild(func() {
 			ctx.tellNext(msgCopy, ctx.self)
 		})
 	} else {
+		ctx.nodeDone(msgCopy, strings.Join(relationTypes, ","), err)
 		for _, relationType := range relationTypes {
+			if ctx.config.MetricsCollector != nil && ctx.ruleChainCtx != nil {
+				ctx.config.MetricsCollector.OnNodeMsg(ctx.ruleChainCtx.Id.Id, ctx.GetSelfId(), relationType)
+			}
 			if ctx.self != nil && ctx.self.IsDebugMode() {
 				// 记录调试信息
 				ctx.SubmitTack(func() {
@@ -194,21 +428,87 @@ func (ctx *DefaultRuleContext) tell(msg types.RuleMsg, err error, relationTypes
 			if nodes, ok := ctx.getNextNodes(relationType); ok {
 				for _, item := range nodes {
 					tmp := item
-					ctx.SubmitTack(func() {
+					// 增加一个待执行的子节点，需要在提交任务前增加，否则计数可能提前归零
+					ctx.submitChild(func() {
 						ctx.tellNext(msg.Copy(), tmp)
 					})
 				}
 			} else {
+				if relationType == types.Failure {
+					ctx.onDeadLetter(msgCopy, err)
+				}
 				ctx.doOnEnd(msgCopy, err)
 			}
 		}
 	}
 }
 
+// onDeadLetter 节点执行失败并且没有`Failure`连接，把消息交给死信处理器
+// 优先使用规则链配置的死信处理器，其次使用`Config.DeadLetterHandler`
+func (ctx *DefaultRuleContext) onDeadLetter(msg types.RuleMsg, err error) {
+	handler := ctx.config.DeadLetterHandler
+	var chainId string
+	if ctx.ruleChainCtx != nil {
+		chainId = ctx.ruleChainCtx.Id.Id
+		if ctx.ruleChainCtx.deadLetterHandler != nil {
+			handler = ctx.ruleChainCtx.deadLetterHandler
+		}
+	}
+	if handler == nil {
+		return
+	}
+	if handleErr := handler.Handle(types.NewDeadLetter(chainId, ctx.GetSelfId(), msg, err)); handleErr != nil {
+		ctx.config.Logger.Printf("dead letter handle error.node id:%s error:%s", ctx.GetSelfId(), handleErr)
+	}
+}
+
+// startSpan 开始当前节点的span，并通过context把链路上下文传递给节点和后续节点
+func (ctx *DefaultRuleContext) startSpan(msg types.RuleMsg) {
+	tracer := ctx.config.Tracer
+	if tracer == nil || ctx.self == nil {
+		return
+	}
+	parent, _ := types.SpanContextFromContext(ctx.context)
+	span := tracer.StartSpan(parent, ctx.self.Type(), msg)
+	span.SetAttribute(types.AttrNodeId, ctx.GetSelfId())
+	span.SetAttribute(types.AttrNodeType, ctx.self.Type())
+	if ctx.ruleChainCtx != nil {
+		span.SetAttribute(types.AttrChainId, ctx.ruleChainCtx.Id.Id)
+	}
+	ctx.span = span
+	ctx.context = types.ContextWithSpanContext(ctx.context, span.Context())
+}
+
+// startStep 记录当前节点的输入
+func (ctx *DefaultRuleContext) startStep(msg types.RuleMsg) {
+	if ctx.runObserver == nil || ctx.self == nil {
+		return
+	}
+	var chainId string
+	if ctx.ruleChainCtx != nil {
+		chainId = ctx.ruleChainCtx.Id.Id
+	}
+	ctx.onNodeEnd = ctx.runObserver.OnNodeStart(chainId, ctx.GetSelfId(), ctx.self.Type(), msg.Copy())
+}
+
+// nodeDone 当前节点处理完成，结束span并记录节点输出
+func (ctx *DefaultRuleContext) nodeDone(msg types.RuleMsg, relationType string, err error) {
+	if ctx.span != nil {
+		ctx.span.End(relationType, err)
+	}
+	if ctx.onNodeEnd != nil {
+		ctx.onNodeEnd(msg.Copy(), relationType, err)
+	}
+	// 节点可能多次通知下一个节点，每次执行只统计一次
+	if ctx.config.MetricsCollector != nil && ctx.ruleChainCtx != nil && !ctx.startTime.IsZero() &&
+		atomic.CompareAndSwapInt32(&ctx.observed, 0, 1) {
+		ctx.config.MetricsCollector.OnNodeEnd(ctx.ruleChainCtx.Id.Id, ctx.GetSelfId(), time.Since(ctx.startTime), err)
+	}
+}
+
 func (ctx *DefaultRuleContext) tellNext(msg types.RuleMsg, nextNode types.NodeCtx) {
 	nextCtx := ctx.NewNextNodeRuleContext(nextNode)
-	// 增加一个待执行的子节点
-	ctx.childReady()
+	nextCtx.startTime = time.Now()
 	defer func() {
 		// 捕捉异常
 		if e := recover(); e != nil {
@@ -216,20 +516,57 @@ func (ctx *DefaultRuleContext) tellNext(msg types.RuleMsg, nextNode types.NodeCt
 				// 记录异常信息
 				ctx.onDebug(types.In, nextCtx.GetSelfId(), msg, "", fmt.Errorf("%v", e))
 			}
-			ctx.childDone()
+			nextCtx.nodeDone(msg, types.Failure, fmt.Errorf("%v", e))
+			// 已经通过Timeout关系通知下一个节点，则计数已经释放
+			if nextCtx.timeoutTimer == nil || atomic.CompareAndSwapInt32(&nextCtx.tellState, tellStatePending, tellStateTold) {
+				ctx.childDone()
+			}
 		}
 	}()
+	// 任务等待执行期间上下文已取消或者超时，则不再执行该节点
+	if ctxErr := nextCtx.contextErr(); ctxErr != nil {
+		nextCtx.doOnEnd(msg, ctxErr)
+		return
+	}
+	nextCtx.startSpan(msg)
+	nextCtx.startStep(msg)
+	if nodeCtx, ok := nextNode.(*RuleNodeCtx); ok {
+		// 节点配置了重试策略
+		if retryPolicy := nodeCtx.GetRetryPolicy(); retryPolicy != nil {
+			nextCtx.retryPolicy = retryPolicy
+			nextCtx.inMsg = msg.Copy()
+		}
+		// 节点配置了执行超时时间
+		if timeout := nodeCtx.GetTimeout(); timeout > 0 {
+			nextCtx.watchTimeout(msg.Copy(), timeout)
+		}
+	}
 	if nextCtx.self != nil && nextCtx.self.IsDebugMode() {
 		// 记录调试信息
 		ctx.onDebug(types.In, nextCtx.GetSelfId(), msg, "", nil)
 	}
+	// 节点执行期间持有规则链版本，节点超时后消息虽然已经结束，但是旧版本要等OnMsg返回才能销毁
+	release := nextCtx.holdChain()
+	defer release()
 	if err := nextNode.OnMsg(nextCtx, msg); err != nil {
 		ctx.config.Logger.Printf("tellNext error.node type:%s error: %s", nextCtx.self.Type(), err)
 	}
 }
 
+// holdChain 持有当前规则链版本，防止被新版本替换后销毁，返回释放函数
+func (ctx *DefaultRuleContext) holdChain() func() {
+	rc := ctx.ruleChainCtx
+	if rc == nil {
+		return func() {}
+	}
+	rc.acquire()
+	return rc.release
+}
+
 // 规则链执行完成回调函数
 func (ctx *DefaultRuleContext) doOnEnd(msg types.RuleMsg, err error) {
+	// 每个结束点占用一个计数，回调执行完成后释放
+	ctx.childReady()
 	// 全局回调
 	// 通过`Config.OnEnd`设置
 	if ctx.config.OnEnd != nil {
@@ -240,13 +577,12 @@ func (ctx *DefaultRuleContext) doOnEnd(msg types.RuleMsg, err error) {
 	// 单条消息的context回调
 	// 通过OnMsgWithEndFunc(msg, endFunc)设置
 	if ctx.onEnd != nil {
-		ctx.SubmitTack(func() {
+		ctx.submitChild(func() {
 			ctx.onEnd(msg, err)
 			ctx.childDone()
 		})
-	} else {
-		ctx.childDone()
 	}
+	ctx.childDone()
 }
 
 // RuleEngine 规则引擎
@@ -258,8 +594,16 @@ type RuleEngine struct {
 	Config types.Config
 	// 子规则链池
 	RuleChainPool *RuleGo
-	// 根规则链
+	// 根规则链，当前生效的版本
 	rootRuleChainCtx *RuleChainCtx
+	// 最新的规则链版本号
+	version int64
+	// 规则链死信处理器
+	deadLetterHandler types.DeadLetterHandler
+	// 规则链存储，规则链创建和更新后写回存储
+	chainStore types.ChainStore
+	// 保护根规则链替换
+	lock sync.RWMutex
 }
 
 // RuleEngineOption is a function type that modifies the RuleEngine.
@@ -283,12 +627,18 @@ func newRuleEngine(id string, def []byte, opts ...RuleEngineOption) (*RuleEngine
 			// 使用规则链ID
 			ruleEngine.Id = ruleEngine.rootRuleChainCtx.Id.Id
 		}
+		// 写回规则链存储
+		if err = ruleEngine.saveToStore(def); err != nil {
+			ruleEngine.Stop()
+		}
 	}
 
 	return ruleEngine, err
 }
 
 // ReloadSelf 重新加载规则链
+// 新规则链生成新的版本，新消息交给新版本处理，旧版本处理中的消息继续在旧版本执行，
+// 旧版本所有处理中的消息执行完后，才销毁旧版本
 func (e *RuleEngine) ReloadSelf(def []byte, opts ...RuleEngineOption) error {
 	// Apply the options to the RuleEngine.
 	for _, opt := range opts {
@@ -296,16 +646,28 @@ func (e *RuleEngine) ReloadSelf(def []byte, opts ...RuleEngineOption) error {
 	}
 	// 初始化
 	if ctx, err := e.Config.Parser.DecodeRuleChain(e.Config, def); err == nil {
-		if e.Initialized() {
-			e.Stop()
+		newCtx := ctx.(*RuleChainCtx)
+		// 设置子规则链池
+		newCtx.SetRuleChainPool(e.RuleChainPool)
+		newCtx.deadLetterHandler = e.deadLetterHandler
+
+		e.lock.Lock()
+		oldCtx := e.rootRuleChainCtx
+		if oldCtx != nil {
+			newCtx.Id = oldCtx.Id
+			// 新版本接收消息前，转移有状态节点的状态
+			oldCtx.transferStates(newCtx)
 		}
-		if e.rootRuleChainCtx != nil {
-			ctx.(*RuleChainCtx).Id = e.rootRuleChainCtx.Id
+		e.version++
+		newCtx.version = e.version
+		e.rootRuleChainCtx = newCtx
+		e.lock.Unlock()
+
+		if oldCtx != nil {
+			oldCtx.retire()
+			// 规则链已经更新，写回规则链存储
+			return e.saveToStore(def)
 		}
-		e.rootRuleChainCtx = ctx.(*RuleChainCtx)
-		// 设置子规则链池
-		e.rootRuleChainCtx.SetRuleChainPool(e.RuleChainPool)
-
 		return nil
 	} else {
 		return err
@@ -318,21 +680,60 @@ func (e *RuleEngine) ReloadSelf(def []byte, opts ...RuleEngineOption) error {
 func (e *RuleEngine) ReloadChild(ruleNodeId string, dsl []byte) error {
 	if len(dsl) == 0 {
 		return errors.New("dsl can not empty")
-	} else if e.rootRuleChainCtx == nil {
+	} else if e.RootRuleChainCtx() == nil {
 		return errors.New("ReloadNode error.RuleEngine not initialized")
 	} else if ruleNodeId == "" {
 		// 更新根规则链
 		return e.ReloadSelf(dsl)
 	} else {
 		// 更新根规则链子节点
-		return e.rootRuleChainCtx.ReloadChild(types.RuleNodeId{Id: ruleNodeId}, dsl)
+		if err := e.RootRuleChainCtx().ReloadChild(types.RuleNodeId{Id: ruleNodeId}, dsl); err != nil {
+			return err
+		}
+		return e.saveToStore(e.DSL())
 	}
 }
 
+// Rollback 把根规则链回滚到规则链存储中指定的历史版本，回滚后生成一个新的版本
+func (e *RuleEngine) Rollback(revision int64) error {
+	if e.chainStore == nil {
+		return errors.New("rollback error.chain store not configured")
+	}
+	history, err := e.chainStore.History(e.Id)
+	if err != nil {
+		return err
+	}
+	for _, item := range history {
+		if item.Revision == revision {
+			return e.ReloadSelf(item.Def)
+		}
+	}
+	return fmt.Errorf("rule chain id:%s revision:%d not found", e.Id, revision)
+}
+
+// History 获取规则链存储中根规则链所有保存的版本
+func (e *RuleEngine) History() ([]types.ChainRevision, error) {
+	if e.chainStore == nil {
+		return nil, errors.New("chain store not configured")
+	}
+	return e.chainStore.History(e.Id)
+}
+
+// saveToStore 把规则链定义写回规则链存储，没有配置存储则忽略
+func (e *RuleEngine) saveToStore(def []byte) error {
+	if e.chainStore == nil || e.Id == "" {
+		return nil
+	}
+	if _, err := e.chainStore.Save(e.Id, def); err != nil {
+		return fmt.Errorf("save rule chain id:%s to store error:%w", e.Id, err)
+	}
+	return nil
+}
+
 // DSL 获取根规则链配置
 func (e *RuleEngine) DSL() []byte {
-	if e.rootRuleChainCtx != nil {
-		return e.rootRuleChainCtx.DSL()
+	if ruleChainCtx := e.RootRuleChainCtx(); ruleChainCtx != nil {
+		return ruleChainCtx.DSL()
 	} else {
 		return nil
 	}
@@ -340,13 +741,13 @@ func (e *RuleEngine) DSL() []byte {
 
 // NodeDSL 获取规则链节点配置
 func (e *RuleEngine) NodeDSL(chainId types.RuleNodeId, childNodeId types.RuleNodeId) []byte {
-	if e.rootRuleChainCtx != nil {
+	if ruleChainCtx := e.RootRuleChainCtx(); ruleChainCtx != nil {
 		if chainId.Id == "" {
-			if node, ok := e.rootRuleChainCtx.GetNodeById(childNodeId); ok {
+			if node, ok := ruleChainCtx.GetNodeById(childNodeId); ok {
 				return node.DSL()
 			}
 		} else {
-			if node, ok := e.rootRuleChainCtx.GetNodeById(chainId); ok {
+			if node, ok := ruleChainCtx.GetNodeById(chainId); ok {
 				if childNode, ok := node.GetNodeById(childNodeId); ok {
 					return childNode.DSL()
 				}
@@ -357,15 +758,28 @@ func (e *RuleEngine) NodeDSL(chainId types.RuleNodeId, childNodeId types.RuleNod
 }
 
 func (e *RuleEngine) Initialized() bool {
-	return e.rootRuleChainCtx != nil
+	return e.RootRuleChainCtx() != nil
 }
 
-// RootRuleChainCtx 获取根规则链
+// RootRuleChainCtx 获取根规则链当前生效的版本
 func (e *RuleEngine) RootRuleChainCtx() *RuleChainCtx {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
 	return e.rootRuleChainCtx
 }
 
+// Version 获取根规则链当前生效的版本号，每次重新加载根规则链加1，没初始化返回0
+func (e *RuleEngine) Version() int64 {
+	if ruleChainCtx := e.RootRuleChainCtx(); ruleChainCtx != nil {
+		return ruleChainCtx.Version()
+	}
+	return 0
+}
+
+// Stop 立即销毁根规则链，不等待处理中的消息
 func (e *RuleEngine) Stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
 	if e.rootRuleChainCtx != nil {
 		e.rootRuleChainCtx.Destroy()
 		e.rootRuleChainCtx = nil
@@ -389,36 +803,129 @@ func (e *RuleEngine) OnMsgWithEndFunc(msg types.RuleMsg, endFunc func(msg types.
 // context 用于不同组件实例数据共享
 // endFunc 用于数据经过规则链执行完的回调，用于获取规则链处理结果数据。注意：如果规则链有多个结束点，回调函数则会执行多次
 func (e *RuleEngine) OnMsgWithOptions(msg types.RuleMsg, opts ...types.RuleContextOption) {
-	e.onMsgAndWait(msg, false, opts...)
+	_ = e.onMsgAndWait(msg, false, 0, "", opts...)
+}
+
+// OnMsgFromNode 把消息交给规则引擎处理，从指定节点开始执行，异步执行
+// 用于重放死信等场景，节点不存在返回错误
+func (e *RuleEngine) OnMsgFromNode(nodeId string, msg types.RuleMsg, opts ...types.RuleContextOption) error {
+	return e.onMsgAndWait(msg, false, 0, nodeId, opts...)
 }
 
 // OnMsgAndWait 把消息交给规则引擎处理，同步执行，等规则链所有节点执行完，返回
+// 如果通过types.WithContext设置的context被取消或者超时，则不再等待，以context错误调用结束回调函数后直接返回
 func (e *RuleEngine) OnMsgAndWait(msg types.RuleMsg, opts ...types.RuleContextOption) {
-	e.onMsgAndWait(msg, true, opts...)
+	_ = e.onMsgAndWait(msg, true, 0, "", opts...)
 }
 
-func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, opts ...types.RuleContextOption) {
-	if e.rootRuleChainCtx != nil {
-		rootCtx := e.rootRuleChainCtx.rootRuleContext.(*DefaultRuleContext)
+// OnMsgAndWaitWithTimeout 把消息交给规则引擎处理，同步执行，等规则链所有节点执行完或者超时，返回
+// 超时后规则链不再往下一个节点分发消息，并以context.DeadlineExceeded错误调用结束回调函数，节点挂起时也一样
+// 返回context取消或者超时错误，规则链正常执行完成返回nil
+func (e *RuleEngine) OnMsgAndWaitWithTimeout(msg types.RuleMsg, timeout time.Duration, opts ...types.RuleContextOption) error {
+	return e.onMsgAndWait(msg, true, timeout, "", opts...)
+}
+
+// onMsgAndWait timeout<=0 表示不设置超时时间，startNodeId为空表示从第一个节点开始执行
+func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, timeout time.Duration, startNodeId string, opts ...types.RuleContextOption) error {
+	// 在读锁内记录处理中的消息，保证版本被替换后不会再有新消息进入
+	e.lock.RLock()
+	ruleChainCtx := e.rootRuleChainCtx
+	if ruleChainCtx != nil {
+		ruleChainCtx.acquire()
+	}
+	e.lock.RUnlock()
+	if ruleChainCtx != nil {
+		var startNode types.NodeCtx
+		if startNodeId != "" {
+			var ok bool
+			if startNode, ok = ruleChainCtx.GetNodeById(types.RuleNodeId{Id: startNodeId, Type: types.NODE}); !ok {
+				ruleChainCtx.release()
+				return fmt.Errorf("node id:%s not found", startNodeId)
+			}
+		}
+		rootCtx := ruleChainCtx.rootRuleContext.(*DefaultRuleContext)
 		rootCtxCopy := NewRuleContext(rootCtx.config, rootCtx.ruleChainCtx, rootCtx.from, rootCtx.self, rootCtx.pool, rootCtx.onEnd, rootCtx.GetContext())
 		rootCtxCopy.isFirst = rootCtx.isFirst
 		for _, opt := range opts {
 			opt(rootCtxCopy)
 		}
-		rootCtxCopy.TellNext(msg)
-
+		if timeout > 0 {
+			// 基于当前context创建带超时的context，超时后规则链停止往下执行
+			c, cancel := context.WithTimeout(rootCtxCopy.GetContext(), timeout)
+			defer cancel()
+			rootCtxCopy.SetContext(c)
+		}
+		collector := e.Config.MetricsCollector
+		chainId := ruleChainCtx.Id.Id
+		startTime := time.Now()
+		if collector != nil {
+			collector.OnMsgStart(chainId)
+		}
+		// 规则链span，节点span都是它的子span
+		var chainSpan types.Span
+		if tracer := e.Config.Tracer; tracer != nil {
+			parent, _ := types.SpanContextFromContext(rootCtxCopy.GetContext())
+			chainSpan = tracer.StartSpan(parent, ruleChainCtx.Type(), msg)
+			chainSpan.SetAttribute(types.AttrChainId, chainId)
+			rootCtxCopy.SetContext(types.ContextWithSpanContext(rootCtxCopy.GetContext(), chainSpan.Context()))
+		}
+		if recorder := e.Config.RunRecorder; recorder != nil {
+			rootCtxCopy.runObserver = recorder.OnRunStart(chainId, msg.Copy())
+		}
+		// 规则链都执行完，释放该版本处理中的消息
+		done := make(chan struct{})
+		var once sync.Once
+		rootCtxCopy.onAllNodeCompleted = func() {
+			once.Do(func() {
+				if collector != nil {
+					collector.OnMsgEnd(chainId, time.Since(startTime))
+				}
+				if chainSpan != nil {
+					chainSpan.End("", rootCtxCopy.contextErr())
+				}
+				if rootCtxCopy.runObserver != nil {
+					rootCtxCopy.runObserver.OnRunEnd(rootCtxCopy.contextErr())
+				}
+				ruleChainCtx.release()
+				close(done)
+			})
+		}
+		// 等待被放弃后，不再触发结束回调，防止挂起的节点之后恢复时重复通知调用方
+		var abandoned int32
+		onEnd := rootCtxCopy.onEnd
+		if wait && onEnd != nil {
+			rootCtxCopy.onEnd = func(msg types.RuleMsg, err error) {
+				if atomic.LoadInt32(&abandoned) == 0 {
+					onEnd(msg, err)
+				}
+			}
+		}
+		if startNode != nil {
+			rootCtxCopy.submitChild(func() {
+				rootCtxCopy.tellNext(msg.Copy(), startNode)
+			})
+		} else {
+			rootCtxCopy.TellNext(msg)
+		}
 		// 同步方式调用，等规则链都执行完，才返回
 		if wait {
-			c := make(chan struct{})
-			rootCtxCopy.onAllNodeCompleted = func() {
-				close(c)
+			select {
+			case <-done:
+				return nil
+			case <-rootCtxCopy.GetContext().Done():
+				// 有节点挂起，上下文取消或者超时，用上下文错误触发结束回调
+				err := rootCtxCopy.GetContext().Err()
+				if onEnd != nil && atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+					onEnd(msg, err)
+				}
+				return err
 			}
-			<-c
 		}
-
+		return nil
 	} else {
 		// 沒有定义根则链或者没初始化
 		e.Config.Logger.Printf("onMsg error.RuleEngine not initialized")
+		return errors.New("RuleEngine not initialized")
 	}
 }
 
@@ -442,6 +949,32 @@ func WithConfig(config types.Config) RuleEngineOption {
 	}
 }
 
+// WithParser 规则链解析器，会覆盖Config中的解析器
+// 需要在WithConfig之后使用
+func WithParser(parser types.Parser) RuleEngineOption {
+	return func(re *RuleEngine) error {
+		re.Config.Parser = parser
+		return nil
+	}
+}
+
+// WithDeadLetterHandler 规则链死信处理器，优先于`Config.DeadLetterHandler`
+func WithDeadLetterHandler(handler types.DeadLetterHandler) RuleEngineOption {
+	return func(re *RuleEngine) error {
+		re.deadLetterHandler = handler
+		return nil
+	}
+}
+
+// WithChainStore 规则链存储，规则链创建和通过`ReloadSelf`/`ReloadChild`更新后写回存储
+// 可以通过`RuleEngine.Rollback`回滚到历史版本
+func WithChainStore(store types.ChainStore) RuleEngineOption {
+	return func(re *RuleEngine) error {
+		re.chainStore = store
+		return nil
+	}
+}
+
 // WithRuleChainPool 子规则链池
 func WithRuleChainPool(ruleChainPool *RuleGo) RuleEngineOption {
 	return func(re *RuleEngine) error {
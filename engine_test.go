@@ -17,11 +17,15 @@
 package rulego
 
 import (
+	"errors"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/xyzbit/rulego/api/types"
 	"github.com/xyzbit/rulego/test/assert"
+	"github.com/xyzbit/rulego/utils/str"
 )
 
 var rootRuleChain = `
@@ -179,3 +183,41 @@ func TestEngine(t *testing.T) {
 	assert.False(t, ok)
 	assert.False(t, ruleEngine.Initialized())
 }
+
+// limitPool 只接受前limit个任务的协程池，超出返回错误
+type limitPool struct {
+	limit int32
+	count int32
+}
+
+func (p *limitPool) Submit(task func()) error {
+	if atomic.AddInt32(&p.count, 1) > p.limit {
+		return errors.New("pool is full")
+	}
+	go task()
+	return nil
+}
+
+func (p *limitPool) Release() {
+}
+
+// TestSubmitTackFailed 测试任务提交失败，同步调用不会一直阻塞
+func TestSubmitTackFailed(t *testing.T) {
+	for limit := int32(0); limit < 6; limit++ {
+		config := NewConfig(types.WithPool(&limitPool{limit: limit}))
+		ruleEngine, err := New(str.RandomStr(10), []byte(rootRuleChain), WithConfig(config))
+		assert.Nil(t, err)
+		msg := types.NewMsg(0, "TEST_MSG_TYPE1", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+		done := make(chan struct{})
+		go func() {
+			ruleEngine.OnMsgAndWait(msg)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second * 3):
+			t.Fatalf("OnMsgAndWait blocked, pool limit:%d", limit)
+		}
+		ruleEngine.Stop()
+	}
+}
@@ -0,0 +1,371 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics 规则引擎指标，使用Prometheus文本格式输出，不依赖第三方库
+//
+// 使用方式：
+//
+//	collector := metrics.NewCollector()
+//	config := rulego.NewConfig(types.WithDefaultPool(), types.WithMetricsCollector(collector))
+//	collector.RegisterPool("default", config.Pool.(*pool.WorkerPool))
+//	http.Handle("/metrics", collector.Handler())
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/pool"
+)
+
+// ContentType Prometheus文本格式
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 指标名称
+const (
+	ChainMessagesTotal      = "rulego_chain_messages_total"
+	ChainInflightMessages   = "rulego_chain_inflight_messages"
+	ChainMsgDurationSeconds = "rulego_chain_msg_duration_seconds"
+	NodeMessagesTotal       = "rulego_node_messages_total"
+	NodeErrorsTotal         = "rulego_node_errors_total"
+	NodeDurationSeconds     = "rulego_node_duration_seconds"
+	PoolMaxWorkers          = "rulego_pool_max_workers"
+	PoolWorkers             = "rulego_pool_workers"
+	PoolIdleWorkers         = "rulego_pool_idle_workers"
+)
+
+// DefaultBuckets 默认耗时直方图分桶，单位：秒
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var _ types.MetricsCollector = (*Collector)(nil)
+
+// PoolStatsProvider 可以获取使用情况的协程池，例如：`pool.WorkerPool`
+type PoolStatsProvider interface {
+	Stats() pool.Stats
+}
+
+// nodeKey 节点指标标签
+type nodeKey struct {
+	chainId      string
+	nodeId       string
+	relationType string
+}
+
+// histogram 耗时直方图
+type histogram struct {
+	// 每个分桶的计数，不累加
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// chainMetrics 规则链指标
+type chainMetrics struct {
+	total    uint64
+	inflight int64
+	duration *histogram
+}
+
+// Collector 内存指标收集器，实现`types.MetricsCollector`
+type Collector struct {
+	buckets       []float64
+	chains        map[string]*chainMetrics
+	nodeMsgs      map[nodeKey]uint64
+	nodeErrors    map[nodeKey]uint64
+	nodeDurations map[nodeKey]*histogram
+	pools         map[string]PoolStatsProvider
+	lock          sync.Mutex
+}
+
+// NewCollector 创建指标收集器，buckets为耗时直方图分桶(秒)，为空使用DefaultBuckets
+func NewCollector(buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	return &Collector{
+		buckets:       sorted,
+		chains:        make(map[string]*chainMetrics),
+		nodeMsgs:      make(map[nodeKey]uint64),
+		nodeErrors:    make(map[nodeKey]uint64),
+		nodeDurations: make(map[nodeKey]*histogram),
+		pools:         make(map[string]PoolStatsProvider),
+	}
+}
+
+// RegisterPool 注册需要监控的协程池，同名会被覆盖
+func (c *Collector) RegisterPool(name string, p PoolStatsProvider) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pools[name] = p
+}
+
+func (c *Collector) chain(chainId string) *chainMetrics {
+	m, ok := c.chains[chainId]
+	if !ok {
+		m = &chainMetrics{duration: c.newHistogram()}
+		c.chains[chainId] = m
+	}
+	return m
+}
+
+// OnMsgStart 根规则链开始处理消息
+func (c *Collector) OnMsgStart(chainId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := c.chain(chainId)
+	m.total++
+	m.inflight++
+}
+
+// OnMsgEnd 根规则链处理消息完成
+func (c *Collector) OnMsgEnd(chainId string, cost time.Duration) {
+	seconds := cost.Seconds()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := c.chain(chainId)
+	m.inflight--
+	c.observe(m.duration, seconds)
+}
+
+// OnNodeMsg 节点输出一条消息
+func (c *Collector) OnNodeMsg(chainId, nodeId, relationType string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.nodeMsgs[nodeKey{chainId: chainId, nodeId: nodeId, relationType: relationType}]++
+}
+
+// OnNodeEnd 节点执行完成
+func (c *Collector) OnNodeEnd(chainId, nodeId string, cost time.Duration, err error) {
+	seconds := cost.Seconds()
+	key := nodeKey{chainId: chainId, nodeId: nodeId}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err != nil {
+		c.nodeErrors[key]++
+	}
+	h, ok := c.nodeDurations[key]
+	if !ok {
+		h = c.newHistogram()
+		c.nodeDurations[key] = h
+	}
+	c.observe(h, seconds)
+}
+
+func (c *Collector) newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(c.buckets))}
+}
+
+// observe 记录一次耗时，需要持有锁
+func (c *Collector) observe(h *histogram, seconds float64) {
+	for i, bound := range c.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Handler 返回输出Prometheus文本格式指标的http.Handler
+func (c *Collector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = c.WriteTo(w)
+	})
+}
+
+// WriteTo 以Prometheus文本格式输出所有指标，实现io.WriterTo
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	c.lock.Lock()
+	c.writeChains(cw)
+	c.writeNodes(cw)
+	pools := make(map[string]PoolStatsProvider, len(c.pools))
+	for k, v := range c.pools {
+		pools[k] = v
+	}
+	c.lock.Unlock()
+	// 获取协程池使用情况需要加协程池锁，在收集器锁外执行
+	writePools(cw, pools)
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (c *Collector) writeChains(w *countWriter) {
+	chainIds := make([]string, 0, len(c.chains))
+	for k := range c.chains {
+		chainIds = append(chainIds, k)
+	}
+	sort.Strings(chainIds)
+
+	w.header(ChainMessagesTotal, "counter", "Total number of messages received by the rule chain.")
+	for _, chainId := range chainIds {
+		w.sample(ChainMessagesTotal, labels("chain", chainId), float64(c.chains[chainId].total))
+	}
+	w.header(ChainInflightMessages, "gauge", "Number of messages currently being processed by the rule chain.")
+	for _, chainId := range chainIds {
+		w.sample(ChainInflightMessages, labels("chain", chainId), float64(c.chains[chainId].inflight))
+	}
+	w.header(ChainMsgDurationSeconds, "histogram", "Time taken for the rule chain to process a message.")
+	for _, chainId := range chainIds {
+		c.writeHistogram(w, ChainMsgDurationSeconds, c.chains[chainId].duration, "chain", chainId)
+	}
+}
+
+// writeHistogram 输出直方图，kv为标签，key,value交替
+func (c *Collector) writeHistogram(w *countWriter, name string, h *histogram, kv ...string) {
+	var cumulative uint64
+	for i, bound := range c.buckets {
+		cumulative += h.counts[i]
+		w.sample(name+"_bucket", labels(append(kv, "le", formatFloat(bound))...), float64(cumulative))
+	}
+	w.sample(name+"_bucket", labels(append(kv, "le", "+Inf")...), float64(h.count))
+	w.sample(name+"_sum", labels(kv...), h.sum)
+	w.sample(name+"_count", labels(kv...), float64(h.count))
+}
+
+func (c *Collector) writeNodes(w *countWriter) {
+	w.header(NodeMessagesTotal, "counter", "Total number of messages processed by the node, by relation type.")
+	for _, key := range sortedKeys(c.nodeMsgs) {
+		w.sample(NodeMessagesTotal, labels("chain", key.chainId, "node", key.nodeId, "relation", key.relationType), float64(c.nodeMsgs[key]))
+	}
+	w.header(NodeErrorsTotal, "counter", "Total number of node execution errors.")
+	for _, key := range sortedKeys(c.nodeErrors) {
+		w.sample(NodeErrorsTotal, labels("chain", key.chainId, "node", key.nodeId), float64(c.nodeErrors[key]))
+	}
+	w.header(NodeDurationSeconds, "histogram", "Time taken for the node to process a message.")
+	for _, key := range sortedKeys(c.nodeDurations) {
+		c.writeHistogram(w, NodeDurationSeconds, c.nodeDurations[key], "chain", key.chainId, "node", key.nodeId)
+	}
+}
+
+func writePools(w *countWriter, pools map[string]PoolStatsProvider) {
+	if len(pools) == 0 {
+		return
+	}
+	names := make([]string, 0, len(pools))
+	for k := range pools {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	stats := make([]pool.Stats, len(names))
+	for i, name := range names {
+		stats[i] = pools[name].Stats()
+	}
+	w.header(PoolMaxWorkers, "gauge", "Maximum number of workers of the pool.")
+	for i, name := range names {
+		w.sample(PoolMaxWorkers, labels("pool", name), float64(stats[i].MaxWorkers))
+	}
+	w.header(PoolWorkers, "gauge", "Number of started workers of the pool.")
+	for i, name := range names {
+		w.sample(PoolWorkers, labels("pool", name), float64(stats[i].Workers))
+	}
+	w.header(PoolIdleWorkers, "gauge", "Number of idle workers of the pool.")
+	for i, name := range names {
+		w.sample(PoolIdleWorkers, labels("pool", name), float64(stats[i].IdleWorkers))
+	}
+}
+
+func sortedKeys[V any](m map[nodeKey]V) []nodeKey {
+	keys := make([]nodeKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].chainId != keys[j].chainId {
+			return keys[i].chainId < keys[j].chainId
+		}
+		if keys[i].nodeId != keys[j].nodeId {
+			return keys[i].nodeId < keys[j].nodeId
+		}
+		return keys[i].relationType < keys[j].relationType
+	})
+	return keys
+}
+
+// labels 格式化标签，参数为key,value交替
+func labels(kv ...string) string {
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(kv[i])
+		builder.WriteString(`="`)
+		builder.WriteString(labelValueReplacer.Replace(kv[i+1]))
+		builder.WriteByte('"')
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		// 计数类指标使用整数格式
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// countWriter 记录写入字节数和第一个错误
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countWriter) header(name, metricType, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func (w *countWriter) sample(name, labels string, value float64) {
+	w.printf("%s%s %s\n", name, labels, formatFloat(value))
+}
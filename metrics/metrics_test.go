@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/pool"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var ruleChain = `
+	{
+	  "ruleChain": {
+		"id": "metricsChain",
+		"name": "指标测试规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsFilter",
+			"configuration": {
+			  "jsScript": "return msg.temperature > 50;"
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "throw 'fail';"
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "True"
+		  }
+		]
+	  }
+	}
+`
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector(0.1, 0.01)
+	collector.OnMsgStart("c1")
+	collector.OnMsgStart("c1")
+	collector.OnMsgEnd("c1", time.Millisecond*50)
+	collector.OnNodeMsg("c1", "s1", types.Success)
+	collector.OnNodeMsg("c1", "s1", types.Failure)
+	collector.OnNodeMsg(`c"2`, "s1", types.Success)
+	collector.OnNodeEnd("c1", "s1", time.Millisecond*5, nil)
+	collector.OnNodeEnd("c1", "s1", time.Millisecond*20, errors.New("fail"))
+
+	var builder strings.Builder
+	_, err := collector.WriteTo(&builder)
+	assert.Nil(t, err)
+	output := builder.String()
+	for _, line := range []string{
+		"# TYPE rulego_chain_messages_total counter",
+		`rulego_chain_messages_total{chain="c1"} 2`,
+		`rulego_chain_inflight_messages{chain="c1"} 1`,
+		`rulego_chain_msg_duration_seconds_bucket{chain="c1",le="0.01"} 0`,
+		`rulego_chain_msg_duration_seconds_bucket{chain="c1",le="0.1"} 1`,
+		`rulego_chain_msg_duration_seconds_bucket{chain="c1",le="+Inf"} 1`,
+		`rulego_chain_msg_duration_seconds_sum{chain="c1"} 0.05`,
+		`rulego_chain_msg_duration_seconds_count{chain="c1"} 1`,
+		`rulego_node_messages_total{chain="c1",node="s1",relation="Failure"} 1`,
+		`rulego_node_messages_total{chain="c1",node="s1",relation="Success"} 1`,
+		`rulego_node_messages_total{chain="c\"2",node="s1",relation="Success"} 1`,
+		`rulego_node_errors_total{chain="c1",node="s1"} 1`,
+		"# TYPE rulego_node_duration_seconds histogram",
+		`rulego_node_duration_seconds_bucket{chain="c1",node="s1",le="0.01"} 1`,
+		`rulego_node_duration_seconds_bucket{chain="c1",node="s1",le="0.1"} 2`,
+		`rulego_node_duration_seconds_bucket{chain="c1",node="s1",le="+Inf"} 2`,
+		`rulego_node_duration_seconds_sum{chain="c1",node="s1"} 0.025`,
+		`rulego_node_duration_seconds_count{chain="c1",node="s1"} 2`,
+	} {
+		assert.True(t, strings.Contains(output, line+"\n"))
+	}
+	//没有注册协程池，不输出协程池指标
+	assert.False(t, strings.Contains(output, PoolWorkers))
+}
+
+func TestEngineMetrics(t *testing.T) {
+	collector := NewCollector()
+	config := rulego.NewConfig(types.WithDefaultPool(), types.WithMetricsCollector(collector))
+	collector.RegisterPool("default", config.Pool.(*pool.WorkerPool))
+	ruleEngine, err := rulego.New("", []byte(ruleChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer rulego.Del("metricsChain")
+
+	for _, data := range []string{`{"temperature":60}`, `{"temperature":40}`, `{"temperature":70}`} {
+		ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), data))
+	}
+
+	server := httptest.NewServer(collector.Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, ContentType, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	output := string(body)
+	for _, line := range []string{
+		`rulego_chain_messages_total{chain="metricsChain"} 3`,
+		`rulego_chain_inflight_messages{chain="metricsChain"} 0`,
+		`rulego_chain_msg_duration_seconds_count{chain="metricsChain"} 3`,
+		`rulego_node_messages_total{chain="metricsChain",node="s1",relation="True"} 2`,
+		`rulego_node_messages_total{chain="metricsChain",node="s1",relation="False"} 1`,
+		`rulego_node_messages_total{chain="metricsChain",node="s2",relation="Failure"} 2`,
+		`rulego_node_errors_total{chain="metricsChain",node="s2"} 2`,
+		`rulego_node_duration_seconds_count{chain="metricsChain",node="s1"} 3`,
+		`rulego_node_duration_seconds_count{chain="metricsChain",node="s2"} 2`,
+		`rulego_pool_max_workers{pool="default"} 2147483647`,
+	} {
+		assert.True(t, strings.Contains(output, line+"\n"))
+	}
+}
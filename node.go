@@ -18,6 +18,11 @@ package rulego
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/xyzbit/rulego/api/types"
 	"github.com/xyzbit/rulego/utils/str"
@@ -27,6 +32,14 @@ const (
 	defaultNodeIdPrefix = "node"
 )
 
+// 重试退避策略
+const (
+	// BackoffFixed 固定间隔
+	BackoffFixed = "fixed"
+	// BackoffExponential 指数增长间隔
+	BackoffExponential = "exponential"
+)
+
 // RuleNodeCtx 节点组件实例定义
 type RuleNodeCtx struct {
 	// 组件实例
@@ -35,10 +48,19 @@ type RuleNodeCtx struct {
 	SelfDefinition *RuleNode
 	// 规则引擎配置
 	Config types.Config
+	// 有状态组件状态转移锁，状态转移期间等待正在处理的消息
+	stateLock sync.RWMutex
+	// 状态已经转移到的新版本规则链节点，旧版本规则链中还在处理的消息交给该节点处理
+	successor *RuleNodeCtx
 }
 
 // InitRuleNodeCtx 初始化RuleNodeCtx
 func InitRuleNodeCtx(config types.Config, selfDefinition *RuleNode) (*RuleNodeCtx, error) {
+	if selfDefinition.Retry != nil {
+		if err := selfDefinition.Retry.validate(); err != nil {
+			return &RuleNodeCtx{}, fmt.Errorf("node id:%s retry error:%w", selfDefinition.Id, err)
+		}
+	}
 	node, err := config.ComponentsRegistry.NewNode(selfDefinition.Type)
 	if err != nil {
 		return &RuleNodeCtx{}, err
@@ -58,16 +80,52 @@ func InitRuleNodeCtx(config types.Config, selfDefinition *RuleNode) (*RuleNodeCt
 	}
 }
 
+// OnMsg 处理消息
+// 有状态组件的状态已经转移到新版本规则链的节点时，交给新节点处理，防止旧版本规则链还在处理的消息丢失
+func (rn *RuleNodeCtx) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	if _, ok := rn.Node.(types.StatefulNode); !ok {
+		return rn.Node.OnMsg(ctx, msg)
+	}
+	rn.stateLock.RLock()
+	successor := rn.successor
+	if successor == nil {
+		defer rn.stateLock.RUnlock()
+		return rn.Node.OnMsg(ctx, msg)
+	}
+	rn.stateLock.RUnlock()
+	return successor.OnMsg(ctx, msg)
+}
+
 func (rn *RuleNodeCtx) IsDebugMode() bool {
 	return rn.SelfDefinition.DebugMode
 }
 
+// GetTimeout 获取节点执行超时时间，0表示不限制
+func (rn *RuleNodeCtx) GetTimeout() time.Duration {
+	if rn.SelfDefinition.TimeoutMs <= 0 {
+		return 0
+	}
+	return time.Duration(rn.SelfDefinition.TimeoutMs) * time.Millisecond
+}
+
+// GetRetryPolicy 获取节点重试策略，不重试返回nil
+func (rn *RuleNodeCtx) GetRetryPolicy() *RetryPolicy {
+	if rn.SelfDefinition.Retry == nil || rn.SelfDefinition.Retry.MaxAttempts <= 1 {
+		return nil
+	}
+	return rn.SelfDefinition.Retry
+}
+
 func (rn *RuleNodeCtx) GetNodeId() types.RuleNodeId {
 	return types.RuleNodeId{Id: rn.SelfDefinition.Id, Type: types.NODE}
 }
 
 func (rn *RuleNodeCtx) ReloadSelf(def []byte) error {
 	if ruleNodeCtx, err := rn.Config.Parser.DecodeRuleNode(rn.Config, def); err == nil {
+		rn.stateLock.Lock()
+		defer rn.stateLock.Unlock()
+		// 转移有状态组件的状态
+		transferState(rn.Config, rn.SelfDefinition.Id, rn, ruleNodeCtx.(*RuleNodeCtx))
 		// 先销毁
 		rn.Destroy()
 		// 重新加载
@@ -99,9 +157,39 @@ func (rn *RuleNodeCtx) Copy(newCtx *RuleNodeCtx) {
 	rn.SelfDefinition.Name = newCtx.SelfDefinition.Name
 	rn.SelfDefinition.Type = newCtx.SelfDefinition.Type
 	rn.SelfDefinition.DebugMode = newCtx.SelfDefinition.DebugMode
+	rn.SelfDefinition.TimeoutMs = newCtx.SelfDefinition.TimeoutMs
+	rn.SelfDefinition.Retry = newCtx.SelfDefinition.Retry
 	rn.SelfDefinition.Configuration = newCtx.SelfDefinition.Configuration
 }
 
+// transferState 把旧节点实例的状态快照恢复到新节点实例
+// 类型不同或者组件没有实现types.StatefulNode则忽略，快照失败只打印日志，不影响重新加载
+// 调用方需要持有oldCtx.stateLock写锁，返回状态是否已经转移
+func transferState(config types.Config, nodeId string, oldCtx, newCtx *RuleNodeCtx) bool {
+	if oldCtx.SelfDefinition.Type != newCtx.SelfDefinition.Type {
+		return false
+	}
+	oldNode, ok := oldCtx.Node.(types.StatefulNode)
+	if !ok {
+		return false
+	}
+	newNode, ok := newCtx.Node.(types.StatefulNode)
+	if !ok {
+		return false
+	}
+	snapshot, err := oldNode.Snapshot()
+	if err == nil {
+		err = newNode.Restore(snapshot)
+	}
+	if err != nil {
+		if config.Logger != nil {
+			config.Logger.Printf("transfer state error.node id:%s error:%s", nodeId, err)
+		}
+		return false
+	}
+	return true
+}
+
 // 使用全局配置替换节点占位符配置，例如：${global.propertyKey}
 func processGlobalPlaceholders(config types.Config, configuration types.Configuration) types.Configuration {
 	if config.Properties.Values() != nil {
@@ -117,3 +205,51 @@ func processGlobalPlaceholders(config types.Config, configuration types.Configur
 	}
 	return configuration
 }
+
+func (p *RetryPolicy) validate() error {
+	if p.Backoff != "" && p.Backoff != BackoffFixed && p.Backoff != BackoffExponential {
+		return fmt.Errorf("unsupported backoff:%s", p.Backoff)
+	}
+	if p.DelayMs < 0 || p.MaxDelayMs < 0 || p.Multiplier < 0 {
+		return errors.New("delayMs, maxDelayMs and multiplier can not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// shouldRetry 关系列表是否触发重试
+func (p *RetryPolicy) shouldRetry(relationTypes []string) bool {
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{types.Failure}
+	}
+	for _, relationType := range relationTypes {
+		for _, item := range retryOn {
+			if item == relationType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// delay 获取第attempt次重试的等待时间，attempt从1开始
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	delay := float64(p.DelayMs)
+	if p.Backoff == BackoffExponential {
+		multiplier := p.Multiplier
+		if multiplier == 0 {
+			multiplier = 2
+		}
+		delay = delay * math.Pow(multiplier, float64(attempt-1))
+	}
+	if p.MaxDelayMs > 0 && delay > float64(p.MaxDelayMs) {
+		delay = float64(p.MaxDelayMs)
+	}
+	if p.Jitter > 0 {
+		delay = delay * (1 - p.Jitter + 2*p.Jitter*rand.Float64())
+	}
+	return time.Duration(delay * float64(time.Millisecond))
+}
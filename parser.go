@@ -17,8 +17,11 @@
 package rulego
 
 import (
+	"bytes"
+
 	"github.com/xyzbit/rulego/api/types"
 	string2 "github.com/xyzbit/rulego/utils/json"
+	"gopkg.in/yaml.v3"
 )
 
 // JsonParser Json
@@ -50,3 +53,46 @@ func (p *JsonParser) EncodeRuleNode(def interface{}) ([]byte, error) {
 	// 缩进符为两个空格
 	return string2.MarshalIndent(def, "", "  ")
 }
+
+// YamlParser Yaml
+// 多行字符串(例如：jsScript)使用yaml块格式，方便阅读和代码评审
+type YamlParser struct{}
+
+func (p *YamlParser) DecodeRuleChain(config types.Config, dsl []byte) (types.Node, error) {
+	if rootRuleChainDef, err := ParserRuleChainYaml(dsl); err == nil {
+		// 初始化
+		return InitRuleChainCtx(config, &rootRuleChainDef)
+	} else {
+		return nil, err
+	}
+}
+
+func (p *YamlParser) DecodeRuleNode(config types.Config, dsl []byte) (types.Node, error) {
+	if node, err := ParserRuleNodeYaml(dsl); err == nil {
+		return InitRuleNodeCtx(config, &node)
+	} else {
+		return nil, err
+	}
+}
+
+func (p *YamlParser) EncodeRuleChain(def interface{}) ([]byte, error) {
+	return p.encode(def)
+}
+
+func (p *YamlParser) EncodeRuleNode(def interface{}) ([]byte, error) {
+	return p.encode(def)
+}
+
+func (p *YamlParser) encode(def interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	// 缩进符为两个空格
+	encoder.SetIndent(2)
+	if err := encoder.Encode(def); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
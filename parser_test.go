@@ -0,0 +1,61 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rulego
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+// 测试yaml解析器
+func TestYamlParser(t *testing.T) {
+	def, err := ParserRuleChain([]byte(rootRuleChain))
+	assert.Nil(t, err)
+	def.Metadata.Nodes[1].TimeoutMs = 1000
+
+	parser := &YamlParser{}
+	// json规则链转换成yaml
+	yamlDef, err := parser.EncodeRuleChain(def)
+	assert.Nil(t, err)
+	//多行脚本使用块格式
+	assert.True(t, strings.Contains(string(yamlDef), "jsScript: |-\n"))
+	assert.True(t, strings.Contains(string(yamlDef), "timeoutMs: 1000"))
+	assert.False(t, strings.Contains(string(yamlDef), "retry:"))
+
+	// yaml规则链转换回结构体，和原规则链一致
+	newDef, err := ParserRuleChainYaml(yamlDef)
+	assert.Nil(t, err)
+	assert.Equal(t, def, newDef)
+
+	config := NewConfig(types.WithParser(parser))
+	_, err = New("subChain01", []byte(subRuleChain))
+	assert.Nil(t, err)
+	defer Del("subChain01")
+
+	ruleEngine, err := New("testYamlParser", yamlDef, WithConfig(config))
+	assert.Nil(t, err)
+	defer Del("testYamlParser")
+	assert.Equal(t, "s2", ruleEngine.rootRuleChainCtx.nodeIds[1].Id)
+
+	// 更新节点
+	node, err := parser.EncodeRuleNode(def.Metadata.Nodes[0])
+	assert.Nil(t, err)
+	assert.Nil(t, ruleEngine.ReloadChild("s1", node))
+}
@@ -104,6 +104,27 @@ func (wp *WorkerPool) Stop() {
 func (wp *WorkerPool) Release() {
 	wp.Stop()
 }
+
+// Stats describes the worker usage of the pool.
+type Stats struct {
+	// MaxWorkers is the maximum number of workers.
+	MaxWorkers int
+	// Workers is the number of started workers.
+	Workers int
+	// IdleWorkers is the number of workers waiting for functions.
+	IdleWorkers int
+}
+
+// Stats returns the current worker usage of the pool.
+func (wp *WorkerPool) Stats() Stats {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	return Stats{
+		MaxWorkers:  wp.MaxWorkersCount,
+		Workers:     wp.workersCount,
+		IdleWorkers: len(wp.ready),
+	}
+}
 func (wp *WorkerPool) getMaxIdleWorkerDuration() time.Duration {
 	if wp.MaxIdleWorkerDuration <= 0 {
 		return 10 * time.Second
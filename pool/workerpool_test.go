@@ -43,3 +43,24 @@ func TestWorkerPool(t *testing.T) {
 		t.Fatalf("unexpected number of served functions: %d. Expecting %d", n, 100)
 	}
 }
+
+func TestWorkerPoolStats(t *testing.T) {
+	wp := &WorkerPool{MaxWorkersCount: 10}
+	wp.Start()
+	defer wp.Stop()
+	block := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		if wp.Submit(func() { <-block }) != nil {
+			t.Fatalf("cannot submit function #%d", i)
+		}
+	}
+	stats := wp.Stats()
+	if stats.MaxWorkers != 10 || stats.Workers != 3 || stats.IdleWorkers != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	close(block)
+	time.Sleep(time.Millisecond * 100)
+	if stats = wp.Stats(); stats.Workers != 3 || stats.IdleWorkers != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
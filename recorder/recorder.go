@@ -0,0 +1,205 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package recorder 消息运行记录和重放
+//
+// Recorder 记录根规则链每次处理消息经过的节点，包括节点输入、输出、关系、耗时和错误，
+// 生成可以通过消息ID查询、序列化成JSON的RunSnapshot。
+// Replay 使用(修改后的)规则链重新执行快照中的消息，Compare 逐个节点比较两次运行的差异。
+//
+// 使用方式：
+//
+//	rec := recorder.NewRecorder(1000)
+//	config := rulego.NewConfig(types.WithRunRecorder(rec))
+//	snapshot, ok := rec.Get(msg.Id)
+package recorder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// DefaultCapacity 默认保存的运行记录数量
+const DefaultCapacity = 1000
+
+// Step 节点处理一次消息的记录
+type Step struct {
+	ChainId  string        `json:"chainId"`
+	NodeId   string        `json:"nodeId"`
+	NodeType string        `json:"nodeType"`
+	In       types.RuleMsg `json:"in"`
+	// Out 节点输出，节点未处理完成为nil
+	Out          *types.RuleMsg `json:"out,omitempty"`
+	RelationType string         `json:"relationType,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	StartTime    time.Time      `json:"startTime"`
+	// Duration 节点处理耗时
+	Duration time.Duration `json:"duration"`
+}
+
+// RunSnapshot 根规则链处理一条消息的运行快照
+type RunSnapshot struct {
+	ChainId string        `json:"chainId"`
+	Msg     types.RuleMsg `json:"msg"`
+	// Steps 按节点开始处理的顺序排列
+	Steps     []Step    `json:"steps"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// Done 所有节点是否已经执行完成
+	Done bool `json:"done"`
+	// Error 上下文取消或者超时错误
+	Error string `json:"error,omitempty"`
+}
+
+// Duration 运行耗时，未执行完成返回0
+func (s RunSnapshot) Duration() time.Duration {
+	if !s.Done {
+		return 0
+	}
+	return s.EndTime.Sub(s.StartTime)
+}
+
+var _ types.RunRecorder = (*Recorder)(nil)
+
+// Recorder 内存运行记录器，实现`types.RunRecorder`
+// 超过容量后，最早的运行记录会被丢弃
+type Recorder struct {
+	capacity int
+	runs     []*run
+	lock     sync.RWMutex
+}
+
+// NewRecorder 创建运行记录器，capacity<=0使用默认容量
+func NewRecorder(capacity int) *Recorder {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Recorder{capacity: capacity}
+}
+
+// OnRunStart 根规则链开始处理消息
+func (r *Recorder) OnRunStart(chainId string, msg types.RuleMsg) types.RunObserver {
+	item := &run{snapshot: RunSnapshot{ChainId: chainId, Msg: msg, StartTime: time.Now()}}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.runs) >= r.capacity {
+		copy(r.runs, r.runs[1:])
+		r.runs[len(r.runs)-1] = nil
+		r.runs = r.runs[:len(r.runs)-1]
+	}
+	r.runs = append(r.runs, item)
+	return item
+}
+
+// Get 通过消息ID获取最近一次运行快照
+func (r *Recorder) Get(msgId string) (RunSnapshot, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		if r.runs[i].msgId() == msgId {
+			return r.runs[i].Snapshot(), true
+		}
+	}
+	return RunSnapshot{}, false
+}
+
+// List 按开始顺序获取所有运行快照
+func (r *Recorder) List() []RunSnapshot {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	snapshots := make([]RunSnapshot, 0, len(r.runs))
+	for _, item := range r.runs {
+		snapshots = append(snapshots, item.Snapshot())
+	}
+	return snapshots
+}
+
+// Reset 清空所有运行记录
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.runs = nil
+}
+
+// run 一次运行，实现`types.RunObserver`
+type run struct {
+	snapshot RunSnapshot
+	lock     sync.Mutex
+}
+
+func (r *run) msgId() string {
+	// 消息ID创建后不会修改，不需要加锁
+	return r.snapshot.Msg.Id
+}
+
+// OnNodeStart 节点开始处理消息
+func (r *run) OnNodeStart(chainId, nodeId, nodeType string, msg types.RuleMsg) func(msg types.RuleMsg, relationType string, err error) {
+	r.lock.Lock()
+	index := len(r.snapshot.Steps)
+	r.snapshot.Steps = append(r.snapshot.Steps, Step{
+		ChainId:   chainId,
+		NodeId:    nodeId,
+		NodeType:  nodeType,
+		In:        msg,
+		StartTime: time.Now(),
+	})
+	r.lock.Unlock()
+	var once sync.Once
+	return func(out types.RuleMsg, relationType string, err error) {
+		once.Do(func() {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			step := &r.snapshot.Steps[index]
+			step.Out = &out
+			step.RelationType = relationType
+			step.Duration = time.Since(step.StartTime)
+			if err != nil {
+				step.Error = err.Error()
+			}
+		})
+	}
+}
+
+// OnRunEnd 所有节点执行完成
+func (r *run) OnRunEnd(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.snapshot.Done = true
+	r.snapshot.EndTime = time.Now()
+	if err != nil {
+		r.snapshot.Error = err.Error()
+	}
+}
+
+// Snapshot 获取当前运行快照
+func (r *run) Snapshot() RunSnapshot {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	snapshot := r.snapshot
+	snapshot.Msg = r.snapshot.Msg.Copy()
+	snapshot.Steps = make([]Step, len(r.snapshot.Steps))
+	for i, step := range r.snapshot.Steps {
+		step.In = step.In.Copy()
+		if step.Out != nil {
+			out := step.Out.Copy()
+			step.Out = &out
+		}
+		snapshot.Steps[i] = step
+	}
+	return snapshot
+}
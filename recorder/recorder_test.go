@@ -0,0 +1,143 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var ruleChain = `
+	{
+	  "ruleChain": {
+		"id": "recorderChain",
+		"name": "运行记录测试规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "metadata['step']='s1';msg.temperature=msg.temperature+1;return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "jsFilter",
+			"configuration": {
+			  "jsScript": "return msg.temperature > 50;"
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Success"
+		  }
+		]
+	  }
+	}
+`
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder(2)
+	config := rulego.NewConfig(types.WithRunRecorder(rec))
+	ruleEngine, err := rulego.New("", []byte(ruleChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer rulego.Del("recorderChain")
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"temperature":50}`)
+	ruleEngine.OnMsgAndWait(msg)
+
+	snapshot, ok := rec.Get(msg.Id)
+	assert.True(t, ok)
+	assert.True(t, snapshot.Done)
+	assert.Equal(t, "recorderChain", snapshot.ChainId)
+	assert.Equal(t, 2, len(snapshot.Steps))
+	s1, s2 := snapshot.Steps[0], snapshot.Steps[1]
+	assert.Equal(t, "s1", s1.NodeId)
+	assert.Equal(t, "jsTransform", s1.NodeType)
+	assert.Equal(t, `{"temperature":50}`, s1.In.Data)
+	assert.Equal(t, `{"temperature":51}`, s1.Out.Data)
+	assert.Equal(t, "s1", s1.Out.Metadata.GetValue("step"))
+	assert.Equal(t, types.Success, s1.RelationType)
+	assert.Equal(t, "s2", s2.NodeId)
+	assert.Equal(t, types.True, s2.RelationType)
+
+	//JSON序列化
+	b, err := json.Marshal(snapshot)
+	assert.Nil(t, err)
+	var decoded RunSnapshot
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, 0, len(Compare(snapshot, decoded)))
+	assert.Equal(t, "s1", decoded.Steps[0].Out.Metadata.GetValue("step"))
+
+	//超过容量丢弃最早的记录
+	ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"temperature":10}`))
+	ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"temperature":20}`))
+	_, ok = rec.Get(msg.Id)
+	assert.False(t, ok)
+	assert.Equal(t, 2, len(rec.List()))
+}
+
+func TestReplay(t *testing.T) {
+	rec := NewRecorder(10)
+	config := rulego.NewConfig(types.WithRunRecorder(rec))
+	ruleEngine, err := rulego.New("", []byte(ruleChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer rulego.Del("recorderChain")
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"temperature":50}`)
+	ruleEngine.OnMsgAndWait(msg)
+	snapshot, _ := rec.Get(msg.Id)
+
+	//使用相同的规则链重放，结果一致
+	result, err := Replay(context.Background(), snapshot, []byte(ruleChain), rulego.NewConfig())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.Steps))
+	assert.Equal(t, 0, len(Compare(snapshot, result)))
+
+	//修改过滤条件后重放
+	modified := strings.Replace(ruleChain, "msg.temperature > 50", "msg.temperature > 60", 1)
+	result, err = Replay(context.Background(), snapshot, []byte(modified), rulego.NewConfig())
+	assert.Nil(t, err)
+	diffs := Compare(snapshot, result)
+	assert.Equal(t, 1, len(diffs))
+	assert.Equal(t, "s2", diffs[0].NodeId)
+	assert.Equal(t, "relationType", diffs[0].Field)
+	assert.Equal(t, types.True, diffs[0].Expected)
+	assert.Equal(t, types.False, diffs[0].Actual)
+
+	//重放不影响规则链池中的规则链
+	engine, ok := rulego.Get("recorderChain")
+	assert.True(t, ok)
+	assert.True(t, strings.Contains(string(engine.DSL()), "msg.temperature > 50"))
+
+	//删除节点
+	result.Steps = result.Steps[:1]
+	diffs = Compare(snapshot, result)
+	assert.Equal(t, 1, len(diffs))
+	assert.Equal(t, "visited", diffs[0].Field)
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// Replay 使用规则链def重新执行快照中的消息，返回新的运行快照
+// 规则链在独立的规则引擎实例中执行，不影响规则链池中同ID的规则链，
+// 子规则链从opts指定的规则链池(默认rulego.DefaultRuleGo)获取。
+// config 规则引擎配置，运行记录器会被替换；ctx 取消或者超时后不再等待，返回当前快照和错误
+func Replay(ctx context.Context, snapshot RunSnapshot, def []byte, config types.Config, opts ...rulego.RuleEngineOption) (RunSnapshot, error) {
+	rec := NewRecorder(1)
+	config.RunRecorder = rec
+	engineOpts := append([]rulego.RuleEngineOption{rulego.WithConfig(config)}, opts...)
+	pool := &rulego.RuleGo{}
+	ruleEngine, err := pool.New(snapshot.ChainId, def, engineOpts...)
+	if err != nil {
+		return RunSnapshot{}, err
+	}
+	defer pool.Stop()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ruleEngine.OnMsgAndWait(snapshot.Msg.Copy(), types.WithContext(ctx))
+	result, _ := rec.Get(snapshot.Msg.Id)
+	return result, ctx.Err()
+}
+
+// Difference 两次运行某个节点的差异
+type Difference struct {
+	ChainId string `json:"chainId"`
+	NodeId  string `json:"nodeId"`
+	// Occurrence 节点在一次运行中第几次处理消息，从0开始
+	Occurrence int `json:"occurrence"`
+	// Field 差异字段：visited/relationType/error/msgType/data/metadata
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s/%s#%d %s: expected %q, actual %q", d.ChainId, d.NodeId, d.Occurrence, d.Field, d.Expected, d.Actual)
+}
+
+// stepKey 节点第几次处理消息，用于对齐两次运行的节点，并行分支的执行顺序不影响比较结果
+type stepKey struct {
+	chainId    string
+	nodeId     string
+	occurrence int
+}
+
+// Compare 逐个节点比较两次运行的差异，没有差异返回空
+// 比较节点是否执行，以及节点输出的关系、错误、消息类型、数据和元数据
+func Compare(expected, actual RunSnapshot) []Difference {
+	expectedKeys, expectedSteps := indexSteps(expected.Steps)
+	actualKeys, actualSteps := indexSteps(actual.Steps)
+	var diffs []Difference
+	for _, key := range expectedKeys {
+		e := expectedSteps[key]
+		a, ok := actualSteps[key]
+		if !ok {
+			diffs = append(diffs, newDifference(key, "visited", "true", "false"))
+			continue
+		}
+		diffs = append(diffs, compareStep(key, e, a)...)
+	}
+	for _, key := range actualKeys {
+		if _, ok := expectedSteps[key]; !ok {
+			diffs = append(diffs, newDifference(key, "visited", "false", "true"))
+		}
+	}
+	return diffs
+}
+
+func indexSteps(steps []Step) ([]stepKey, map[stepKey]Step) {
+	keys := make([]stepKey, 0, len(steps))
+	index := make(map[stepKey]Step, len(steps))
+	counts := make(map[[2]string]int)
+	for _, step := range steps {
+		id := [2]string{step.ChainId, step.NodeId}
+		key := stepKey{chainId: step.ChainId, nodeId: step.NodeId, occurrence: counts[id]}
+		counts[id]++
+		keys = append(keys, key)
+		index[key] = step
+	}
+	return keys, index
+}
+
+func compareStep(key stepKey, expected, actual Step) []Difference {
+	var diffs []Difference
+	add := func(field, e, a string) {
+		if e != a {
+			diffs = append(diffs, newDifference(key, field, e, a))
+		}
+	}
+	add("relationType", expected.RelationType, actual.RelationType)
+	add("error", expected.Error, actual.Error)
+	var expectedOut, actualOut types.RuleMsg
+	if expected.Out != nil {
+		expectedOut = *expected.Out
+	}
+	if actual.Out != nil {
+		actualOut = *actual.Out
+	}
+	add("msgType", expectedOut.Type, actualOut.Type)
+	add("data", expectedOut.Data, actualOut.Data)
+	add("metadata", metadataString(expectedOut.Metadata), metadataString(actualOut.Metadata))
+	return diffs
+}
+
+func newDifference(key stepKey, field, expected, actual string) Difference {
+	return Difference{ChainId: key.chainId, NodeId: key.nodeId, Occurrence: key.occurrence, Field: field, Expected: expected, Actual: actual}
+}
+
+// metadataString 元数据转换成key有序的JSON字符串
+func metadataString(metadata types.Metadata) string {
+	b, _ := json.Marshal(metadata)
+	return string(b)
+}
@@ -17,6 +17,8 @@
 package rulego
 
 import (
+	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
 
@@ -31,25 +33,75 @@ type RuleGo struct {
 	ruleEngines sync.Map
 }
 
-// Load 加载指定文件夹及其子文件夹所有规则链配置（与.json结尾文件），到规则引擎实例池
+// fileConverters 规则链文件扩展名对应的转换函数，把文件内容转换成JSON规则链，.json文件不需要转换
+var fileConverters = map[string]func(b []byte) ([]byte, error){
+	".yaml": yamlToJson,
+	".yml":  yamlToJson,
+}
+
+// inHiddenDir 文件是否在rootDir下`.`开头的文件夹中
+func inHiddenDir(rootDir, path string) bool {
+	if rootDir == "" {
+		rootDir = "."
+	}
+	rel, err := filepath.Rel(rootDir, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return false
+	}
+	for _, item := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(item, ".") && item != "." && item != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlToJson 把YAML规则链转换成JSON规则链
+func yamlToJson(b []byte) ([]byte, error) {
+	def, err := ParserRuleChainYaml(b)
+	if err != nil {
+		return nil, err
+	}
+	return (&JsonParser{}).EncodeRuleChain(def)
+}
+
+// Load 加载指定文件夹及其子文件夹所有规则链配置（.json/.yaml/.yml结尾文件），到规则引擎实例池
+// 跳过`.`开头的文件夹，例如：规则链文件存储的历史版本目录`.history`
+// .yaml/.yml文件转换成JSON规则链后加载，规则引擎仍然使用配置的解析器(默认:JsonParser)，
+// 因此DSL()、规则链存储和热更新都使用JSON格式
+// 也可以指定文件匹配模式，例如：./chains/*.yaml
 // 规则链ID，使用规则链文件配置的ruleChain.id
 func (g *RuleGo) Load(folderPath string, opts ...RuleEngineOption) error {
-	if !strings.HasSuffix(folderPath, "*.json") && !strings.HasSuffix(folderPath, "*.JSON") {
+	if !strings.Contains(filepath.Base(folderPath), "*") {
 		if strings.HasSuffix(folderPath, "/") || strings.HasSuffix(folderPath, "\\") {
-			folderPath = folderPath + "*.json"
+			folderPath = folderPath + "*"
 		} else if folderPath == "" {
-			folderPath = "./*.json"
+			folderPath = "./*"
 		} else {
-			folderPath = folderPath + "/*.json"
+			folderPath = folderPath + "/*"
 		}
 	}
 	paths, err := fs.GetFilePaths(folderPath)
 	if err != nil {
 		return err
 	}
+	rootDir, _ := filepath.Split(folderPath)
 	for _, path := range paths {
+		if inHiddenDir(rootDir, path) {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		converter, ok := fileConverters[ext]
+		if !ok && ext != ".json" {
+			continue
+		}
 		b := fs.LoadFile(path)
 		if b != nil {
+			if converter != nil {
+				if b, err = converter(b); err != nil {
+					return fmt.Errorf("load rule chain file:%s error:%w", path, err)
+				}
+			}
 			if _, err = g.New("", b, opts...); err != nil {
 				return err
 			}
@@ -58,6 +110,26 @@ func (g *RuleGo) Load(folderPath string, opts ...RuleEngineOption) error {
 	return nil
 }
 
+// LoadFromStore 加载规则链存储中所有规则链的最新版本，到规则引擎实例池
+// 规则链通过`ReloadSelf`/`ReloadChild`更新后会写回存储
+func (g *RuleGo) LoadFromStore(store types.ChainStore, opts ...RuleEngineOption) error {
+	ids, err := store.List()
+	if err != nil {
+		return err
+	}
+	storeOpts := append(append([]RuleEngineOption{}, opts...), WithChainStore(store))
+	for _, id := range ids {
+		def, err := store.Get(id)
+		if err != nil {
+			return err
+		}
+		if _, err = g.New(id, def, storeOpts...); err != nil {
+			return fmt.Errorf("load rule chain id:%s error:%w", id, err)
+		}
+	}
+	return nil
+}
+
 // New 创建一个新的RuleEngine并将其存储在RuleGo规则链池中
 // 如果指定id="",则使用规则链文件的ruleChain.id
 func (g *RuleGo) New(id string, rootRuleChainSrc []byte, opts ...RuleEngineOption) (*RuleEngine, error) {
@@ -86,6 +158,16 @@ func (g *RuleGo) Get(id string) (*RuleEngine, bool) {
 	}
 }
 
+// Range 遍历所有规则引擎实例，f返回false停止遍历
+func (g *RuleGo) Range(f func(id string, ruleEngine *RuleEngine) bool) {
+	g.ruleEngines.Range(func(key, value any) bool {
+		if item, ok := value.(*RuleEngine); ok {
+			return f(key.(string), item)
+		}
+		return true
+	})
+}
+
 // Del 删除指定ID规则引擎实例
 func (g *RuleGo) Del(id string) {
 	v, ok := g.ruleEngines.Load(id)
@@ -117,12 +199,18 @@ func (g *RuleGo) OnMsg(msg types.RuleMsg) {
 	})
 }
 
-// Load 加载指定文件夹及其子文件夹所有规则链配置（与.json结尾文件），到规则引擎实例池
+// Load 加载指定文件夹及其子文件夹所有规则链配置（.json/.yaml/.yml结尾文件），到规则引擎实例池
+// 跳过`.`开头的文件夹
 // 规则链ID，使用文件配置的 ruleChain.id
 func Load(folderPath string, opts ...RuleEngineOption) error {
 	return DefaultRuleGo.Load(folderPath, opts...)
 }
 
+// LoadFromStore 加载规则链存储中所有规则链的最新版本，到规则引擎实例池
+func LoadFromStore(store types.ChainStore, opts ...RuleEngineOption) error {
+	return DefaultRuleGo.LoadFromStore(store, opts...)
+}
+
 // New 创建一个新的RuleEngine并将其存储在RuleGo规则链池中
 func New(id string, rootRuleChainSrc []byte, opts ...RuleEngineOption) (*RuleEngine, error) {
 	return DefaultRuleGo.New(id, rootRuleChainSrc, opts...)
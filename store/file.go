@@ -0,0 +1,201 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+const (
+	fileExt    = ".json"
+	historyDir = ".history"
+)
+
+var _ types.ChainStore = (*FileStore)(nil)
+
+// FileStore 文件系统规则链存储
+// 最新版本保存在`<dir>/<id>.json`，可以直接通过`rulego.Load`加载；
+// 历史版本保存在`<dir>/.history/<id>/<revision>.json`
+type FileStore struct {
+	dir     string
+	options options
+	lock    sync.Mutex
+}
+
+// NewFileStore 创建文件系统规则链存储，目录不存在则创建
+func NewFileStore(dir string, opts ...Option) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, historyDir), 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, options: newOptions(opts...)}, nil
+}
+
+func (s *FileStore) chainFile(id string) string {
+	return filepath.Join(s.dir, escapeId(id)+fileExt)
+}
+
+func (s *FileStore) historyPath(id string) string {
+	return filepath.Join(s.dir, historyDir, escapeId(id))
+}
+
+// List 获取所有规则链ID
+func (s *FileStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		if id, ok := unescapeId(strings.TrimSuffix(name, fileExt)); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Get 获取规则链最新版本定义
+func (s *FileStore) Get(id string) ([]byte, error) {
+	def, err := os.ReadFile(s.chainFile(id))
+	if os.IsNotExist(err) {
+		return nil, types.ErrChainNotFound
+	}
+	return def, err
+}
+
+// Save 保存规则链定义，生成新的版本
+func (s *FileStore) Save(id string, def []byte) (int64, error) {
+	if id == "" {
+		return 0, errors.New("rule chain id can not empty")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	revisions, err := s.revisions(id)
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	if len(revisions) > 0 {
+		latest = revisions[len(revisions)-1]
+		if current, err := os.ReadFile(s.chainFile(id)); err == nil && bytes.Equal(current, def) {
+			return latest, nil
+		}
+	}
+	revision := latest + 1
+	if err := os.MkdirAll(s.historyPath(id), 0755); err != nil {
+		return 0, err
+	}
+	if err := writeFile(s.revisionFile(id, revision), def); err != nil {
+		return 0, err
+	}
+	if err := writeFile(s.chainFile(id), def); err != nil {
+		return 0, err
+	}
+	// 删除超出数量的历史版本
+	revisions = append(revisions, revision)
+	if s.options.maxHistory > 0 && len(revisions) > s.options.maxHistory {
+		for _, item := range revisions[:len(revisions)-s.options.maxHistory] {
+			_ = os.Remove(s.revisionFile(id, item))
+		}
+	}
+	return revision, nil
+}
+
+// Delete 删除规则链和所有历史版本
+func (s *FileStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := os.Remove(s.chainFile(id)); os.IsNotExist(err) {
+		return types.ErrChainNotFound
+	} else if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.historyPath(id))
+}
+
+// History 获取规则链所有保存的版本
+func (s *FileStore) History(id string) ([]types.ChainRevision, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := os.Stat(s.chainFile(id)); os.IsNotExist(err) {
+		return nil, types.ErrChainNotFound
+	}
+	revisions, err := s.revisions(id)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]types.ChainRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		file := s.revisionFile(id, revision)
+		def, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		item := types.ChainRevision{Revision: revision, Def: def}
+		if info, err := os.Stat(file); err == nil {
+			item.Ts = info.ModTime().UnixMilli()
+		}
+		history = append(history, item)
+	}
+	return history, nil
+}
+
+func (s *FileStore) revisionFile(id string, revision int64) string {
+	return filepath.Join(s.historyPath(id), strconv.FormatInt(revision, 10)+fileExt)
+}
+
+// revisions 获取规则链所有版本号，从小到大排序
+func (s *FileStore) revisions(id string) ([]int64, error) {
+	entries, err := os.ReadDir(s.historyPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var revisions []int64
+	for _, entry := range entries {
+		if revision, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), fileExt), 10, 64); err == nil {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i] < revisions[j]
+	})
+	return revisions, nil
+}
+
+// writeFile 先写临时文件再重命名，避免写入中断导致文件内容不完整
+func writeFile(file string, data []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// KV 键值存储接口，实现需要并发安全
+type KV interface {
+	// Get 获取值，key不存在返回false
+	Get(key string) ([]byte, bool, error)
+	// Put 设置值
+	Put(key string, value []byte) error
+	// Delete 删除key，key不存在不返回错误
+	Delete(key string) error
+	// Keys 获取指定前缀的所有key，按字典序排序
+	Keys(prefix string) ([]string, error)
+}
+
+const (
+	chainKeyPrefix = "chain/"
+	headKeySuffix  = "/head"
+	revKeyInfix    = "/rev/"
+)
+
+var _ types.ChainStore = (*KVStore)(nil)
+
+// KVStore 键值存储规则链存储
+// key格式：`chain/<id>/head` 保存最新版本号，`chain/<id>/rev/<revision>` 保存每个版本
+type KVStore struct {
+	kv      KV
+	options options
+	lock    sync.Mutex
+}
+
+// NewKVStore 创建键值存储规则链存储
+func NewKVStore(kv KV, opts ...Option) *KVStore {
+	return &KVStore{kv: kv, options: newOptions(opts...)}
+}
+
+func headKey(id string) string {
+	return chainKeyPrefix + escapeId(id) + headKeySuffix
+}
+
+func revisionPrefix(id string) string {
+	return chainKeyPrefix + escapeId(id) + revKeyInfix
+}
+
+// revisionKey 版本号补齐长度，保证key按字典序排序和版本号顺序一致
+func revisionKey(id string, revision int64) string {
+	return fmt.Sprintf("%s%020d", revisionPrefix(id), revision)
+}
+
+// List 获取所有规则链ID
+func (s *KVStore) List() ([]string, error) {
+	keys, err := s.kv.Keys(chainKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, key := range keys {
+		if !strings.HasSuffix(key, headKeySuffix) {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, chainKeyPrefix), headKeySuffix)
+		if id, ok := unescapeId(name); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Get 获取规则链最新版本定义
+func (s *KVStore) Get(id string) ([]byte, error) {
+	revision, err := s.head(id)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.revision(id, revision)
+	if err != nil {
+		return nil, err
+	}
+	return item.Def, nil
+}
+
+// Save 保存规则链定义，生成新的版本
+func (s *KVStore) Save(id string, def []byte) (int64, error) {
+	if id == "" {
+		return 0, errors.New("rule chain id can not empty")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	latest, err := s.head(id)
+	if err == nil {
+		if item, err := s.revision(id, latest); err == nil && bytes.Equal(item.Def, def) {
+			return latest, nil
+		}
+	} else if !errors.Is(err, types.ErrChainNotFound) {
+		return 0, err
+	}
+	revision := latest + 1
+	value, err := json.Marshal(types.ChainRevision{Revision: revision, Def: def, Ts: time.Now().UnixMilli()})
+	if err != nil {
+		return 0, err
+	}
+	// 先写版本，再更新最新版本号
+	if err := s.kv.Put(revisionKey(id, revision), value); err != nil {
+		return 0, err
+	}
+	if err := s.kv.Put(headKey(id), []byte(strconv.FormatInt(revision, 10))); err != nil {
+		return 0, err
+	}
+	if s.options.maxHistory > 0 {
+		keys, err := s.kv.Keys(revisionPrefix(id))
+		if err != nil {
+			return revision, err
+		}
+		if len(keys) > s.options.maxHistory {
+			for _, key := range keys[:len(keys)-s.options.maxHistory] {
+				if err := s.kv.Delete(key); err != nil {
+					return revision, err
+				}
+			}
+		}
+	}
+	return revision, nil
+}
+
+// Delete 删除规则链和所有历史版本
+func (s *KVStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := s.head(id); err != nil {
+		return err
+	}
+	// 先删除最新版本号，保证中断后规则链不可见
+	if err := s.kv.Delete(headKey(id)); err != nil {
+		return err
+	}
+	keys, err := s.kv.Keys(revisionPrefix(id))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := s.kv.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History 获取规则链所有保存的版本
+func (s *KVStore) History(id string) ([]types.ChainRevision, error) {
+	if _, err := s.head(id); err != nil {
+		return nil, err
+	}
+	keys, err := s.kv.Keys(revisionPrefix(id))
+	if err != nil {
+		return nil, err
+	}
+	history := make([]types.ChainRevision, 0, len(keys))
+	for _, key := range keys {
+		value, ok, err := s.kv.Get(key)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		var item types.ChainRevision
+		if err := json.Unmarshal(value, &item); err != nil {
+			return nil, err
+		}
+		history = append(history, item)
+	}
+	return history, nil
+}
+
+func (s *KVStore) head(id string) (int64, error) {
+	value, ok, err := s.kv.Get(headKey(id))
+	if err != nil {
+		return 0, err
+	} else if !ok {
+		return 0, types.ErrChainNotFound
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+func (s *KVStore) revision(id string, revision int64) (types.ChainRevision, error) {
+	var item types.ChainRevision
+	value, ok, err := s.kv.Get(revisionKey(id, revision))
+	if err != nil {
+		return item, err
+	} else if !ok {
+		return item, fmt.Errorf("rule chain id:%s revision:%d not found", id, revision)
+	}
+	err = json.Unmarshal(value, &item)
+	return item, err
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xyzbit/rulego/utils/fs"
+)
+
+var _ KV = (*MemoryKV)(nil)
+
+// MemoryKV 内存键值存储，重启后数据丢失，用于测试
+type MemoryKV struct {
+	data map[string][]byte
+	lock sync.RWMutex
+}
+
+// NewMemoryKV 创建内存键值存储
+func NewMemoryKV() *MemoryKV {
+	return &MemoryKV{data: make(map[string][]byte)}
+}
+
+func (m *MemoryKV) Get(key string) ([]byte, bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	v, ok := m.data[key]
+	return v, ok, nil
+}
+
+func (m *MemoryKV) Put(key string, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *MemoryKV) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+func (m *MemoryKV) Keys(prefix string) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return sortedKeys(m.data, prefix), nil
+}
+
+func sortedKeys(data map[string][]byte, prefix string) []string {
+	var keys []string
+	for k := range data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const (
+	kvOpPut    = "put"
+	kvOpDelete = "delete"
+)
+
+// kvRecord 文件中的一行记录
+type kvRecord struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+var _ KV = (*FileKV)(nil)
+
+// FileKV 嵌入式文件键值存储
+// 数据全部保存在内存，每次修改以一行JSON追加到文件末尾，打开时回放文件恢复数据，
+// 无效记录过多时重写文件，也可以通过Compact手动重写
+type FileKV struct {
+	log  *fs.AppendLog[kvRecord]
+	data map[string][]byte
+	// 文件中的记录数量
+	records int
+	lock    sync.RWMutex
+}
+
+// OpenFileKV 打开文件键值存储，文件不存在则创建
+func OpenFileKV(path string) (*FileKV, error) {
+	kv := &FileKV{data: make(map[string][]byte)}
+	log, err := fs.OpenAppendLog(path, kv.replay)
+	if err != nil {
+		return nil, err
+	}
+	kv.log = log
+	// 无效记录超过一半时重写文件
+	if kv.records > 2*len(kv.data) {
+		if err := kv.rewrite(); err != nil {
+			_ = log.Close()
+			return nil, err
+		}
+	}
+	return kv, nil
+}
+
+// replay 从文件记录恢复数据
+func (kv *FileKV) replay(r kvRecord) {
+	kv.records++
+	switch r.Op {
+	case kvOpPut:
+		kv.data[r.Key] = r.Value
+	case kvOpDelete:
+		delete(kv.data, r.Key)
+	}
+}
+
+// rewrite 只保留有效数据重写文件
+func (kv *FileKV) rewrite() error {
+	keys := sortedKeys(kv.data, "")
+	records := make([]kvRecord, 0, len(keys))
+	for _, key := range keys {
+		records = append(records, kvRecord{Op: kvOpPut, Key: key, Value: kv.data[key]})
+	}
+	if err := kv.log.Rewrite(records); err != nil {
+		return err
+	}
+	kv.records = len(records)
+	return nil
+}
+
+func (kv *FileKV) append(r kvRecord) error {
+	if err := kv.log.Append(r); err != nil {
+		return err
+	}
+	kv.records++
+	return nil
+}
+
+func (kv *FileKV) Get(key string) ([]byte, bool, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	v, ok := kv.data[key]
+	return v, ok, nil
+}
+
+func (kv *FileKV) Put(key string, value []byte) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	value = append([]byte(nil), value...)
+	if err := kv.append(kvRecord{Op: kvOpPut, Key: key, Value: value}); err != nil {
+		return err
+	}
+	kv.data[key] = value
+	return nil
+}
+
+func (kv *FileKV) Delete(key string) error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	if _, ok := kv.data[key]; !ok {
+		return nil
+	}
+	if err := kv.append(kvRecord{Op: kvOpDelete, Key: key}); err != nil {
+		return err
+	}
+	delete(kv.data, key)
+	return nil
+}
+
+func (kv *FileKV) Keys(prefix string) ([]string, error) {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	return sortedKeys(kv.data, prefix), nil
+}
+
+// Compact 只保留有效数据重写文件
+func (kv *FileKV) Compact() error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	return kv.rewrite()
+}
+
+// Close 关闭文件
+func (kv *FileKV) Close() error {
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	return kv.log.Close()
+}
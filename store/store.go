@@ -0,0 +1,59 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package store 规则链存储`types.ChainStore`内置实现
+//
+// FileStore 使用文件系统保存规则链，最新版本保存在`<dir>/<id>.json`，历史版本保存在`<dir>/.history/<id>/`；
+// KVStore 使用键值存储保存规则链，内置内存键值存储MemoryKV和嵌入式文件键值存储FileKV，也可以实现KV接口对接其他键值数据库。
+package store
+
+import (
+	"net/url"
+)
+
+// Option 规则链存储选项
+type Option func(*options)
+
+type options struct {
+	// 每条规则链最多保留的版本数量，<=0不限制
+	maxHistory int
+}
+
+// WithMaxHistory 每条规则链最多保留的版本数量，超过后删除最早的版本，<=0不限制
+func WithMaxHistory(maxHistory int) Option {
+	return func(o *options) {
+		o.maxHistory = maxHistory
+	}
+}
+
+func newOptions(opts ...Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// escapeId 规则链ID转义，用于文件名或者key
+func escapeId(id string) string {
+	return url.PathEscape(id)
+}
+
+// unescapeId 还原规则链ID
+func unescapeId(name string) (string, bool) {
+	id, err := url.PathUnescape(name)
+	return id, err == nil
+}
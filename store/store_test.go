@@ -0,0 +1,199 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var ruleChain = `
+	{
+	  "ruleChain": {
+		"id": "storeChain",
+		"name": "存储测试规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsFilter",
+			"configuration": {
+			  "jsScript": "return msg.temperature > 50;"
+			}
+		  }
+		]
+	  }
+	}
+`
+
+// testChainStore 测试规则链存储通用行为
+func testChainStore(t *testing.T, store types.ChainStore) {
+	_, err := store.Get("c1")
+	assert.True(t, errors.Is(err, types.ErrChainNotFound))
+	_, err = store.History("c1")
+	assert.True(t, errors.Is(err, types.ErrChainNotFound))
+
+	revision, err := store.Save("c1", []byte("v1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), revision)
+	//内容相同不生成新版本
+	revision, err = store.Save("c1", []byte("v1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), revision)
+	revision, err = store.Save("c1", []byte("v2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), revision)
+	_, err = store.Save("a/b", []byte("v1"))
+	assert.Nil(t, err)
+
+	def, err := store.Get("c1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(def))
+	ids, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/b", "c1"}, ids)
+
+	history, err := store.History("c1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, int64(1), history[0].Revision)
+	assert.Equal(t, "v1", string(history[0].Def))
+	assert.True(t, history[1].Ts > 0)
+
+	assert.Nil(t, store.Delete("c1"))
+	assert.True(t, errors.Is(store.Delete("c1"), types.ErrChainNotFound))
+	ids, _ = store.List()
+	assert.Equal(t, []string{"a/b"}, ids)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	testChainStore(t, store)
+}
+
+func TestKVStore(t *testing.T) {
+	testChainStore(t, NewKVStore(NewMemoryKV()))
+
+	path := filepath.Join(t.TempDir(), "chains.db")
+	kv, err := OpenFileKV(path)
+	assert.Nil(t, err)
+	testChainStore(t, NewKVStore(kv))
+	assert.Nil(t, kv.Compact())
+	assert.Nil(t, kv.Close())
+
+	//重新打开，数据不丢失
+	kv, err = OpenFileKV(path)
+	assert.Nil(t, err)
+	defer kv.Close()
+	def, err := NewKVStore(kv).Get("a/b")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(def))
+}
+
+func TestMaxHistory(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir(), WithMaxHistory(2))
+	assert.Nil(t, err)
+	for _, store := range []types.ChainStore{fileStore, NewKVStore(NewMemoryKV(), WithMaxHistory(2))} {
+		for _, def := range []string{"v1", "v2", "v3"} {
+			_, err := store.Save("c1", []byte(def))
+			assert.Nil(t, err)
+		}
+		history, err := store.History("c1")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(history))
+		assert.Equal(t, int64(2), history[0].Revision)
+		revision, err := store.Save("c1", []byte("v4"))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), revision)
+	}
+}
+
+func TestRuleGoWithStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	_, err = store.Save("storeChain", []byte(ruleChain))
+	assert.Nil(t, err)
+
+	pool := &rulego.RuleGo{}
+	defer pool.Stop()
+	assert.Nil(t, pool.LoadFromStore(store))
+	ruleEngine, ok := pool.Get("storeChain")
+	assert.True(t, ok)
+
+	//更新规则链写回存储
+	assert.Nil(t, ruleEngine.ReloadSelf([]byte(strings.Replace(ruleChain, "> 50", "> 60", 1))))
+	def, err := store.Get("storeChain")
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(def), "> 60"))
+
+	//更新节点写回存储
+	assert.Nil(t, ruleEngine.ReloadChild("s1", []byte(`{"id":"s1","type":"jsFilter","configuration":{"jsScript":"return msg.temperature > 70;"}}`)))
+	def, _ = store.Get("storeChain")
+	assert.True(t, strings.Contains(string(def), "> 70"))
+
+	history, err := ruleEngine.History()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history))
+
+	//回滚到第一个版本
+	assert.Nil(t, ruleEngine.Rollback(1))
+	assert.True(t, strings.Contains(string(ruleEngine.DSL()), "> 50"))
+	def, _ = store.Get("storeChain")
+	assert.True(t, strings.Contains(string(def), "> 50"))
+	history, _ = ruleEngine.History()
+	assert.Equal(t, 4, len(history))
+	assert.NotNil(t, ruleEngine.Rollback(100))
+
+	//新建的规则链写回存储
+	_, err = pool.New("newChain", []byte(ruleChain), rulego.WithChainStore(store))
+	assert.Nil(t, err)
+	ids, _ := store.List()
+	assert.Equal(t, []string{"newChain", "storeChain"}, ids)
+}
+
+func TestLoadStoreDir(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	//第一个版本的ruleChain.id不同
+	_, err = store.Save("storeChain", []byte(strings.Replace(ruleChain, `"id": "storeChain"`, `"id": "storeChainV1"`, 1)))
+	assert.Nil(t, err)
+	_, err = store.Save("storeChain", []byte(strings.Replace(ruleChain, "> 50", "> 60", 1)))
+	assert.Nil(t, err)
+
+	//历史版本不会被加载
+	pool := &rulego.RuleGo{}
+	defer pool.Stop()
+	assert.Nil(t, pool.Load(dir))
+	var count int
+	pool.Range(func(id string, ruleEngine *rulego.RuleEngine) bool {
+		count++
+		return true
+	})
+	assert.Equal(t, 1, count)
+	ruleEngine, ok := pool.Get("storeChain")
+	assert.True(t, ok)
+	assert.True(t, strings.Contains(string(ruleEngine.DSL()), "> 60"))
+}
@@ -18,7 +18,10 @@ package testcases
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/xyzbit/rulego/api/types"
@@ -92,3 +95,137 @@ func (n *TimeNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
 func (n *TimeNode) Destroy() {
 	// Do some cleanup work
 }
+
+// FlakyNode 前failTimes次执行失败，之后执行成功，用于测试重试
+type FlakyNode struct {
+	failTimes int
+	// 已执行次数
+	Attempts int32
+}
+
+func (n *FlakyNode) Type() string {
+	return "test/flaky"
+}
+
+func (n *FlakyNode) New() types.Node {
+	return &FlakyNode{}
+}
+
+func (n *FlakyNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.failTimes, _ = strconv.Atoi(configuration.GetToString("failTimes"))
+	return nil
+}
+
+func (n *FlakyNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	attempts := atomic.AddInt32(&n.Attempts, 1)
+	msg.Metadata.PutValue("attempts", strconv.Itoa(int(attempts)))
+	if int(attempts) <= n.failTimes {
+		ctx.TellFailure(msg, fmt.Errorf("attempt %d failed", attempts))
+	} else {
+		ctx.TellSuccess(msg)
+	}
+	return nil
+}
+
+func (n *FlakyNode) Destroy() {
+}
+
+// SlowNode 延迟sleepMs后执行成功，如果执行期间被销毁则执行失败，用于测试热更新
+type SlowNode struct {
+	sleepMs int
+	// 是否已经销毁
+	Destroyed int32
+}
+
+func (n *SlowNode) Type() string {
+	return "test/slow"
+}
+
+func (n *SlowNode) New() types.Node {
+	return &SlowNode{}
+}
+
+func (n *SlowNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.sleepMs, _ = strconv.Atoi(configuration.GetToString("sleepMs"))
+	return nil
+}
+
+func (n *SlowNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	time.Sleep(time.Duration(n.sleepMs) * time.Millisecond)
+	if atomic.LoadInt32(&n.Destroyed) == 1 {
+		ctx.TellFailure(msg, fmt.Errorf("node destroyed"))
+	} else {
+		ctx.TellSuccess(msg)
+	}
+	return nil
+}
+
+func (n *SlowNode) Destroy() {
+	atomic.StoreInt32(&n.Destroyed, 1)
+}
+
+// BusyNode 执行期间修改节点内部状态，记录是否在执行期间被销毁，用于测试节点超时后热更新
+type BusyNode struct {
+	sleepMs int
+	// 节点内部状态，不加锁
+	state map[string]int
+	// 正在执行的数量
+	running *int32
+	// 执行期间被销毁的次数
+	destroyedWhileRunning *int32
+}
+
+func (n *BusyNode) Type() string {
+	return "test/busy"
+}
+
+func (n *BusyNode) New() types.Node {
+	return &BusyNode{running: n.running, destroyedWhileRunning: n.destroyedWhileRunning}
+}
+
+func (n *BusyNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	n.sleepMs, _ = strconv.Atoi(configuration.GetToString("sleepMs"))
+	n.state = make(map[string]int)
+	return nil
+}
+
+func (n *BusyNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	atomic.AddInt32(n.running, 1)
+	defer atomic.AddInt32(n.running, -1)
+	time.Sleep(time.Duration(n.sleepMs) * time.Millisecond)
+	n.state[msg.Id]++
+	ctx.TellSuccess(msg)
+	return nil
+}
+
+func (n *BusyNode) Destroy() {
+	if atomic.LoadInt32(n.running) > 0 {
+		atomic.AddInt32(n.destroyedWhileRunning, 1)
+	}
+	n.state = nil
+}
+
+// HangNode 收到消息后一直挂起，直到release关闭，并且不通知下一个节点，用于测试同步等待放弃后的结束回调
+type HangNode struct {
+	release chan struct{}
+}
+
+func (n *HangNode) Type() string {
+	return "test/hang"
+}
+
+func (n *HangNode) New() types.Node {
+	return &HangNode{release: n.release}
+}
+
+func (n *HangNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (n *HangNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	<-n.release
+	return nil
+}
+
+func (n *HangNode) Destroy() {
+}
@@ -17,10 +17,13 @@
 package testcases
 
 import (
+	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/xyzbit/rulego"
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test"
 	"github.com/xyzbit/rulego/utils/str"
 )
 
@@ -58,6 +61,144 @@ func BenchmarkChainChangeMetadataAndMsg(b *testing.B) {
 	}
 }
 
+// 使用fieldMapping组件实现和modifyMetadataAndMsgNode相同的转换
+var fieldMappingNode = `
+	  {
+			"id":"s2",
+			"type": "fieldMapping",
+			"name": "转换",
+			"debugMode": true,
+			"configuration": {
+			  "mappings": [
+				{"op": "set", "path": "metadata.test", "value": "test02"},
+				{"op": "set", "path": "metadata.index", "value": 50},
+				{"op": "set", "path": "msgType", "value": "TEST_MSG_TYPE_MODIFY"},
+				{"op": "set", "path": "$.aa", "value": 66}
+			  ]
+			}
+		  }
+`
+
+func BenchmarkChainFieldMapping(b *testing.B) {
+	config := rulego.NewConfig()
+
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(ruleChainFile), rulego.WithConfig(config))
+	if err != nil {
+		b.Fatal(err)
+	}
+	// 使用fieldMapping组件替换s2节点
+	if err = ruleEngine.ReloadChild("s2", []byte(fieldMappingNode)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		metaData := types.NewMetadata()
+		metaData.PutValue("productType", "test01")
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, "{\"temperature\":35}")
+		ruleEngine.OnMsg(msg)
+	}
+}
+
+// 只有一个转换节点的规则链，关闭调试模式，用于对比转换节点本身的耗时
+var singleTransformChain = `
+	{
+	  "ruleChain": {
+		"id":"%s",
+		"name": "transformBenchmark"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "%s",
+			"configuration": %s
+		  }
+		]
+	  }
+	}
+`
+
+// 同一转换的jsTransform和fieldMapping配置
+const (
+	jsTransformConfiguration  = `{"jsScript": "metadata['test']='test02';\n metadata['index']=50;\n msgType='TEST_MSG_TYPE_MODIFY';\n  msg['aa']=66;\n return {'msg':msg,'metadata':metadata,'msgType':msgType};"}`
+	fieldMappingConfiguration = `{"mappings": [
+		{"op": "set", "path": "metadata.test", "value": "test02"},
+		{"op": "set", "path": "metadata.index", "value": 50},
+		{"op": "set", "path": "msgType", "value": "TEST_MSG_TYPE_MODIFY"},
+		{"op": "set", "path": "$.aa", "value": 66}
+	]}`
+)
+
+// BenchmarkNodeJsTransform 和 BenchmarkNodeFieldMapping 对比同一转换节点本身的耗时
+// 本地测试结果(单核)：jsTransform约20µs/op，fieldMapping约1.8µs/op，约11倍
+func BenchmarkNodeJsTransform(b *testing.B) {
+	benchmarkTransformNode(b, "jsTransform", jsTransformConfiguration)
+}
+
+func BenchmarkNodeFieldMapping(b *testing.B) {
+	benchmarkTransformNode(b, "fieldMapping", fieldMappingConfiguration)
+}
+
+func benchmarkTransformNode(b *testing.B, nodeType, configuration string) {
+	node, err := rulego.Registry.NewNode(nodeType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var nodeConfiguration types.Configuration
+	if err = json.Unmarshal([]byte(configuration), &nodeConfiguration); err != nil {
+		b.Fatal(err)
+	}
+	if err = node.Init(rulego.NewConfig(), nodeConfiguration); err != nil {
+		b.Fatal(err)
+	}
+	defer node.Destroy()
+	ctx := test.NewRuleContext(rulego.NewConfig(), func(msg types.RuleMsg, relationType string) {
+		if relationType != types.Success {
+			b.Error(relationType)
+		}
+	})
+	metaData := types.NewMetadata()
+	metaData.PutValue("productType", "test01")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, "{\"temperature\":35}")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = node.OnMsg(ctx, msg)
+	}
+}
+
+// BenchmarkEngineJsTransform 和 BenchmarkEngineFieldMapping 通过只有一个转换节点的规则链对比，包含规则引擎调度的耗时
+// 本地测试结果(单核)：jsTransform约35µs/op，fieldMapping约14µs/op，其中约12µs为两者相同的规则引擎调度开销
+func BenchmarkEngineJsTransform(b *testing.B) {
+	benchmarkTransformChain(b, "jsTransform", jsTransformConfiguration)
+}
+
+func BenchmarkEngineFieldMapping(b *testing.B) {
+	benchmarkTransformChain(b, "fieldMapping", fieldMappingConfiguration)
+}
+
+func benchmarkTransformChain(b *testing.B, nodeType, configuration string) {
+	chainId := str.RandomStr(10)
+	ruleEngine, err := rulego.New(chainId, []byte(fmt.Sprintf(singleTransformChain, chainId, nodeType, configuration)), rulego.WithConfig(rulego.NewConfig()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rulego.Del(chainId)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		metaData := types.NewMetadata()
+		metaData.PutValue("productType", "test01")
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, "{\"temperature\":35}")
+		ruleEngine.OnMsgAndWait(msg, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+			if err != nil {
+				b.Error(err)
+			}
+		}))
+	}
+}
+
 func BenchmarkCallRestApiNodeGo(b *testing.B) {
 	// 不使用协程池
 	config := rulego.NewConfig()
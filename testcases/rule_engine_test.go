@@ -18,9 +18,11 @@ package testcases
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -28,6 +30,7 @@ import (
 
 	"github.com/xyzbit/rulego"
 	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/components/action"
 	"github.com/xyzbit/rulego/test/assert"
 	"github.com/xyzbit/rulego/utils/str"
 )
@@ -469,6 +472,14 @@ func TestLoadChain(t *testing.T) {
 	_, ok = rulego.Get("test_context_chain")
 	assert.Equal(t, true, ok)
 
+	// yaml 规则链
+	yamlEngine, ok := rulego.Get("chain_yaml")
+	assert.Equal(t, true, ok)
+	// yaml 规则链转换成json规则链加载，使用json热更新
+	dsl := yamlEngine.DSL()
+	assert.True(t, strings.HasPrefix(string(dsl), "{"))
+	assert.Nil(t, yamlEngine.ReloadSelf(dsl))
+
 	msg := types.NewMsg(0, "TEST_MSG_TYPE1", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
 
 	rulego.OnMsg(msg)
@@ -525,3 +536,804 @@ func TestWait(t *testing.T) {
 	assert.Equal(t, int32(1), count)
 	wg.Wait()
 }
+
+// TestWaitWithTimeout 测试同步执行规则链超时和取消
+func TestWaitWithTimeout(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试超时规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "delay",
+			"name": "延迟",
+			"configuration": {
+			  "periodInSeconds": 1
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "test/upper",
+			"name": "转大写"
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Success"
+		  }
+		]
+	  }
+	}`
+	rulego.Registry.Register(&UpperNode{})
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+
+	// 超时，规则链不再往下执行，结束回调返回context.DeadlineExceeded错误
+	var wg sync.WaitGroup
+	wg.Add(1)
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Millisecond*100, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.Equal(t, "{\"temperature\":41}", msg.Data)
+		wg.Done()
+	}))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	wg.Wait()
+
+	// 规则链在超时前执行完成
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Second*3, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+		assert.Equal(t, "{\"TEMPERATURE\":41}", msg.Data)
+	}))
+	assert.Nil(t, err)
+
+	// context已经取消，不执行任何节点
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ruleEngine.OnMsgAndWait(msg, types.WithContext(ctx), types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		assert.Equal(t, context.Canceled, err)
+	}))
+}
+
+// TestWaitWithHangingNode 测试节点一直不通知时，同步等待超时或者取消后用上下文错误触发结束回调
+func TestWaitWithHangingNode(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试挂起节点规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "test/hang",
+			"name": "挂起节点"
+		  }
+		]
+	  }
+	}`
+	node := &HangNode{release: make(chan struct{})}
+	_ = rulego.Registry.Unregister(node.Type())
+	_ = rulego.Registry.Register(node)
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{}")
+
+	// 结束回调在等待放弃时同步执行
+	var count int32
+	var endErr error
+	endFunc := types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		atomic.AddInt32(&count, 1)
+		endErr = err
+	})
+	// 超时
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Millisecond*100, endFunc)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	assert.Equal(t, context.DeadlineExceeded, endErr)
+
+	// 取消
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*100, cancel)
+	ruleEngine.OnMsgAndWait(msg, types.WithContext(ctx), endFunc)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	assert.Equal(t, context.Canceled, endErr)
+
+	// 挂起的节点恢复后，不再重复触发结束回调
+	close(node.release)
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+	ruleEngine.Stop()
+}
+
+// TestNodeTimeout 测试节点执行超时
+func TestNodeTimeout(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试节点超时规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "delay",
+			"name": "延迟",
+			"timeoutMs": 100,
+			"configuration": {
+			  "periodInSeconds": 1
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "test/upper",
+			"name": "转大写"
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Timeout"
+		  }
+		]
+	  }
+	}`
+	rulego.Registry.Register(&UpperNode{})
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+
+	// 超时通过Timeout关系发送到s2
+	var count int32
+	start := time.Now()
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Second*3, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		atomic.AddInt32(&count, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, "{\"TEMPERATURE\":41}", msg.Data)
+	}))
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// 没有Timeout关系，使用Failure关系
+	_ = ruleEngine.ReloadSelf([]byte(strings.Replace(chainFile, `"type": "Timeout"`, `"type": "Success"`, 1)))
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Second*3, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		atomic.AddInt32(&count, 1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "{\"temperature\":41}", msg.Data)
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	// 等待延迟节点超时后再通知，通知被忽略
+	time.Sleep(time.Millisecond * 1500)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+}
+
+// TestReloadDuringNodeTimeout 测试节点超时后重新加载规则链，旧版本等超时节点执行结束才销毁
+func TestReloadDuringNodeTimeout(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试超时热更新规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "test/busy",
+			"name": "耗时节点",
+			"timeoutMs": 50,
+			"configuration": {
+			  "sleepMs": 200
+			}
+		  }
+		]
+	  }
+	}`
+	var running, destroyedWhileRunning int32
+	node := &BusyNode{running: &running, destroyedWhileRunning: &destroyedWhileRunning}
+	_ = rulego.Registry.Unregister(node.Type())
+	_ = rulego.Registry.Register(node)
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{}")
+	var endErr error
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Second, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		endErr = err
+	}))
+	assert.Nil(t, err)
+	//节点超时，消息已经结束，节点仍在执行
+	assert.NotNil(t, endErr)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&running))
+	assert.Nil(t, ruleEngine.ReloadSelf([]byte(chainFile)))
+	time.Sleep(time.Millisecond * 300)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&running))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&destroyedWhileRunning))
+}
+
+// TestNodeRetry 测试节点重试策略
+func TestNodeRetry(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试节点重试规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "test/flaky",
+			"name": "不稳定节点",
+			"retry": {
+			  "maxAttempts": 3,
+			  "backoff": "exponential",
+			  "delayMs": 10,
+			  "jitter": 0.2
+			},
+			"configuration": {
+			  "failTimes": %d
+			}
+		  }
+		]
+	  }
+	}`
+	rulego.Registry.Register(&FlakyNode{})
+	config := rulego.NewConfig()
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+
+	// 失败2次，第3次执行成功
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(fmt.Sprintf(chainFile, 2)), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	var count int32
+	ruleEngine.OnMsgAndWait(msg, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		atomic.AddInt32(&count, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, "3", msg.Metadata.GetValue("attempts"))
+	}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	// 失败5次，达到最大执行次数后，通过Failure关系结束
+	ruleEngine, err = rulego.New(str.RandomStr(10), []byte(fmt.Sprintf(chainFile, 5)), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	ruleEngine.OnMsgAndWait(msg, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		atomic.AddInt32(&count, 1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "3", msg.Metadata.GetValue("attempts"))
+	}))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+	// 不支持的退避策略
+	_, err = rulego.New(str.RandomStr(10), []byte(strings.Replace(fmt.Sprintf(chainFile, 1), "exponential", "unknown", 1)), rulego.WithConfig(config))
+	assert.NotNil(t, err)
+}
+
+// TestForkJoin 测试并行分支汇聚，同一个分支通过多个关系连接到汇聚节点只等待一次
+func TestForkJoin(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试分支汇聚规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsFilter",
+			"name": "过滤",
+			"configuration": {
+			  "jsScript": "return msg.temperature>10;"
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "jsTransform",
+			"name": "分支1",
+			"configuration": {
+			  "jsScript": "msg.branch1=true;metadata.branch1='s2';return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+			}
+		  },
+		  {
+			"id":"s3",
+			"type": "jsTransform",
+			"name": "分支2",
+			"configuration": {
+			  "jsScript": "msg.branch2=true;metadata.branch2='s3';return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+			}
+		  },
+		  {
+			"id":"s4",
+			"type": "join",
+			"name": "汇聚",
+			"configuration": {
+			  "timeoutMs": 1000
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "True"
+		  },
+		  {
+			"fromId": "s1",
+			"toId": "s3",
+			"type": "True"
+		  },
+		  {
+			"fromId": "s2",
+			"toId": "s4",
+			"type": "Success"
+		  },
+		  {
+			"fromId": "s3",
+			"toId": "s4",
+			"type": "Success"
+		  },
+		  {
+			"fromId": "s2",
+			"toId": "s4",
+			"type": "Failure"
+		  },
+		  {
+			"fromId": "s3",
+			"toId": "s4",
+			"type": "Failure"
+		  }
+		]
+	  }
+	}`
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		var count int32
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+		ruleEngine.OnMsgAndWait(msg, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+			atomic.AddInt32(&count, 1)
+			assert.Nil(t, err)
+			assert.Equal(t, "{\"branch1\":true,\"branch2\":true,\"temperature\":41}", msg.Data)
+			assert.Equal(t, "s2", msg.Metadata.GetValue("branch1"))
+			assert.Equal(t, "s3", msg.Metadata.GetValue("branch2"))
+			assert.Equal(t, "2", msg.Metadata.GetValue("joinCount"))
+		}))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+	}
+}
+
+// concurrencyNode 记录同时处理的消息数量
+type concurrencyNode struct {
+	running int32
+	max     int32
+	count   int32
+}
+
+func (n *concurrencyNode) Type() string {
+	return "test/concurrency"
+}
+
+func (n *concurrencyNode) New() types.Node {
+	return n
+}
+
+func (n *concurrencyNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (n *concurrencyNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) error {
+	running := atomic.AddInt32(&n.running, 1)
+	for {
+		max := atomic.LoadInt32(&n.max)
+		if running <= max || atomic.CompareAndSwapInt32(&n.max, max, running) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond * 20)
+	atomic.AddInt32(&n.count, 1)
+	atomic.AddInt32(&n.running, -1)
+	ctx.TellSuccess(msg)
+	return nil
+}
+
+func (n *concurrencyNode) Destroy() {
+}
+
+// TestSplit 测试拆分节点限制并发，并在所有元素处理完成后发送汇总消息
+func TestSplit(t *testing.T) {
+	node := &concurrencyNode{}
+	//重复执行测试时，替换已经注册的组件
+	_ = rulego.Registry.Unregister(node.Type())
+	_ = rulego.Registry.Register(node)
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试拆分规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "split",
+			"name": "拆分",
+			"configuration": {
+			  "path": "$.items",
+			  "maxConcurrency": 2,
+			  "sendDone": true
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "test/concurrency",
+			"name": "处理元素"
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Success"
+		  }
+		]
+	  }
+	}`
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	var elements, done int32
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"items":[1,2,3,4,5,6]}`)
+	ruleEngine.OnMsgAndWait(msg, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+		if msg.Metadata.Has("index") {
+			atomic.AddInt32(&elements, 1)
+		} else {
+			//汇总消息在所有元素处理完成后发送
+			atomic.AddInt32(&done, 1)
+			assert.Equal(t, int32(6), atomic.LoadInt32(&node.count))
+			assert.Equal(t, "6", msg.Metadata.GetValue("total"))
+		}
+	}))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&elements))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&done))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&node.max))
+}
+
+// TestSplitDoneToAggregate 测试拆分节点通过`Done`关系连接聚合节点
+func TestSplitDoneToAggregate(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试拆分汇总规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "split",
+			"name": "拆分",
+			"configuration": {
+			  "path": "$.items",
+			  "sendDone": true
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "aggregate",
+			"name": "汇总",
+			"configuration": {
+			  "windowType": "count",
+			  "count": 2,
+			  "aggregations": [{"func": "count", "as": "count"}]
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Done"
+		  }
+		]
+	  }
+	}`
+	var lock sync.Mutex
+	var results []string
+	config := rulego.NewConfig()
+	config.OnEnd = func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+		if msg.Metadata.GetValue(action.KeyWindowCount) != "" {
+			lock.Lock()
+			defer lock.Unlock()
+			results = append(results, msg.Data)
+		}
+	}
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	var elements int32
+	for i := 0; i < 2; i++ {
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"items":[1,2,3]}`)
+		ruleEngine.OnMsgAndWait(msg, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+			if msg.Metadata.Has("index") {
+				atomic.AddInt32(&elements, 1)
+			}
+		}))
+	}
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(6), atomic.LoadInt32(&elements))
+	lock.Lock()
+	defer lock.Unlock()
+	//每条消息的所有元素处理完成后发送一条汇总消息，两条汇总消息组成一个计数窗口
+	assert.Equal(t, []string{`{"count":2}`}, results)
+}
+
+// TestAggregateReload 测试规则链和节点重新加载后，聚合窗口状态转移到新实例
+func TestAggregateReload(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试聚合规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "aggregate",
+			"name": "聚合",
+			"configuration": {
+			  "sizeMs": 300,
+			  "aggregations": [{"func": "count", "as": "count"}, {"field": "v", "func": "sum", "as": "sum"}]
+			}
+		  }
+		]
+	  }
+	}`
+	nodeFile := `
+	{
+	  "id":"s1",
+	  "type": "aggregate",
+	  "name": "聚合2",
+	  "configuration": {
+		"sizeMs": 300,
+		"aggregations": [{"func": "count", "as": "count"}, {"field": "v", "func": "sum", "as": "sum"}]
+	  }
+	}`
+	var lock sync.Mutex
+	var count, sum float64
+	config := rulego.NewConfig()
+	// 聚合消息作为新消息执行，通过全局结束回调获取
+	config.OnEnd = func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+		if msg.Metadata.GetValue(action.KeyWindowCount) == "" {
+			return
+		}
+		var data map[string]float64
+		assert.Nil(t, json.Unmarshal([]byte(msg.Data), &data))
+		lock.Lock()
+		defer lock.Unlock()
+		count += data["count"]
+		sum += data["sum"]
+	}
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	send := func(v int) {
+		ruleEngine.OnMsg(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), fmt.Sprintf(`{"v":%d}`, v)))
+	}
+	send(1)
+	send(2)
+	time.Sleep(time.Millisecond * 20)
+	assert.Nil(t, ruleEngine.ReloadSelf([]byte(chainFile)))
+	send(3)
+	time.Sleep(time.Millisecond * 20)
+	assert.Nil(t, ruleEngine.ReloadChild("s1", []byte(nodeFile)))
+	send(4)
+	time.Sleep(time.Millisecond * 800)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, float64(4), count)
+	assert.Equal(t, float64(10), sum)
+}
+
+// TestAggregateDetachContext 测试聚合消息不受流入消息上下文影响，同步调用不等待窗口关闭
+func TestAggregateDetachContext(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试聚合规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "aggregate",
+			"name": "聚合",
+			"configuration": {
+			  "sizeMs": 300,
+			  "aggregations": [{"func": "count", "as": "count"}]
+			}
+		  }
+		]
+	  }
+	}`
+	var count int32
+	config := rulego.NewConfig()
+	config.OnEnd = func(msg types.RuleMsg, err error) {
+		if msg.Metadata.GetValue(action.KeyWindowCount) != "" {
+			assert.Nil(t, err)
+			atomic.AddInt32(&count, 1)
+		}
+	}
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), `{"v":1}`), types.WithContext(ctx))
+	assert.True(t, time.Since(start) < time.Millisecond*100)
+	// 流入消息的上下文取消，不影响聚合消息发送
+	cancel()
+	time.Sleep(time.Millisecond * 700)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+}
+
+// TestAggregateReloadWithInFlightMsg 测试热更新时旧版本规则链处理中的消息，由新版本的聚合节点聚合
+func TestAggregateReloadWithInFlightMsg(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试聚合规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "test/slow",
+			"name": "慢节点",
+			"configuration": {
+			  "sleepMs": 100
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "aggregate",
+			"name": "聚合",
+			"configuration": {
+			  "sizeMs": 500,
+			  "aggregations": [{"func": "count", "as": "count"}, {"field": "v", "func": "sum", "as": "sum"}]
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "Success"
+		  }
+		]
+	  }
+	}`
+	rulego.Registry.Register(&SlowNode{})
+	var lock sync.Mutex
+	var ended int
+	var count, sum float64
+	config := rulego.NewConfig()
+	config.OnEnd = func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+		if msg.Metadata.GetValue(action.KeyWindowCount) == "" {
+			return
+		}
+		var data map[string]float64
+		assert.Nil(t, json.Unmarshal([]byte(msg.Data), &data))
+		lock.Lock()
+		defer lock.Unlock()
+		count += data["count"]
+		sum += data["sum"]
+	}
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(chainFile), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer ruleEngine.Stop()
+
+	// 被聚合的消息结束回调
+	endFunc := types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+		assert.Equal(t, "", msg.Metadata.GetValue(action.KeyWindowCount))
+		lock.Lock()
+		defer lock.Unlock()
+		ended++
+	})
+	for i := 1; i <= 3; i++ {
+		ruleEngine.OnMsgWithOptions(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), fmt.Sprintf(`{"v":%d}`, i)), endFunc)
+	}
+	time.Sleep(time.Millisecond * 20)
+	// 消息还在慢节点处理，热更新后流入旧版本的聚合节点
+	assert.Nil(t, ruleEngine.ReloadSelf([]byte(chainFile)))
+	time.Sleep(time.Millisecond * 1200)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 3, ended)
+	assert.Equal(t, float64(3), count)
+	assert.Equal(t, float64(6), sum)
+}
+
+// TestReloadSelfWithInFlightMsg 测试热更新不影响处理中的消息
+func TestReloadSelfWithInFlightMsg(t *testing.T) {
+	chainFile := `
+	{
+	  "ruleChain": {
+		"name": "测试热更新规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "test/slow",
+			"name": "慢节点",
+			"configuration": {
+			  "sleepMs": %d
+			}
+		  }
+		]
+	  }
+	}`
+	rulego.Registry.Register(&SlowNode{})
+	config := rulego.NewConfig()
+	ruleEngine, err := rulego.New(str.RandomStr(10), []byte(fmt.Sprintf(chainFile, 200)), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), ruleEngine.Version())
+
+	nodeCtx, ok := ruleEngine.RootRuleChainCtx().GetNodeById(types.RuleNodeId{Id: "s1"})
+	assert.True(t, ok)
+	oldNode := nodeCtx.(*rulego.RuleNodeCtx).Node.(*SlowNode)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+	ruleEngine.OnMsgWithEndFunc(msg, func(msg types.RuleMsg, err error) {
+		// 处理中的消息在旧版本执行完成
+		assert.Nil(t, err)
+		wg.Done()
+	})
+	time.Sleep(time.Millisecond * 50)
+
+	// 热更新，旧版本还有处理中的消息，不销毁
+	err = ruleEngine.ReloadSelf([]byte(fmt.Sprintf(chainFile, 10)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), ruleEngine.Version())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&oldNode.Destroyed))
+
+	// 新消息交给新版本处理
+	err = ruleEngine.OnMsgAndWaitWithTimeout(msg, time.Second, types.WithEndFunc(func(msg types.RuleMsg, err error) {
+		assert.Nil(t, err)
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&oldNode.Destroyed))
+
+	// 旧版本处理中的消息执行完后销毁
+	wg.Wait()
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&oldNode.Destroyed))
+
+	// 没有处理中的消息，立即销毁
+	nodeCtx, _ = ruleEngine.RootRuleChainCtx().GetNodeById(types.RuleNodeId{Id: "s1"})
+	oldNode = nodeCtx.(*rulego.RuleNodeCtx).Node.(*SlowNode)
+	err = ruleEngine.ReloadSelf([]byte(fmt.Sprintf(chainFile, 10)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), ruleEngine.Version())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&oldNode.Destroyed))
+}
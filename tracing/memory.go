@@ -0,0 +1,86 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultMemoryCapacity 内存导出器默认容量
+const DefaultMemoryCapacity = 10000
+
+var _ Exporter = (*MemoryExporter)(nil)
+
+// MemoryExporter 内存导出器，超过容量后最早的span会被丢弃，用于调试和测试
+type MemoryExporter struct {
+	capacity int
+	spans    []SpanData
+	lock     sync.RWMutex
+}
+
+// NewMemoryExporter 创建内存导出器，capacity<=0使用默认容量
+func NewMemoryExporter(capacity int) *MemoryExporter {
+	if capacity <= 0 {
+		capacity = DefaultMemoryCapacity
+	}
+	return &MemoryExporter{capacity: capacity}
+}
+
+// Export 保存span
+func (e *MemoryExporter) Export(span SpanData) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.spans) >= e.capacity {
+		copy(e.spans, e.spans[1:])
+		e.spans = e.spans[:len(e.spans)-1]
+	}
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans 按结束顺序获取所有span
+func (e *MemoryExporter) Spans() []SpanData {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	spans := make([]SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// MsgSpans 获取指定消息ID经过的所有span，按开始时间排序
+func (e *MemoryExporter) MsgSpans(msgId string) []SpanData {
+	e.lock.RLock()
+	var spans []SpanData
+	for _, item := range e.spans {
+		if item.MsgId == msgId {
+			spans = append(spans, item)
+		}
+	}
+	e.lock.RUnlock()
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime.Before(spans[j].StartTime)
+	})
+	return spans
+}
+
+// Reset 清空所有span
+func (e *MemoryExporter) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.spans = nil
+}
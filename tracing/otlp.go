@@ -0,0 +1,337 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+const (
+	// DefaultOTLPEndpoint OTLP/HTTP 默认地址
+	DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+	// DefaultServiceName 默认服务名
+	DefaultServiceName = "rulego"
+	// DefaultBatchSize 默认每批发送的span数量
+	DefaultBatchSize = 512
+	// DefaultFlushInterval 默认发送间隔
+	DefaultFlushInterval = time.Second * 5
+	// DefaultMaxQueueSize 默认等待发送的最大span数量，超过后丢弃新的span
+	DefaultMaxQueueSize = 4096
+	// 导出器名称
+	scopeName = "github.com/xyzbit/rulego"
+)
+
+// ErrQueueFull 等待发送的span已满
+var ErrQueueFull = errors.New("otlp exporter queue is full")
+
+// OTLPExporterOption OTLPExporter选项
+type OTLPExporterOption func(*OTLPExporter)
+
+// WithServiceName 服务名，对应资源属性service.name
+func WithServiceName(serviceName string) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.serviceName = serviceName
+	}
+}
+
+// WithHeaders 请求头，例如：认证信息
+func WithHeaders(headers map[string]string) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.headers = headers
+	}
+}
+
+// WithBatchSize 每批发送的span数量
+func WithBatchSize(batchSize int) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.batchSize = batchSize
+	}
+}
+
+// WithFlushInterval 发送间隔
+func WithFlushInterval(interval time.Duration) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.flushInterval = interval
+	}
+}
+
+// WithMaxQueueSize 等待发送的最大span数量
+func WithMaxQueueSize(maxQueueSize int) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.maxQueueSize = maxQueueSize
+	}
+}
+
+// WithHTTPClient http客户端
+func WithHTTPClient(client *http.Client) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.client = client
+	}
+}
+
+// WithLogger 日志记录接口，用于记录发送失败
+func WithLogger(logger types.Logger) OTLPExporterOption {
+	return func(e *OTLPExporter) {
+		e.logger = logger
+	}
+}
+
+var _ Exporter = (*OTLPExporter)(nil)
+
+// OTLPExporter 使用OTLP/HTTP JSON协议，把span批量发送到OpenTelemetry Collector
+// 达到批量大小或者发送间隔时发送，Shutdown时发送剩余的span
+type OTLPExporter struct {
+	endpoint      string
+	serviceName   string
+	headers       map[string]string
+	batchSize     int
+	flushInterval time.Duration
+	maxQueueSize  int
+	client        *http.Client
+	logger        types.Logger
+
+	queue   []SpanData
+	lock    sync.Mutex
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+	once    sync.Once
+}
+
+// NewOTLPExporter 创建OTLP/HTTP JSON导出器，并启动后台发送协程
+// endpoint 完整的接收地址，为空使用DefaultOTLPEndpoint
+func NewOTLPExporter(endpoint string, opts ...OTLPExporterOption) *OTLPExporter {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	e := &OTLPExporter{
+		endpoint:      endpoint,
+		serviceName:   DefaultServiceName,
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		maxQueueSize:  DefaultMaxQueueSize,
+		client:        &http.Client{Timeout: time.Second * 10},
+		logger:        types.DefaultLogger(),
+		flushCh:       make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+		doneCh:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	go e.loop()
+	return e
+}
+
+// Export 把span放入发送队列
+func (e *OTLPExporter) Export(span SpanData) error {
+	e.lock.Lock()
+	if len(e.queue) >= e.maxQueueSize {
+		e.lock.Unlock()
+		return ErrQueueFull
+	}
+	e.queue = append(e.queue, span)
+	full := len(e.queue) >= e.batchSize
+	e.lock.Unlock()
+	if full {
+		select {
+		case e.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush 立即发送队列中所有的span
+func (e *OTLPExporter) Flush() error {
+	for {
+		e.lock.Lock()
+		n := len(e.queue)
+		if n > e.batchSize {
+			n = e.batchSize
+		}
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		e.lock.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := e.send(batch); err != nil {
+			return err
+		}
+	}
+}
+
+// Shutdown 停止后台发送协程，并发送剩余的span
+func (e *OTLPExporter) Shutdown() error {
+	e.once.Do(func() {
+		close(e.stopCh)
+		<-e.doneCh
+	})
+	return e.Flush()
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.doneCh)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+		case <-e.flushCh:
+		}
+		if err := e.Flush(); err != nil {
+			e.logger.Printf("otlp exporter send error:%s", err)
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []SpanData) error {
+	body, err := json.Marshal(e.toRequest(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp exporter unexpected status:%s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON 请求结构，详见：https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	// span类型：内部操作
+	spanKindInternal = 1
+	// span状态
+	statusCodeOk    = 1
+	statusCodeError = 2
+)
+
+func (e *OTLPExporter) toRequest(spans []SpanData) otlpRequest {
+	items := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		item := otlpSpan{
+			TraceId:           span.TraceId,
+			SpanId:            span.SpanId,
+			ParentSpanId:      span.ParentSpanId,
+			Name:              span.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        toKeyValues(span.Attributes),
+			Status:            otlpStatus{Code: statusCodeOk},
+		}
+		if span.Error != "" {
+			item.Status = otlpStatus{Code: statusCodeError, Message: span.Error}
+		}
+		items = append(items, item)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{{Key: "service.name", Value: otlpValue{StringValue: e.serviceName}}}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: scopeName},
+			Spans: items,
+		}},
+	}}}
+}
+
+func toKeyValues(attributes map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	values := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, otlpKeyValue{Key: k, Value: otlpValue{StringValue: attributes[k]}})
+	}
+	return values
+}
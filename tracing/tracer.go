@@ -0,0 +1,154 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing 规则引擎链路追踪
+//
+// 每条消息在根规则链生成一个span，消息经过的每个节点生成一个子span，
+// 节点span的父span为上一个节点的span，记录节点ID、通知下一个节点的关系、耗时和错误信息。
+// 支持W3C traceparent传递，内置内存导出器和OTLP/HTTP JSON导出器。
+//
+// 使用方式：
+//
+//	exporter := tracing.NewMemoryExporter(1000)
+//	config := rulego.NewConfig(types.WithTracer(tracing.NewTracer(exporter)))
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// SpanData 已结束的span数据
+type SpanData struct {
+	TraceId      string            `json:"traceId"`
+	SpanId       string            `json:"spanId"`
+	ParentSpanId string            `json:"parentSpanId,omitempty"`
+	Name         string            `json:"name"`
+	MsgId        string            `json:"msgId"`
+	StartTime    time.Time         `json:"startTime"`
+	EndTime      time.Time         `json:"endTime"`
+	RelationType string            `json:"relationType,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// Duration 耗时
+func (d SpanData) Duration() time.Duration {
+	return d.EndTime.Sub(d.StartTime)
+}
+
+// Exporter span导出器
+type Exporter interface {
+	// Export 导出已结束的span
+	Export(span SpanData) error
+}
+
+var _ types.Tracer = (*Tracer)(nil)
+
+// Tracer 链路追踪，实现`types.Tracer`
+// 父span未采样时，子span也不导出
+type Tracer struct {
+	exporter Exporter
+}
+
+// NewTracer 创建链路追踪
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// StartSpan 开始一个span，parent无效时开始一条新的链路
+func (t *Tracer) StartSpan(parent types.SpanContext, name string, msg types.RuleMsg) types.Span {
+	sc := types.SpanContext{SpanId: newId(8), Sampled: true}
+	var parentSpanId string
+	if parent.IsValid() {
+		sc.TraceId = parent.TraceId
+		sc.Sampled = parent.Sampled
+		parentSpanId = parent.SpanId
+	} else {
+		sc.TraceId = newId(16)
+	}
+	return &span{
+		tracer:      t,
+		spanContext: sc,
+		data: SpanData{
+			TraceId:      sc.TraceId,
+			SpanId:       sc.SpanId,
+			ParentSpanId: parentSpanId,
+			Name:         name,
+			MsgId:        msg.Id,
+			StartTime:    time.Now(),
+			Attributes: map[string]string{
+				types.AttrMsgId:   msg.Id,
+				types.AttrMsgType: msg.Type,
+			},
+		},
+	}
+}
+
+// span `types.Span`实现
+type span struct {
+	tracer      *Tracer
+	spanContext types.SpanContext
+	data        SpanData
+	ended       bool
+	lock        sync.Mutex
+}
+
+func (s *span) Context() types.SpanContext {
+	return s.spanContext
+}
+
+func (s *span) SetAttribute(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.ended {
+		s.data.Attributes[key] = value
+	}
+}
+
+func (s *span) End(relationType string, err error) {
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	s.data.RelationType = relationType
+	if relationType != "" {
+		s.data.Attributes[types.AttrRelationType] = relationType
+	}
+	if err != nil {
+		s.data.Error = err.Error()
+	}
+	data := s.data
+	s.lock.Unlock()
+
+	if s.spanContext.Sampled && s.tracer.exporter != nil {
+		_ = s.tracer.exporter.Export(data)
+	}
+}
+
+// newId 生成指定字节数的16进制随机ID
+func newId(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego"
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var ruleChain = `
+	{
+	  "ruleChain": {
+		"id": "tracingChain",
+		"name": "链路追踪测试规则链"
+	  },
+	  "metadata": {
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsFilter",
+			"configuration": {
+			  "jsScript": "return msg.temperature > 50;"
+			}
+		  },
+		  {
+			"id":"s2",
+			"type": "restApiCall",
+			"configuration": {
+			  "restEndpointUrlPattern": "${url}",
+			  "requestMethod": "POST"
+			}
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s2",
+			"type": "True"
+		  }
+		]
+	  }
+	}
+`
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := types.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceId)
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanId)
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+
+	for _, item := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-xyz92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, ok = types.ParseTraceParent(item)
+		assert.False(t, ok)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var traceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(types.TraceParentHeader)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	exporter := NewMemoryExporter(100)
+	config := rulego.NewConfig(types.WithTracer(NewTracer(exporter)))
+	ruleEngine, err := rulego.New("", []byte(ruleChain), rulego.WithConfig(config))
+	assert.Nil(t, err)
+	defer rulego.Del("tracingChain")
+
+	metaData := types.NewMetadata()
+	metaData.PutValue("url", server.URL)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"temperature":60}`)
+	parent, _ := types.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ruleEngine.OnMsgAndWait(msg, types.WithContext(types.ContextWithSpanContext(context.Background(), parent)))
+
+	spans := exporter.MsgSpans(msg.Id)
+	assert.Equal(t, 3, len(spans))
+	chainSpan, s1, s2 := spans[0], spans[1], spans[2]
+	//继承上游链路
+	for _, item := range spans {
+		assert.Equal(t, parent.TraceId, item.TraceId)
+	}
+	assert.Equal(t, parent.SpanId, chainSpan.ParentSpanId)
+	assert.Equal(t, "tracingChain", chainSpan.Attributes[types.AttrChainId])
+
+	assert.Equal(t, chainSpan.SpanId, s1.ParentSpanId)
+	assert.Equal(t, "jsFilter", s1.Name)
+	assert.Equal(t, "s1", s1.Attributes[types.AttrNodeId])
+	assert.Equal(t, types.True, s1.RelationType)
+
+	assert.Equal(t, s1.SpanId, s2.ParentSpanId)
+	assert.Equal(t, "s2", s2.Attributes[types.AttrNodeId])
+	assert.Equal(t, types.Success, s2.RelationType)
+	//传递到外部请求
+	assert.Equal(t, "00-"+parent.TraceId+"-"+s2.SpanId+"-01", traceParent)
+
+	//失败节点记录错误
+	exporter.Reset()
+	metaData.PutValue("url", "http://127.0.0.1:1")
+	msg = types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"temperature":60}`)
+	ruleEngine.OnMsgAndWait(msg)
+	spans = exporter.MsgSpans(msg.Id)
+	assert.Equal(t, 3, len(spans))
+	assert.Equal(t, "", spans[0].ParentSpanId)
+	assert.Equal(t, types.Failure, spans[2].RelationType)
+	assert.True(t, spans[2].Error != "")
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+		var req otlpRequest
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&req))
+		received <- req
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL+"/v1/traces", WithServiceName("test"),
+		WithHeaders(map[string]string{"Authorization": "token"}), WithBatchSize(2), WithFlushInterval(time.Minute))
+	defer exporter.Shutdown()
+	tracer := NewTracer(exporter)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{}")
+	root := tracer.StartSpan(types.SpanContext{}, "ruleChain", msg)
+	child := tracer.StartSpan(root.Context(), "jsFilter", msg)
+	child.End(types.Failure, context.DeadlineExceeded)
+	root.End("", nil)
+
+	select {
+	case req := <-received:
+		assert.Equal(t, "test", req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+		spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+		assert.Equal(t, 2, len(spans))
+		assert.Equal(t, root.Context().SpanId, spans[0].ParentSpanId)
+		assert.Equal(t, statusCodeError, spans[0].Status.Code)
+		assert.Equal(t, statusCodeOk, spans[1].Status.Code)
+		assert.Equal(t, 32, len(spans[1].TraceId))
+	case <-time.After(time.Second * 3):
+		t.Fatal("spans not exported")
+	}
+}
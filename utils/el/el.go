@@ -0,0 +1,471 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package el 组件配置占位符表达式
+//
+// 占位符格式：${expr} 或者 ${expr:-默认值}，expr支持：
+//
+//	${msg}                   消息负荷
+//	${msg.a.b}               消息负荷JSON字段，数组使用下标：${msg.items.0.name}
+//	${metadata.key}          消息元数据
+//	${global.key}            全局属性(types.Config.Properties)
+//	${key}                   消息元数据，兼容旧的${metaKeyName}写法
+//	${upper(metadata.key)}   函数调用，参数可以是变量、字符串('abc'或者"abc")、数字或者函数调用
+//	${metadata.x:-fallback}  变量不存在或者为空时使用默认值
+//	$${key}                  转义，输出${key}，例如shell命令中的${VAR:-x}
+//
+// 变量不存在并且没有默认值时，占位符保持不变；无法解析的占位符，例如shell的${var,,}，当作文本处理。
+// 函数和utils/expr共用，通过expr.RegisterFunc注册。
+// 模板在组件初始化时通过Compile编译一次，处理消息时通过Execute替换。
+package el
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/utils/expr"
+	"github.com/xyzbit/rulego/utils/json"
+	"github.com/xyzbit/rulego/utils/str"
+)
+
+const (
+	varPatternLeft  = "${"
+	varPatternRight = "}"
+	// 默认值分隔符
+	defaultValueSep = ":-"
+	// 转义符，$${key}输出${key}
+	escapeChar = '$'
+)
+
+// errFuncNotFound 函数不存在，占位符语法正确，编译返回错误
+var errFuncNotFound = errors.New("not found")
+
+// 变量命名空间
+const (
+	msgNamespace      = "msg"
+	metadataNamespace = "metadata"
+	globalNamespace   = "global"
+)
+
+// Env 占位符取值环境，同一条消息执行多个模板时可以共用，消息负荷只解析一次
+type Env struct {
+	msg    types.RuleMsg
+	global map[string]string
+	// 解析后的消息负荷
+	data   interface{}
+	parsed bool
+}
+
+// NewEnv 创建取值环境
+// global 全局属性，可以为nil
+func NewEnv(msg types.RuleMsg, global map[string]string) *Env {
+	return &Env{msg: msg, global: global}
+}
+
+// msgData 获取解析后的消息负荷，不是JSON返回nil
+func (env *Env) msgData() interface{} {
+	if !env.parsed {
+		env.parsed = true
+		_ = json.Unmarshal([]byte(env.msg.Data), &env.data)
+	}
+	return env.data
+}
+
+// Template 编译后的模板
+type Template struct {
+	pattern string
+	parts   []part
+	hasVar  bool
+	// 是否包含转义的占位符，需要去掉转义符
+	escaped bool
+}
+
+// part 模板片段，文本或者占位符
+type part struct {
+	// 文本片段
+	text string
+	// 占位符表达式，文本片段为nil
+	expr node
+	// 占位符默认值
+	defaultValue *string
+}
+
+// Compile 编译模板
+func Compile(pattern string) (*Template, error) {
+	t := &Template{pattern: pattern}
+	rest := pattern
+	for {
+		start := strings.Index(rest, varPatternLeft)
+		if start < 0 {
+			break
+		}
+		if start > 0 && rest[start-1] == escapeChar {
+			// 转义，去掉转义符，${原样输出
+			t.parts = append(t.parts, part{text: rest[:start-1] + varPatternLeft})
+			t.escaped = true
+			rest = rest[start+len(varPatternLeft):]
+			continue
+		}
+		end := closingIndex(rest, start+len(varPatternLeft))
+		if end < 0 {
+			// 没有闭合的占位符当作文本处理
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, part{text: rest[:start]})
+		}
+		raw := rest[start : end+len(varPatternRight)]
+		p, err := compilePlaceholder(raw, rest[start+len(varPatternLeft):end])
+		if errors.Is(err, errFuncNotFound) {
+			return nil, fmt.Errorf("compile pattern %s error:%w", pattern, err)
+		} else if err != nil {
+			// 无法解析的占位符当作文本处理，兼容shell、SQL等配置中的${...}
+			t.parts = append(t.parts, part{text: raw})
+		} else {
+			t.parts = append(t.parts, p)
+			t.hasVar = true
+		}
+		rest = rest[end+len(varPatternRight):]
+	}
+	if rest != "" {
+		t.parts = append(t.parts, part{text: rest})
+	}
+	return t, nil
+}
+
+// MustCompile 编译模板，失败panic
+func MustCompile(pattern string) *Template {
+	t, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// HasVar 模板是否包含占位符
+func (t *Template) HasVar() bool {
+	return t.hasVar
+}
+
+// String 返回原始模板
+func (t *Template) String() string {
+	return t.pattern
+}
+
+// Execute 使用取值环境替换占位符
+func (t *Template) Execute(env *Env) string {
+	if !t.hasVar && !t.escaped {
+		return t.pattern
+	}
+	var builder strings.Builder
+	for _, item := range t.parts {
+		if item.expr == nil {
+			builder.WriteString(item.text)
+			continue
+		}
+		if v, ok := item.expr.eval(env); ok && (v != "" || item.defaultValue == nil) {
+			builder.WriteString(v)
+		} else if item.defaultValue != nil {
+			builder.WriteString(*item.defaultValue)
+		} else {
+			// 变量不存在，保持不变
+			builder.WriteString(item.text)
+		}
+	}
+	return builder.String()
+}
+
+// ExecuteMsg 使用消息和全局属性替换占位符
+func (t *Template) ExecuteMsg(msg types.RuleMsg, global map[string]string) string {
+	if !t.hasVar && !t.escaped {
+		return t.pattern
+	}
+	return t.Execute(NewEnv(msg, global))
+}
+
+// closingIndex 查找占位符结束位置，忽略引号内的`}`
+func closingIndex(s string, from int) int {
+	var quote byte
+	for i := from; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '}':
+			return i
+		}
+	}
+	return -1
+}
+
+// compilePlaceholder 编译占位符，raw是包含${}的原始内容
+func compilePlaceholder(raw, content string) (part, error) {
+	p := part{text: raw}
+	exprStr := content
+	if index := defaultSepIndex(content); index >= 0 {
+		defaultValue := content[index+len(defaultValueSep):]
+		p.defaultValue = &defaultValue
+		exprStr = content[:index]
+	}
+	exprStr = strings.TrimSpace(exprStr)
+	if exprStr == "" {
+		return p, errors.New("empty expression")
+	}
+	if !strings.ContainsAny(exprStr, "()'\",") {
+		// 变量，兼容任意字符的元数据key
+		p.expr = newVarNode(exprStr)
+		return p, nil
+	}
+	parser := &exprParser{input: exprStr}
+	expr, err := parser.parse()
+	if err != nil {
+		return p, err
+	}
+	p.expr = expr
+	return p, nil
+}
+
+// defaultSepIndex 查找默认值分隔符位置，忽略引号和括号内的分隔符
+func defaultSepIndex(s string) int {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], defaultValueSep):
+			return i
+		}
+	}
+	return -1
+}
+
+// node 表达式节点
+type node interface {
+	// eval 计算表达式，变量不存在返回false
+	eval(env *Env) (string, bool)
+}
+
+// literalNode 字符串或者数字常量
+type literalNode string
+
+func (n literalNode) eval(_ *Env) (string, bool) {
+	return string(n), true
+}
+
+// varNode 变量
+type varNode struct {
+	namespace string
+	// 命名空间下的key或者JSON字段路径
+	key  string
+	path []string
+}
+
+func newVarNode(name string) *varNode {
+	if name == msgNamespace {
+		return &varNode{namespace: msgNamespace}
+	}
+	if strings.HasPrefix(name, msgNamespace+".") {
+		key := name[len(msgNamespace)+1:]
+		return &varNode{namespace: msgNamespace, key: key, path: strings.Split(key, ".")}
+	}
+	if strings.HasPrefix(name, metadataNamespace+".") {
+		return &varNode{namespace: metadataNamespace, key: name[len(metadataNamespace)+1:]}
+	}
+	if strings.HasPrefix(name, globalNamespace+".") {
+		return &varNode{namespace: globalNamespace, key: name[len(globalNamespace)+1:]}
+	}
+	return &varNode{namespace: metadataNamespace, key: name}
+}
+
+func (n *varNode) eval(env *Env) (string, bool) {
+	switch n.namespace {
+	case msgNamespace:
+		if n.key == "" {
+			return env.msg.Data, true
+		}
+		return lookupPath(env.msgData(), n.path)
+	case globalNamespace:
+		v, ok := env.global[n.key]
+		return v, ok
+	default:
+		if env.msg.Metadata.Has(n.key) {
+			return env.msg.Metadata.GetValue(n.key), true
+		}
+		return "", false
+	}
+}
+
+// lookupPath 按路径获取JSON字段值
+func lookupPath(data interface{}, path []string) (string, bool) {
+	current := data
+	for _, key := range path {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			value, ok := v[key]
+			if !ok {
+				return "", false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return "", false
+			}
+			current = v[index]
+		default:
+			return "", false
+		}
+	}
+	if current == nil {
+		return "", false
+	}
+	return str.ToString(current), true
+}
+
+// callNode 函数调用
+type callNode struct {
+	name string
+	fn   expr.Func
+	args []node
+}
+
+// eval 参数都以字符串传给函数，函数返回错误或者nil时，按变量不存在处理
+func (n *callNode) eval(env *Env) (string, bool) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, ok := arg.eval(env)
+		if !ok {
+			return "", false
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args...)
+	if err != nil || v == nil {
+		return "", false
+	}
+	return str.ToString(v), true
+}
+
+// exprParser 表达式递归下降解析器
+// expr := string | number | call | var
+// call := ident '(' [expr {',' expr}] ')'
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func (p *exprParser) parse() (node, error) {
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+	return n, nil
+}
+
+func (p *exprParser) parseExpr() (node, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	c := p.input[p.pos]
+	if c == '\'' || c == '"' {
+		end := strings.IndexByte(p.input[p.pos+1:], c)
+		if end < 0 {
+			return nil, errors.New("unterminated string")
+		}
+		value := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return literalNode(value), nil
+	}
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune("(), \t'\"", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '(' {
+		return p.parseCall(name)
+	}
+	if _, err := strconv.ParseFloat(name, 64); err == nil {
+		return literalNode(name), nil
+	}
+	return newVarNode(name), nil
+}
+
+func (p *exprParser) parseCall(name string) (node, error) {
+	fn, ok := expr.GetFunc(name)
+	if !ok {
+		return nil, fmt.Errorf("function %s %w", name, errFuncNotFound)
+	}
+	call := &callNode{name: name, fn: fn}
+	// 跳过(
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == ')' {
+		p.pos++
+		return call, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		p.skipSpace()
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("function %s missing )", name)
+		}
+		switch p.input[p.pos] {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return call, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+		}
+	}
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
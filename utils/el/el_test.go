@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package el
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+	"github.com/xyzbit/rulego/utils/expr"
+)
+
+func TestTemplate(t *testing.T) {
+	metaData := types.NewMetadata()
+	metaData.PutValue("productType", "test01")
+	metaData.PutValue("name", "a b&c")
+	metaData.PutValue("empty", "")
+	metaData.PutValue("a.b", "dot")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"temperature":41.5,"device":{"id":"d1"},"items":[{"name":"i0"}]}`)
+	env := NewEnv(msg, map[string]string{"host": "127.0.0.1"})
+
+	testCases := []struct {
+		pattern  string
+		expected string
+	}{
+		{"no var", "no var"},
+		{"/api/${productType}/${metadata.productType}", "/api/test01/test01"},
+		{"${a.b}", "dot"},
+		{"${msg.temperature}-${msg.device.id}-${msg.items.0.name}", "41.5-d1-i0"},
+		{"${msg}", msg.Data},
+		{"http://${global.host}:9090", "http://127.0.0.1:9090"},
+		{"${notFound}/${msg.notFound}", "${notFound}/${msg.notFound}"},
+		{"${metadata.notFound:-fallback}", "fallback"},
+		{"${empty:-fallback}", "fallback"},
+		{"${empty}", ""},
+		{"${metadata.notFound:-}", ""},
+		{"${upper(productType)}", "TEST01"},
+		{"${upper( 'x' )}${lower(\"Y\")}", "Xy"},
+		{"q=${urlEncode(metadata.name)}", "q=a+b%26c"},
+		{"${upper(metadata.notFound):-N/A}", "N/A"},
+		{"${formatTime(0, '2006')}", time.Unix(0, 0).Format("2006")},
+		{"${formatTime('2023-10-01T08:00:00Z', '2006-01-02')}", "2023-10-01"},
+		{"${formatTime('bad'):-bad time}", "bad time"},
+		{"${upper(formatTime(1697500000000, 'Jan'))}", "OCT"},
+		{"unclosed ${productType", "unclosed ${productType"},
+		{"${lower('A}')}", "a}"},
+	}
+	for _, item := range testCases {
+		tpl, err := Compile(item.pattern)
+		assert.Nil(t, err)
+		assert.Equal(t, item.expected, tpl.Execute(env))
+	}
+
+	tpl := MustCompile("${now('2006')}")
+	assert.Equal(t, time.Now().Format("2006"), tpl.ExecuteMsg(msg, nil))
+	assert.True(t, tpl.HasVar())
+	assert.False(t, MustCompile("abc").HasVar())
+}
+
+func TestCompileError(t *testing.T) {
+	for _, pattern := range []string{"${notFound(x)}", "a ${upper(notFound(x))}"} {
+		_, err := Compile(pattern)
+		assert.NotNil(t, err)
+	}
+}
+
+// TestCompileLiteral 无法解析的占位符和转义的占位符当作文本处理
+func TestCompileLiteral(t *testing.T) {
+	metaData := types.NewMetadata()
+	metaData.PutValue("dir", "/tmp")
+	metaData.PutValue("HOME", "meta")
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, "{}")
+	testCases := []struct {
+		pattern  string
+		expected string
+		hasVar   bool
+	}{
+		{"${}", "${}", false},
+		{"${upper(x}", "${upper(x}", false},
+		{"${upper(x) y}", "${upper(x) y}", false},
+		{"${upper(x,)}", "${upper(x,)}", false},
+		{"echo ${f,,} ${dir}", "echo ${f,,} /tmp", true},
+		{"echo $${HOME:-/root} ${HOME:-/root}", "echo ${HOME:-/root} meta", true},
+		{"$${dir}$${", "${dir}${", false},
+	}
+	for _, item := range testCases {
+		tpl, err := Compile(item.pattern)
+		assert.Nil(t, err)
+		assert.Equal(t, item.hasVar, tpl.HasVar())
+		assert.Equal(t, item.expected, tpl.ExecuteMsg(msg, nil))
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	expr.RegisterFunc("concat", func(args ...interface{}) (interface{}, error) {
+		var result string
+		for _, item := range args {
+			result += item.(string)
+		}
+		return result, nil
+	})
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.TEXT, types.NewMetadata(), "aa")
+	assert.Equal(t, "aa-bb", MustCompile("${concat(msg, '-', 'bb')}").ExecuteMsg(msg, nil))
+}
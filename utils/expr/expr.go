@@ -0,0 +1,1101 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package expr 规则表达式，编译成语法树后直接求值，不需要js引擎
+//
+// 变量：
+//
+//	msg 消息负荷，JSON数据类型解析成对象，否则为字符串，也可以使用$表示，例如：$.items[0]
+//	metadata 元数据，例如：metadata.deviceType
+//	msgType 消息类型
+//	其他标识符表示msg中的字段，例如：temperature 等同于 msg.temperature
+//
+// 运算符(优先级从低到高)：
+//
+//	|| or
+//	&& and
+//	== != < <= > >= =~(正则匹配) !~ in(包含) not in
+//	+ -
+//	* / %
+//	! not -(取负)
+//	.字段 [下标]
+//
+// 字面量：数字、字符串('a'或者"a")、true、false、null、数组[1, 2]
+//
+// and、or、not、in、true、false、null是关键字，同名字段使用msg['in']访问
+// 字段不存在时值为null，数字字符串和数字比较时转换成数字比较
+// 例如：temperature > 50 && metadata.deviceType == 'sensor'
+package expr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xyzbit/rulego/api/types"
+	json2 "github.com/xyzbit/rulego/utils/json"
+)
+
+// Env 表达式求值环境，msg.Data 按需解析，多个表达式可以共用同一个环境
+type Env struct {
+	msg      types.RuleMsg
+	data     interface{}
+	parsed   bool
+	metadata map[string]interface{}
+}
+
+// NewEnv 创建求值环境
+func NewEnv(msg types.RuleMsg) *Env {
+	return &Env{msg: msg}
+}
+
+func (env *Env) msgData() interface{} {
+	if !env.parsed {
+		env.parsed = true
+		env.data = env.msg.Data
+		if env.msg.DataType == types.JSON && env.msg.Data != "" {
+			if v, err := json2.UnmarshalValue(env.msg.Data); err == nil {
+				env.data = v
+			}
+		}
+	}
+	return env.data
+}
+
+func (env *Env) metadataMap() map[string]interface{} {
+	if env.metadata == nil {
+		values := env.msg.Metadata.Values()
+		env.metadata = make(map[string]interface{}, len(values))
+		for k, v := range values {
+			env.metadata[k] = v
+		}
+	}
+	return env.metadata
+}
+
+// Program 编译后的表达式，可以并发使用
+type Program struct {
+	src  string
+	root node
+}
+
+// Compile 编译表达式
+func Compile(src string) (*Program, error) {
+	p := &parser{lexer: lexer{input: src}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF {
+		return nil, errors.New("empty expression")
+	}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok.text)
+	}
+	return &Program{src: src, root: root}, nil
+}
+
+// MustCompile 编译表达式，失败panic
+func MustCompile(src string) *Program {
+	p, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String 返回原始表达式
+func (p *Program) String() string {
+	return p.src
+}
+
+// Eval 计算表达式
+func (p *Program) Eval(env *Env) (interface{}, error) {
+	return p.root.eval(env)
+}
+
+// EvalBool 计算表达式并转换成布尔值
+// null、false、0、空字符串、空数组和空对象为false，其他为true
+func (p *Program) EvalBool(env *Env) (bool, error) {
+	v, err := p.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// EvalMsg 使用消息计算表达式
+func (p *Program) EvalMsg(msg types.RuleMsg) (interface{}, error) {
+	return p.Eval(NewEnv(msg))
+}
+
+// Path 字段路径
+type Path struct {
+	// Scope 字段所在范围：msg、metadata或者msgType
+	Scope string
+	// Keys 字段名称和数组下标，元素为string(对象字段)或者int(数组下标)
+	Keys []interface{}
+}
+
+// ParsePath 解析字段路径，语法和表达式的字段访问相同，但是必须以msg、$、metadata或者msgType开头，下标必须是常量
+// 例如：$.items[0]、msg['a.b']、metadata.deviceType、msgType
+func ParsePath(src string) (*Path, error) {
+	p := &parser{lexer: lexer{input: src}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokIdent || !isPathRoot(p.tok.text) {
+		return nil, fmt.Errorf("path %s must start with $, msg, metadata or msgType", src)
+	}
+	n, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok.text)
+	}
+	path := &Path{}
+	for path.Scope == "" {
+		switch t := n.(type) {
+		case msgNode:
+			path.Scope = types.MsgKey
+		case metadataNode:
+			path.Scope = types.MetadataKey
+		case msgTypeNode:
+			path.Scope = types.MsgTypeKey
+		case *memberNode:
+			key, err := constantKey(t.key)
+			if err != nil {
+				return nil, fmt.Errorf("path %s %w", src, err)
+			}
+			path.Keys = append(path.Keys, key)
+			n = t.target
+		default:
+			return nil, fmt.Errorf("invalid path %s", src)
+		}
+	}
+	if path.Scope == types.MsgTypeKey && len(path.Keys) > 0 {
+		return nil, fmt.Errorf("path %s, msgType has no field", src)
+	}
+	// 从外到内解析，反转成从根开始的顺序
+	for i, j := 0, len(path.Keys)-1; i < j; i, j = i+1, j-1 {
+		path.Keys[i], path.Keys[j] = path.Keys[j], path.Keys[i]
+	}
+	return path, nil
+}
+
+func isPathRoot(name string) bool {
+	switch name {
+	case types.MsgKey, "$", types.MetadataKey, types.MsgTypeKey:
+		return true
+	}
+	return false
+}
+
+// constantKey 计算常量字段名或者下标
+func constantKey(n node) (interface{}, error) {
+	if !isConstant(n) {
+		return nil, errors.New("key must be constant")
+	}
+	v, err := n.eval(nil)
+	if err != nil {
+		return nil, err
+	}
+	switch k := v.(type) {
+	case string:
+		return k, nil
+	case float64:
+		if k == math.Trunc(k) {
+			return int(k), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid key %v", v)
+}
+
+// isConstant 是否是常量，例如：'a'、1、-1
+func isConstant(n node) bool {
+	switch t := n.(type) {
+	case *literalNode:
+		return true
+	case *arithNode:
+		return isConstant(t.left) && isConstant(t.right)
+	}
+	return false
+}
+
+// ---------- 词法分析 ----------
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+// 运算符，长的在前
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && (l.input[l.pos] == ' ' || l.input[l.pos] == '\t' || l.input[l.pos] == '\n' || l.input[l.pos] == '\r') {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokEOF, text: "EOF", pos: start}, nil
+	}
+	c := l.input[l.pos]
+	switch {
+	case c >= '0' && c <= '9':
+		for l.pos < len(l.input) && (isDigit(l.input[l.pos]) || l.input[l.pos] == '.' ||
+			l.input[l.pos] == 'e' || l.input[l.pos] == 'E' ||
+			((l.input[l.pos] == '+' || l.input[l.pos] == '-') && (l.input[l.pos-1] == 'e' || l.input[l.pos-1] == 'E'))) {
+			l.pos++
+		}
+		return token{kind: tokNumber, text: l.input[start:l.pos], pos: start}, nil
+	case c == '\'' || c == '"':
+		var b strings.Builder
+		l.pos++
+		for l.pos < len(l.input) {
+			ch := l.input[l.pos]
+			if ch == c {
+				l.pos++
+				return token{kind: tokString, text: b.String(), pos: start}, nil
+			}
+			if ch == '\\' && l.pos+1 < len(l.input) {
+				l.pos++
+				switch esc := l.input[l.pos]; esc {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case 'r':
+					b.WriteByte('\r')
+				default:
+					// 其他转义字符保持原样，例如正则表达式中的\d
+					if esc != '\\' && esc != '\'' && esc != '"' {
+						b.WriteByte('\\')
+					}
+					b.WriteByte(esc)
+				}
+				l.pos++
+				continue
+			}
+			b.WriteByte(ch)
+			l.pos++
+		}
+		return token{}, fmt.Errorf("unterminated string at %d", start)
+	case isIdentStart(c):
+		for l.pos < len(l.input) && (isIdentStart(l.input[l.pos]) || isDigit(l.input[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.input[start:l.pos], pos: start}, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// ---------- 语法分析 ----------
+
+type parser struct {
+	lexer lexer
+	tok   token
+}
+
+func (p *parser) next() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), p.tok.pos)
+}
+
+// isOp 当前是否是指定运算符或者关键字
+func (p *parser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp && p.tok.kind != tokIdent {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if p.tok.kind != tokOp || p.tok.text != op {
+		return p.errorf("expected %s but found %s", op, p.tok.text)
+	}
+	return p.next()
+}
+
+func (p *parser) parseExpr() (node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||", "or") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&", "and") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=", "=~", "!~", "in", "not") {
+		return left, nil
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if op == "not" {
+		// not in
+		if !p.isOp("in") {
+			return nil, p.errorf("expected in but found %s", p.tok.text)
+		}
+		op = "not in"
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "=~", "!~":
+		return p.newMatchNode(left, right, op == "!~")
+	case "in", "not in":
+		return &inNode{left: left, right: right, not: op == "not in"}, nil
+	}
+	return &compareNode{op: op, left: left, right: right}, nil
+}
+
+// newMatchNode 创建正则匹配节点，常量正则表达式在编译期编译
+func (p *parser) newMatchNode(left, right node, not bool) (node, error) {
+	n := &matchNode{left: left, right: right, not: not}
+	if lit, ok := right.(*literalNode); ok {
+		pattern, ok := lit.value.(string)
+		if !ok {
+			return nil, p.errorf("regex must be string")
+		}
+		var err error
+		if n.re, err = regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "+" || p.tok.text == "-") {
+		op := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "*" || p.tok.text == "/" || p.tok.text == "%") {
+		op := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("!", "not") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if p.tok.kind == tokOp && p.tok.text == "-" {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithNode{op: "-", left: &literalNode{value: float64(0)}, right: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp && (p.tok.text == "." || p.tok.text == "[") {
+		if p.tok.text == "." {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected field name but found %s", p.tok.text)
+			}
+			n = &memberNode{target: n, key: &literalNode{value: p.tok.text}}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			n = &memberNode{target: n, key: key}
+		}
+	}
+	return n, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", tok.text)
+		}
+		return &literalNode{value: f}, p.next()
+	case tokString:
+		return &literalNode{value: tok.text}, p.next()
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null", "nil":
+			return &literalNode{value: nil}, nil
+		}
+		if p.tok.kind == tokOp && p.tok.text == "(" {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case types.MsgKey, "$":
+			return msgNode{}, nil
+		case types.MetadataKey:
+			return metadataNode{}, nil
+		case types.MsgTypeKey:
+			return msgTypeNode{}, nil
+		}
+		// 其他标识符表示msg中的字段
+		return &memberNode{target: msgNode{}, key: &literalNode{value: tok.text}}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			n, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	}
+	return nil, p.errorf("unexpected %s", tok.text)
+}
+
+// parseList 解析逗号分隔的表达式列表，直到结束符
+func (p *parser) parseList(end string) ([]node, error) {
+	var items []node
+	if p.tok.kind == tokOp && p.tok.text == end {
+		return items, p.next()
+	}
+	for {
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.tok.kind == tokOp && p.tok.text == "," {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return items, p.expect(end)
+	}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, ok := GetFunc(name.text)
+	if !ok {
+		return nil, fmt.Errorf("function %s not found at %d", name.text, name.pos)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	args, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	if name.text == "matches" && len(args) == 2 && isBuiltinFunc(name.text) {
+		// 内置matches函数的常量正则表达式在编译期编译
+		if _, ok := args[1].(*literalNode); ok {
+			return p.newMatchNode(args[0], args[1], false)
+		}
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+// ---------- 语法树求值 ----------
+
+type node interface {
+	eval(env *Env) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(_ *Env) (interface{}, error) {
+	return n.value, nil
+}
+
+type msgNode struct{}
+
+func (n msgNode) eval(env *Env) (interface{}, error) {
+	return normalize(env.msgData()), nil
+}
+
+type metadataNode struct{}
+
+func (n metadataNode) eval(env *Env) (interface{}, error) {
+	return env.metadataMap(), nil
+}
+
+type msgTypeNode struct{}
+
+func (n msgTypeNode) eval(env *Env) (interface{}, error) {
+	return env.msg.Type, nil
+}
+
+type listNode struct {
+	items []node
+}
+
+func (n *listNode) eval(env *Env) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// memberNode 字段或者下标访问，不存在返回null
+type memberNode struct {
+	target node
+	key    node
+}
+
+func (n *memberNode) eval(env *Env) (interface{}, error) {
+	// 元数据字段直接获取，不需要转换成map
+	if _, ok := n.target.(metadataNode); ok {
+		if lit, ok := n.key.(*literalNode); ok {
+			if key, ok := lit.value.(string); ok {
+				if env.msg.Metadata.Has(key) {
+					return env.msg.Metadata.GetValue(key), nil
+				}
+				return nil, nil
+			}
+		}
+	}
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case map[string]interface{}:
+		return normalize(t[toString(key)]), nil
+	case []interface{}:
+		f, ok := toNumber(key)
+		if !ok {
+			return nil, nil
+		}
+		i := int(f)
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return nil, nil
+		}
+		return normalize(t[i]), nil
+	}
+	return nil, nil
+}
+
+type callNode struct {
+	name string
+	fn   Func
+	args []node
+}
+
+func (n *callNode) eval(env *Env) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, item := range n.args {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	v, err := n.fn(args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n *orNode) eval(env *Env) (interface{}, error) {
+	v, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(v) {
+		return true, nil
+	}
+	v, err = n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(v), nil
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n *andNode) eval(env *Env) (interface{}, error) {
+	v, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if !truthy(v) {
+		return false, nil
+	}
+	v, err = n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(v), nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(env *Env) (interface{}, error) {
+	v, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env *Env) (interface{}, error) {
+	a, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(a, b), nil
+	case "!=":
+		return !equal(a, b), nil
+	}
+	// 和null比较大小为false
+	if a == nil || b == nil {
+		return false, nil
+	}
+	c, err := compare(a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+type inNode struct {
+	left, right node
+	not         bool
+}
+
+func (n *inNode) eval(env *Env) (interface{}, error) {
+	a, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return contains(b, a) != n.not, nil
+}
+
+type matchNode struct {
+	left, right node
+	re          *regexp.Regexp
+	not         bool
+}
+
+func (n *matchNode) eval(env *Env) (interface{}, error) {
+	a, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	re := n.re
+	if re == nil {
+		pattern, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		// 动态正则表达式每次求值都重新编译，不做缓存，防止内存无限增长
+		if re, err = regexp.Compile(toString(pattern)); err != nil {
+			return nil, err
+		}
+	}
+	if a == nil {
+		return n.not, nil
+	}
+	return re.MatchString(toString(a)) != n.not, nil
+}
+
+type arithNode struct {
+	op          string
+	left, right node
+}
+
+func (n *arithNode) eval(env *Env) (interface{}, error) {
+	a, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "+" {
+		// 有一边是非数字字符串时，拼接字符串
+		_, aStr := a.(string)
+		_, bStr := b.(string)
+		if aStr || bStr {
+			if x, ok := toNumber(a); ok {
+				if y, ok := toNumber(b); ok {
+					return x + y, nil
+				}
+			}
+			return toString(a) + toString(b), nil
+		}
+	}
+	x, ok := toNumber(a)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", a)
+	}
+	y, ok := toNumber(b)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", b)
+	}
+	switch n.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return x / y, nil
+	default:
+		if y == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return math.Mod(x, y), nil
+	}
+}
+
+// ---------- 类型转换 ----------
+
+// normalize 把json.Number转换成float64
+func normalize(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return n.String()
+	}
+	return v
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []interface{}:
+		return len(t) > 0
+	case map[string]interface{}:
+		return len(t) > 0
+	}
+	return true
+}
+
+// toNumber 转换成数字，支持数字字符串
+func toNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		// 不把Inf、NaN等字符串当作数字
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	case map[string]interface{}, []interface{}:
+		s, _ := json2.MarshalValue(t)
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	_, aNum := a.(float64)
+	_, bNum := b.(float64)
+	if aNum || bNum {
+		x, ok1 := toNumber(a)
+		y, ok2 := toNumber(b)
+		return ok1 && ok2 && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare 比较大小，数字和数字字符串按数字比较，字符串按字典序比较
+func compare(a, b interface{}) (int, error) {
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if aStr && bStr {
+		return strings.Compare(a.(string), b.(string)), nil
+	}
+	x, ok1 := toNumber(a)
+	y, ok2 := toNumber(b)
+	if !ok1 || !ok2 {
+		return 0, fmt.Errorf("can't compare %v and %v", a, b)
+	}
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// contains 数组包含元素、对象包含key或者字符串包含子串
+func contains(container, item interface{}) bool {
+	switch t := container.(type) {
+	case []interface{}:
+		for _, v := range t {
+			if equal(normalize(v), item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		_, ok := t[toString(item)]
+		return ok
+	case string:
+		return item != nil && strings.Contains(t, toString(item))
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expr
+
+import (
+	"testing"
+
+	"github.com/xyzbit/rulego/api/types"
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+func TestEval(t *testing.T) {
+	metaData := types.NewMetadata()
+	metaData.PutValue("deviceType", "sensor")
+	metaData.PutValue("threshold", "40")
+	metaData.PutValue("a.b", "dot")
+	msg := types.NewMsg(0, "TELEMETRY", types.JSON, metaData, `{"temperature":41.5,"name":" Dev-01 ","tags":["a","b"],"device":{"id":"d1","online":true},"items":[{"v":1},{"v":2}],"empty":"","nil":null}`)
+	env := NewEnv(msg)
+
+	testCases := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"temperature > 40 && metadata.deviceType == 'sensor'", true},
+		{"msg.temperature > 50 || metadata.deviceType != 'sensor'", false},
+		{"temperature >= metadata.threshold", true},
+		{"metadata.threshold == 40", true},
+		{"metadata['a.b'] == \"dot\"", true},
+		{"msgType in ['TELEMETRY', 'ATTRIBUTES']", true},
+		{"msgType not in ['TELEMETRY']", false},
+		{"'a' in tags && !('c' in tags)", true},
+		{"'id' in device && 'Dev' in name", true},
+		{"device.id =~ '^d\\d+$'", true},
+		{"device.id !~ '^x'", true},
+		{"device.online and not nil", true},
+		{"notFound == null && nil == null && isNull(device.notFound.x)", true},
+		{"notFound > 1 || notFound < 1", false},
+		{"items[1].v + items[-1].v * 2 - 1", float64(5)},
+		{"items[5].v", nil},
+		{"temperature % 10", 1.5},
+		{"-temperature", -41.5},
+		{"(1 + 2) * 3 / 2", 4.5},
+		{"'t=' + temperature", "t=41.5"},
+		{"metadata.threshold + 1", float64(41)},
+		{"len(tags) == 2 && len(name) == 8 && len(nil) == 0", true},
+		{"upper(trim(name)) == 'DEV-01' && lower('A') == 'a'", true},
+		{"urlEncode('a b&c')", "a+b%26c"},
+		{"formatTime(1697500000000, 'Jan') + formatTime('2023-10-01T08:00:00Z', '2006-01-02')", "Oct2023-10-01"},
+		{"now() > 0 && len(now('2006')) == 4", true},
+		{"contains(name, 'Dev') && startsWith(device.id, 'd') && endsWith(device.id, '1')", true},
+		{"matches(metadata.deviceType, '^sen')", true},
+		{"abs(-1.5) + ceil(1.2) + floor(1.8)", 4.5},
+		{"round(41.567, 2)", 41.57},
+		{"round(temperature)", float64(42)},
+		{"min(3, 1, 2) + max(2, 5)", float64(6)},
+		{"max([1, 3, 2])", float64(3)},
+		{"int('12.9') + float('0.5')", 12.5},
+		{"string(temperature) == '41.5'", true},
+		{"isEmpty(empty) && isEmpty(nil) && !isEmpty(tags)", true},
+		{"msg.device.id", "d1"},
+		{"true == !false", true},
+		{"'b' < 'a'", false},
+	}
+	for _, item := range testCases {
+		program, err := Compile(item.expr)
+		assert.Nil(t, err)
+		v, err := program.Eval(env)
+		assert.Nil(t, err)
+		assert.Equal(t, item.expected, v)
+	}
+
+	ok, err := MustCompile("tags").EvalBool(env)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = MustCompile("empty").EvalBool(env)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	v, err := MustCompile("metadata").EvalMsg(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "sensor", v.(map[string]interface{})["deviceType"])
+}
+
+func TestEvalText(t *testing.T) {
+	msg := types.NewMsg(0, "TEXT", types.TEXT, types.NewMetadata(), "hello world")
+	v, err := MustCompile("msg =~ 'world$' && len(msg) == 11 && temperature == null").EvalMsg(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, true, v)
+}
+
+func TestEvalError(t *testing.T) {
+	msg := types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"a":1,"s":"x","b":true}`)
+	for _, item := range []string{"a / 0", "a % 0", "s * 2", "b > 1", "round(s)", "msg =~ s + '('"} {
+		program, err := Compile(item)
+		assert.Nil(t, err)
+		_, err = program.EvalMsg(msg)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, item := range []string{"", "a >", "(a", "a b", "notFound(a)", "a =~ '('", "a =~ 1", "'abc", "a not b", "a.1", "[1, 2", "1.2.3", "a # b", "a > 1 > 2", "matches(a, '(')"} {
+		_, err := Compile(item)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	for src, expected := range map[string]Path{
+		"$":                   {Scope: types.MsgKey},
+		"msg":                 {Scope: types.MsgKey},
+		"$.a.b[0]":            {Scope: types.MsgKey, Keys: []interface{}{"a", "b", 0}},
+		"msg['a.b'][-1]":      {Scope: types.MsgKey, Keys: []interface{}{"a.b", -1}},
+		"metadata.deviceType": {Scope: types.MetadataKey, Keys: []interface{}{"deviceType"}},
+		"metadata['a b']":     {Scope: types.MetadataKey, Keys: []interface{}{"a b"}},
+		"msgType":             {Scope: types.MsgTypeKey},
+	} {
+		path, err := ParsePath(src)
+		assert.Nil(t, err)
+		assert.Equal(t, expected.Scope, path.Scope)
+		assert.Equal(t, len(expected.Keys), len(path.Keys))
+		for i, key := range expected.Keys {
+			assert.Equal(t, key, path.Keys[i])
+		}
+	}
+	for _, item := range []string{"", "a.b", "$a", "$.a[", "$.a[b]", "$.a[1.5]", "$.a + 1", "msgType.a", "upper(msg)", "'a'"} {
+		_, err := ParsePath(item)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestMatchesRegexp(t *testing.T) {
+	//常量正则表达式在编译期编译
+	program := MustCompile("matches(a, '^d\\d+$')")
+	_, ok := program.root.(*matchNode)
+	assert.True(t, ok)
+	//动态正则表达式每次求值编译
+	msg := types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"a":"d12","p":"^d[0-9]+$"}`)
+	for _, item := range []string{"matches(a, '^d\\d+$')", "matches(a, p)", "a =~ p", "!matches(b, p)"} {
+		v, err := MustCompile(item).EvalMsg(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, true, v)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	RegisterFunc("double", func(args ...interface{}) (interface{}, error) {
+		x, _ := toNumber(args[0])
+		return x * 2, nil
+	})
+	v, err := MustCompile("double(a) == 4").EvalMsg(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), `{"a":2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, true, v)
+}
+
+func BenchmarkEval(b *testing.B) {
+	metaData := types.NewMetadata()
+	metaData.PutValue("deviceType", "sensor")
+	msg := types.NewMsg(0, "TELEMETRY", types.JSON, metaData, `{"temperature":41.5,"humidity":80}`)
+	program := MustCompile("temperature > 40 && metadata.deviceType == 'sensor'")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := program.EvalBool(NewEnv(msg)); err != nil || !ok {
+			b.Fatal(ok, err)
+		}
+	}
+}
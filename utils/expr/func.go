@@ -0,0 +1,283 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Func 表达式函数，同时用于utils/el占位符表达式
+// 参数：数字为float64，字符串为string，对象为map[string]interface{}，数组为[]interface{}，不存在为nil
+// 占位符表达式中参数都是字符串，返回值通过字符串替换占位符
+type Func func(args ...interface{}) (interface{}, error)
+
+var (
+	funcs   = make(map[string]Func)
+	funcsMu sync.RWMutex
+	// 已被RegisterFunc覆盖的内置函数名
+	overridden = make(map[string]bool)
+)
+
+func init() {
+	RegisterFunc("len", length)
+	RegisterFunc("lower", stringFunc(strings.ToLower))
+	RegisterFunc("upper", stringFunc(strings.ToUpper))
+	RegisterFunc("trim", stringFunc(strings.TrimSpace))
+	RegisterFunc("urlEncode", stringFunc(url.QueryEscape))
+	RegisterFunc("contains", stringPredicate(strings.Contains))
+	RegisterFunc("startsWith", stringPredicate(strings.HasPrefix))
+	RegisterFunc("endsWith", stringPredicate(strings.HasSuffix))
+	RegisterFunc("matches", matches)
+	RegisterFunc("abs", numberFunc(math.Abs))
+	RegisterFunc("ceil", numberFunc(math.Ceil))
+	RegisterFunc("floor", numberFunc(math.Floor))
+	RegisterFunc("round", round)
+	RegisterFunc("min", minMax(true))
+	RegisterFunc("max", minMax(false))
+	RegisterFunc("int", numberFunc(math.Trunc))
+	RegisterFunc("float", numberFunc(func(f float64) float64 { return f }))
+	RegisterFunc("string", toStringFunc)
+	RegisterFunc("isNull", isNull)
+	RegisterFunc("isEmpty", isEmpty)
+	RegisterFunc("now", now)
+	RegisterFunc("formatTime", formatTime)
+	// 以上为内置函数
+	overridden = make(map[string]bool)
+}
+
+// RegisterFunc 注册函数，同名函数会被覆盖
+// 需要在编译表达式前注册
+func RegisterFunc(name string, fn Func) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	funcs[name] = fn
+	overridden[name] = true
+}
+
+// isBuiltinFunc 函数是否是内置函数并且没有被覆盖
+func isBuiltinFunc(name string) bool {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	_, ok := funcs[name]
+	return ok && !overridden[name]
+}
+
+// GetFunc 获取函数
+func GetFunc(name string) (Func, bool) {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	fn, ok := funcs[name]
+	return fn, ok
+}
+
+func checkArgs(args []interface{}, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	return nil
+}
+
+// length 字符串字符数、数组或者对象元素个数，null为0
+func length(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	switch t := args[0].(type) {
+	case nil:
+		return float64(0), nil
+	case string:
+		return float64(len([]rune(t))), nil
+	case []interface{}:
+		return float64(len(t)), nil
+	case map[string]interface{}:
+		return float64(len(t)), nil
+	}
+	return float64(len([]rune(toString(args[0])))), nil
+}
+
+// stringFunc 把单参数字符串函数转换成Func
+func stringFunc(f func(string) string) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+		return f(toString(args[0])), nil
+	}
+}
+
+// stringPredicate 把字符串判断函数转换成Func，参数：s, substr
+func stringPredicate(f func(s, substr string) bool) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 2); err != nil {
+			return nil, err
+		}
+		if args[0] == nil {
+			return false, nil
+		}
+		return f(toString(args[0]), toString(args[1])), nil
+	}
+}
+
+// matches 正则匹配，参数：s, pattern
+// pattern为常量时在编译表达式时转换成matchNode，这里只处理动态正则表达式，每次调用都重新编译
+func matches(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(toString(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	return args[0] != nil && re.MatchString(toString(args[0])), nil
+}
+
+// numberFunc 把单参数数字函数转换成Func，支持数字字符串
+func numberFunc(f func(float64) float64) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := checkArgs(args, 1); err != nil {
+			return nil, err
+		}
+		x, ok := toNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number", args[0])
+		}
+		return f(x), nil
+	}
+}
+
+// round 四舍五入，参数：value, [places]，places 保留小数位数，默认：0
+func round(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+	x, ok := toNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", args[0])
+	}
+	if len(args) == 1 {
+		return math.Round(x), nil
+	}
+	places, ok := toNumber(args[1])
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", args[1])
+	}
+	p := math.Pow(10, math.Trunc(places))
+	return math.Round(x*p) / p, nil
+}
+
+// minMax 最小值或者最大值，参数可以是多个数字或者一个数组
+func minMax(min bool) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) == 1 {
+			if list, ok := args[0].([]interface{}); ok {
+				args = list
+			}
+		}
+		if len(args) == 0 {
+			return nil, errors.New("expected at least 1 argument")
+		}
+		var result float64
+		for i, item := range args {
+			x, ok := toNumber(normalize(item))
+			if !ok {
+				return nil, fmt.Errorf("%v is not a number", item)
+			}
+			if i == 0 || (min && x < result) || (!min && x > result) {
+				result = x
+			}
+		}
+		return result, nil
+	}
+}
+
+func toStringFunc(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	return toString(args[0]), nil
+}
+
+// isNull 是否为null或者不存在
+func isNull(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	return args[0] == nil, nil
+}
+
+// isEmpty 是否为null、空字符串、空数组或者空对象
+func isEmpty(args ...interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1); err != nil {
+		return nil, err
+	}
+	switch t := args[0].(type) {
+	case nil:
+		return true, nil
+	case string:
+		return t == "", nil
+	case []interface{}:
+		return len(t) == 0, nil
+	case map[string]interface{}:
+		return len(t) == 0, nil
+	}
+	return false, nil
+}
+
+// now 当前时间，参数：[layout]
+// 没有layout返回毫秒时间戳，否则返回按layout(Go时间格式)格式化的字符串
+func now(args ...interface{}) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected 0 or 1 arguments, got %d", len(args))
+	}
+	if len(args) == 1 {
+		return time.Now().Format(toString(args[0])), nil
+	}
+	return float64(time.Now().UnixMilli()), nil
+}
+
+// formatTime 格式化时间，参数：value, [layout]
+// value 支持毫秒/秒时间戳或者RFC3339格式的时间，layout为Go时间格式，默认:RFC3339
+func formatTime(args ...interface{}) (interface{}, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+	layout := time.RFC3339
+	if len(args) == 2 && toString(args[1]) != "" {
+		layout = toString(args[1])
+	}
+	var t time.Time
+	value := toString(normalize(args[0]))
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// 大于该值认为是毫秒时间戳
+		if ts > 1e11 {
+			t = time.UnixMilli(ts)
+		} else {
+			t = time.Unix(ts, 0)
+		}
+	} else if t, err = time.Parse(time.RFC3339, value); err != nil {
+		return nil, err
+	}
+	return t.Format(layout), nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// AppendLog 追加写JSON行文件
+// 每条记录以一行JSON追加到文件末尾，打开时按顺序回放文件中的记录，可以通过Rewrite只保留有效记录重写文件
+// 不是并发安全的，由调用方加锁
+type AppendLog[T any] struct {
+	path string
+	file *os.File
+}
+
+// OpenAppendLog 打开追加写文件，文件不存在则创建
+// replay 按写入顺序回放文件中的记录，写入不完整的行会被跳过
+func OpenAppendLog[T any](path string, replay func(record T)) (*AppendLog[T], error) {
+	if err := replayLog(path, replay); err != nil {
+		return nil, err
+	}
+	l := &AppendLog[T]{path: path}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func replayLog[T any](path string, replay func(record T)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var record T
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 跳过写入不完整的行
+			continue
+		}
+		replay(record)
+	}
+	return scanner.Err()
+}
+
+func (l *AppendLog[T]) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	return nil
+}
+
+// Append 追加一条记录
+func (l *AppendLog[T]) Append(record T) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(b, '\n'))
+	return err
+}
+
+// Rewrite 使用records重写文件，先写临时文件再替换，重写失败原文件不变
+func (l *AppendLog[T]) Rewrite(records []T) error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	rewriteErr := l.rewrite(records)
+	if err := l.open(); err != nil {
+		return err
+	}
+	return rewriteErr
+}
+
+func (l *AppendLog[T]) rewrite(records []T) error {
+	tmp := l.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, record := range records {
+		b, err := json.Marshal(record)
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		_, _ = writer.Write(append(b, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// Close 关闭文件
+func (l *AppendLog[T]) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+type testRecord struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+}
+
+func TestAppendLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	log, err := OpenAppendLog(path, func(record testRecord) {
+		t.Fatal("empty file should not replay records")
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, log.Append(testRecord{Key: "a", Value: 1}))
+	assert.Nil(t, log.Append(testRecord{Key: "b", Value: 2}))
+	assert.Nil(t, log.Close())
+	//模拟写入不完整的行
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, _ = file.WriteString(`{"key":"c",`)
+	assert.Nil(t, file.Close())
+
+	var records []testRecord
+	log, err = OpenAppendLog(path, func(record testRecord) {
+		records = append(records, record)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []testRecord{{Key: "a", Value: 1}, {Key: "b", Value: 2}}, records)
+
+	//重写后可以继续追加
+	assert.Nil(t, log.Rewrite([]testRecord{{Key: "b", Value: 2}}))
+	assert.Nil(t, log.Append(testRecord{Key: "d", Value: 4}))
+	assert.Nil(t, log.Close())
+	records = nil
+	log, err = OpenAppendLog(path, func(record testRecord) {
+		records = append(records, record)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []testRecord{{Key: "b", Value: 2}, {Key: "d", Value: 4}}, records)
+	assert.Nil(t, log.Close())
+}
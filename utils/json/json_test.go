@@ -19,6 +19,7 @@ package json
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -40,3 +41,76 @@ func TestMarshal(t *testing.T) {
 	v, _ = Marshal(user)
 	fmt.Println(string(v))
 }
+
+func TestUnmarshalValue(t *testing.T) {
+	for _, item := range []string{`{"a":[1,{"b":null}],"c":1.50,"d":"x\"<>&\n"}`, `[]`, `"abc"`, `-0.5E+10`, `true`, `12345678901234567890`} {
+		v, err := UnmarshalValue(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := MarshalValue(v)
+		if err != nil || out != item {
+			t.Fatalf("%s != %s err=%v", out, item, err)
+		}
+	}
+	for _, item := range []string{"", " ", "{", "{}x", "{} {}", "[1,2", `{"a":1`, `{"a":`, "tru", "1.2.3", "01", "1.", `"ab`, `{"a":1,}`, `[1,]`, "\"a\tb\"", `"\x"`, `"\u12"`} {
+		if _, err := UnmarshalValue(item); err == nil {
+			t.Fatalf("%s should be invalid", item)
+		}
+	}
+	// 转义字符和encoding/json一致
+	for _, item := range []string{`"a\"\\\/\b\f\n\r\t"`, `"\u4e2d\u6587"`, `"\ud83d\ude00"`, `"\ud83dx"`, `"\ude00\ud83d\ude00"`, `{"\u0061":"中文"}`} {
+		v, err := UnmarshalValue(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected interface{}
+		_ = json.Unmarshal([]byte(item), &expected)
+		if !reflect.DeepEqual(expected, v) {
+			t.Fatalf("%s: %v != %v", item, v, expected)
+		}
+	}
+}
+
+func TestUnmarshalValueTo(t *testing.T) {
+	object := make(map[string]interface{})
+	v, err := UnmarshalValueTo(`{"a":{"b":1}}`, object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object["c"] = true
+	out, _ := MarshalValue(v)
+	if out != `{"a":{"b":1},"c":true}` {
+		t.Fatalf("top-level object should be decoded into object, got %s", out)
+	}
+	// 不是对象时不使用object
+	v, err = UnmarshalValueTo(`[{"a":1}]`, make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ = MarshalValue(v)
+	if out != `[{"a":1}]` {
+		t.Fatalf("%s != [{\"a\":1}]", out)
+	}
+}
+
+func TestMarshalValue(t *testing.T) {
+	v := map[string]interface{}{"a\"b": "x\\y\n\r\t\b\f\x01\x1f<>&\u2028\u2029\xff中文", "z": []interface{}{nil, true, "s", 1, int64(2)}, "f": 1.5, "n": 1e21}
+	out, err := MarshalValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := Marshal(v)
+	if out != string(expected) {
+		t.Fatalf("%s != %s", out, expected)
+	}
+	// 字段较多的对象
+	for i := 0; i < 30; i++ {
+		v[fmt.Sprintf("k%d", i)] = i
+	}
+	out, _ = MarshalValue(v)
+	expected, _ = Marshal(v)
+	if out != string(expected) {
+		t.Fatalf("%s != %s", out, expected)
+	}
+}
@@ -0,0 +1,535 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var valueJson = jsoniter.Config{UseNumber: true, SortMapKeys: true, EscapeHTML: false}.Froze()
+
+// UnmarshalValue 解析JSON，对象解析成map[string]interface{}，数组解析成[]interface{}，数字解析成json.Number保留精度
+// 直接解析字符串，没有转义字符的字符串和数字不复制数据，比Unmarshal到interface{}更快
+func UnmarshalValue(data string) (interface{}, error) {
+	return UnmarshalValueTo(data, nil)
+}
+
+// UnmarshalValueTo 和UnmarshalValue相同，如果JSON是对象，则解析到空的object中，用于复用map
+func UnmarshalValueTo(data string, object map[string]interface{}) (interface{}, error) {
+	d := decoder{data: data, object: object}
+	d.skipSpace()
+	value, err := d.readValue(0)
+	if err != nil {
+		return nil, err
+	}
+	d.skipSpace()
+	if d.pos < len(d.data) {
+		return nil, d.syntaxError("invalid data after top-level value")
+	}
+	return value, nil
+}
+
+// maxDepth 对象和数组最大嵌套层数，和encoding/json一致
+const maxDepth = 10000
+
+// decoder JSON解析器
+type decoder struct {
+	data string
+	pos  int
+	// object 顶层对象使用的map
+	object map[string]interface{}
+}
+
+func (d *decoder) syntaxError(msg string) error {
+	if d.pos >= len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%s at offset %d", msg, d.pos)
+}
+
+func (d *decoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (d *decoder) readValue(depth int) (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch c := d.data[d.pos]; {
+	case c == '{':
+		return d.readObject(depth + 1)
+	case c == '[':
+		return d.readArray(depth + 1)
+	case c == '"':
+		return d.readString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return d.readNumber()
+	case c == 't':
+		return true, d.readLiteral("true")
+	case c == 'f':
+		return false, d.readLiteral("false")
+	case c == 'n':
+		return nil, d.readLiteral("null")
+	}
+	return nil, d.syntaxError("invalid json value")
+}
+
+func (d *decoder) readObject(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, d.syntaxError("exceeded max depth")
+	}
+	d.pos++
+	m := d.object
+	if depth > 1 || m == nil {
+		m = make(map[string]interface{})
+	}
+	d.skipSpace()
+	if d.pos < len(d.data) && d.data[d.pos] == '}' {
+		d.pos++
+		return m, nil
+	}
+	for {
+		d.skipSpace()
+		if d.pos >= len(d.data) || d.data[d.pos] != '"' {
+			return nil, d.syntaxError("expected object key")
+		}
+		key, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		d.skipSpace()
+		if d.pos >= len(d.data) || d.data[d.pos] != ':' {
+			return nil, d.syntaxError("expected colon after object key")
+		}
+		d.pos++
+		d.skipSpace()
+		value, err := d.readValue(depth)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+		d.skipSpace()
+		if d.pos >= len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		switch d.data[d.pos] {
+		case ',':
+			d.pos++
+		case '}':
+			d.pos++
+			return m, nil
+		default:
+			return nil, d.syntaxError("expected comma or } after object value")
+		}
+	}
+}
+
+func (d *decoder) readArray(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, d.syntaxError("exceeded max depth")
+	}
+	d.pos++
+	s := make([]interface{}, 0)
+	d.skipSpace()
+	if d.pos < len(d.data) && d.data[d.pos] == ']' {
+		d.pos++
+		return s, nil
+	}
+	for {
+		d.skipSpace()
+		value, err := d.readValue(depth)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, value)
+		d.skipSpace()
+		if d.pos >= len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		switch d.data[d.pos] {
+		case ',':
+			d.pos++
+		case ']':
+			d.pos++
+			return s, nil
+		default:
+			return nil, d.syntaxError("expected comma or ] after array element")
+		}
+	}
+}
+
+// readString 读取字符串，没有转义字符时直接返回原数据的子串
+func (d *decoder) readString() (string, error) {
+	d.pos++
+	start := d.pos
+	for d.pos < len(d.data) {
+		switch c := d.data[d.pos]; {
+		case c == '"':
+			d.pos++
+			return d.data[start : d.pos-1], nil
+		case c == '\\':
+			return d.readEscapedString(start)
+		case c < 0x20:
+			return "", d.syntaxError("invalid character in string")
+		}
+		d.pos++
+	}
+	return "", io.ErrUnexpectedEOF
+}
+
+// readEscapedString 读取包含转义字符的字符串，转义规则和encoding/json一致
+func (d *decoder) readEscapedString(start int) (string, error) {
+	var b strings.Builder
+	b.WriteString(d.data[start:d.pos])
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		switch {
+		case c == '"':
+			d.pos++
+			return b.String(), nil
+		case c < 0x20:
+			return "", d.syntaxError("invalid character in string")
+		case c != '\\':
+			b.WriteByte(c)
+			d.pos++
+			continue
+		}
+		d.pos++
+		if d.pos >= len(d.data) {
+			return "", io.ErrUnexpectedEOF
+		}
+		switch esc := d.data[d.pos]; esc {
+		case '"', '\\', '/':
+			b.WriteByte(esc)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			r, ok := d.readHex()
+			if !ok {
+				return "", d.syntaxError("invalid unicode escape in string")
+			}
+			if utf16.IsSurrogate(r) {
+				// 代理对，不成对时替换成U+FFFD
+				r = d.readSurrogate(r)
+			}
+			b.WriteRune(r)
+		default:
+			return "", d.syntaxError("invalid escape in string")
+		}
+		d.pos++
+	}
+	return "", io.ErrUnexpectedEOF
+}
+
+// readSurrogate 读取代理对的低位，不成对时返回U+FFFD，不读取后面的转义字符
+func (d *decoder) readSurrogate(high rune) rune {
+	pos := d.pos
+	if strings.HasPrefix(d.data[d.pos+1:], `\u`) {
+		d.pos += 2
+		if low, ok := d.readHex(); ok {
+			if r := utf16.DecodeRune(high, low); r != unicode.ReplacementChar {
+				return r
+			}
+		}
+	}
+	d.pos = pos
+	return unicode.ReplacementChar
+}
+
+// readHex 读取\u后面的4位16进制数，读取后pos指向最后一位
+func (d *decoder) readHex() (rune, bool) {
+	if d.pos+4 >= len(d.data) {
+		return 0, false
+	}
+	var r rune
+	for _, c := range []byte(d.data[d.pos+1 : d.pos+5]) {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r*16 + rune(c)
+	}
+	d.pos += 4
+	return r, true
+}
+
+func (d *decoder) readNumber() (interface{}, error) {
+	start := d.pos
+	for d.pos < len(d.data) {
+		c := d.data[d.pos]
+		if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+		d.pos++
+	}
+	number := d.data[start:d.pos]
+	if !validNumber(number) {
+		d.pos = start
+		return nil, d.syntaxError("invalid number " + number)
+	}
+	return json.Number(number), nil
+}
+
+func (d *decoder) readLiteral(literal string) error {
+	if strings.HasPrefix(d.data[d.pos:], literal) {
+		d.pos += len(literal)
+		return nil
+	}
+	if strings.HasPrefix(literal, d.data[d.pos:]) {
+		return io.ErrUnexpectedEOF
+	}
+	return d.syntaxError("invalid literal")
+}
+
+// validNumber 是否符合JSON数字格式：-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func validNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	if i >= len(s) {
+		return false
+	}
+	if s[i] == '0' {
+		i++
+	} else if s[i] >= '1' && s[i] <= '9' {
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	} else {
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == start {
+			return false
+		}
+	}
+	return i == len(s)
+}
+
+// MarshalValue 序列化UnmarshalValue解析的数据，结果和Marshal一致(对象key排序，不转义HTML)
+// 常用类型直接序列化，避免反射的开销
+func MarshalValue(value interface{}) (string, error) {
+	var b strings.Builder
+	b.Grow(64)
+	if err := writeValue(&b, value); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func writeValue(b *strings.Builder, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("null")
+	case string:
+		writeString(b, v)
+	case json.Number:
+		b.WriteString(v.String())
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int:
+		b.WriteString(strconv.Itoa(v))
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case map[string]interface{}:
+		return writeObject(b, v)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeValue(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	default:
+		// 配置中的其他类型，例如：float64
+		data, err := valueJson.MarshalToString(v)
+		if err != nil {
+			return err
+		}
+		b.WriteString(data)
+	}
+	return nil
+}
+
+// maxSortFields 字段数量不超过时在栈上排序字段，避免分配内存
+const maxSortFields = 16
+
+// field 对象字段
+type field struct {
+	key   string
+	value interface{}
+}
+
+// writeObject 按照key排序序列化对象
+func writeObject(b *strings.Builder, v map[string]interface{}) error {
+	if len(v) > maxSortFields {
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeString(b, k)
+			b.WriteByte(':')
+			if err := writeValue(b, v[k]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+		return nil
+	}
+	// 一次遍历取出字段和值，插入排序
+	var buf [maxSortFields]field
+	fields := buf[:0]
+	for k, item := range v {
+		fields = append(fields, field{key: k, value: item})
+	}
+	for i := 1; i < len(fields); i++ {
+		for j := i; j > 0 && fields[j].key < fields[j-1].key; j-- {
+			fields[j], fields[j-1] = fields[j-1], fields[j]
+		}
+	}
+	b.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeString(b, f.key)
+		b.WriteByte(':')
+		if err := writeValue(b, f.value); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
+
+const hex = "0123456789abcdef"
+
+// writeString 转义规则和encoding/json一致
+func writeString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\t':
+				b.WriteString(`\t`)
+			case '\b':
+				b.WriteString(`\b`)
+			case '\f':
+				b.WriteString(`\f`)
+			default:
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[c>>4])
+				b.WriteByte(hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b.WriteString(s[start:i])
+			b.WriteRune(utf8.RuneError)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b.WriteString(s[start:i])
+			b.WriteString(`\u202`)
+			b.WriteByte(hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b.WriteString(s[start:])
+	b.WriteByte('"')
+}
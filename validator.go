@@ -0,0 +1,233 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rulego
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xyzbit/rulego/api/types"
+)
+
+// ValidationError 规则链校验错误
+type ValidationError struct {
+	// 出错的节点ID，规则链级别的错误为空
+	NodeId string
+	// 出错字段在规则链定义中的JSON路径，例如：metadata.connections[0].toId
+	Path string
+	// 错误信息
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.NodeId == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s(node id:%s): %s", e.Path, e.NodeId, e.Message)
+}
+
+// ValidationErrors 规则链校验错误列表
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	var msgs []string
+	for _, item := range e {
+		msgs = append(msgs, item.Error())
+	}
+	return "rule chain validation error: " + strings.Join(msgs, "; ")
+}
+
+// Validate 使用默认组件注册器`rulego.Registry`静态校验规则链定义，返回所有问题，没有问题返回nil
+func Validate(def RuleChain) []ValidationError {
+	return ValidateWithRegistry(Registry, def)
+}
+
+// ValidateWithRegistry 使用指定组件注册器静态校验规则链定义，返回所有问题，没有问题返回nil
+// 校验内容：
+// 节点ID重复、节点类型没注册、firstNodeIndex越界、连接引用不存在的节点、
+// 连接关系不是源节点组件能产生的关系(通过ComponentForm.RelationTypes判断)、节点连接存在环
+func ValidateWithRegistry(registry types.ComponentRegistry, def RuleChain) []ValidationError {
+	var errs []ValidationError
+	nodes := def.Metadata.Nodes
+	nodeIndex := make(map[string]int)
+	if len(nodes) == 0 {
+		errs = append(errs, ValidationError{Path: "metadata.nodes", Message: "rule chain has no nodes"})
+	} else if def.Metadata.FirstNodeIndex < 0 || def.Metadata.FirstNodeIndex >= len(nodes) {
+		errs = append(errs, ValidationError{
+			Path:    "metadata.firstNodeIndex",
+			Message: fmt.Sprintf("index %d out of range [0,%d)", def.Metadata.FirstNodeIndex, len(nodes)),
+		})
+	}
+
+	var forms types.ComponentFormList
+	if registry != nil {
+		forms = registry.GetComponentForms()
+	}
+	for index, node := range nodes {
+		if node == nil {
+			errs = append(errs, ValidationError{Path: fmt.Sprintf("metadata.nodes[%d]", index), Message: "node is null"})
+			continue
+		}
+		id := node.Id
+		if id == "" {
+			id = fmt.Sprintf(defaultNodeIdPrefix+"%d", index)
+		}
+		if _, ok := nodeIndex[id]; ok {
+			errs = append(errs, ValidationError{
+				NodeId:  id,
+				Path:    fmt.Sprintf("metadata.nodes[%d].id", index),
+				Message: "duplicate node id",
+			})
+		} else {
+			nodeIndex[id] = index
+		}
+		if forms != nil {
+			if _, ok := forms.GetComponent(node.Type); !ok {
+				errs = append(errs, ValidationError{
+					NodeId:  id,
+					Path:    fmt.Sprintf("metadata.nodes[%d].type", index),
+					Message: fmt.Sprintf("component not found.componentType=%s", node.Type),
+				})
+			}
+		}
+	}
+
+	// 校验连接源节点和关系
+	checkFrom := func(path, fromId, relationType string) {
+		index, ok := nodeIndex[fromId]
+		if !ok {
+			errs = append(errs, ValidationError{
+				NodeId:  fromId,
+				Path:    path + ".fromId",
+				Message: fmt.Sprintf("node id:%s not found", fromId),
+			})
+			return
+		}
+		if relationType == "" {
+			errs = append(errs, ValidationError{NodeId: fromId, Path: path + ".type", Message: "relation type is empty"})
+			return
+		}
+		if forms == nil {
+			return
+		}
+		node := nodes[index]
+		if form, ok := forms.GetComponent(node.Type); ok && !canEmitRelation(form, node, relationType) {
+			errs = append(errs, ValidationError{
+				NodeId:  fromId,
+				Path:    path + ".type",
+				Message: fmt.Sprintf("component type:%s can not emit relation type:%s, supported:%v", node.Type, relationType, *form.RelationTypes),
+			})
+		}
+	}
+
+	graph := make(map[string][]string)
+	for index, item := range def.Metadata.Connections {
+		path := fmt.Sprintf("metadata.connections[%d]", index)
+		checkFrom(path, item.FromId, item.Type)
+		if _, ok := nodeIndex[item.ToId]; !ok {
+			errs = append(errs, ValidationError{
+				NodeId:  item.ToId,
+				Path:    path + ".toId",
+				Message: fmt.Sprintf("node id:%s not found", item.ToId),
+			})
+		} else {
+			graph[item.FromId] = append(graph[item.FromId], item.ToId)
+		}
+	}
+	for index, item := range def.Metadata.RuleChainConnections {
+		path := fmt.Sprintf("metadata.ruleChainConnections[%d]", index)
+		checkFrom(path, item.FromId, item.Type)
+		if item.ToId == "" {
+			errs = append(errs, ValidationError{Path: path + ".toId", Message: "rule chain id is empty"})
+		}
+	}
+
+	// 按节点定义顺序检测环，保证结果稳定
+	for _, cycle := range findCycles(nodes, graph) {
+		errs = append(errs, ValidationError{
+			NodeId:  cycle[0],
+			Path:    "metadata.connections",
+			Message: "cycle detected: " + strings.Join(cycle, " -> "),
+		})
+	}
+	return errs
+}
+
+// canEmitRelation 组件是否能产生指定关系
+// RelationTypes为空表示用户可以自定义连接关系
+// 配置了超时时间的节点，还可以产生`Timeout`关系
+func canEmitRelation(form types.ComponentForm, node *RuleNode, relationType string) bool {
+	if form.RelationTypes == nil || len(*form.RelationTypes) == 0 {
+		return true
+	}
+	if relationType == types.Timeout && node.TimeoutMs > 0 {
+		return true
+	}
+	for _, item := range *form.RelationTypes {
+		if item == relationType {
+			return true
+		}
+	}
+	return false
+}
+
+// findCycles 深度优先查找节点连接中的环，每个环只返回一次
+func findCycles(nodes []*RuleNode, graph map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var cycles [][]string
+	state := make(map[string]int)
+	var stack []string
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, next := range graph[id] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				// 找到回边，截取环路径
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						cycle := append([]string{}, stack[i:]...)
+						cycles = append(cycles, append(cycle, next))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = visited
+	}
+	for index, node := range nodes {
+		if node == nil {
+			continue
+		}
+		id := node.Id
+		if id == "" {
+			id = fmt.Sprintf(defaultNodeIdPrefix+"%d", index)
+		}
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return cycles
+}
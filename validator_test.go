@@ -0,0 +1,122 @@
+/*
+ * Copyright 2023 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rulego
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/xyzbit/rulego/test/assert"
+)
+
+var invalidRuleChain = `
+	{
+	  "ruleChain": {
+		"name": "错误规则链"
+	  },
+	  "metadata": {
+		"firstNodeIndex": 3,
+		"nodes": [
+		  {
+			"id":"s1",
+			"type": "jsFilter",
+			"configuration": {
+			  "jsScript": "return true;"
+			}
+		  },
+		  {
+			"id":"s1",
+			"type": "jsTransform",
+			"configuration": {
+			  "jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+			}
+		  },
+		  {
+			"id":"s3",
+			"type": "notFound"
+		  }
+		],
+		"connections": [
+		  {
+			"fromId": "s1",
+			"toId": "s4",
+			"type": "True"
+		  },
+		  {
+			"fromId": "s1",
+			"toId": "s3",
+			"type": "Success"
+		  }
+		]
+	  }
+	}
+`
+
+func TestValidate(t *testing.T) {
+	def, err := ParserRuleChain([]byte(rootRuleChain))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(Validate(def)))
+
+	def, err = ParserRuleChain([]byte(invalidRuleChain))
+	assert.Nil(t, err)
+	errs := Validate(def)
+	paths := make(map[string]string)
+	for _, item := range errs {
+		paths[item.Path] = item.NodeId
+	}
+	assert.Equal(t, 5, len(errs))
+	assert.Equal(t, "", paths["metadata.firstNodeIndex"])
+	assert.Equal(t, "s1", paths["metadata.nodes[1].id"])
+	assert.Equal(t, "s3", paths["metadata.nodes[2].type"])
+	assert.Equal(t, "s4", paths["metadata.connections[0].toId"])
+	//jsFilter 只能产生True/False/Failure关系
+	assert.Equal(t, "s1", paths["metadata.connections[1].type"])
+
+	//加载时返回所有问题
+	_, err = New("invalidRuleChain", []byte(invalidRuleChain))
+	var validationErrs ValidationErrors
+	assert.True(t, errors.As(err, &validationErrs))
+	assert.Equal(t, 5, len(validationErrs))
+	_, ok := Get("invalidRuleChain")
+	assert.False(t, ok)
+}
+
+func TestValidateCycle(t *testing.T) {
+	def := RuleChain{}
+	def.Metadata.Nodes = []*RuleNode{
+		{Id: "s1", Type: "jsTransform"},
+		{Id: "s2", Type: "jsTransform"},
+		{Id: "s3", Type: "jsTransform"},
+	}
+	def.Metadata.Connections = []NodeConnection{
+		{FromId: "s1", ToId: "s2", Type: "Success"},
+		{FromId: "s2", ToId: "s3", Type: "Success"},
+		{FromId: "s3", ToId: "s1", Type: "Success"},
+	}
+	errs := Validate(def)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "s1", errs[0].NodeId)
+	assert.Equal(t, "cycle detected: s1 -> s2 -> s3 -> s1", errs[0].Message)
+
+	//配置超时时间的节点，可以使用Timeout关系
+	def.Metadata.Connections = []NodeConnection{
+		{FromId: "s1", ToId: "s2", Type: "Timeout"},
+	}
+	assert.Equal(t, 1, len(Validate(def)))
+	def.Metadata.Nodes[0].TimeoutMs = 1000
+	assert.Equal(t, 0, len(Validate(def)))
+}